@@ -8,11 +8,16 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -21,15 +26,24 @@ import (
 )
 
 type cache struct {
+	*aos
+
 	ioStreams *IOStreams
 
 	listSource   bool
 	listTarballs bool
+
+	olderThan time.Duration
+	maxSize   byteSize
+
+	exportRelease  string
+	exportProjects []string
 }
 
 // newCmdCache creates the cache command.
 func (a *aos) newCmdCache(ctx context.Context, ioStreams *IOStreams) *cobra.Command {
 	cache := &cache{
+		aos:       a,
 		ioStreams: ioStreams,
 	}
 
@@ -39,7 +53,11 @@ func (a *aos) newCmdCache(ctx context.Context, ioStreams *IOStreams) *cobra.Comm
 	}
 
 	cmd.AddCommand(cache.cmdList(ctx))
+	cmd.AddCommand(cache.cmdStats(ctx))
+	cmd.AddCommand(cache.cmdPrune(ctx))
 	cmd.AddCommand(cache.cmdDelete(ctx))
+	cmd.AddCommand(cache.cmdExport(ctx))
+	cmd.AddCommand(cache.cmdImport(ctx))
 
 	return cmd
 }
@@ -54,54 +72,151 @@ func (c *cache) cmdList(ctx context.Context) *cobra.Command {
 	}
 	f := cmd.Flags()
 	f.BoolVarP(&c.listSource, "source", "s", false, "List the source resources type cache")
-	f.BoolVarP(&c.listTarballs, "tarballs", "t", false, "List the tarballs resources type cache")
+	f.BoolVarP(&c.listTarballs, "tarballs", "t", false, "List the tarballs resources type cache (default)")
 
 	return cmd
 }
 
 func (c *cache) runList(ctx context.Context) error {
-	dir := cacheDir()
+	dir := c.cacheDir()
 	if _, err := os.Stat(dir); err != nil && os.IsNotExist(err) {
 		return fmt.Errorf("Not exists cache")
 	}
 
 	var typ appleopensource.ResourceType
 	switch {
-	case c.listTarballs:
-		typ = appleopensource.TarballsResource
-	case c.listSource:
-		typ = appleopensource.SourceResource
 	case c.listTarballs && c.listSource:
 		return errors.New("-source and -tarballs flags are must be one")
+	case c.listSource:
+		typ = appleopensource.SourceResource
+	default:
+		typ = appleopensource.TarballsResource
 	}
 
-	files, err := ioutil.ReadDir(filepath.Join(dir, typ.String()))
+	// the cached version index page of the project is "/<typ>/<project>"
+	records := productRecords{}
+	err := appleopensource.NewFileCache(c.pagesCacheDir()).Walk(func(e *appleopensource.CacheEntry) error {
+		u, err := url.Parse(e.URL)
+		if err != nil {
+			return err
+		}
+		elems := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(elems) == 2 && elems[0] == typ.String() {
+			records = append(records, appleopensource.Product{Name: elems[1]})
+		}
+		return nil
+	})
 	if err != nil {
 		return errors.Wrapf(err, "Not exists the %s type cache", typ.String())
 	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Name < records[j].Name })
+
+	return c.printer.print(c.ioStreams.Out, records, func(w io.Writer) error {
+		var buf bytes.Buffer
+		for _, p := range records {
+			buf.WriteString(p.Name + "\n")
+		}
+		_, err := w.Write(buf.Bytes())
+		return err
+	})
+}
+
+func (c *cache) cmdStats(ctx context.Context) *cobra.Command {
+	return &cobra.Command{
+		Use:   "stats",
+		Short: "Show the number of entries, bytes and age of each cache category",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkArgs(cmd.Name(), cmd.Flags(), 0, exactArgs, args...); err != nil {
+				return err
+			}
+			return c.runStats(ctx)
+		},
+	}
+}
+
+func (c *cache) runStats(ctx context.Context) error {
+	items, err := c.client.CacheItems()
+	if err != nil {
+		return err
+	}
+
+	records := cacheStatRecords{
+		{Category: appleopensource.CategoryPages},
+		{Category: appleopensource.CategoryTarballs},
+	}
+	for _, item := range items {
+		for i := range records {
+			if records[i].Category == item.Category {
+				records[i].add(item)
+			}
+		}
+	}
+
+	return c.printer.print(c.ioStreams.Out, records, func(w io.Writer) error {
+		var buf bytes.Buffer
+		tbuf := tabwriter.NewWriter(&buf, 2, 1, 2, ' ', 0)
+		fmt.Fprintln(tbuf, "CATEGORY\tENTRIES\tSIZE\tOLDEST\tNEWEST")
+		now := time.Now()
+		for _, r := range records {
+			fmt.Fprintf(tbuf, "%s\t%d\t%s\t%s\t%s\n", r.Category, r.Entries, formatByteSize(r.Bytes), formatAge(now, r.Oldest), formatAge(now, r.Newest))
+		}
+		tbuf.Flush()
+
+		_, err := w.Write(buf.Bytes())
+		return err
+	})
+}
+
+func (c *cache) cmdPrune(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Evict the least recently used cache entries",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkArgs(cmd.Name(), cmd.Flags(), 0, exactArgs, args...); err != nil {
+				return err
+			}
+			return c.runPrune(ctx)
+		},
+	}
+	f := cmd.Flags()
+	f.DurationVar(&c.olderThan, "older-than", 0, "Evict the entries which are not used for longer than the duration")
+	f.Var(&c.maxSize, "max-size", "Evict the least recently used entries until the total size is under the size such as 1GB")
+
+	return cmd
+}
 
-	var buf bytes.Buffer
-	for _, f := range files {
-		buf.WriteString(strings.TrimSuffix(f.Name(), ".html") + "\n")
+func (c *cache) runPrune(ctx context.Context) error {
+	if c.olderThan <= 0 && c.maxSize <= 0 {
+		return errors.New("--older-than or --max-size flag is required")
 	}
 
-	fmt.Printf(buf.String())
+	opts := &appleopensource.PruneOptions{
+		OlderThan: c.olderThan,
+		MaxSize:   int64(c.maxSize),
+	}
+	evicted, err := c.client.Prune(opts)
+	if err != nil {
+		return err
+	}
 
-	return nil
+	return c.printEvicted("Pruned", evicted)
 }
 
 func (c *cache) cmdDelete(ctx context.Context) *cobra.Command {
 	return &cobra.Command{
-		Use:   "delete",
-		Short: "Delete cache",
-		RunE: func(*cobra.Command, []string) error {
+		Use:   "delete [category|product...]",
+		Short: "Delete all cache, or the cache of the categories (pages|tarballs) or the products",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				return c.runDeleteItems(ctx, args)
+			}
 			return c.runDelete(ctx)
 		},
 	}
 }
 
 func (c *cache) runDelete(ctx context.Context) error {
-	dir := cacheDir()
+	dir := c.cacheDir()
 	if _, err := os.Stat(dir); err == nil {
 		log.Printf("Delete %s cache", dir)
 		return os.RemoveAll(dir)
@@ -110,19 +225,268 @@ func (c *cache) runDelete(ctx context.Context) error {
 	return fmt.Errorf("Not exists cache")
 }
 
-// cacheDir create appleopensource cache directory into cacheHome, and return the cache directory path.
-func cacheDir() string {
-	rootCacheDir := os.Getenv("APPLEOPENSOURCE_CACHE_DIR")
-	if rootCacheDir == "" {
-		cacheDir, _ := os.UserCacheDir()
-		rootCacheDir = filepath.Join(cacheDir, "appleopensource")
+// runDeleteItems deletes the cache entries of the categories or the products.
+func (c *cache) runDeleteItems(ctx context.Context, names []string) error {
+	items, err := c.client.CacheItems()
+	if err != nil {
+		return err
+	}
+
+	var deleted []*appleopensource.CacheItem
+	for _, name := range names {
+		var matched int
+		for _, item := range items {
+			if !matchCacheItem(item, name) {
+				continue
+			}
+			if err := c.client.Evict(item); err != nil {
+				return err
+			}
+			deleted = append(deleted, item)
+			matched++
+		}
+		if matched == 0 {
+			return fmt.Errorf("no cache of %s", name)
+		}
+	}
+
+	return c.printEvicted("Deleted", deleted)
+}
+
+// matchCacheItem reports whether the item belongs to the category or the product name.
+func matchCacheItem(item *appleopensource.CacheItem, name string) bool {
+	if item.Category == name {
+		return true
+	}
+	for _, p := range item.Products {
+		if p.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// printEvicted prints the evicted items, and the summary by the verb in the text format.
+func (c *cache) printEvicted(verb string, items []*appleopensource.CacheItem) error {
+	records := cacheItemRecords(items)
+	if records == nil {
+		records = cacheItemRecords{}
+	}
+
+	return c.printer.print(c.ioStreams.Out, records, func(w io.Writer) error {
+		var size int64
+		for _, item := range items {
+			size += item.Size
+		}
+		_, err := fmt.Fprintf(w, "%s %d entries, %s\n", verb, len(items), formatByteSize(size))
+		return err
+	})
+}
+
+func (c *cache) cmdExport(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export bundle.tar.zst [--release platform version] [--projects project,...]",
+		Short: "Export the cached pages and tarballs to the bundle for the offline machines",
+		Long: `Export the cached pages and tarballs to the zstd compressed tar bundle with the manifest and checksums.
+
+With --release, the bundle contains the release page, and the version lists and the tarballs of the
+projects in the release, which are fetched if not cached. With only --projects, the bundle contains the
+version lists and all cached tarballs of the projects. Otherwise the bundle contains all cache.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			n := 1
+			if c.exportRelease != "" {
+				n = 2 // bundle.tar.zst and the release version
+			}
+			if err := checkArgs(cmd.Name(), cmd.Flags(), n, exactArgs, args...); err != nil {
+				return err
+			}
+			return c.runExport(ctx, args)
+		},
+	}
+	f := cmd.Flags()
+	f.StringVar(&c.exportRelease, "release", "", "Export the projects of the platform (macos|xcode|ios|server) release version")
+	f.StringSliceVar(&c.exportProjects, "projects", nil, "Export only the projects")
+
+	return cmd
+}
+
+func (c *cache) runExport(ctx context.Context, args []string) (err error) {
+	opts := &appleopensource.BundleOptions{
+		Projects: c.exportProjects,
+	}
+	if c.exportRelease != "" {
+		platform, err := appleopensource.ParsePlatform(c.exportRelease)
+		if err != nil {
+			return err
+		}
+		opts.Platform = platform
+		opts.Release = args[1]
+	}
+
+	fname := args[0]
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(fname) // do not leave the incomplete bundle
+		}
+	}()
+
+	manifest, err := c.client.ExportBundle(ctx, f, opts)
+	if err != nil {
+		return err
+	}
+
+	return c.printManifest("Exported", "to", fname, manifest)
+}
+
+func (c *cache) cmdImport(ctx context.Context) *cobra.Command {
+	return &cobra.Command{
+		Use:   "import bundle.tar.zst",
+		Short: "Verify and merge the bundle into the cache",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkArgs(cmd.Name(), cmd.Flags(), 1, exactArgs, args...); err != nil {
+				return err
+			}
+			return c.runImport(ctx, args[0])
+		},
+	}
+}
+
+func (c *cache) runImport(ctx context.Context, fname string) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	manifest, err := c.client.ImportBundle(f)
+	if err != nil {
+		return errors.Wrapf(err, "could not import %s", fname)
+	}
+
+	return c.printManifest("Imported", "from", fname, manifest)
+}
+
+// printManifest prints the bundle manifest, and the summary by the verb in the text format.
+func (c *cache) printManifest(verb, prep, fname string, manifest *appleopensource.BundleManifest) error {
+	return c.printer.print(c.ioStreams.Out, manifest, func(w io.Writer) error {
+		var size int64
+		for _, p := range manifest.Pages {
+			size += p.Size
+		}
+		for _, t := range manifest.Tarballs {
+			size += t.Size
+		}
+		_, err := fmt.Fprintf(w, "%s %d pages and %d tarballs (%s) %s %s\n", verb, len(manifest.Pages), len(manifest.Tarballs), formatByteSize(size), prep, fname)
+		return err
+	})
+}
+
+// cacheStatRecord represents the record of the cache category, which is the output of cache stats command.
+type cacheStatRecord struct {
+	Category string    `json:"category" yaml:"category"`
+	Entries  int       `json:"entries" yaml:"entries"`
+	Bytes    int64     `json:"bytes" yaml:"bytes"`
+	Oldest   time.Time `json:"oldest" yaml:"oldest"`
+	Newest   time.Time `json:"newest" yaml:"newest"`
+}
+
+func (r *cacheStatRecord) add(item *appleopensource.CacheItem) {
+	r.Entries++
+	r.Bytes += item.Size
+	if r.Oldest.IsZero() || item.LastUsed.Before(r.Oldest) {
+		r.Oldest = item.LastUsed
 	}
+	if item.LastUsed.After(r.Newest) {
+		r.Newest = item.LastUsed
+	}
+}
+
+// cacheStatRecords represents the records of the cache categories.
+type cacheStatRecords []cacheStatRecord
+
+func (r cacheStatRecords) csvHeader() []string {
+	return []string{"category", "entries", "bytes", "oldest", "newest"}
+}
+
+func (r cacheStatRecords) csvRows() [][]string {
+	rows := make([][]string, len(r))
+	for i, s := range r {
+		rows[i] = []string{s.Category, strconv.Itoa(s.Entries), strconv.FormatInt(s.Bytes, 10), formatTime(s.Oldest), formatTime(s.Newest)}
+	}
+
+	return rows
+}
+
+// cacheItemRecords represents the records of the cache entries, which is the output of cache prune and delete commands.
+type cacheItemRecords []*appleopensource.CacheItem
+
+func (r cacheItemRecords) csvHeader() []string {
+	return []string{"category", "key", "products", "size", "last_used"}
+}
 
-	if fi, err := os.Stat(rootCacheDir); err == nil && fi.IsDir() {
-		if err := os.MkdirAll(rootCacheDir, 0700); err != nil {
-			return ""
+func (r cacheItemRecords) csvRows() [][]string {
+	rows := make([][]string, len(r))
+	for i, item := range r {
+		products := make([]string, len(item.Products))
+		for j, p := range item.Products {
+			products[j] = p.Name
+			if p.Version != "" {
+				products[j] += "-" + p.Version
+			}
 		}
+		rows[i] = []string{item.Category, item.Key, strings.Join(products, " "), strconv.FormatInt(item.Size, 10), formatTime(item.LastUsed)}
 	}
 
-	return rootCacheDir
+	return rows
+}
+
+// formatTime formats t in RFC 3339, or the empty string if t is zero.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+// formatAge formats the elapsed time from t to now such as "3d ago", or "-" if t is zero.
+func formatAge(now, t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d/time.Hour))
+	default:
+		return fmt.Sprintf("%dd ago", int(d/(24*time.Hour)))
+	}
+}
+
+// pagesCacheDir returns the directory path of the cached pages.
+func (a *aos) pagesCacheDir() string {
+	return filepath.Join(a.cacheDir(), "pages")
+}
+
+// blobsCacheDir returns the directory path of the stored tarballs.
+func (a *aos) blobsCacheDir() string {
+	return filepath.Join(a.cacheDir(), "blobs")
+}
+
+// cacheDir returns the cache directory path.
+func (a *aos) cacheDir() string {
+	return a.config.Cache.Dir
 }
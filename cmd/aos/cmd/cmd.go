@@ -6,13 +6,18 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource"
 )
 
 var (
@@ -31,22 +36,50 @@ var (
 
 // aos represents a root command options.
 type aos struct {
-	noCache    bool
-	debug      bool
-	configPath string
+	noCache      bool
+	cacheTTL     time.Duration
+	cacheMaxSize byteSize
+	cacheDirPath string
+	baseURL      string
+	offline      bool
+	debug        bool
+	traceHTTP    string
+	rateLimit    float64
+	bwLimit      byteSize
+	userAgent    string
+	configPath   string
+	output       string
+
+	ioStreams  *IOStreams
+	config     *config
+	configFile string
+	printer    *printer
+	client     *appleopensource.Client
+	har        *appleopensource.HARRecorder
+	finalized  bool
 
-	ioStreams *IOStreams
+	// transport overrides the HTTP transport of the client if not nil, such as the fixture command does.
+	transport http.RoundTripper
 }
 
 // NewCommand creates the aos root command.
 func NewCommand(ctx context.Context, args []string) *cobra.Command {
-	a := &aos{}
+	return newCommand(ctx, args, &IOStreams{In: os.Stdin, Out: os.Stdout, ErrOut: os.Stderr})
+}
+
+// newCommand creates the aos root command which uses ioStreams.
+func newCommand(ctx context.Context, args []string, ioStreams *IOStreams) *cobra.Command {
+	return (&aos{}).rootCommand(ctx, args, ioStreams)
+}
+
+// rootCommand creates the aos root command of a.
+func (a *aos) rootCommand(ctx context.Context, args []string, ioStreams *IOStreams) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:                AppName,
 		Short:              "An opensource.apple.com resource management tool.",
 		SilenceUsage:       false,
-		PersistentPreRunE:  func(*cobra.Command, []string) error { return initProfiling() },
-		PersistentPostRunE: func(*cobra.Command, []string) error { return flushProfiling() },
+		PersistentPreRunE:  func(cmd *cobra.Command, _ []string) error { return a.init(cmd.Flags()) },
+		PersistentPostRunE: func(*cobra.Command, []string) error { return a.finalize() },
 		Version:            version,
 	}
 	cmd.Flags().BoolP("version", "v", false, "Show "+AppName+" version.") // version flag is root only
@@ -55,21 +88,178 @@ func NewCommand(ctx context.Context, args []string) *cobra.Command {
 	addGlobalFlags(f, a)
 	f.Parse(args)
 
-	a.ioStreams = &IOStreams{In: os.Stdin, Out: os.Stdout, ErrOut: os.Stderr}
+	a.ioStreams = ioStreams
 	cmd.SetIn(a.ioStreams.In)
 	cmd.SetOut(a.ioStreams.Out)
 	cmd.SetErr(a.ioStreams.ErrOut)
 
 	cmd.AddCommand(a.newCmdCache(ctx, a.ioStreams))
+	cmd.AddCommand(a.newCmdConfig(ctx, a.ioStreams))
+	cmd.AddCommand(a.newCmdDiff(ctx, a.ioStreams))
 	cmd.AddCommand(a.newCmdFetch(ctx, a.ioStreams))
+	cmd.AddCommand(a.newCmdFixture(ctx, a.ioStreams))
+	cmd.AddCommand(a.newCmdHistory(ctx, a.ioStreams))
+	cmd.AddCommand(a.newCmdInfo(ctx, a.ioStreams))
 	cmd.AddCommand(a.newCmdList(ctx, a.ioStreams))
+	cmd.AddCommand(a.newCmdMirror(ctx, a.ioStreams))
+	cmd.AddCommand(a.newCmdPatch(ctx, a.ioStreams))
 	cmd.AddCommand(a.newCmdRelease(ctx, a.ioStreams))
+	cmd.AddCommand(a.newCmdSearch(ctx, a.ioStreams))
+	cmd.AddCommand(a.newCmdServe(ctx, a.ioStreams))
+	cmd.AddCommand(a.newCmdSync(ctx, a.ioStreams))
 	cmd.AddCommand(a.newCmdVersions(ctx, a.ioStreams))
+	cmd.AddCommand(a.newCmdWatch(ctx, a.ioStreams))
+	cmd.AddCommand(a.newCmdWhich(ctx, a.ioStreams))
 	cmd.AddCommand(a.newCompletion(ctx, a.ioStreams))
 
+	// cobra skips PersistentPostRunE when RunE fails, but the profile and the HTTP trace are
+	// still wanted to investigate the failure
+	a.finalizeOnError(cmd)
+
 	return cmd
 }
 
+// finalizeOnError wraps RunE of cmd and its sub commands to call a.finalize when RunE fails.
+func (a *aos) finalizeOnError(cmd *cobra.Command) {
+	if run := cmd.RunE; run != nil {
+		cmd.RunE = func(cmd *cobra.Command, args []string) error {
+			if err := run(cmd, args); err != nil {
+				if ferr := a.finalize(); ferr != nil {
+					fmt.Fprintf(a.ioStreams.ErrOut, "%s: %v\n", AppName, ferr)
+				}
+				return err
+			}
+			return nil
+		}
+	}
+
+	for _, c := range cmd.Commands() {
+		a.finalizeOnError(c)
+	}
+}
+
+// finalize flushes the profile and writes the HTTP trace. It is called once at the end of the command.
+func (a *aos) finalize() error {
+	if a.finalized {
+		return nil
+	}
+	a.finalized = true
+
+	if err := flushProfiling(); err != nil {
+		return err
+	}
+
+	if a.har == nil {
+		return nil
+	}
+	f, err := os.Create(a.traceHTTP)
+	if err != nil {
+		return fmt.Errorf("could not create the HTTP trace file: %w", err)
+	}
+	if err := a.har.WriteHAR(f); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write the HTTP trace file: %w", err)
+	}
+
+	return f.Close()
+}
+
+// init initializes the global states from the configuration and the global flags.
+func (a *aos) init(flags *pflag.FlagSet) error {
+	if err := initProfiling(); err != nil {
+		return err
+	}
+
+	cfg, fname, err := loadConfig(a.configPath)
+	if err != nil {
+		return err
+	}
+	if err := a.applyFlags(cfg, flags); err != nil {
+		return err
+	}
+	a.config, a.configFile = cfg, fname
+
+	p, err := newPrinter(cfg.Output)
+	if err != nil {
+		return err
+	}
+	a.printer = p
+
+	a.client = &appleopensource.Client{
+		Cache:        appleopensource.NewFileCache(a.pagesCacheDir()),
+		CacheTTL:     time.Duration(cfg.Cache.TTL),
+		Blobs:        appleopensource.NewBlobStore(a.blobsCacheDir()),
+		MaxCacheSize: int64(cfg.Cache.MaxSize),
+		Offline:      cfg.Offline,
+		BaseURL:      cfg.BaseURL,
+		Providers:    cfg.Providers,
+		Retry: appleopensource.RetryPolicy{
+			Max:     cfg.Retry.Max,
+			Backoff: time.Duration(cfg.Retry.Backoff),
+		},
+		Concurrency: cfg.Concurrency,
+		Limits:      cfg.Limits.clientLimits(),
+		UserAgent:   cfg.UserAgent,
+	}
+	if a.noCache {
+		a.client.CacheTTL = -1 // always revalidates the cached pages
+	}
+	if a.debug {
+		a.client.Logger = appleopensource.NewTextLogger(a.ioStreams.ErrOut, appleopensource.LevelDebug)
+	}
+
+	transport := a.transport
+	if a.traceHTTP != "" {
+		a.har = &appleopensource.HARRecorder{Transport: transport}
+		transport = a.har
+	}
+	if transport != nil {
+		a.client.HTTPClient = &http.Client{Transport: transport}
+	}
+
+	return nil
+}
+
+// applyFlags overrides cfg by the global flags which are set explicitly.
+func (a *aos) applyFlags(cfg *config, flags *pflag.FlagSet) error {
+	if flags.Changed("base-url") {
+		cfg.BaseURL = a.baseURL
+	}
+	if flags.Changed("cache-dir") {
+		cfg.Cache.Dir = a.cacheDirPath
+	}
+	if flags.Changed("cache-ttl") {
+		cfg.Cache.TTL = duration(a.cacheTTL)
+	}
+	if flags.Changed("cache-max-size") {
+		cfg.Cache.MaxSize = a.cacheMaxSize
+	}
+	if flags.Changed("output") {
+		cfg.Output = a.output
+	}
+	if flags.Changed("offline") {
+		cfg.Offline = a.offline
+	}
+	if flags.Changed("rate-limit") {
+		cfg.Limits.RequestsPerSecond = a.rateLimit
+	}
+	if flags.Changed("bandwidth-limit") {
+		cfg.Limits.BytesPerSecond = a.bwLimit
+	}
+	if flags.Changed("user-agent") {
+		cfg.UserAgent = a.userAgent
+	}
+
+	if a.noCache {
+		if flags.Changed("offline") && a.offline {
+			return errors.New("--no-cache and --offline flags are exclusive")
+		}
+		cfg.Offline = false // --no-cache overrides the configured offline mode
+	}
+
+	return nil
+}
+
 const (
 	exactArgs = iota
 	minArgs
@@ -0,0 +1,572 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource"
+	"go-darwin.dev/appleopensource/pkg/appleopensource/aostest"
+)
+
+var testSite = &aostest.Site{
+	Projects: []aostest.Project{
+		{
+			Name: "xnu",
+			Versions: []aostest.Version{
+				{Version: "3789.1.32", Files: map[string]string{"README.md": "old xnu\n"}},
+				{Version: "4903.221.2", Files: map[string]string{"README.md": "xnu\n", "bsd/conf/files": "OPTIONS/kdebug\n"}},
+			},
+		},
+		{
+			Name:     "Csu",
+			Versions: []aostest.Version{{Version: "85", Tarball: bytes.Repeat([]byte("Csu tarball\n"), 10)}},
+		},
+	},
+	Releases: []aostest.Release{
+		{
+			Name: "macos-1014",
+			Projects: []aostest.ReleaseProject{
+				{Name: "Csu", Version: "85"},
+				{Name: "xnu", Version: "4903.221.2", Updated: true},
+				{Name: "dyld", Version: "635.2", ComingSoon: true},
+			},
+		},
+		{
+			Name: "macos-10141",
+			Projects: []aostest.ReleaseProject{
+				{Name: "Csu", Version: "85"},
+				{Name: "xnu", Version: "4903.231.4", Updated: true},
+			},
+		},
+	},
+}
+
+// testAos runs the aos command against the srv with the isolated config and cache directories.
+type testAos struct {
+	t        *testing.T
+	srv      *aostest.Server
+	cacheDir string
+}
+
+func newTestAos(t *testing.T) *testAos {
+	t.Helper()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv(envPrefix+"CONFIG", "")
+
+	srv := aostest.NewServer(testSite)
+	t.Cleanup(srv.Close)
+
+	return &testAos{t: t, srv: srv, cacheDir: t.TempDir()}
+}
+
+// run runs the aos command with args, and returns the stdout and the stderr.
+func (ta *testAos) run(args ...string) (string, string, error) {
+	ta.t.Helper()
+
+	args = append([]string{"--base-url", ta.srv.BaseURL(), "--cache-dir", ta.cacheDir}, args...)
+	ioStreams, _, out, errOut := NewTestIOStreams()
+	cmd := newCommand(context.Background(), args, &ioStreams)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+
+	return out.String(), errOut.String(), err
+}
+
+func TestCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "list",
+			args: []string{"list"},
+			want: "Csu\nxnu\n",
+		},
+		{
+			name: "list source",
+			args: []string{"list", "--source"},
+			want: "Csu\nxnu\n",
+		},
+		{
+			name: "list json",
+			args: []string{"-o", "json", "list"},
+			want: "[\n  {\n    \"name\": \"Csu\"\n  },\n  {\n    \"name\": \"xnu\"\n  }\n]\n",
+		},
+		{
+			name: "versions",
+			args: []string{"versions", "xnu"},
+			want: "3789.1.32\n4903.221.2\n",
+		},
+		{
+			name: "release",
+			args: []string{"release", "macos", "10.14"},
+			want: "Release version: 10.14\n" +
+				"  Csu   85          \n" +
+				"• xnu   4903.221.2  \n" +
+				"  dyld  635.2       (coming soon!)\n",
+		},
+		{
+			name: "search",
+			args: []string{"search", "XUN"},
+			want: "xnu\n",
+		},
+		{
+			name: "search latest",
+			args: []string{"search", "--latest", "cs"},
+			want: "Csu  85\n",
+		},
+		{
+			name: "search csv",
+			args: []string{"-o", "csv", "search", "xn"},
+			want: "name,match,distance,latest\nxnu,prefix,1,\n",
+		},
+		{
+			name: "which",
+			args: []string{"which", "--platform", "server", "--release", "macos/10.14", "xnu", "4903.221.2"},
+			want: "macos  10.14\n",
+		},
+		{
+			name: "which default platforms",
+			args: []string{"which", "xnu", "4903.221.2"},
+			want: "macos  10.14\n",
+		},
+		{
+			name: "history",
+			args: []string{"history", "--platform", "server", "--release", "macos/10.14,macos/10.14.1", "xnu", "dyld"},
+			want: "xnu:\n" +
+				"  macos  10.14    4903.221.2  added\n" +
+				"  macos  10.14.1  4903.231.4  modified\n" +
+				"\n" +
+				"dyld:\n" +
+				"  macos  10.14    635.2 (coming soon!)  added\n" +
+				"  macos  10.14.1  -                     removed\n",
+		},
+		{
+			name: "history default platforms",
+			args: []string{"history", "xnu"},
+			want: "xnu:\n" +
+				"  macos  10.14    4903.221.2  added\n" +
+				"  macos  10.14.1  4903.231.4  modified\n",
+		},
+		{
+			name: "history matrix",
+			args: []string{"history", "--platform", "server", "--release", "macos/10.14,macos/10.14.1", "--matrix", "Csu", "dyld"},
+			want: "PLATFORM  RELEASE  Csu  dyld\n" +
+				"macos     10.14    85   635.2\n" +
+				"macos     10.14.1  85   -\n",
+		},
+		{
+			name: "info",
+			args: []string{"-o", "template={{.latest}} {{.source_versions}} {{range .releases}}{{.platform}} {{.release}}{{end}}", "info", "--platform", "server", "--release", "macos/10.14", "--no-sizes", "xnu"},
+			want: "4903.221.2 [3789.1.32 4903.221.2] macos 10.14",
+		},
+		{
+			name: "info default platforms",
+			args: []string{"-o", "template={{range .releases}}{{.platform}} {{.release}} {{.version}}\n{{end}}", "info", "--no-sizes", "xnu"},
+			want: "macos 10.14.1 4903.231.4\nmacos 10.14 4903.221.2\n",
+		},
+		{
+			name: "which nearest",
+			args: []string{"which", "--platform", "server", "--release", "macos/10.14", "dyld", "551.3"},
+			want: "No release ships dyld 551.3. The nearest versions:\n" +
+				"macos  10.14  635.2 (coming soon!)\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ta := newTestAos(t)
+
+			got, stderr, err := ta.run(tt.args...)
+			if err != nil {
+				t.Fatalf("aos %s error = %v\n%s", strings.Join(tt.args, " "), err, stderr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("aos %s output mismatch (-want +got):\n%s", strings.Join(tt.args, " "), diff)
+			}
+		})
+	}
+}
+
+func TestCommand_Fetch(t *testing.T) {
+	ta := newTestAos(t)
+	dist := t.TempDir()
+
+	if _, stderr, err := ta.run("fetch", "Csu", "85", dist); err != nil {
+		t.Fatalf("aos fetch error = %v\n%s", err, stderr)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(dist, "Csu-85.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := testSite.Projects[1].Versions[0].Tarball; !bytes.Equal(got, want) {
+		t.Errorf("fetched tarball = %q, want %q", got, want)
+	}
+
+	if _, stderr, err := ta.run("fetch", "--source", "xnu", "4903.221.2", dist); err != nil {
+		t.Fatalf("aos fetch --source error = %v\n%s", err, stderr)
+	}
+	got, err = ioutil.ReadFile(filepath.Join(dist, "xnu-4903.221.2", "bsd", "conf", "files"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "OPTIONS/kdebug\n"; string(got) != want {
+		t.Errorf("mirrored file = %q, want %q", got, want)
+	}
+}
+
+func TestCommand_FetchRelease(t *testing.T) {
+	ta := newTestAos(t)
+	dist := t.TempDir()
+
+	_, stderr, err := ta.run("fetch", "--release", "macos", "10.14", dist)
+	if err != nil {
+		t.Fatalf("aos fetch --release error = %v\n%s", err, stderr)
+	}
+	if want := "warning: skipped dyld-635.2: coming soon\n"; !strings.Contains(stderr, want) {
+		t.Errorf("aos fetch --release stderr = %q, want %q", stderr, want)
+	}
+	for _, name := range []string{"Csu-85.tar.gz", "xnu-4903.221.2.tar.gz", appleopensource.FetchManifestName} {
+		if _, err := os.Stat(filepath.Join(dist, name)); err != nil {
+			t.Errorf("aos fetch --release did not fetch %s: %v", name, err)
+		}
+	}
+
+	if _, _, err := ta.run("fetch", "--projects", "xnu", "xnu", "4903.221.2", dist); err == nil {
+		t.Error("aos fetch --projects without --release succeeded")
+	}
+	if _, _, err := ta.run("fetch", "--release", "macos", "10.14", "10.14.1", dist); err == nil {
+		t.Error("aos fetch --release with the extra version succeeded")
+	}
+}
+
+func TestCommand_Mirror(t *testing.T) {
+	ta := newTestAos(t)
+	dir := t.TempDir()
+
+	out, stderr, err := ta.run("mirror", "--projects", "xnu", dir)
+	if err != nil {
+		t.Fatalf("aos mirror error = %v\n%s", err, stderr)
+	}
+	if want := "Fetched 2 tarballs "; !strings.HasPrefix(out, want) {
+		t.Errorf("aos mirror = %q, want prefix %q", out, want)
+	}
+	for _, name := range []string{"xnu-3789.1.32.tar.gz", "xnu-4903.221.2.tar.gz", "index.html"} {
+		if _, err := os.Stat(filepath.Join(dir, "tarballs", "xnu", name)); err != nil {
+			t.Errorf("aos mirror did not write %s: %v", name, err)
+		}
+	}
+
+	out, _, err = ta.run("mirror", "--projects", "xnu", dir)
+	if err != nil {
+		t.Fatalf("aos mirror again error = %v", err)
+	}
+	if want := "Fetched 0 tarballs "; !strings.HasPrefix(out, want) {
+		t.Errorf("aos mirror again = %q, want prefix %q", out, want)
+	}
+
+	if _, _, err := ta.run("mirror", "--since", "10.14", dir); err == nil {
+		t.Error("aos mirror --since without --platform succeeded")
+	}
+}
+
+func TestCommand_Watch(t *testing.T) {
+	ta := newTestAos(t)
+	state := filepath.Join(t.TempDir(), "watch.json")
+
+	// the first check records the baseline
+	out, stderr, err := ta.run("watch", "--projects", "xnu", "--platforms", "macos", "--state", state, "--once")
+	if err != nil {
+		t.Fatalf("aos watch error = %v\n%s", err, stderr)
+	}
+	if out != "" {
+		t.Errorf("aos watch of the baseline = %q, want empty", out)
+	}
+
+	// the state of the older site, which has no releases of the test site yet
+	old := `{"projects": {"xnu": ["3789.1.32"]}, "platforms": {"macos": true}}`
+	if err := ioutil.WriteFile(state, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var received []string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, _ := ioutil.ReadAll(r.Body)
+		received = append(received, string(buf))
+	}))
+	defer receiver.Close()
+
+	out, stderr, err = ta.run("watch", "--projects", "xnu", "--platforms", "macos", "--state", state, "--webhook", receiver.URL, "--once")
+	if err != nil {
+		t.Fatalf("aos watch --webhook error = %v\n%s", err, stderr)
+	}
+	if out != "" {
+		t.Errorf("aos watch --webhook = %q, want empty", out)
+	}
+	wants := []string{
+		`{"type":"new_version","project":"xnu","version":"4903.221.2",`,
+		`{"type":"new_release","platform":"macos","release":"10.14.1",`,
+		`{"type":"new_release","platform":"macos","release":"10.14",`,
+	}
+	if len(received) != len(wants) {
+		t.Fatalf("received events = %q, want %d events", received, len(wants))
+	}
+	for i, want := range wants {
+		if !strings.HasPrefix(received[i], want) {
+			t.Errorf("received event = %q, want prefix %q", received[i], want)
+		}
+	}
+
+	// the delivered events are not reported again
+	out, _, err = ta.run("watch", "--projects", "xnu", "--platforms", "macos", "--state", state, "--once")
+	if err != nil || out != "" {
+		t.Errorf("aos watch again = %q, %v, want empty", out, err)
+	}
+
+	if _, _, err := ta.run("watch", "--platforms", "nonexistent", "--state", state, "--once"); err == nil {
+		t.Error("aos watch --platforms nonexistent succeeded")
+	}
+}
+
+func TestCommand_Sync(t *testing.T) {
+	ta := newTestAos(t)
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, appleopensource.ManifestName)
+	if err := ioutil.WriteFile(manifest, []byte("release: {platform: macos, version: 10.14}\nprojects: [Csu@85, {name: xnu, dir: xnu}]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, stderr, err := ta.run("sync", "-f", manifest, "--dry-run")
+	if err != nil {
+		t.Fatalf("aos sync --dry-run error = %v\n%s", err, stderr)
+	}
+	if want := "added  Csu  85          Csu-85\nadded  xnu  4903.221.2  xnu\n"; out != want {
+		t.Errorf("aos sync --dry-run = %q, want %q", out, want)
+	}
+
+	// Csu tarball of the test site is not a gzip archive
+	if err := ioutil.WriteFile(manifest, []byte("release: {platform: macos, version: 10.14}\nprojects: [{name: xnu, dir: xnu}]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr, err := ta.run("sync", "-f", manifest); err != nil {
+		t.Fatalf("aos sync error = %v\n%s", err, stderr)
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "xnu", "README.md"))
+	if err != nil || string(buf) != "xnu\n" {
+		t.Errorf("aos sync extracted README.md = %q, %v", buf, err)
+	}
+
+	out, _, err = ta.run("sync", "-f", manifest)
+	if err != nil {
+		t.Fatalf("aos sync again error = %v", err)
+	}
+	if want := "unchanged  xnu  4903.221.2  xnu\n"; out != want {
+		t.Errorf("aos sync again = %q, want %q", out, want)
+	}
+}
+
+func TestCommand_Patch(t *testing.T) {
+	ta := newTestAos(t)
+	patches := t.TempDir()
+	series := filepath.Join(patches, "xnu-4903.221.2")
+	if err := os.MkdirAll(series, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(series, appleopensource.SeriesName), []byte("0001-readme.patch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(series, "0001-readme.patch"), []byte("--- a/README.md\n+++ b/README.md\n@@ -1 +1 @@\n-xnu\n+patched xnu\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, stderr, err := ta.run("patch", "--patches", patches, "list", "--check", "xnu", "4903.221.2")
+	if err != nil {
+		t.Fatalf("aos patch list --check error = %v\n%s", err, stderr)
+	}
+	if want := "0001-readme.patch  1 files  1 hunks  ok\n"; out != want {
+		t.Errorf("aos patch list --check = %q, want %q", out, want)
+	}
+
+	out, _, err = ta.run("patch", "--patches", patches, "list", "--against", "3789.1.32", "xnu", "4903.221.2")
+	if err == nil {
+		t.Error("aos patch list --against of the patch which does not apply succeeded")
+	}
+	if want := "0001-readme.patch  1 files  1 hunks  failed\n"; !strings.HasPrefix(out, want) {
+		t.Errorf("aos patch list --against = %q, want %q", out, want)
+	}
+
+	dir := filepath.Join(t.TempDir(), "xnu")
+	if _, stderr, err := ta.run("patch", "--patches", patches, "apply", "xnu", "4903.221.2", dir); err != nil {
+		t.Fatalf("aos patch apply error = %v\n%s", err, stderr)
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "README.md"))
+	if err != nil || string(buf) != "patched xnu\n" {
+		t.Errorf("aos patch apply README.md = %q, %v", buf, err)
+	}
+	if _, _, err := ta.run("patch", "--patches", patches, "apply", "xnu", "4903.221.2", dir); err == nil {
+		t.Error("aos patch apply to the existing dir succeeded")
+	}
+
+	if _, _, err := ta.run("patch", "--patches", patches, "rebase", "xnu", "4903.221.2", "3789.1.32"); !errors.Is(err, appleopensource.ErrRebaseConflict) {
+		t.Errorf("aos patch rebase error = %v, want %v", err, appleopensource.ErrRebaseConflict)
+	}
+}
+
+func TestCommand_DidYouMean(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "versions",
+			args: []string{"versions", "xun"},
+			want: "\n\nDid you mean this?\n\txnu\n",
+		},
+		{
+			name: "fetch version",
+			args: []string{"fetch", "xnu", "4903.221.3", "."},
+			want: "\n\nDid you mean this?\n\txnu 4903.221.2\n",
+		},
+		{
+			name: "release",
+			args: []string{"release", "macos", "10.12.4"},
+			want: "\n\nDid you mean this?\n\t10.1.4\n\t10.10.4\n\t10.11.4\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ta := newTestAos(t)
+
+			_, _, err := ta.run(tt.args...)
+			if err == nil {
+				t.Fatalf("aos %s succeeded", strings.Join(tt.args, " "))
+			}
+			if !strings.HasSuffix(err.Error(), tt.want) {
+				t.Errorf("aos %s error = %q, want suffix %q", strings.Join(tt.args, " "), err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommand_Offline(t *testing.T) {
+	ta := newTestAos(t)
+
+	if _, stderr, err := ta.run("list"); err != nil {
+		t.Fatalf("aos list error = %v\n%s", err, stderr)
+	}
+
+	ta.srv.ResetRequests()
+	got, stderr, err := ta.run("--offline", "list")
+	if err != nil {
+		t.Fatalf("aos --offline list error = %v\n%s", err, stderr)
+	}
+	if want := "Csu\nxnu\n"; got != want {
+		t.Errorf("aos --offline list = %q, want %q", got, want)
+	}
+
+	_, _, err = ta.run("--offline", "versions", "xnu")
+	if err == nil || !strings.Contains(err.Error(), "not cached: "+ta.srv.BaseURL()+"tarballs/xnu") {
+		t.Errorf("aos --offline versions xnu error = %v, want not cached error", err)
+	}
+
+	if reqs := ta.srv.Requests(); len(reqs) != 0 {
+		t.Errorf("offline mode sent the requests: %v", reqs)
+	}
+}
+
+func TestCommand_Retry(t *testing.T) {
+	ta := newTestAos(t)
+	ta.srv.AddFault(aostest.Fault{Status: http.StatusServiceUnavailable, Times: 2})
+
+	if _, _, err := ta.run("list"); err == nil {
+		t.Fatal("aos list without the retry succeeded on 503")
+	}
+
+	ta.srv.ClearFaults()
+	ta.srv.AddFault(aostest.Fault{Status: http.StatusServiceUnavailable, Times: 2})
+	t.Setenv(envPrefix+"RETRY_MAX", "2")
+	t.Setenv(envPrefix+"RETRY_BACKOFF", "1ms")
+	got, stderr, err := ta.run("list")
+	if err != nil {
+		t.Fatalf("aos list error = %v\n%s", err, stderr)
+	}
+	if want := "Csu\nxnu\n"; got != want {
+		t.Errorf("aos list = %q, want %q", got, want)
+	}
+}
+
+func TestCommand_Limits(t *testing.T) {
+	ta := newTestAos(t)
+	fname := filepath.Join(t.TempDir(), "config.yaml")
+	if err := ioutil.WriteFile(fname, []byte("limits:\n  requests_per_second: 2\n  hosts:\n    127.0.0.1: {requests_per_second: 100, bytes_per_second: 1MB}\nuser_agent: ci/1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := "template={{.limits.requests_per_second}} {{.limits.bytes_per_second}} {{index .limits.hosts \"127.0.0.1\"}} {{.user_agent}}"
+	got, stderr, err := ta.run("-c", fname, "--bandwidth-limit", "512KiB", "-o", tmpl, "config", "view")
+	if err != nil {
+		t.Fatalf("aos config view error = %v\n%s", err, stderr)
+	}
+	if want := "2 512KiB map[bytes_per_second:1MB requests_per_second:100] ci/1"; got != want {
+		t.Errorf("aos config view = %q, want %q", got, want)
+	}
+
+	// the default User-Agent is same as the library
+	got, stderr, err = ta.run("-o", "template={{.user_agent}}", "config", "view")
+	if err != nil {
+		t.Fatalf("aos config view error = %v\n%s", err, stderr)
+	}
+	if want := appleopensource.DefaultUserAgent; got != want {
+		t.Errorf("aos config view of the default user_agent = %q, want %q", got, want)
+	}
+
+	got, stderr, err = ta.run("-c", fname, "--rate-limit", "100", "--user-agent", "ci/2", "list")
+	if err != nil {
+		t.Fatalf("aos list with the limits error = %v\n%s", err, stderr)
+	}
+	if want := "Csu\nxnu\n"; got != want {
+		t.Errorf("aos list with the limits = %q, want %q", got, want)
+	}
+}
+
+func TestCommand_Fixture(t *testing.T) {
+	ta := newTestAos(t)
+	dir := t.TempDir()
+
+	run := func(args ...string) string {
+		t.Helper()
+
+		ioStreams, _, out, errOut := NewTestIOStreams()
+		cmd := newCommand(context.Background(), args, &ioStreams)
+		cmd.SetArgs(args)
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("aos %s error = %v\n%s", strings.Join(args, " "), err, errOut)
+		}
+		return out.String()
+	}
+
+	want := run("fixture", "record", dir, "--base-url", ta.srv.BaseURL(), "versions", "xnu")
+	ta.srv.Close()
+
+	got := run("fixture", "replay", dir, "--base-url", ta.srv.BaseURL(), "versions", "xnu")
+	if got != want {
+		t.Errorf("replayed output = %q, want %q", got, want)
+	}
+}
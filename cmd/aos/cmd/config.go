@@ -0,0 +1,291 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource"
+)
+
+// envPrefix is the prefix of the environment variables of the configuration.
+const envPrefix = "APPLEOPENSOURCE_"
+
+// config represents the configuration of aos.
+//
+// The configuration is loaded from the defaults, the config file, the APPLEOPENSOURCE_* environment
+// variables and the global flags in order, and the latter overrides the former.
+type config struct {
+	// BaseURL is the base URL of the opensource.apple.com resources.
+	BaseURL string `json:"base_url" yaml:"base_url" toml:"base_url"`
+
+	// Providers is the alternative base URLs which are tried in order when BaseURL fails.
+	Providers []string `json:"providers" yaml:"providers" toml:"providers"`
+
+	Cache cacheConfig `json:"cache" yaml:"cache" toml:"cache"`
+
+	// Concurrency is the number of concurrent requests of the downloads.
+	Concurrency int `json:"concurrency" yaml:"concurrency" toml:"concurrency"`
+
+	Retry retryConfig `json:"retry" yaml:"retry" toml:"retry"`
+
+	Limits limitsConfig `json:"limits" yaml:"limits" toml:"limits"`
+
+	// UserAgent is the User-Agent header of the requests.
+	UserAgent string `json:"user_agent" yaml:"user_agent" toml:"user_agent"`
+
+	// Output is the default output format.
+	Output string `json:"output" yaml:"output" toml:"output"`
+
+	// Offline serves only from the cache.
+	Offline bool `json:"offline" yaml:"offline" toml:"offline"`
+}
+
+// cacheConfig represents the cache configuration.
+type cacheConfig struct {
+	Dir     string   `json:"dir" yaml:"dir" toml:"dir"`
+	TTL     duration `json:"ttl" yaml:"ttl" toml:"ttl"`
+	MaxSize byteSize `json:"max_size" yaml:"max_size" toml:"max_size"`
+}
+
+// retryConfig represents the retry policy configuration.
+type retryConfig struct {
+	Max     int      `json:"max" yaml:"max" toml:"max"`
+	Backoff duration `json:"backoff" yaml:"backoff" toml:"backoff"`
+}
+
+// limitsConfig represents the rate limits of the requests and the bandwidth limits of the downloads.
+type limitsConfig struct {
+	RequestsPerSecond float64                     `json:"requests_per_second" yaml:"requests_per_second" toml:"requests_per_second"`
+	BytesPerSecond    byteSize                    `json:"bytes_per_second" yaml:"bytes_per_second" toml:"bytes_per_second"`
+	Hosts             map[string]hostLimitsConfig `json:"hosts" yaml:"hosts" toml:"hosts"`
+}
+
+// hostLimitsConfig represents the limits of the requests to a host.
+type hostLimitsConfig struct {
+	RequestsPerSecond float64  `json:"requests_per_second" yaml:"requests_per_second" toml:"requests_per_second"`
+	BytesPerSecond    byteSize `json:"bytes_per_second" yaml:"bytes_per_second" toml:"bytes_per_second"`
+}
+
+// clientLimits returns the Limits of the client, or nil if nothing is limited.
+func (c *limitsConfig) clientLimits() *appleopensource.Limits {
+	if c.RequestsPerSecond <= 0 && c.BytesPerSecond <= 0 && len(c.Hosts) == 0 {
+		return nil
+	}
+
+	limits := &appleopensource.Limits{
+		RequestsPerSecond: c.RequestsPerSecond,
+		BytesPerSecond:    int64(c.BytesPerSecond),
+		Hosts:             make(map[string]appleopensource.HostLimits, len(c.Hosts)),
+	}
+	for host, hl := range c.Hosts {
+		limits.Hosts[host] = appleopensource.HostLimits{RequestsPerSecond: hl.RequestsPerSecond, BytesPerSecond: int64(hl.BytesPerSecond)}
+	}
+
+	return limits
+}
+
+// defaultConfig returns the default configuration.
+func defaultConfig() *config {
+	cacheHome, _ := os.UserCacheDir()
+
+	return &config{
+		BaseURL:     appleopensource.DefaultBaseURL,
+		Providers:   []string{},
+		Cache:       cacheConfig{Dir: filepath.Join(cacheHome, "appleopensource"), TTL: duration(appleopensource.DefaultCacheTTL)},
+		Concurrency: appleopensource.DefaultConcurrency,
+		Retry:       retryConfig{Max: 0, Backoff: duration(time.Second)},
+		Limits:      limitsConfig{Hosts: map[string]hostLimitsConfig{}},
+		UserAgent:   appleopensource.DefaultUserAgent,
+		Output:      outputText,
+	}
+}
+
+// defaultConfigPaths returns the candidate paths of the config file in the user config directory.
+func defaultConfigPaths() []string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return nil
+	}
+
+	dir = filepath.Join(dir, "appleopensource")
+	return []string{
+		filepath.Join(dir, "config.yaml"),
+		filepath.Join(dir, "config.yml"),
+		filepath.Join(dir, "config.toml"),
+	}
+}
+
+// loadConfig loads the configuration from the defaults, the config file and the environment variables.
+//
+// The config file is the path if not empty, $APPLEOPENSOURCE_CONFIG, or the first existing default path.
+// It returns the loaded config file path, which is empty if there is no config file.
+func loadConfig(path string) (*config, string, error) {
+	cfg := defaultConfig()
+
+	if path == "" {
+		path = os.Getenv(envPrefix + "CONFIG")
+	}
+	if path == "" {
+		for _, fname := range defaultConfigPaths() {
+			if _, err := os.Stat(fname); err == nil {
+				path = fname
+				break
+			}
+		}
+	}
+
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, "", fmt.Errorf("could not load the config file %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, "", err
+	}
+
+	return cfg, path, nil
+}
+
+// loadFile loads the YAML, or the TOML if the extension is ".toml", config file.
+func (c *config) loadFile(fname string) error {
+	buf, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return err
+	}
+
+	if filepath.Ext(fname) == ".toml" {
+		md, err := toml.Decode(string(buf), c)
+		if err != nil {
+			return err
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("unknown keys: %v", undecoded)
+		}
+		return nil
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(buf))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	return nil
+}
+
+// loadEnv loads the APPLEOPENSOURCE_* environment variables.
+func (c *config) loadEnv() error {
+	vars := []struct {
+		name string
+		set  func(s string) error
+	}{
+		{"BASE_URL", func(s string) error { c.BaseURL = s; return nil }},
+		{"PROVIDERS", func(s string) error { c.Providers = splitList(s); return nil }},
+		{"CACHE_DIR", func(s string) error { c.Cache.Dir = s; return nil }},
+		{"CACHE_TTL", c.Cache.TTL.Set},
+		{"CACHE_MAX_SIZE", c.Cache.MaxSize.Set},
+		{"CONCURRENCY", func(s string) (err error) { c.Concurrency, err = strconv.Atoi(s); return err }},
+		{"RETRY_MAX", func(s string) (err error) { c.Retry.Max, err = strconv.Atoi(s); return err }},
+		{"RETRY_BACKOFF", c.Retry.Backoff.Set},
+		{"LIMITS_REQUESTS_PER_SECOND", func(s string) (err error) { c.Limits.RequestsPerSecond, err = strconv.ParseFloat(s, 64); return err }},
+		{"LIMITS_BYTES_PER_SECOND", c.Limits.BytesPerSecond.Set},
+		{"USER_AGENT", func(s string) error { c.UserAgent = s; return nil }},
+		{"OUTPUT", func(s string) error { c.Output = s; return nil }},
+		{"OFFLINE", func(s string) (err error) { c.Offline, err = strconv.ParseBool(s); return err }},
+	}
+
+	for _, v := range vars {
+		s, ok := os.LookupEnv(envPrefix + v.name)
+		if !ok || s == "" {
+			continue
+		}
+		if err := v.set(s); err != nil {
+			return fmt.Errorf("invalid %s%s: %w", envPrefix, v.name, err)
+		}
+	}
+
+	return nil
+}
+
+// splitList splits the comma separated list.
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
+
+type configCmd struct {
+	*aos
+
+	ioStreams *IOStreams
+}
+
+// newCmdConfig creates the config command.
+func (a *aos) newCmdConfig(ctx context.Context, ioStreams *IOStreams) *cobra.Command {
+	config := &configCmd{
+		aos:       a,
+		ioStreams: ioStreams,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage the configuration",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "view",
+		Short: "Show the effective configuration merged from the config file, the environment variables and the flags",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkArgs(cmd.Name(), cmd.Flags(), 0, exactArgs, args...); err != nil {
+				return err
+			}
+			return config.runView(ctx)
+		},
+	})
+
+	return cmd
+}
+
+func (c *configCmd) runView(ctx context.Context) error {
+	return c.printer.print(c.ioStreams.Out, c.config, func(w io.Writer) error {
+		var buf bytes.Buffer
+		if c.configFile != "" {
+			fmt.Fprintf(&buf, "# %s\n", c.configFile)
+		}
+
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(c.config); err != nil {
+			return err
+		}
+		if err := enc.Close(); err != nil {
+			return err
+		}
+
+		_, err := w.Write(buf.Bytes())
+		return err
+	})
+}
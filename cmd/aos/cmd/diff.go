@@ -0,0 +1,151 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource"
+)
+
+type diff struct {
+	*aos
+
+	ioStreams *IOStreams
+
+	product    string
+	oldVersion string
+	newVersion string
+
+	include []string
+	exclude []string
+	patch   bool
+	context int
+}
+
+// newCmdDiff creates the diff command.
+func (a *aos) newCmdDiff(ctx context.Context, ioStreams *IOStreams) *cobra.Command {
+	diff := &diff{
+		aos:       a,
+		ioStreams: ioStreams,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "diff product old-version new-version",
+		Short: "Show changes between two versions of the product.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkArgs(cmd.Name(), cmd.Flags(), 3, exactArgs, args...); err != nil {
+				return err
+			}
+
+			diff.product = args[0]
+			diff.oldVersion = args[1]
+			diff.newVersion = args[2]
+			return diff.run(ctx)
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringSliceVarP(&diff.include, "include", "i", nil, "Compare only the paths matched to the patterns")
+	f.StringSliceVarP(&diff.exclude, "exclude", "x", nil, "Ignore the paths matched to the patterns")
+	f.BoolVarP(&diff.patch, "patch", "p", false, "Output the unified diff instead of the summary")
+	f.IntVarP(&diff.context, "unified", "U", 3, "Number of context lines of the unified diff")
+
+	return cmd
+}
+
+// tarball returns the stored tarball path of the product version, and fetches it if not stored.
+func (d *diff) tarball(ctx context.Context, version string) (string, error) {
+	p := appleopensource.Product{
+		Name:    d.product,
+		Version: version,
+	}
+
+	return d.client.Tarball(ctx, p)
+}
+
+func (d *diff) run(ctx context.Context) error {
+	oldArchive, oldErr := d.tarball(ctx, d.oldVersion)
+	newArchive, newErr := d.tarball(ctx, d.newVersion)
+	if err := appleopensource.JoinNotCached(oldErr, newErr); err != nil {
+		return err
+	}
+
+	opts := &appleopensource.DiffOptions{
+		Include: d.include,
+		Exclude: d.exclude,
+		Patch:   d.patch,
+		Context: d.context,
+	}
+	diffs, err := appleopensource.DiffArchives(oldArchive, newArchive, opts)
+	if err != nil {
+		return err
+	}
+
+	if d.patch {
+		for _, fd := range diffs {
+			if _, err := d.ioStreams.Out.Write(fd.Patch); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return d.printer.print(d.ioStreams.Out, fileDiffRecords(diffs), func(w io.Writer) error {
+		var buf bytes.Buffer
+		tbuf := tabwriter.NewWriter(&buf, 2, 1, 2, ' ', 0)
+
+		var added, removed int
+		for _, fd := range diffs {
+			var mark string
+			switch fd.Kind {
+			case appleopensource.Added:
+				mark = "A"
+			case appleopensource.Removed:
+				mark = "D"
+			case appleopensource.Modified:
+				mark = "M"
+			}
+
+			stat := fmt.Sprintf("+%d -%d", fd.Added, fd.Removed)
+			if fd.Binary {
+				stat = "binary"
+			}
+			fmt.Fprintf(tbuf, "%s\t%s\t%s\n", mark, fd.Path, stat)
+
+			added += fd.Added
+			removed += fd.Removed
+		}
+		tbuf.Flush()
+
+		fmt.Fprintf(&buf, "%d files changed, %d insertions(+), %d deletions(-)\n", len(diffs), added, removed)
+
+		_, err := w.Write(buf.Bytes())
+		return err
+	})
+}
+
+// fileDiffRecords represents the records of the changed files, which is the output of diff command.
+type fileDiffRecords []appleopensource.FileDiff
+
+func (r fileDiffRecords) csvHeader() []string {
+	return []string{"path", "kind", "binary", "added", "removed"}
+}
+
+func (r fileDiffRecords) csvRows() [][]string {
+	rows := make([][]string, len(r))
+	for i, fd := range r {
+		rows[i] = []string{fd.Path, fd.Kind.String(), strconv.FormatBool(fd.Binary), strconv.Itoa(fd.Added), strconv.Itoa(fd.Removed)}
+	}
+
+	return rows
+}
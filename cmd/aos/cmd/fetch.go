@@ -6,6 +6,8 @@ package cmd
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/spf13/cobra"
 
@@ -13,23 +15,41 @@ import (
 )
 
 type fetch struct {
+	*aos
+
 	ioStreams *IOStreams
 
 	product  string
 	versions []string
 	dist     string
+
+	source      bool
+	concurrency int
+
+	release  string
+	platform appleopensource.Platform
+	projects []string
 }
 
 // newCmdList creates the list command.
 func (a *aos) newCmdFetch(ctx context.Context, ioStreams *IOStreams) *cobra.Command {
 	fetch := &fetch{
+		aos:       a,
 		ioStreams: ioStreams,
 	}
 
 	cmd := &cobra.Command{
-		Use:   "fetch product [version...] dist",
-		Short: "Fetch the tarballs",
+		Use:   "fetch product [version...] dist | fetch --release platform version dist",
+		Short: "Fetch the tarballs or the source resources tree",
+		Example: `  aos fetch xnu 4903.221.2 .
+  aos fetch --release macos 10.14.1 --projects dtrace,AvailabilityVersions,libplatform,libdispatch,xnu,Libsystem .`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if fetch.release != "" {
+				return fetch.runReleaseArgs(ctx, cmd, args)
+			}
+			if len(fetch.projects) > 0 {
+				return errors.New("--projects requires --release")
+			}
 			if err := checkArgs(cmd.Name(), cmd.Flags(), 3, minArgs, args...); err != nil {
 				return err
 			}
@@ -41,18 +61,85 @@ func (a *aos) newCmdFetch(ctx context.Context, ioStreams *IOStreams) *cobra.Comm
 		},
 	}
 
+	f := cmd.Flags()
+	f.BoolVarP(&fetch.source, "source", "s", false, "Mirror the source resources tree instead of the tarballs")
+	f.IntVarP(&fetch.concurrency, "jobs", "j", 0, "Number of concurrent requests (default the concurrency config)")
+	f.StringVar(&fetch.release, "release", "", "Fetch the tarballs of the projects in the platform (macos|xcode|ios|server) release version, which takes the release version arg instead of the product and the versions")
+	f.StringSliceVar(&fetch.projects, "projects", nil, "Fetch only the projects of the release with --release (default all projects)")
+
 	return cmd
 }
 
 func (f *fetch) run(ctx context.Context) error {
+	if f.concurrency > 0 {
+		f.client.Concurrency = f.concurrency
+	}
+	if f.source {
+		return f.runSource(ctx)
+	}
+
 	list := make([]string, len(f.versions))
 	for i, v := range f.versions {
 		p := appleopensource.Product{
 			Name:    f.product,
 			Version: v,
 		}
-		list[i] = p.Tarball()
+		list[i] = f.client.TarballURL(p)
+	}
+
+	if err := f.client.Fetch(ctx, f.dist, list...); err != nil {
+		return f.suggestProduct(ctx, err, appleopensource.TarballsResource, f.product, f.versions...)
+	}
+
+	return nil
+}
+
+// runSource mirrors the source resources tree of each versions into dist.
+func (f *fetch) runSource(ctx context.Context) error {
+	for _, v := range f.versions {
+		p := appleopensource.Product{
+			Name:    f.product,
+			Version: v,
+		}
+		if err := f.client.MirrorSource(ctx, f.dist, f.client.SourceURL(p), 0); err != nil {
+			return f.suggestProduct(ctx, err, appleopensource.SourceResource, f.product, v)
+		}
+	}
+
+	return nil
+}
+
+// runReleaseArgs parses the --release platform and the "version dist" args, and runs runRelease.
+func (f *fetch) runReleaseArgs(ctx context.Context, cmd *cobra.Command, args []string) error {
+	if err := checkArgs(cmd.Name(), cmd.Flags(), 2, exactArgs, args...); err != nil {
+		return err
+	}
+	if f.source {
+		return errors.New("--release does not support --source")
+	}
+
+	platform, err := appleopensource.ParsePlatform(f.release)
+	if err != nil {
+		return err
+	}
+	f.platform, f.dist = platform, args[1]
+
+	return f.runRelease(ctx, args[0])
+}
+
+// runRelease fetches the tarballs of the projects in the release into dist, and warns the skipped projects.
+func (f *fetch) runRelease(ctx context.Context, version string) error {
+	m, err := f.client.FetchRelease(ctx, f.dist, f.platform, version, &appleopensource.FetchReleaseOptions{
+		Projects: f.projects,
+		Jobs:     f.concurrency,
+	})
+	if err != nil {
+		return suggestRelease(err, f.platform, version)
+	}
+
+	for _, s := range m.Skipped {
+		fmt.Fprintf(f.ioStreams.ErrOut, "warning: skipped %s-%s: %s\n", s.Name, s.Version, s.Reason)
 	}
 
-	return appleopensource.Fetch(ctx, f.dist, list...)
+	return nil
 }
@@ -0,0 +1,96 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource"
+)
+
+type fixtureCmd struct {
+	*aos
+
+	ioStreams *IOStreams
+}
+
+// newCmdFixture creates the hidden fixture command, which records and replays the HTTP fixtures of the tests.
+func (a *aos) newCmdFixture(ctx context.Context, ioStreams *IOStreams) *cobra.Command {
+	fixture := &fixtureCmd{
+		aos:       a,
+		ioStreams: ioStreams,
+	}
+
+	cmd := &cobra.Command{
+		Use:    "fixture",
+		Short:  "Record and replay the HTTP fixtures of the tests",
+		Hidden: true,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:                "record dir command [args...]",
+		Short:              "Run the aos command, and record its HTTP responses into the dir fixture directory",
+		DisableFlagParsing: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := fixture.checkArgs(cmd.Name(), args); err != nil {
+				return err
+			}
+			return fixture.run(ctx, &appleopensource.RecordTransport{Dir: args[0]}, args[1:])
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:                "replay dir command [args...]",
+		Short:              "Run the aos command with replaying the HTTP responses from the dir fixture directory",
+		DisableFlagParsing: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := fixture.checkArgs(cmd.Name(), args); err != nil {
+				return err
+			}
+			if _, err := os.Stat(args[0]); err != nil {
+				return fmt.Errorf("no such %s fixture directory: %w", args[0], err)
+			}
+			return fixture.run(ctx, &appleopensource.ReplayTransport{Dir: args[0]}, args[1:])
+		},
+	})
+
+	return cmd
+}
+
+// checkArgs checks the args of the record and the replay commands, which do not parse the flags.
+func (f *fixtureCmd) checkArgs(cmdName string, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("%s: %q requires a minimum of %d argument(s), args: <%s>\n", AppName, cmdName, 2, strings.Join(args, " "))
+	}
+
+	return nil
+}
+
+// run runs the aos command args with the transport.
+//
+// The command uses the temporary cache directory, so that all the requests go through the transport
+// regardless of the user cache.
+func (f *fixtureCmd) run(ctx context.Context, transport http.RoundTripper, args []string) error {
+	cacheDir, err := ioutil.TempDir("", "aos-fixture-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(cacheDir)
+
+	args = append([]string{"--cache-dir", cacheDir}, args...)
+	cmd := (&aos{transport: transport}).rootCommand(ctx, args, f.ioStreams)
+	cmd.SetArgs(args)
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+
+	return cmd.Execute()
+}
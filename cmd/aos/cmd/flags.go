@@ -5,13 +5,172 @@
 package cmd
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/spf13/pflag"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource"
 )
 
 func addGlobalFlags(flags *pflag.FlagSet, a *aos) {
 	flags.BoolVar(&a.noCache, "no-cache", false, "Do not use cache")
-	flags.BoolVarP(&a.debug, "debug", "d", false, "Use debug output")
-	flags.StringVarP(&a.configPath, "config", "c", "", "config file path")
+	flags.DurationVar(&a.cacheTTL, "cache-ttl", appleopensource.DefaultCacheTTL, "Duration while the cached pages are used without the revalidation")
+	flags.Var(&a.cacheMaxSize, "cache-max-size", "Total size limit of the cached pages and tarballs such as 2GB (default no limit)")
+	flags.StringVar(&a.cacheDirPath, "cache-dir", "", "Cache directory (default the appleopensource directory in the user cache directory)")
+	flags.StringVar(&a.baseURL, "base-url", appleopensource.DefaultBaseURL, "Base URL of the opensource.apple.com resources")
+	flags.BoolVar(&a.offline, "offline", false, "Serve only from the cache, and fail if not cached")
+	flags.BoolVarP(&a.debug, "debug", "d", false, "Log the requests, the cache and the scraping to stderr")
+	flags.StringVar(&a.traceHTTP, "trace-http", "", "Record the HTTP traffic to the file in the HAR format")
+	flags.Float64Var(&a.rateLimit, "rate-limit", 0, "Maximum number of the requests per second (default no limit)")
+	flags.Var(&a.bwLimit, "bandwidth-limit", "Maximum download throughput per second such as 1MB (default no limit)")
+	flags.StringVar(&a.userAgent, "user-agent", appleopensource.DefaultUserAgent, "User-Agent header of the requests")
+	flags.StringVarP(&a.configPath, "config", "c", "", "Config file path (default the appleopensource/config.{yaml,toml} in the user config directory)")
+	flags.StringVarP(&a.output, "output", "o", outputText, "Output format. One of (text|json|yaml|csv|markdown|template=...)")
 
 	addProfilingFlags(flags)
 }
+
+// byteSize is a pflag.Value of the bytes size such as "512MB" or "2GiB".
+type byteSize int64
+
+var _ pflag.Value = (*byteSize)(nil)
+
+// list of byteSize units.
+var byteSizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"KiB", 1 << 10},
+	{"MiB", 1 << 20},
+	{"GiB", 1 << 30},
+	{"TiB", 1 << 40},
+	{"KB", 1000},
+	{"MB", 1000 * 1000},
+	{"GB", 1000 * 1000 * 1000},
+	{"TB", 1000 * 1000 * 1000 * 1000},
+	{"K", 1 << 10},
+	{"M", 1 << 20},
+	{"G", 1 << 30},
+	{"T", 1 << 40},
+	{"B", 1},
+}
+
+// parseByteSize parses the bytes size. The empty string is zero.
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	num, unit := s, int64(1)
+	for _, u := range byteSizeUnits {
+		if strings.HasSuffix(strings.ToUpper(s), strings.ToUpper(u.suffix)) {
+			num, unit = strings.TrimSpace(s[:len(s)-len(u.suffix)]), u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+
+	return int64(n * float64(unit)), nil
+}
+
+// formatByteSize formats the bytes size in the binary units.
+func formatByteSize(n int64) string {
+	const unit = 1 << 10
+	if n < unit {
+		return strconv.FormatInt(n, 10) + "B"
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGT"[exp])
+}
+
+// Set implements a pflag.Value interface.
+func (b *byteSize) Set(s string) error {
+	n, err := parseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = byteSize(n)
+
+	return nil
+}
+
+// String implements a pflag.Value interface.
+func (b byteSize) String() string {
+	if b == 0 {
+		return ""
+	}
+
+	return formatByteSize(int64(b))
+}
+
+// Type implements a pflag.Value interface.
+func (b *byteSize) Type() string {
+	return "size"
+}
+
+// MarshalText implements a encoding.TextMarshaler interface.
+//
+// Unlike String, it keeps the exact bytes such as "2GB" or "1536B".
+func (b byteSize) MarshalText() ([]byte, error) {
+	if b == 0 {
+		return []byte{}, nil
+	}
+
+	for _, suffix := range []string{"TiB", "TB", "GiB", "GB", "MiB", "MB", "KiB", "KB"} {
+		for _, u := range byteSizeUnits {
+			if u.suffix == suffix && int64(b)%u.size == 0 {
+				return []byte(strconv.FormatInt(int64(b)/u.size, 10) + u.suffix), nil
+			}
+		}
+	}
+
+	return []byte(strconv.FormatInt(int64(b), 10) + "B"), nil
+}
+
+// UnmarshalText implements a encoding.TextUnmarshaler interface.
+func (b *byteSize) UnmarshalText(text []byte) error {
+	return b.Set(string(text))
+}
+
+// duration is a time.Duration which is encoded as the string such as "24h".
+type duration time.Duration
+
+// Set parses the duration string.
+func (d *duration) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+
+	return nil
+}
+
+// String implements a fmt.Stringer interface.
+func (d duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalText implements a encoding.TextMarshaler interface.
+func (d duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements a encoding.TextUnmarshaler interface.
+func (d *duration) UnmarshalText(text []byte) error {
+	return d.Set(string(text))
+}
@@ -0,0 +1,302 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource"
+)
+
+type history struct {
+	*aos
+
+	ioStreams *IOStreams
+
+	projects  []string
+	platforms []string
+	releases  []string
+	matrix    bool
+}
+
+// newCmdHistory creates the history command.
+func (a *aos) newCmdHistory(ctx context.Context, ioStreams *IOStreams) *cobra.Command {
+	history := &history{
+		aos:       a,
+		ioStreams: ioStreams,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "history project...",
+		Short: "Show the versions of the projects shipped in every release",
+		Example: `  aos history xnu
+  aos history xnu Libc dyld --platform macos --matrix`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkArgs(cmd.Name(), cmd.Flags(), 1, minArgs, args...); err != nil {
+				return err
+			}
+
+			history.projects = args
+			return history.run(ctx)
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringSliceVarP(&history.platforms, "platform", "p", nil, "Show only the releases of the platforms (default all platforms)")
+	f.StringSliceVar(&history.releases, "release", nil, "Also show the platform/version releases which are not known yet, e.g. macos/10.15")
+	f.BoolVarP(&history.matrix, "matrix", "m", false, "Show the versions as the release by project matrix")
+
+	return cmd
+}
+
+func (h *history) run(ctx context.Context) error {
+	releases, err := releaseTargets(h.platforms, h.releases)
+	if err != nil {
+		return err
+	}
+
+	index, err := h.client.BuildReleaseIndex(ctx, releases)
+	if err != nil {
+		return err
+	}
+
+	histories := make([][]appleopensource.HistoryEntry, len(h.projects))
+	for i, project := range h.projects {
+		histories[i] = index.History(project)
+		if !shippedAny(histories[i]) {
+			return h.suggestShipped(index, project)
+		}
+	}
+
+	if h.matrix {
+		record := newHistoryMatrix(h.projects, histories)
+		return h.printer.print(h.ioStreams.Out, record, record.writeText)
+	}
+
+	record := make(historyRecords, len(h.projects))
+	for i, project := range h.projects {
+		record[i] = newHistoryRecord(project, histories[i])
+	}
+
+	return h.printer.print(h.ioStreams.Out, record, record.writeText)
+}
+
+// suggestShipped returns the error of the project which no release ships, with the similar shipped projects.
+func (h *history) suggestShipped(index *appleopensource.ReleaseIndex, project string) error {
+	err := fmt.Errorf("no release ships %s", project)
+	if suggestions := appleopensource.Suggest(index.Projects(), project, maxSuggestions); len(suggestions) > 0 {
+		return &suggestError{err: err, suggestions: suggestions}
+	}
+
+	return err
+}
+
+// shippedAny reports whether any release of the history ships the project.
+func shippedAny(history []appleopensource.HistoryEntry) bool {
+	for _, e := range history {
+		if e.Shipped() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// historyEntry represents the project in a release.
+type historyEntry struct {
+	Platform   string `json:"platform" yaml:"platform"`
+	Release    string `json:"release" yaml:"release"`
+	Version    string `json:"version,omitempty" yaml:"version,omitempty"`
+	Updated    bool   `json:"updated,omitempty" yaml:"updated,omitempty"`
+	ComingSoon bool   `json:"coming_soon,omitempty" yaml:"coming_soon,omitempty"`
+	Change     string `json:"change,omitempty" yaml:"change,omitempty"`
+}
+
+// historyRecord represents the timeline of the project, which only has the releases shipping the project
+// and the releases the project disappears.
+type historyRecord struct {
+	Project  string         `json:"project" yaml:"project"`
+	Releases []historyEntry `json:"releases" yaml:"releases"`
+}
+
+func newHistoryRecord(project string, history []appleopensource.HistoryEntry) historyRecord {
+	r := historyRecord{Project: project, Releases: []historyEntry{}}
+	for _, e := range history {
+		if !e.Shipped() && e.Change == 0 {
+			continue
+		}
+
+		entry := historyEntry{
+			Platform:   e.Platform.String(),
+			Release:    e.Release,
+			Version:    e.Product.Version,
+			Updated:    e.Product.Updated,
+			ComingSoon: e.Product.ComingSoon,
+		}
+		if e.Change != 0 {
+			entry.Change = e.Change.String()
+		}
+		r.Releases = append(r.Releases, entry)
+	}
+
+	return r
+}
+
+// historyRecords represents the records of the history command.
+type historyRecords []historyRecord
+
+func (r historyRecords) writeText(w io.Writer) error {
+	var buf bytes.Buffer
+	for i, h := range r {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "%s:\n", h.Project)
+
+		tbuf := tabwriter.NewWriter(&buf, 2, 1, 2, ' ', 0)
+		for _, e := range h.Releases {
+			version := "-"
+			if e.Version != "" {
+				version = productVersion(appleopensource.Product{Version: e.Version, ComingSoon: e.ComingSoon})
+			}
+			fmt.Fprintf(tbuf, "  %s\t%s\t%s\t%s\n", e.Platform, e.Release, version, e.Change)
+		}
+		tbuf.Flush()
+	}
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+func (r historyRecords) csvHeader() []string {
+	return []string{"name", "platform", "release", "version", "change"}
+}
+
+func (r historyRecords) csvRows() [][]string {
+	var rows [][]string
+	for _, h := range r {
+		for _, e := range h.Releases {
+			rows = append(rows, []string{h.Project, e.Platform, e.Release, e.Version, e.Change})
+		}
+	}
+
+	return rows
+}
+
+func (r historyRecords) writeMarkdown(w io.Writer) error {
+	var buf bytes.Buffer
+	for i, h := range r {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "## %s\n\n", h.Project)
+		buf.WriteString("| Platform | Release | Version | Change |\n")
+		buf.WriteString("|----------|---------|---------|--------|\n")
+		for _, e := range h.Releases {
+			fmt.Fprintf(&buf, "| %s | %s | %s | %s |\n", e.Platform, e.Release, e.Version, e.Change)
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+// historyMatrixRow represents the versions of the projects in a release.
+type historyMatrixRow struct {
+	Platform string   `json:"platform" yaml:"platform"`
+	Release  string   `json:"release" yaml:"release"`
+	Versions []string `json:"versions" yaml:"versions"` // in the order of the projects, empty if not shipped
+}
+
+// historyMatrix represents the release by project matrix of the history command, which only has the releases
+// shipping any of the projects.
+type historyMatrix struct {
+	Projects []string           `json:"projects" yaml:"projects"`
+	Releases []historyMatrixRow `json:"releases" yaml:"releases"`
+}
+
+func newHistoryMatrix(projects []string, histories [][]appleopensource.HistoryEntry) *historyMatrix {
+	m := &historyMatrix{Projects: projects, Releases: []historyMatrixRow{}}
+	if len(histories) == 0 {
+		return m
+	}
+
+	// every history has the same releases in the same order
+	for i, e := range histories[0] {
+		row := historyMatrixRow{
+			Platform: e.Platform.String(),
+			Release:  e.Release,
+			Versions: make([]string, len(projects)),
+		}
+		shipped := false
+		for j := range projects {
+			if p := histories[j][i].Product; p.Name != "" {
+				row.Versions[j] = p.Version
+				shipped = true
+			}
+		}
+		if shipped {
+			m.Releases = append(m.Releases, row)
+		}
+	}
+
+	return m
+}
+
+func (m *historyMatrix) writeText(w io.Writer) error {
+	var buf bytes.Buffer
+	tbuf := tabwriter.NewWriter(&buf, 2, 1, 2, ' ', 0)
+	fmt.Fprintf(tbuf, "PLATFORM\tRELEASE\t%s\n", strings.Join(m.Projects, "\t"))
+	for _, row := range m.Releases {
+		versions := make([]string, len(row.Versions))
+		for i, v := range row.Versions {
+			versions[i] = v
+			if v == "" {
+				versions[i] = "-"
+			}
+		}
+		fmt.Fprintf(tbuf, "%s\t%s\t%s\n", row.Platform, row.Release, strings.Join(versions, "\t"))
+	}
+	tbuf.Flush()
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+func (m *historyMatrix) csvHeader() []string {
+	return append([]string{"platform", "release"}, m.Projects...)
+}
+
+func (m *historyMatrix) csvRows() [][]string {
+	rows := make([][]string, len(m.Releases))
+	for i, row := range m.Releases {
+		rows[i] = append([]string{row.Platform, row.Release}, row.Versions...)
+	}
+
+	return rows
+}
+
+func (m *historyMatrix) writeMarkdown(w io.Writer) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "| Platform | Release | %s |\n", strings.Join(m.Projects, " | "))
+	fmt.Fprintf(&buf, "|----------|---------|%s\n", strings.Repeat("---|", len(m.Projects)))
+	for _, row := range m.Releases {
+		fmt.Fprintf(&buf, "| %s | %s | %s |\n", row.Platform, row.Release, strings.Join(row.Versions, " | "))
+	}
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
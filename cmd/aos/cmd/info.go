@@ -0,0 +1,169 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource"
+)
+
+type info struct {
+	*aos
+
+	ioStreams *IOStreams
+
+	product    string
+	platforms  []string
+	releases   []string
+	noReleases bool
+	noSizes    bool
+}
+
+// newCmdInfo creates the info command.
+func (a *aos) newCmdInfo(ctx context.Context, ioStreams *IOStreams) *cobra.Command {
+	info := &info{
+		aos:       a,
+		ioStreams: ioStreams,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "info product",
+		Short: "Show the versions, the releases, the tarballs and the cache status of the product",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkArgs(cmd.Name(), cmd.Flags(), 1, exactArgs, args...); err != nil {
+				return err
+			}
+
+			info.product = args[0]
+			return info.run(ctx)
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringSliceVarP(&info.platforms, "platform", "p", nil, "Search only the releases of the platforms (default all platforms)")
+	f.StringSliceVar(&info.releases, "release", nil, "Also search the platform/version releases which are not known yet, e.g. macos/10.15")
+	f.BoolVar(&info.noReleases, "no-releases", false, "Do not search the releases shipping the product")
+	f.BoolVar(&info.noSizes, "no-sizes", false, "Do not request the sizes of the tarballs which are not cached")
+
+	return cmd
+}
+
+func (i *info) run(ctx context.Context) error {
+	opts := &appleopensource.InfoOptions{Sizes: !i.noSizes}
+	if !i.noReleases {
+		releases, err := releaseTargets(i.platforms, i.releases)
+		if err != nil {
+			return err
+		}
+		opts.Releases = releases
+	}
+
+	pi, err := i.client.ProductInfo(ctx, i.product, opts)
+	if err != nil {
+		return i.suggestProduct(ctx, err, appleopensource.TarballsResource, i.product)
+	}
+
+	record := &infoRecord{
+		Name:            pi.Name,
+		TarballVersions: pi.TarballVersions,
+		SourceVersions:  pi.SourceVersions,
+		Latest:          pi.Latest,
+		Tarballs:        pi.Tarballs,
+		Releases:        []whichRelease{},
+	}
+	for _, e := range pi.Releases {
+		record.Releases = append(record.Releases, whichRelease{
+			Platform:   e.Platform.String(),
+			Release:    e.Release,
+			Version:    e.Product.Version,
+			Updated:    e.Product.Updated,
+			ComingSoon: e.Product.ComingSoon,
+		})
+	}
+
+	return i.printer.print(i.ioStreams.Out, record, record.writeText)
+}
+
+// infoRecord represents the record of the info command, which is the ProductInfo with the releases same as
+// the which command.
+type infoRecord struct {
+	Name            string                        `json:"name" yaml:"name"`
+	TarballVersions []string                      `json:"tarball_versions" yaml:"tarball_versions"`
+	SourceVersions  []string                      `json:"source_versions" yaml:"source_versions"`
+	Latest          string                        `json:"latest" yaml:"latest"`
+	Tarballs        []appleopensource.TarballInfo `json:"tarballs" yaml:"tarballs"`
+	Releases        []whichRelease                `json:"releases" yaml:"releases"`
+}
+
+func (r *infoRecord) writeText(w io.Writer) error {
+	var buf bytes.Buffer
+	tbuf := tabwriter.NewWriter(&buf, 2, 1, 2, ' ', 0)
+	fmt.Fprintf(tbuf, "Name:\t%s\n", r.Name)
+	fmt.Fprintf(tbuf, "Latest:\t%s\n", r.Latest)
+	fmt.Fprintf(tbuf, "Tarballs:\t%s\n", joinOrNone(r.TarballVersions))
+	fmt.Fprintf(tbuf, "Source:\t%s\n", joinOrNone(r.SourceVersions))
+	tbuf.Flush()
+
+	if len(r.Releases) > 0 {
+		buf.WriteString("\nReleases:\n")
+		tbuf = tabwriter.NewWriter(&buf, 2, 1, 2, ' ', 0)
+		for _, rel := range r.Releases {
+			v := productVersion(appleopensource.Product{Version: rel.Version, ComingSoon: rel.ComingSoon})
+			fmt.Fprintf(tbuf, "  %s\t%s\t%s\n", rel.Platform, rel.Release, v)
+		}
+		tbuf.Flush()
+	}
+
+	if len(r.Tarballs) > 0 {
+		buf.WriteString("\nTarball files:\n")
+		tbuf = tabwriter.NewWriter(&buf, 2, 1, 2, ' ', 0)
+		for _, t := range r.Tarballs {
+			size, cached := "-", ""
+			if t.Size > 0 {
+				size = formatByteSize(t.Size)
+			}
+			if t.Cached {
+				cached = "cached"
+			}
+			fmt.Fprintf(tbuf, "  %s\t%s\t%s\t%s\n", t.Version, size, cached, t.URL)
+		}
+		tbuf.Flush()
+	}
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+func (r *infoRecord) csvHeader() []string {
+	return []string{"name", "version", "url", "size", "cached", "digest"}
+}
+
+func (r *infoRecord) csvRows() [][]string {
+	rows := make([][]string, len(r.Tarballs))
+	for i, t := range r.Tarballs {
+		rows[i] = []string{r.Name, t.Version, t.URL, strconv.FormatInt(t.Size, 10), strconv.FormatBool(t.Cached), t.Digest}
+	}
+
+	return rows
+}
+
+// joinOrNone joins the list by the comma, or returns "none" if empty.
+func joinOrNone(list []string) string {
+	if len(list) == 0 {
+		return "none"
+	}
+
+	return strings.Join(list, ", ")
+}
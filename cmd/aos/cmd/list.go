@@ -8,10 +8,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
-	"fmt"
-	"io/ioutil"
-	"os"
-	"path/filepath"
+	"io"
 
 	"github.com/spf13/cobra"
 
@@ -23,7 +20,6 @@ type list struct {
 
 	ioStreams *IOStreams
 
-	cacheDir string
 	source   bool
 	tarballs bool
 }
@@ -33,19 +29,12 @@ func (a *aos) newCmdList(ctx context.Context, ioStreams *IOStreams) *cobra.Comma
 	list := &list{
 		aos:       a,
 		ioStreams: ioStreams,
-		cacheDir:  filepath.Join(cacheDir(), "list"),
 	}
 
 	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List all project available to opensource.apple.com.",
-		PreRunE: func(*cobra.Command, []string) error {
-			if _, err := os.Stat(list.cacheDir); err != nil && errors.Is(err, os.ErrNotExist) {
-				return os.MkdirAll(list.cacheDir, 0755)
-			}
-			return nil
-		},
-		RunE: func(*cobra.Command, []string) error { return list.run(ctx) },
+		RunE:  func(*cobra.Command, []string) error { return list.run(ctx) },
 	}
 
 	f := cmd.Flags()
@@ -55,26 +44,6 @@ func (a *aos) newCmdList(ctx context.Context, ioStreams *IOStreams) *cobra.Comma
 	return cmd
 }
 
-// index return the opensource.apple.com project index, and caches the HTML DOM tree into cacheDir.
-func (l *list) indexList(ctx context.Context, typ appleopensource.ResourceType) ([]byte, error) {
-	fname := filepath.Join(l.cacheDir, fmt.Sprintf("%s.html", typ))
-
-	if _, err := os.Stat(fname); err == nil && !l.noCache {
-		return ioutil.ReadFile(fname)
-	}
-
-	buf, err := appleopensource.IndexProject(typ)
-	if err != nil {
-		return nil, err
-	}
-
-	if err := ioutil.WriteFile(fname, buf, 0664); err != nil {
-		return nil, err
-	}
-
-	return buf, nil
-}
-
 func (l *list) run(ctx context.Context) error {
 	var mode appleopensource.ResourceType
 	switch {
@@ -88,7 +57,7 @@ func (l *list) run(ctx context.Context) error {
 		mode = appleopensource.TarballsResource // default is tarballs mode
 	}
 
-	index, err := l.indexList(ctx, mode)
+	index, err := l.client.IndexProject(ctx, mode)
 	if err != nil {
 		return err
 	}
@@ -98,13 +67,12 @@ func (l *list) run(ctx context.Context) error {
 		return err
 	}
 
-	var buf bytes.Buffer
-	for _, b := range list {
-		buf.WriteString(b.Name + "\n")
-	}
-	s := buf.String()[:buf.Len()-2]
-
-	_, err = fmt.Println(s)
-
-	return err
+	return l.printer.print(l.ioStreams.Out, productRecords(list), func(w io.Writer) error {
+		var buf bytes.Buffer
+		for _, b := range list {
+			buf.WriteString(b.Name + "\n")
+		}
+		_, err := w.Write(buf.Bytes())
+		return err
+	})
 }
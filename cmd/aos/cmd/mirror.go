@@ -0,0 +1,102 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource"
+)
+
+type mirror struct {
+	*aos
+
+	ioStreams *IOStreams
+
+	platform string
+	since    string
+	projects []string
+	jobs     int
+	rate     float64
+}
+
+// newCmdMirror creates the mirror command.
+func (a *aos) newCmdMirror(ctx context.Context, ioStreams *IOStreams) *cobra.Command {
+	mirror := &mirror{
+		aos:       a,
+		ioStreams: ioStreams,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "mirror <dir>",
+		Short: "Mirror the project index, the version lists and the tarballs into the directory",
+		Example: `  # mirror all versions of all projects, fetching only what is missing
+  aos mirror /srv/aos
+
+  # mirror the projects of the macOS releases since 10.12
+  aos mirror --platform macos --since 10.12 --rate 2 /srv/aos
+
+  # serve the mirror
+  aos serve --dir /srv/aos`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkArgs(cmd.Name(), cmd.Flags(), 1, exactArgs, args...); err != nil {
+				return err
+			}
+
+			return mirror.run(ctx, args[0])
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVar(&mirror.platform, "platform", "", "Mirror the projects in the releases of the platform (default all versions of all projects)")
+	f.StringVar(&mirror.since, "since", "", "Oldest release version of the --platform to mirror")
+	f.StringSliceVar(&mirror.projects, "projects", nil, "Projects to mirror (default all projects)")
+	f.IntVarP(&mirror.jobs, "jobs", "j", 0, "Number of the pages and the tarballs fetched in parallel (default the concurrency config)")
+	f.Float64Var(&mirror.rate, "rate", 0, "Maximum number of the pages and the tarballs fetched per second (default no limit)")
+
+	return cmd
+}
+
+func (m *mirror) run(ctx context.Context, dir string) error {
+	opts := &appleopensource.MirrorOptions{
+		Since:    m.since,
+		Projects: m.projects,
+		Jobs:     m.jobs,
+		Rate:     m.rate,
+	}
+	if m.platform != "" {
+		platform, err := appleopensource.ParsePlatform(m.platform)
+		if err != nil {
+			return err
+		}
+		opts.Platform = platform
+	}
+	if m.since != "" && m.platform == "" {
+		return errors.New("--since requires --platform")
+	}
+
+	res, err := m.client.Mirror(ctx, dir, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range res.Skipped {
+		fmt.Fprintf(m.ioStreams.ErrOut, "warning: skipped %s-%s: %s\n", s.Name, s.Version, s.Reason)
+	}
+
+	return m.printer.print(m.ioStreams.Out, res, func(w io.Writer) error {
+		var size int64
+		for _, t := range res.Fetched {
+			size += t.Size
+		}
+		_, err := fmt.Fprintf(w, "Fetched %d tarballs (%s) into %s, which has %d tarballs\n", len(res.Fetched), formatByteSize(size), dir, res.Tarballs)
+		return err
+	})
+}
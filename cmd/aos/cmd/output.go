@@ -0,0 +1,182 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource"
+)
+
+// output formats.
+const (
+	outputText     = "text"
+	outputJSON     = "json"
+	outputYAML     = "yaml"
+	outputCSV      = "csv"
+	outputMarkdown = "markdown"
+	outputTemplate = "template"
+)
+
+// csvRecords is implemented by the records which can be written as CSV.
+type csvRecords interface {
+	csvHeader() []string
+	csvRows() [][]string
+}
+
+// markdownWriter is implemented by the records which can be written as Markdown.
+type markdownWriter interface {
+	writeMarkdown(w io.Writer) error
+}
+
+// printer prints the command results in the --output format.
+//
+// The schema of each command results is documented in docs/output.md.
+type printer struct {
+	format string
+	tmpl   *template.Template
+}
+
+// newPrinter parses the --output flag value, and return the printer.
+func newPrinter(output string) (*printer, error) {
+	format, text := output, ""
+	if i := strings.IndexByte(output, '='); i >= 0 {
+		format, text = output[:i], output[i+1:]
+	}
+
+	p := &printer{format: format}
+	switch format {
+	case outputText, outputJSON, outputYAML, outputCSV, outputMarkdown:
+		if text != "" {
+			return nil, fmt.Errorf("--output %s does not take any argument", format)
+		}
+	case outputTemplate:
+		tmpl, err := template.New("output").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse --output template: %w", err)
+		}
+		p.tmpl = tmpl
+	default:
+		return nil, fmt.Errorf("unknown output format: %q, must be one of (text|json|yaml|csv|markdown|template=...)", output)
+	}
+
+	return p, nil
+}
+
+// print writes v in the printer format to w. The text format is written by the text function.
+func (p *printer) print(w io.Writer, v interface{}, text func(io.Writer) error) error {
+	switch p.format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+
+	case outputYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return enc.Close()
+
+	case outputCSV:
+		records, ok := v.(csvRecords)
+		if !ok {
+			return fmt.Errorf("csv output is not supported by this command")
+		}
+		cw := csv.NewWriter(w)
+		if err := cw.Write(records.csvHeader()); err != nil {
+			return err
+		}
+		if err := cw.WriteAll(records.csvRows()); err != nil {
+			return err
+		}
+		return cw.Error()
+
+	case outputMarkdown:
+		md, ok := v.(markdownWriter)
+		if !ok {
+			return fmt.Errorf("markdown output is not supported by this command")
+		}
+		return md.writeMarkdown(w)
+
+	case outputTemplate:
+		// executes the template against the JSON representation, so that the template uses the same field names as JSON
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var data interface{}
+		if err := json.Unmarshal(buf, &data); err != nil {
+			return err
+		}
+		return p.tmpl.Execute(w, data)
+
+	default:
+		return text(w)
+	}
+}
+
+// productRecords represents the records of the products, which is the output of list and versions commands.
+type productRecords []appleopensource.Product
+
+func (r productRecords) csvHeader() []string {
+	return []string{"name", "version", "updated", "coming_soon"}
+}
+
+func (r productRecords) csvRows() [][]string {
+	rows := make([][]string, len(r))
+	for i, p := range r {
+		rows[i] = []string{p.Name, p.Version, strconv.FormatBool(p.Updated), strconv.FormatBool(p.ComingSoon)}
+	}
+
+	return rows
+}
+
+// releaseRecord represents the record of the release, which is the output of release command.
+type releaseRecord struct {
+	Platform string         `json:"platform" yaml:"platform"`
+	Version  string         `json:"version" yaml:"version"`
+	Projects productRecords `json:"projects" yaml:"projects"`
+}
+
+func (r *releaseRecord) csvHeader() []string {
+	return append([]string{"platform", "release"}, r.Projects.csvHeader()...)
+}
+
+func (r *releaseRecord) writeMarkdown(w io.Writer) error {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "## %s %s\n\n", r.Platform, r.Version)
+	buf.WriteString("| Project | Version | Updated |\n")
+	buf.WriteString("|---------|---------|---------|\n")
+	for _, p := range r.Projects {
+		var updated string
+		if p.Updated {
+			updated = "\u2022"
+		}
+		fmt.Fprintf(&buf, "| %s | %s | %s |\n", p.Name, productVersion(p), updated)
+	}
+
+	_, err := io.WriteString(w, buf.String())
+
+	return err
+}
+
+func (r *releaseRecord) csvRows() [][]string {
+	rows := r.Projects.csvRows()
+	for i, row := range rows {
+		rows[i] = append([]string{r.Platform, r.Version}, row...)
+	}
+
+	return rows
+}
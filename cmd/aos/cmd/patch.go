@@ -0,0 +1,412 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource"
+)
+
+type patch struct {
+	*aos
+
+	ioStreams *IOStreams
+
+	patchesDir string
+	fuzz       int
+	check      bool
+	against    string
+}
+
+// newCmdPatch creates the patch command.
+func (a *aos) newCmdPatch(ctx context.Context, ioStreams *IOStreams) *cobra.Command {
+	patch := &patch{
+		aos:       a,
+		ioStreams: ioStreams,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "patch",
+		Short: "Manage the quilt style series of the patches of the product version",
+		Long: `Manage the quilt style series of the patches of the product version.
+
+The series of the product version is the "series" file in the <patches>/<product>-<version> directory,
+which lists the patch files in the directory in the applied order, such as patches/xnu-4903.221.2/series.`,
+	}
+	cmd.PersistentFlags().StringVar(&patch.patchesDir, "patches", "patches", "Directory of the series of the product versions")
+
+	cmd.AddCommand(patch.cmdApply(ctx))
+	cmd.AddCommand(patch.cmdList(ctx))
+	cmd.AddCommand(patch.cmdRebase(ctx))
+	cmd.AddCommand(patch.cmdRefresh(ctx))
+
+	return cmd
+}
+
+// series reads the series of the product version.
+func (p *patch) series(product, version string) (*appleopensource.Series, error) {
+	dir := appleopensource.SeriesDir(p.patchesDir, appleopensource.Product{Name: product, Version: version})
+	s, err := appleopensource.ReadSeries(dir)
+	if err != nil {
+		return nil, fmt.Errorf("no series of %s-%s: %w", product, version, err)
+	}
+
+	return s, nil
+}
+
+func (p *patch) cmdList(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list product version",
+		Short: "List the patches of the series, and check whether they apply",
+		Example: `  # check whether the series applies to the pristine sources
+  aos patch list --check xnu 4903.221.2
+
+  # check whether the series still applies to the newer version
+  aos patch list --against 4903.231.4 xnu 4903.221.2`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkArgs(cmd.Name(), cmd.Flags(), 2, exactArgs, args...); err != nil {
+				return err
+			}
+			return p.runList(ctx, args[0], args[1])
+		},
+	}
+	f := cmd.Flags()
+	f.BoolVar(&p.check, "check", false, "Apply the series to the pristine sources, and report the offset, the fuzz and the failure of each patch")
+	f.StringVar(&p.against, "against", "", "Check against the pristine sources of the version instead of the version of the series (implies --check)")
+	f.IntVarP(&p.fuzz, "fuzz", "F", appleopensource.DefaultFuzz, "Maximum number of the context lines ignored to apply the hunk")
+
+	return cmd
+}
+
+func (p *patch) runList(ctx context.Context, product, version string) error {
+	s, err := p.series(product, version)
+	if err != nil {
+		return err
+	}
+
+	records, err := newSeriesRecords(s)
+	if err != nil {
+		return err
+	}
+
+	var applyErr error
+	if p.check || p.against != "" {
+		target := appleopensource.Product{Name: product, Version: version}
+		if p.against != "" {
+			target.Version = p.against
+		}
+
+		results, err := p.client.CheckSeries(ctx, s, target, p.fuzz)
+		var perr *appleopensource.PatchError
+		if err != nil && !errors.As(err, &perr) {
+			return err
+		}
+		records.setStatus(results, err != nil)
+		if err != nil {
+			applyErr = fmt.Errorf("the series does not apply to %s-%s: %w", target.Name, target.Version, err)
+		}
+	}
+
+	if err := p.printer.print(p.ioStreams.Out, records, records.writeText); err != nil {
+		return err
+	}
+
+	return applyErr
+}
+
+func (p *patch) cmdApply(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apply product version [dir]",
+		Short: "Extract the pristine sources to dir, and apply the series",
+		Long: `Extract the pristine sources of the product version to dir, and apply the patches of the series in order.
+
+The default dir is <product>-<version>, which must not exist. The offset and the fuzz of the hunks are
+reported. apply stops at the patch which does not apply, and leaves dir patched by the preceding patches.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkArgs(cmd.Name(), cmd.Flags(), 2, minArgs, args...); err != nil {
+				return err
+			}
+			if err := checkArgs(cmd.Name(), cmd.Flags(), 3, maxArgs, args...); err != nil {
+				return err
+			}
+
+			dir := args[0] + "-" + args[1]
+			if len(args) == 3 {
+				dir = args[2]
+			}
+			return p.runApply(ctx, args[0], args[1], dir)
+		},
+	}
+	cmd.Flags().IntVarP(&p.fuzz, "fuzz", "F", appleopensource.DefaultFuzz, "Maximum number of the context lines ignored to apply the hunk")
+
+	return cmd
+}
+
+func (p *patch) runApply(ctx context.Context, product, version, dir string) error {
+	s, err := p.series(product, version)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return fmt.Errorf("%s already exists", dir)
+	}
+
+	if err := p.client.Extract(ctx, appleopensource.Product{Name: product, Version: version}, dir); err != nil {
+		return err
+	}
+
+	results, applyErr := s.Apply(dir, p.fuzz)
+	records := hunkRecords{}
+	for _, r := range results {
+		for _, h := range r.Hunks {
+			records = append(records, hunkRecord{Patch: r.Patch, HunkResult: h})
+		}
+	}
+
+	err = p.printer.print(p.ioStreams.Out, records, func(w io.Writer) error {
+		var buf bytes.Buffer
+		for _, r := range results {
+			fmt.Fprintf(&buf, "Applied %s\n", r.Patch)
+			for _, h := range r.Hunks {
+				if h.Offset != 0 || h.Fuzz != 0 {
+					fmt.Fprintf(&buf, "  %s: hunk #%d succeeded with offset %d, fuzz %d\n", h.Path, h.Hunk, h.Offset, h.Fuzz)
+				}
+			}
+		}
+		_, err := w.Write(buf.Bytes())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return applyErr
+}
+
+func (p *patch) cmdRefresh(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "refresh product version",
+		Short: "Regenerate the patches of the series so that they apply without the offset and the fuzz",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkArgs(cmd.Name(), cmd.Flags(), 2, exactArgs, args...); err != nil {
+				return err
+			}
+			return p.runRefresh(ctx, args[0], args[1])
+		},
+	}
+
+	return cmd
+}
+
+func (p *patch) runRefresh(ctx context.Context, product, version string) error {
+	s, err := p.series(product, version)
+	if err != nil {
+		return err
+	}
+
+	refreshed, err := p.client.RefreshSeries(ctx, s, appleopensource.Product{Name: product, Version: version})
+	if err != nil {
+		return err
+	}
+
+	records, err := newSeriesRecords(s)
+	if err != nil {
+		return err
+	}
+	for i := range records {
+		records[i].Status = "unchanged"
+		if containsString(refreshed, records[i].Patch) {
+			records[i].Status = "refreshed"
+		}
+	}
+
+	return p.printer.print(p.ioStreams.Out, records, records.writeText)
+}
+
+func (p *patch) cmdRebase(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rebase product old-version new-version",
+		Short: "Rebase the series of the old version to the new version by the three-way merge",
+		Long: `Rebase the series of the old version to the new version by the three-way merge against the pristine
+sources of the old version, and write the rebased series of the new version.
+
+Nothing is written if any patch conflicts with the new version.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkArgs(cmd.Name(), cmd.Flags(), 3, exactArgs, args...); err != nil {
+				return err
+			}
+			return p.runRebase(ctx, args[0], args[1], args[2])
+		},
+	}
+
+	return cmd
+}
+
+func (p *patch) runRebase(ctx context.Context, product, oldVersion, newVersion string) error {
+	s, err := p.series(product, oldVersion)
+	if err != nil {
+		return err
+	}
+
+	from := appleopensource.Product{Name: product, Version: oldVersion}
+	to := appleopensource.Product{Name: product, Version: newVersion}
+	results, rebaseErr := p.client.RebaseSeries(ctx, s, from, to, appleopensource.SeriesDir(p.patchesDir, to))
+	if rebaseErr != nil && !errors.Is(rebaseErr, appleopensource.ErrRebaseConflict) {
+		return rebaseErr
+	}
+
+	records := rebaseRecords(results)
+	err = p.printer.print(p.ioStreams.Out, records, func(w io.Writer) error {
+		var buf bytes.Buffer
+		tbuf := tabwriter.NewWriter(&buf, 2, 1, 2, ' ', 0)
+		for _, r := range records {
+			switch {
+			case len(r.Conflicts) > 0:
+				fmt.Fprintf(tbuf, "%s\tconflict\t%s\n", r.Patch, strings.Join(r.Conflicts, " "))
+			case len(r.Merged) > 0:
+				fmt.Fprintf(tbuf, "%s\tmerged\t%s\n", r.Patch, strings.Join(r.Merged, " "))
+			default:
+				fmt.Fprintf(tbuf, "%s\tclean\t\n", r.Patch)
+			}
+		}
+		tbuf.Flush()
+
+		_, err := w.Write(buf.Bytes())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return rebaseErr
+}
+
+// seriesRecord represents the record of the patch of the series, which is the output of patch list and
+// patch refresh commands.
+type seriesRecord struct {
+	Patch  string   `json:"patch" yaml:"patch"`
+	Strip  int      `json:"strip" yaml:"strip"`
+	Files  []string `json:"files" yaml:"files"`
+	Hunks  int      `json:"hunks" yaml:"hunks"`
+	Status string   `json:"status,omitempty" yaml:"status,omitempty"`
+}
+
+type seriesRecords []seriesRecord
+
+// newSeriesRecords returns the records of the patches of s.
+func newSeriesRecords(s *appleopensource.Series) (seriesRecords, error) {
+	records := make(seriesRecords, len(s.Patches))
+	for i, sp := range s.Patches {
+		p, err := s.ReadPatch(sp)
+		if err != nil {
+			return nil, err
+		}
+
+		r := seriesRecord{Patch: sp.Name, Strip: sp.Strip, Files: []string{}}
+		for _, fp := range p.Files {
+			r.Files = append(r.Files, fp.Path(sp.Strip))
+			r.Hunks += len(fp.Hunks)
+		}
+		records[i] = r
+	}
+
+	return records, nil
+}
+
+// setStatus sets the status of the records from the results of applying the series. If failed, the patch
+// next to the results is the failed patch, and the following patches are skipped.
+func (r seriesRecords) setStatus(results []appleopensource.SeriesResult, failed bool) {
+	for i := range r {
+		switch {
+		case i < len(results):
+			r[i].Status = "ok"
+			for _, h := range results[i].Hunks {
+				switch {
+				case h.Fuzz != 0:
+					r[i].Status = "fuzz"
+				case h.Offset != 0 && r[i].Status == "ok":
+					r[i].Status = "offset"
+				}
+			}
+		case i == len(results) && failed:
+			r[i].Status = "failed"
+		default:
+			r[i].Status = "skipped"
+		}
+	}
+}
+
+func (r seriesRecords) writeText(w io.Writer) error {
+	var buf bytes.Buffer
+	tbuf := tabwriter.NewWriter(&buf, 2, 1, 2, ' ', 0)
+	for _, s := range r {
+		fmt.Fprintf(tbuf, "%s\t%d files\t%d hunks\t%s\n", s.Patch, len(s.Files), s.Hunks, s.Status)
+	}
+	tbuf.Flush()
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (r seriesRecords) csvHeader() []string {
+	return []string{"patch", "strip", "files", "hunks", "status"}
+}
+
+func (r seriesRecords) csvRows() [][]string {
+	rows := make([][]string, len(r))
+	for i, s := range r {
+		rows[i] = []string{s.Patch, strconv.Itoa(s.Strip), strings.Join(s.Files, " "), strconv.Itoa(s.Hunks), s.Status}
+	}
+
+	return rows
+}
+
+// hunkRecord represents the record of the applied hunk, which is the output of patch apply command.
+type hunkRecord struct {
+	Patch                      string `json:"patch" yaml:"patch"`
+	appleopensource.HunkResult `yaml:",inline"`
+}
+
+type hunkRecords []hunkRecord
+
+func (r hunkRecords) csvHeader() []string {
+	return []string{"patch", "path", "hunk", "offset", "fuzz"}
+}
+
+func (r hunkRecords) csvRows() [][]string {
+	rows := make([][]string, len(r))
+	for i, h := range r {
+		rows[i] = []string{h.Patch, h.Path, strconv.Itoa(h.Hunk), strconv.Itoa(h.Offset), strconv.Itoa(h.Fuzz)}
+	}
+
+	return rows
+}
+
+// rebaseRecords represents the records of the rebased patches, which is the output of patch rebase command.
+type rebaseRecords []appleopensource.RebasedPatch
+
+func (r rebaseRecords) csvHeader() []string {
+	return []string{"patch", "merged", "conflicts"}
+}
+
+func (r rebaseRecords) csvRows() [][]string {
+	rows := make([][]string, len(r))
+	for i, p := range r {
+		rows[i] = []string{p.Patch, strings.Join(p.Merged, " "), strings.Join(p.Conflicts, " ")}
+	}
+
+	return rows
+}
@@ -8,11 +8,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"io/ioutil"
-	"log"
-	"os"
-	"path/filepath"
-	"strings"
+	"io"
 	"text/tabwriter"
 
 	"github.com/spf13/cobra"
@@ -47,6 +43,7 @@ func (a *aos) newCmdRelease(ctx context.Context, ioStreams *IOStreams) *cobra.Co
 	cmd.AddCommand(release.cmdXCode(ctx))
 	cmd.AddCommand(release.cmdIOS(ctx))
 	cmd.AddCommand(release.cmdServer(ctx))
+	cmd.AddCommand(release.cmdDiff(ctx))
 
 	return cmd
 }
@@ -95,70 +92,55 @@ func (r *release) cmdServer(ctx context.Context) *cobra.Command {
 	}
 }
 
-func (r *release) indexRelease(ctx context.Context, platform appleopensource.Platform, version string) ([]byte, error) {
-	var releaseCachedir = filepath.Join(cacheDir(), "release")
-
-	if _, err := os.Stat(releaseCachedir); err != nil && os.IsNotExist(err) {
-		if err := os.MkdirAll(releaseCachedir, 0700); err != nil {
-			return nil, err
-		}
-	}
-
-	fname := filepath.Join(releaseCachedir, fmt.Sprintf("%s-%s.html", platform, strings.Replace(version, ".", "", -1)))
-
-	if _, err := os.Stat(fname); err == nil && !r.noCache {
-		return ioutil.ReadFile(fname)
-	}
-
-	buf, err := appleopensource.IndexRelease(platform, version)
+// listRelease returns the projects of the platform release version.
+func (r *release) listRelease(ctx context.Context, platform appleopensource.Platform, version string) ([]appleopensource.Product, error) {
+	release, err := r.client.IndexRelease(ctx, platform, version)
 	if err != nil {
 		return nil, err
 	}
-	if err := ioutil.WriteFile(fname, buf, 0664); err != nil {
-		return nil, err
-	}
 
-	return buf, nil
+	return appleopensource.ListRelease(release)
 }
 
 func (r *release) runRelease(ctx context.Context, platform appleopensource.Platform, version string) error {
-	if !r.quiet {
-		fmt.Printf("Release version: %s\n", version)
-	}
-
-	release, err := r.indexRelease(ctx, platform, version)
+	list, err := r.listRelease(ctx, platform, version)
 	if err != nil {
-		log.Fatal(err.Error())
+		return suggestRelease(err, platform, version)
 	}
 
-	list, err := appleopensource.ListRelease(release)
-	if err != nil {
-		log.Fatal(err.Error())
+	record := &releaseRecord{
+		Platform: platform.String(),
+		Version:  version,
+		Projects: productRecords(list),
 	}
 
-	var buf bytes.Buffer
-	tbuf := tabwriter.NewWriter(&buf, 2, 1, 2, ' ', 0)
-
-	for _, b := range list {
+	return r.printer.print(r.ioStreams.Out, record, func(w io.Writer) error {
+		var buf bytes.Buffer
 		if !r.quiet {
-			if b.Updated {
-				tbuf.Write([]byte("\u2022 ")) // u2022: •
-			} else {
-				tbuf.Write([]byte("  "))
-			}
+			fmt.Fprintf(&buf, "Release version: %s\n", version)
 		}
-		tbuf.Write([]byte(fmt.Sprintf("%s\t%s", b.Name, b.Version)))
-		if !r.quiet {
-			tbuf.Write([]byte("\t"))
-			if b.ComingSoon {
-				tbuf.Write([]byte(appleopensource.ComingSoon))
+
+		tbuf := tabwriter.NewWriter(&buf, 2, 1, 2, ' ', 0)
+		for _, b := range list {
+			if !r.quiet {
+				if b.Updated {
+					tbuf.Write([]byte("\u2022 ")) // u2022: •
+				} else {
+					tbuf.Write([]byte("  "))
+				}
+			}
+			tbuf.Write([]byte(fmt.Sprintf("%s\t%s", b.Name, b.Version)))
+			if !r.quiet {
+				tbuf.Write([]byte("\t"))
+				if b.ComingSoon {
+					tbuf.Write([]byte(appleopensource.ComingSoon))
+				}
 			}
+			tbuf.Write([]byte("\n"))
 		}
-		tbuf.Write([]byte("\n"))
-	}
-	tbuf.Flush()
-
-	fmt.Printf(buf.String())
+		tbuf.Flush()
 
-	return nil
+		_, err := w.Write(buf.Bytes())
+		return err
+	})
 }
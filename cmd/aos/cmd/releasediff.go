@@ -0,0 +1,160 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource"
+)
+
+// releaseSpec represents a platform release version.
+type releaseSpec struct {
+	platform appleopensource.Platform
+	version  string
+}
+
+func (r *release) cmdDiff(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff platform old-version [platform] new-version",
+		Short: "Compare the projects of two releases",
+		Example: `  aos release diff macos 10.14.1 10.14.2
+  aos release diff macos 10.14.1 ios 12.1 -o markdown`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkArgs(cmd.Name(), cmd.Flags(), 3, minArgs, args...); err != nil {
+				return err
+			}
+			if err := checkArgs(cmd.Name(), cmd.Flags(), 4, maxArgs, args...); err != nil {
+				return err
+			}
+
+			oldPlatform, err := appleopensource.ParsePlatform(args[0])
+			if err != nil {
+				return err
+			}
+			newPlatform := oldPlatform
+			if len(args) == 4 {
+				if newPlatform, err = appleopensource.ParsePlatform(args[2]); err != nil {
+					return err
+				}
+			}
+
+			oldSpec := releaseSpec{platform: oldPlatform, version: args[1]}
+			newSpec := releaseSpec{platform: newPlatform, version: args[len(args)-1]}
+			return r.runDiff(ctx, oldSpec, newSpec)
+		},
+	}
+
+	return cmd
+}
+
+func (r *release) runDiff(ctx context.Context, oldSpec, newSpec releaseSpec) error {
+	oldList, oldErr := r.listRelease(ctx, oldSpec.platform, oldSpec.version)
+	newList, newErr := r.listRelease(ctx, newSpec.platform, newSpec.version)
+	if err := appleopensource.JoinNotCached(oldErr, newErr); err != nil {
+		return err
+	}
+
+	record := &releaseDiffRecord{
+		Old:         releaseRef{Platform: oldSpec.platform.String(), Version: oldSpec.version},
+		New:         releaseRef{Platform: newSpec.platform.String(), Version: newSpec.version},
+		ReleaseDiff: appleopensource.DiffReleases(oldList, newList),
+	}
+
+	return r.printer.print(r.ioStreams.Out, record, record.writeText)
+}
+
+// productVersion formats the version of p with the coming soon state.
+func productVersion(p appleopensource.Product) string {
+	if p.ComingSoon {
+		return p.Version + " " + appleopensource.ComingSoon
+	}
+
+	return p.Version
+}
+
+// releaseRef represents a reference to the platform release.
+type releaseRef struct {
+	Platform string `json:"platform" yaml:"platform"`
+	Version  string `json:"version" yaml:"version"`
+}
+
+func (r releaseRef) String() string {
+	return r.Platform + " " + r.Version
+}
+
+// releaseDiffRecord represents the record of the release diff, which is the output of release diff command.
+type releaseDiffRecord struct {
+	Old                          releaseRef `json:"old" yaml:"old"`
+	New                          releaseRef `json:"new" yaml:"new"`
+	*appleopensource.ReleaseDiff `yaml:",inline"`
+}
+
+func (r *releaseDiffRecord) writeText(w io.Writer) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", r.Old, r.New)
+
+	tbuf := tabwriter.NewWriter(&buf, 2, 1, 2, ' ', 0)
+	for _, p := range r.Added {
+		fmt.Fprintf(tbuf, "+\t%s\t%s\n", p.Name, productVersion(p))
+	}
+	for _, p := range r.Removed {
+		fmt.Fprintf(tbuf, "-\t%s\t%s\n", p.Name, productVersion(p))
+	}
+	for _, c := range r.Changed {
+		fmt.Fprintf(tbuf, "~\t%s\t%s -> %s\n", c.Name, productVersion(c.Old), productVersion(c.New))
+	}
+	tbuf.Flush()
+
+	fmt.Fprintf(&buf, "%d added, %d removed, %d changed\n", len(r.Added), len(r.Removed), len(r.Changed))
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+func (r *releaseDiffRecord) writeMarkdown(w io.Writer) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "## %s → %s\n\n", r.Old, r.New)
+
+	if r.Empty() {
+		buf.WriteString("No changes.\n")
+	} else {
+		buf.WriteString("| Change | Project | Old | New |\n")
+		buf.WriteString("|--------|---------|-----|-----|\n")
+		for _, row := range r.csvRows() {
+			fmt.Fprintf(&buf, "| %s | %s | %s | %s |\n", row[0], row[1], row[2], row[3])
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+func (r *releaseDiffRecord) csvHeader() []string {
+	return []string{"change", "name", "old_version", "new_version"}
+}
+
+func (r *releaseDiffRecord) csvRows() [][]string {
+	var rows [][]string
+	for _, p := range r.Added {
+		rows = append(rows, []string{"added", p.Name, "", productVersion(p)})
+	}
+	for _, p := range r.Removed {
+		rows = append(rows, []string{"removed", p.Name, productVersion(p), ""})
+	}
+	for _, c := range r.Changed {
+		rows = append(rows, []string{"changed", c.Name, productVersion(c.Old), productVersion(c.New)})
+	}
+
+	return rows
+}
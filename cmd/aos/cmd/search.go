@@ -0,0 +1,240 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource"
+)
+
+type search struct {
+	*aos
+
+	ioStreams *IOStreams
+
+	query       string
+	source      bool
+	latest      bool
+	limit       int
+	maxDistance int
+}
+
+// newCmdSearch creates the search command.
+func (a *aos) newCmdSearch(ctx context.Context, ioStreams *IOStreams) *cobra.Command {
+	search := &search{
+		aos:       a,
+		ioStreams: ioStreams,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "search query",
+		Short: "Search the projects by the case-insensitive, substring and fuzzy match of the name",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkArgs(cmd.Name(), cmd.Flags(), 1, exactArgs, args...); err != nil {
+				return err
+			}
+
+			search.query = args[0]
+			return search.run(ctx)
+		},
+	}
+
+	f := cmd.Flags()
+	f.BoolVarP(&search.source, "source", "s", false, "Search the source resources instead of the tarballs")
+	f.BoolVarP(&search.latest, "latest", "l", false, "Show the latest version of the matched projects")
+	f.IntVarP(&search.limit, "limit", "n", 0, "Maximum number of the results (default no limit)")
+	f.IntVar(&search.maxDistance, "max-distance", 0, "Maximum edit distance of the fuzzy match (default one per four characters of the query)")
+
+	return cmd
+}
+
+func (s *search) run(ctx context.Context) error {
+	typ := appleopensource.TarballsResource
+	if s.source {
+		typ = appleopensource.SourceResource
+	}
+
+	matches, err := s.client.SearchProject(ctx, typ, s.query, s.maxDistance)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("no projects match %q", s.query)
+	}
+	if s.limit > 0 && len(matches) > s.limit {
+		matches = matches[:s.limit]
+	}
+
+	records := make(searchRecords, len(matches))
+	for i, m := range matches {
+		records[i] = searchRecord{Name: m.Name, Match: m.Kind.String(), Distance: m.Distance}
+	}
+	if s.latest {
+		if err := s.fillLatest(ctx, typ, records); err != nil {
+			return err
+		}
+	}
+
+	return s.printer.print(s.ioStreams.Out, records, func(w io.Writer) error {
+		tw := tabwriter.NewWriter(w, 2, 1, 2, ' ', 0)
+		for _, r := range records {
+			if s.latest {
+				fmt.Fprintf(tw, "%s\t%s\n", r.Name, r.Latest)
+				continue
+			}
+			fmt.Fprintln(tw, r.Name)
+		}
+		return tw.Flush()
+	})
+}
+
+// fillLatest fills the latest versions of the records concurrently.
+func (s *search) fillLatest(ctx context.Context, typ appleopensource.ResourceType, records searchRecords) error {
+	n := s.config.Concurrency
+	if n < 1 {
+		n = 1
+	}
+	sem := semaphore.NewWeighted(int64(n))
+	eg, ctx := errgroup.WithContext(ctx)
+	for i := range records {
+		r := &records[i]
+		eg.Go(func() error {
+			if err := sem.Acquire(ctx, 1); err != nil {
+				return err
+			}
+			defer sem.Release(1)
+
+			latest, err := s.client.LatestVersion(ctx, r.Name, typ)
+			switch {
+			case err == nil:
+				r.Latest = latest
+			case errors.Is(err, appleopensource.ErrNotFound), errors.Is(err, appleopensource.ErrNoVersion):
+				// the listed project which has no version page
+			default:
+				return err
+			}
+			return nil
+		})
+	}
+
+	return eg.Wait()
+}
+
+// searchRecord represents the record of the matched project.
+type searchRecord struct {
+	Name     string `json:"name" yaml:"name"`
+	Match    string `json:"match" yaml:"match"`
+	Distance int    `json:"distance" yaml:"distance"`
+	Latest   string `json:"latest,omitempty" yaml:"latest,omitempty"`
+}
+
+// searchRecords represents the records of the search command.
+type searchRecords []searchRecord
+
+func (r searchRecords) csvHeader() []string {
+	return []string{"name", "match", "distance", "latest"}
+}
+
+func (r searchRecords) csvRows() [][]string {
+	rows := make([][]string, len(r))
+	for i, m := range r {
+		rows[i] = []string{m.Name, m.Match, strconv.Itoa(m.Distance), m.Latest}
+	}
+
+	return rows
+}
+
+// maxSuggestions is the maximum number of the "did you mean" suggestions.
+const maxSuggestions = 3
+
+// suggestError represents the error with the "did you mean" suggestions.
+type suggestError struct {
+	err         error
+	suggestions []string
+}
+
+// Error implements a error interface.
+func (e *suggestError) Error() string {
+	return e.err.Error() + "\n\nDid you mean this?\n\t" + strings.Join(e.suggestions, "\n\t") + "\n"
+}
+
+// Unwrap returns the underlying error.
+func (e *suggestError) Unwrap() error {
+	return e.err
+}
+
+// suggestProduct adds the similar project names, or the similar versions if the product exists, to the err
+// if the err is the not found error.
+func (a *aos) suggestProduct(ctx context.Context, err error, typ appleopensource.ResourceType, product string, versions ...string) error {
+	if !errors.Is(err, appleopensource.ErrNotFound) {
+		return err
+	}
+
+	catalog := appleopensource.NewCatalog(a.client, typ)
+	names, lerr := catalog.Projects(ctx)
+	if lerr != nil {
+		return err
+	}
+	if !containsString(names, product) {
+		if suggestions := appleopensource.Suggest(names, product, maxSuggestions); len(suggestions) > 0 {
+			return &suggestError{err: err, suggestions: suggestions}
+		}
+		return err
+	}
+
+	known, lerr := catalog.Versions(ctx, product)
+	if lerr != nil {
+		return err
+	}
+	var suggestions []string
+	for _, v := range versions {
+		if containsString(known, v) {
+			continue
+		}
+		for _, s := range appleopensource.Suggest(known, v, maxSuggestions) {
+			suggestions = append(suggestions, product+" "+s)
+		}
+	}
+	if len(suggestions) > 0 {
+		return &suggestError{err: err, suggestions: suggestions}
+	}
+
+	return err
+}
+
+// suggestRelease adds the similar known release versions of the platform to the err if the err is the not
+// found error.
+func suggestRelease(err error, platform appleopensource.Platform, version string) error {
+	if !errors.Is(err, appleopensource.ErrNotFound) || int(platform) >= len(appleopensource.KnownRelease) {
+		return err
+	}
+
+	if suggestions := appleopensource.Suggest(appleopensource.KnownRelease[platform], version, maxSuggestions); len(suggestions) > 0 {
+		return &suggestError{err: err, suggestions: suggestions}
+	}
+
+	return err
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,109 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource"
+)
+
+// shutdownTimeout is the time to wait the active requests on the shutdown of the serve command.
+const shutdownTimeout = 5 * time.Second
+
+type serve struct {
+	*aos
+
+	ioStreams *IOStreams
+
+	addr string
+	dir  string
+}
+
+// newCmdServe creates the serve command.
+func (a *aos) newCmdServe(ctx context.Context, ioStreams *IOStreams) *cobra.Command {
+	serve := &serve{
+		aos:       a,
+		ioStreams: ioStreams,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the cache over HTTP as an opensource.apple.com mirror",
+		Example: `  # serve the cache to the network
+  aos serve --addr :8080
+
+  # use the mirror from the other machine
+  aos --base-url http://mirror.local:8080/ versions xnu
+
+  # serve the directory written by the mirror command instead of the cache
+  aos serve --dir /srv/aos`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkArgs(cmd.Name(), cmd.Flags(), 0, exactArgs, args...); err != nil {
+				return err
+			}
+
+			return serve.run(ctx)
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVar(&serve.addr, "addr", ":8080", "TCP address to listen on")
+	f.StringVar(&serve.dir, "dir", "", "Serve the mirror directory instead of the cache")
+
+	return cmd
+}
+
+func (s *serve) run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	var h http.Handler = appleopensource.NewCacheServer(s.client)
+	what := "the cache"
+	if s.dir != "" {
+		if _, err := os.Stat(s.dir); err != nil {
+			return err
+		}
+		h, what = http.FileServer(http.Dir(s.dir)), s.dir
+	}
+
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{Handler: h}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(ln)
+	}()
+	fmt.Fprintf(s.ioStreams.ErrOut, "Serving %s on http://%s/\n", what, ln.Addr())
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	sctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(sctx); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource"
+)
+
+type sync struct {
+	*aos
+
+	ioStreams *IOStreams
+
+	manifest string
+	dryRun   bool
+}
+
+// newCmdSync creates the sync command.
+func (a *aos) newCmdSync(ctx context.Context, ioStreams *IOStreams) *cobra.Command {
+	sync := &sync{
+		aos:       a,
+		ioStreams: ioStreams,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Fetch, verify and extract the projects declared in the " + appleopensource.ManifestName + " manifest",
+		Example: `  # extract the projects into the dir of aos.yaml, updating only what changed
+  aos sync
+
+  # show what would change
+  aos sync -f deps/aos.yaml --dry-run`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkArgs(cmd.Name(), cmd.Flags(), 0, exactArgs, args...); err != nil {
+				return err
+			}
+
+			return sync.run(ctx)
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&sync.manifest, "file", "f", appleopensource.ManifestName, "Path of the manifest file")
+	f.BoolVarP(&sync.dryRun, "dry-run", "n", false, "Show the actions without fetching, extracting and removing anything")
+
+	return cmd
+}
+
+func (s *sync) run(ctx context.Context) error {
+	m, err := appleopensource.LoadManifest(s.manifest)
+	if err != nil {
+		return err
+	}
+
+	results, err := s.client.Sync(ctx, m, &appleopensource.SyncOptions{DryRun: s.dryRun})
+	if err != nil {
+		return err
+	}
+
+	records := syncRecords(results)
+	if records == nil {
+		records = syncRecords{}
+	}
+
+	return s.printer.print(s.ioStreams.Out, records, func(w io.Writer) error {
+		var buf bytes.Buffer
+		tbuf := tabwriter.NewWriter(&buf, 2, 1, 2, ' ', 0)
+		for _, r := range records {
+			fmt.Fprintf(tbuf, "%s\t%s\t%s\t%s\n", r.Action, r.Name, r.Version, r.Dir)
+		}
+		tbuf.Flush()
+
+		_, err := w.Write(buf.Bytes())
+		return err
+	})
+}
+
+// syncRecords represents the records of the synced projects, which is the output of sync command.
+type syncRecords []appleopensource.SyncedProject
+
+func (r syncRecords) csvHeader() []string {
+	return []string{"name", "version", "dir", "sha256", "action"}
+}
+
+func (r syncRecords) csvRows() [][]string {
+	rows := make([][]string, len(r))
+	for i, p := range r {
+		rows[i] = []string{p.Name, p.Version, p.Dir, p.SHA256, p.Action.String()}
+	}
+
+	return rows
+}
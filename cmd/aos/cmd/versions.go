@@ -8,9 +8,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"path/filepath"
+	"io"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -51,33 +49,6 @@ func (a *aos) newCmdVersions(ctx context.Context, ioStreams *IOStreams) *cobra.C
 	return cmd
 }
 
-// index return the opensource.apple.com project index, and caches the HTML DOM tree into cacheDir.
-func (v *versions) indexVersion(project string, typ appleopensource.ResourceType) ([]byte, error) {
-	versionsCachedir := filepath.Join(cacheDir(), typ.String())
-
-	if _, err := os.Stat(versionsCachedir); err != nil && errors.Is(err, os.ErrNotExist) {
-		if err := os.MkdirAll(versionsCachedir, 0700); err != nil {
-			return nil, err
-		}
-	}
-
-	fname := filepath.Join(versionsCachedir, fmt.Sprintf("%s.html", project))
-
-	if _, err := os.Stat(fname); err == nil && !v.noCache {
-		return ioutil.ReadFile(fname)
-	}
-
-	buf, err := appleopensource.IndexVersion(project, typ)
-	if err != nil {
-		return nil, err
-	}
-	if err := ioutil.WriteFile(fname, buf, 0664); err != nil {
-		return nil, err
-	}
-
-	return buf, nil
-}
-
 func (v *versions) runVersions(ctx context.Context) error {
 	mode := appleopensource.TarballsResource
 	switch {
@@ -89,9 +60,9 @@ func (v *versions) runVersions(ctx context.Context) error {
 		return errors.New("-source and -tarballs flags are must be one")
 	}
 
-	buf, err := v.indexVersion(v.product, mode)
+	buf, err := v.client.IndexVersion(ctx, v.product, mode)
 	if err != nil {
-		return err
+		return v.suggestProduct(ctx, err, mode, v.product)
 	}
 
 	list, err := appleopensource.ListVersions(buf)
@@ -99,7 +70,13 @@ func (v *versions) runVersions(ctx context.Context) error {
 		return err
 	}
 
-	_, err = fmt.Println(strings.Join(list, "\n"))
+	records := make(productRecords, len(list))
+	for i, version := range list {
+		records[i] = appleopensource.Product{Name: v.product, Version: version}
+	}
 
-	return err
+	return v.printer.print(v.ioStreams.Out, records, func(w io.Writer) error {
+		_, err := fmt.Fprintln(w, strings.Join(list, "\n"))
+		return err
+	})
 }
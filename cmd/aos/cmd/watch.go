@@ -0,0 +1,158 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource"
+)
+
+// defaultWatchInterval is the default interval of the checks of the watch command.
+const defaultWatchInterval = 6 * time.Hour
+
+type watch struct {
+	*aos
+
+	ioStreams *IOStreams
+
+	projects  []string
+	platforms []string
+	interval  time.Duration
+	state     string
+	exec      string
+	webhook   string
+	once      bool
+}
+
+// newCmdWatch creates the watch command.
+func (a *aos) newCmdWatch(ctx context.Context, ioStreams *IOStreams) *cobra.Command {
+	watch := &watch{
+		aos:       a,
+		ioStreams: ioStreams,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Watch for the new project versions and the new releases",
+		Example: `  # print the events of xnu and Libc, and of the macOS and iOS releases as the JSON lines
+  aos watch --projects xnu,Libc --platforms macos,ios --interval 6h
+
+  # run the hook for each event, which reads the event JSON from stdin
+  aos watch --projects xnu --exec 'notify-send "$AOS_EVENT_TYPE" "$AOS_EVENT_PROJECT $AOS_EVENT_VERSION"'
+
+  # post the events to the webhook once, such as from cron
+  aos watch --platforms macos --webhook https://hooks.example.com/aos --once`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkArgs(cmd.Name(), cmd.Flags(), 0, exactArgs, args...); err != nil {
+				return err
+			}
+
+			return watch.run(ctx)
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringSliceVar(&watch.projects, "projects", nil, "Projects to watch the versions (default all projects)")
+	f.StringSliceVar(&watch.platforms, "platforms", nil, "Platforms to watch the releases (default all platforms)")
+	f.DurationVar(&watch.interval, "interval", defaultWatchInterval, "Interval of the checks")
+	f.StringVar(&watch.state, "state", "", "Path of the watch state file (default watch.json in the cache directory)")
+	f.StringVar(&watch.exec, "exec", "", "Shell command run for each event instead of printing the events, at least once as the events are delivered again if any delivery fails")
+	f.StringVar(&watch.webhook, "webhook", "", "URL to post each event to instead of printing the events, at least once as the events are delivered again if any delivery fails")
+	f.BoolVar(&watch.once, "once", false, "Check once and exit")
+
+	return cmd
+}
+
+func (w *watch) run(ctx context.Context) error {
+	if w.interval <= 0 && !w.once {
+		return errors.New("--interval must be positive")
+	}
+
+	opts := &appleopensource.WatchOptions{Projects: w.projects}
+	for _, name := range w.platforms {
+		platform, err := appleopensource.ParsePlatform(name)
+		if err != nil {
+			return err
+		}
+		opts.Platforms = append(opts.Platforms, platform)
+	}
+	if w.state == "" {
+		w.state = filepath.Join(w.cacheDir(), "watch.json")
+	}
+	if err := os.MkdirAll(filepath.Dir(w.state), 0755); err != nil {
+		return err
+	}
+
+	var notifier appleopensource.Notifiers
+	if w.exec != "" {
+		notifier = append(notifier, &appleopensource.CommandNotifier{
+			Name:   "sh",
+			Args:   []string{"-c", w.exec},
+			Stdout: w.ioStreams.Out,
+			Stderr: w.ioStreams.ErrOut,
+		})
+	}
+	if w.webhook != "" {
+		notifier = append(notifier, &appleopensource.WebhookNotifier{
+			URL:        w.webhook,
+			HTTPClient: w.client.HTTPClient,
+			UserAgent:  w.client.UserAgent,
+		})
+	}
+	if len(notifier) == 0 {
+		notifier = append(notifier, &appleopensource.JSONNotifier{W: w.ioStreams.Out})
+	}
+
+	if w.once {
+		return w.check(ctx, opts, notifier)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		// the failed check is retried at the next interval, and its events are reported again
+		if err := w.check(ctx, opts, notifier); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			fmt.Fprintf(w.ioStreams.ErrOut, "%s: %v\n", AppName, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// check checks the updates once, delivers the events to the notifier, and writes the state if delivered.
+func (w *watch) check(ctx context.Context, opts *appleopensource.WatchOptions, notifier appleopensource.Notifier) error {
+	state, err := appleopensource.ReadWatchState(w.state)
+	if err != nil {
+		return err
+	}
+	events, err := w.client.CheckUpdates(ctx, state, opts)
+	if err != nil {
+		return err
+	}
+	if err := notifier.Notify(ctx, events); err != nil {
+		return err
+	}
+
+	return state.Write(w.state)
+}
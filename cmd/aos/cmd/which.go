@@ -0,0 +1,193 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource"
+)
+
+type which struct {
+	*aos
+
+	ioStreams *IOStreams
+
+	project   string
+	version   string
+	platforms []string
+	releases  []string
+}
+
+// newCmdWhich creates the which command.
+func (a *aos) newCmdWhich(ctx context.Context, ioStreams *IOStreams) *cobra.Command {
+	which := &which{
+		aos:       a,
+		ioStreams: ioStreams,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "which project version",
+		Short: "List the releases which ship the project version, or the nearest versions",
+		Example: `  aos which xnu 4903.221.2
+  aos which Libc 1244.1.7 --platform macos,ios
+  aos which xnu 6153.11.26 --release macos/10.15`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkArgs(cmd.Name(), cmd.Flags(), 2, exactArgs, args...); err != nil {
+				return err
+			}
+
+			which.project, which.version = args[0], args[1]
+			return which.run(ctx)
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringSliceVarP(&which.platforms, "platform", "p", nil, "Search only the releases of the platforms (default all platforms)")
+	f.StringSliceVar(&which.releases, "release", nil, "Also search the platform/version releases which are not known yet, e.g. macos/10.15")
+
+	return cmd
+}
+
+// parseReleaseSpec parses the "platform/version" release.
+func parseReleaseSpec(s string) (releaseSpec, error) {
+	i := strings.Index(s, "/")
+	if i < 0 {
+		return releaseSpec{}, fmt.Errorf("invalid release %q: must be platform/version", s)
+	}
+	platform, err := appleopensource.ParsePlatform(s[:i])
+	if err != nil {
+		return releaseSpec{}, err
+	}
+
+	return releaseSpec{platform: platform, version: s[i+1:]}, nil
+}
+
+// releaseTargets returns the known releases of the platforms, or of all platforms if no platform is given,
+// and the "platform/version" releases.
+func releaseTargets(platformNames, releaseSpecs []string) ([]appleopensource.ReleaseVersion, error) {
+	platforms := make([]appleopensource.Platform, len(platformNames))
+	for i, s := range platformNames {
+		p, err := appleopensource.ParsePlatform(s)
+		if err != nil {
+			return nil, err
+		}
+		platforms[i] = p
+	}
+
+	releases := appleopensource.KnownReleases(platforms...)
+	for _, s := range releaseSpecs {
+		spec, err := parseReleaseSpec(s)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, appleopensource.ReleaseVersion{Platform: spec.platform, Version: spec.version})
+	}
+
+	return releases, nil
+}
+
+func (w *which) run(ctx context.Context) error {
+	releases, err := releaseTargets(w.platforms, w.releases)
+	if err != nil {
+		return err
+	}
+
+	index, err := w.client.BuildReleaseIndex(ctx, releases)
+	if err != nil {
+		return err
+	}
+
+	entries, exact := index.Which(w.project, w.version)
+	if len(entries) == 0 {
+		return fmt.Errorf("no release ships %s", w.project)
+	}
+
+	record := &whichRecord{
+		Project:  w.project,
+		Version:  w.version,
+		Exact:    exact,
+		Releases: make([]whichRelease, len(entries)),
+	}
+	for i, e := range entries {
+		record.Releases[i] = whichRelease{
+			Platform:   e.Platform.String(),
+			Release:    e.Release,
+			Version:    e.Product.Version,
+			Updated:    e.Product.Updated,
+			ComingSoon: e.Product.ComingSoon,
+		}
+	}
+
+	return w.printer.print(w.ioStreams.Out, record, record.writeText)
+}
+
+// whichRelease represents the release which ships the project version.
+type whichRelease struct {
+	Platform   string `json:"platform" yaml:"platform"`
+	Release    string `json:"release" yaml:"release"`
+	Version    string `json:"version" yaml:"version"`
+	Updated    bool   `json:"updated,omitempty" yaml:"updated,omitempty"`
+	ComingSoon bool   `json:"coming_soon,omitempty" yaml:"coming_soon,omitempty"`
+}
+
+// whichRecord represents the record of the which command.
+type whichRecord struct {
+	Project  string         `json:"project" yaml:"project"`
+	Version  string         `json:"version" yaml:"version"`
+	Exact    bool           `json:"exact" yaml:"exact"`
+	Releases []whichRelease `json:"releases" yaml:"releases"`
+}
+
+func (r *whichRecord) writeText(w io.Writer) error {
+	var buf bytes.Buffer
+	if !r.Exact {
+		fmt.Fprintf(&buf, "No release ships %s %s. The nearest versions:\n", r.Project, r.Version)
+	}
+
+	tbuf := tabwriter.NewWriter(&buf, 2, 1, 2, ' ', 0)
+	for _, rel := range r.Releases {
+		v := productVersion(appleopensource.Product{Version: rel.Version, ComingSoon: rel.ComingSoon})
+		if r.Exact {
+			fmt.Fprintf(tbuf, "%s\t%s\n", rel.Platform, rel.Release)
+			continue
+		}
+		fmt.Fprintf(tbuf, "%s\t%s\t%s\n", rel.Platform, rel.Release, v)
+	}
+	tbuf.Flush()
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+func (r *whichRecord) csvHeader() []string {
+	return []string{"platform", "release", "name", "version", "exact", "updated", "coming_soon"}
+}
+
+func (r *whichRecord) csvRows() [][]string {
+	rows := make([][]string, len(r.Releases))
+	for i, rel := range r.Releases {
+		rows[i] = []string{
+			rel.Platform,
+			rel.Release,
+			r.Project,
+			rel.Version,
+			strconv.FormatBool(r.Exact),
+			strconv.FormatBool(rel.Updated),
+			strconv.FormatBool(rel.ComingSoon),
+		}
+	}
+
+	return rows
+}
@@ -3,15 +3,18 @@ module go-darwin.dev/appleopensource
 go 1.17
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/PuerkitoBio/goquery v1.7.2-0.20210925201108-6a7f1c4a50e1
 	github.com/blang/semver v1.1.1-0.20200524153540-4487282d7812
 	github.com/google/go-cmp v0.5.6
+	github.com/klauspost/compress v1.13.6
 	github.com/pkg/errors v0.9.1
 	github.com/schollz/progressbar/v3 v3.8.3
 	github.com/spf13/cobra v1.2.1
 	github.com/spf13/pflag v1.0.5
 	go.uber.org/multierr v1.7.0
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
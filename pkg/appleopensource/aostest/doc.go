@@ -0,0 +1,9 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package aostest provides a fake opensource.apple.com server for testing.
+//
+// The Server emulates the project lists, the version lists, the source trees, the tarballs with the Range
+// requests, the release pages and the release plists of a Site model, and injects the Faults into the responses.
+package aostest
@@ -0,0 +1,175 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package aostest
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// pageTemplate is the layout of the pages. The parsers extract the index from "body #content > div.column".
+const pageTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+</head>
+<body>
+<div id="header"><h1>Apple Open Source</h1></div>
+<div id="content">
+<div class="column">
+{{ template "index" . }}
+</div>
+</div>
+</body>
+</html>
+`
+
+// listingTemplate is the index of the directory listing pages, such as the project list, the version list
+// and the source tree.
+const listingTemplate = `{{ define "index" }}<table>
+<tbody><tr><th><img src="/icons/blank.gif" alt="[ICO]" height="25"/></th><th><a href="">Name</a></th><th><a href="">Size</a></th></tr>
+<tr><th colspan="3"><hr/></th></tr>
+<tr><td valign="top"><a href="./../"><img src="/icons/back.gif" alt="[DIR]" height="25"/></a></td><td><a href="./../">Parent Directory</a></td><td align="right">  - </td></tr>
+{{ range .Entries }}<tr><td valign="top"><a href="{{ .Name }}"><img src="{{ .Icon }}" alt="{{ .Alt }}" height="25"/></a></td><td><a href="{{ .Name }}">{{ .Name }}</a></td><td align="right">{{ .Size }}</td></tr>
+{{ end }}<tr><th colspan="3"><hr/></th></tr>
+</tbody></table>{{ end }}`
+
+// releaseTemplate is the index of the release pages.
+const releaseTemplate = `{{ define "index" }}<div class="boxheader project-list-header">
+<h2>
+<div class="project-updated">•</div>
+<div class="project-name">Project</div>
+<div class="project-downloads" style="width:250px;">Downloads</div>
+</h2>
+</div>
+<table id="project-list">
+<tbody>{{ range .Projects }}<tr class="project-row">
+<td class="project-updated">
+{{ if .Updated }}•{{ end }}
+</td>
+<td class="project-name{{ if .Updated }} newproject{{ end }}">
+{{ if .ComingSoon }}{{ .Name }}-{{ .Version }} (<i>coming soon!</i>){{ else }}<a href="/source/{{ .Name }}/{{ .Name }}-{{ .Version }}/">
+{{ .Name }}-{{ .Version }}
+</a>{{ end }}
+</td>
+<td class="project-downloads">
+{{ if not .ComingSoon }}<a href="/tarballs/{{ .Name }}/{{ .Name }}-{{ .Version }}.tar.gz"><img class="download-icon" src="/static/images/icon_downloads.png"/></a>{{ end }}
+</td>
+</tr>
+{{ end }}</tbody></table>{{ end }}`
+
+// releaseListTemplate is the index of the top page, which links the release pages.
+const releaseListTemplate = `{{ define "index" }}<div class="release-list">
+<ul>
+{{ range .Releases }}<li><a href="/release/{{ .Name }}.html">{{ if .Title }}{{ .Title }}{{ else }}{{ .Name }}{{ end }}</a></li>
+{{ end }}</ul>
+</div>{{ end }}`
+
+// plistTemplate is the release plist.
+const plistTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>name</key>
+	<string>{{ .Name | html }}</string>
+	<key>projects</key>
+	<dict>
+{{- range .Projects }}
+		<key>{{ .Name | html }}</key>
+		<dict>
+			<key>version</key>
+			<string>{{ .Version | html }}</string>
+		</dict>
+{{- end }}
+	</dict>
+</dict>
+</plist>
+`
+
+var (
+	listingPage = template.Must(template.Must(template.New("page").Parse(pageTemplate)).Parse(listingTemplate))
+	releasePage = template.Must(template.Must(template.New("page").Parse(pageTemplate)).Parse(releaseTemplate))
+	releaseList = template.Must(template.Must(template.New("page").Parse(pageTemplate)).Parse(releaseListTemplate))
+	plistPage   = texttemplate.Must(texttemplate.New("plist").Parse(plistTemplate))
+)
+
+// entry represents an entry of the directory listing page.
+type entry struct {
+	Name string // has "/" suffix if directory
+	Size string
+	Icon string
+	Alt  string
+}
+
+// dirEntry returns the directory entry of the listing page.
+func dirEntry(name string) entry {
+	return entry{Name: name + "/", Size: "  - ", Icon: "/static/images/icons/folder.png", Alt: "[DIR]"}
+}
+
+// fileEntry returns the file entry of the listing page.
+func fileEntry(name string, size int) entry {
+	if strings.HasSuffix(name, tarballSuffix) {
+		return entry{Name: name, Size: humanSize(size), Icon: "/static/images/icons/gz.png", Alt: "[GZ]"}
+	}
+
+	return entry{Name: name, Size: humanSize(size), Icon: "/static/images/icons/text.png", Alt: "[TXT]"}
+}
+
+// humanSize formats n as the directory listing does, such as "11.8K".
+func humanSize(n int) string {
+	switch {
+	case n < 1<<10:
+		return fmt.Sprint(n)
+	case n < 1<<20:
+		return fmt.Sprintf("%.1fK", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%.1fM", float64(n)/(1<<20))
+	}
+}
+
+// renderListing renders the directory listing page.
+func renderListing(title string, entries []entry) ([]byte, error) {
+	var buf bytes.Buffer
+	err := listingPage.Execute(&buf, struct {
+		Title   string
+		Entries []entry
+	}{title, entries})
+
+	return buf.Bytes(), err
+}
+
+// renderRelease renders the release page.
+func renderRelease(r *Release) ([]byte, error) {
+	var buf bytes.Buffer
+	err := releasePage.Execute(&buf, struct {
+		Title    string
+		Projects []ReleaseProject
+	}{r.Name, r.Projects})
+
+	return buf.Bytes(), err
+}
+
+// renderReleaseList renders the top page of the releases.
+func renderReleaseList(releases []Release) ([]byte, error) {
+	var buf bytes.Buffer
+	err := releaseList.Execute(&buf, struct {
+		Title    string
+		Releases []Release
+	}{"Apple Open Source", releases})
+
+	return buf.Bytes(), err
+}
+
+// renderPlist renders the release plist.
+func renderPlist(r *Release) ([]byte, error) {
+	var buf bytes.Buffer
+	err := plistPage.Execute(&buf, r)
+
+	return buf.Bytes(), err
+}
@@ -0,0 +1,457 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package aostest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tarballSuffix is the file extension of the tarballs resource.
+const tarballSuffix = ".tar.gz"
+
+// Request represents a request received by the Server.
+type Request struct {
+	Method string
+	Path   string
+	Range  string // the Range header, empty if not a range request
+}
+
+// Fault represents a fault injected into the responses of the matched requests.
+//
+// The faults are applied in order of Delay, Drop, Status, IgnoreRange and Truncate.
+type Fault struct {
+	// Path is the path.Match pattern of the request path such as "/tarballs/*/*.tar.gz". Empty matches all.
+	Path string
+
+	// Method is the request method to match such as "HEAD". Empty matches all.
+	Method string
+
+	// Times is the number of the requests which the fault is injected into. Zero is unlimited.
+	Times int
+
+	// Delay delays the response.
+	Delay time.Duration
+
+	// Drop closes the connection without the response.
+	Drop bool
+
+	// Status responds the status code instead of the resource if not zero, such as 503.
+	Status int
+
+	// IgnoreRange ignores the Range header and responds the whole resource.
+	IgnoreRange bool
+
+	// Truncate closes the connection after the first Truncate bytes of the body if positive.
+	Truncate int64
+}
+
+// fault represents a state of the injected Fault.
+type fault struct {
+	Fault
+	n int // number of the injected requests
+}
+
+// match reports whether the fault is injected into r.
+func (f *fault) match(r *http.Request) bool {
+	if f.Times > 0 && f.n >= f.Times {
+		return false
+	}
+	if f.Method != "" && f.Method != r.Method {
+		return false
+	}
+	if f.Path != "" {
+		if ok, _ := path.Match(f.Path, r.URL.Path); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Server is a fake opensource.apple.com server serving the Site.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	site     *Site
+	tarballs map[string][]byte // generated tarballs keyed by the path
+	faults   []*fault
+	requests []Request
+}
+
+var _ http.Handler = (*Server)(nil)
+
+// NewServer starts and returns a new Server serving the site.
+// The caller should call Close when finished, to shut it down.
+func NewServer(site *Site) *Server {
+	if site == nil {
+		site = &Site{}
+	}
+
+	s := &Server{
+		site:     site,
+		tarballs: make(map[string][]byte),
+	}
+	s.Server = httptest.NewServer(s)
+
+	return s
+}
+
+// BaseURL returns the base URL of the site, which is used as the Client.BaseURL.
+func (s *Server) BaseURL() string {
+	return s.URL + "/"
+}
+
+// Update calls fn with the served Site to modify it.
+func (s *Server) Update(fn func(site *Site)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fn(s.site)
+	s.tarballs = make(map[string][]byte)
+}
+
+// AddFault injects the f into the responses of the subsequent requests. The first matched fault is injected.
+func (s *Server) AddFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = append(s.faults, &fault{Fault: f})
+}
+
+// ClearFaults removes all the injected faults.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = nil
+}
+
+// Requests returns the requests received by the Server in order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reqs := make([]Request, len(s.requests))
+	copy(reqs, s.requests)
+
+	return reqs
+}
+
+// ResetRequests clears the received requests.
+func (s *Server) ResetRequests() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = nil
+}
+
+// ServeHTTP implements a http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Range: r.Header.Get("Range")})
+	var f *fault
+	for _, ff := range s.faults {
+		if ff.match(r) {
+			ff.n++
+			f = ff
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if f == nil {
+		s.serve(w, r)
+		return
+	}
+
+	if f.Delay > 0 {
+		t := time.NewTimer(f.Delay)
+		select {
+		case <-t.C:
+		case <-r.Context().Done():
+			t.Stop()
+			return
+		}
+	}
+	if f.Drop {
+		closeConn(w)
+		return
+	}
+	if f.Status != 0 {
+		http.Error(w, http.StatusText(f.Status), f.Status)
+		return
+	}
+	if f.IgnoreRange {
+		r.Header.Del("Range")
+	}
+	if f.Truncate > 0 {
+		tw := &truncateWriter{ResponseWriter: w, rest: f.Truncate}
+		s.serve(tw, r)
+		if tw.truncated {
+			if fl, ok := w.(http.Flusher); ok {
+				fl.Flush()
+			}
+			closeConn(w)
+		}
+		return
+	}
+
+	s.serve(w, r)
+}
+
+// serve serves the resource of the r.URL.Path.
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	body, contentType, err := s.resource(r.URL.Path)
+	modified := s.site.modified()
+	s.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if body == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:8])+`"`)
+	http.ServeContent(w, r, path.Base(r.URL.Path), modified, bytes.NewReader(body))
+}
+
+// list of the Content-Type of the resources.
+const (
+	contentTypeHTML    = "text/html; charset=utf-8"
+	contentTypeText    = "text/plain; charset=utf-8"
+	contentTypeTarball = "application/x-gzip"
+	contentTypePlist   = "application/xml"
+)
+
+// resource returns the body and the Content-Type of the p path resource, or nil body if not found.
+//
+// It must be called with s.mu held.
+func (s *Server) resource(p string) ([]byte, string, error) {
+	elems := strings.Split(strings.Trim(p, "/"), "/")
+
+	switch elems[0] {
+	case "":
+		body, err := renderReleaseList(s.site.Releases)
+		return body, contentTypeHTML, err
+
+	case "tarballs", "source":
+		if len(elems) == 1 {
+			return s.projectList(elems[0])
+		}
+		proj := s.site.project(elems[1])
+		if proj == nil {
+			return nil, "", nil
+		}
+		if elems[0] == "tarballs" {
+			switch len(elems) {
+			case 2:
+				return s.tarballList(proj)
+			case 3:
+				return s.tarball(proj, elems[2])
+			}
+			return nil, "", nil
+		}
+		if len(elems) == 2 {
+			return s.sourceList(proj)
+		}
+		return s.sourceTree(proj, elems[2], strings.Join(elems[3:], "/"))
+
+	case "release":
+		if len(elems) == 2 && strings.HasSuffix(elems[1], ".html") {
+			if rel := s.site.release(strings.TrimSuffix(elems[1], ".html")); rel != nil {
+				body, err := renderRelease(rel)
+				return body, contentTypeHTML, err
+			}
+		}
+
+	case "plist":
+		if len(elems) == 2 && strings.HasSuffix(elems[1], ".plist") {
+			if rel := s.site.release(strings.TrimSuffix(elems[1], ".plist")); rel != nil {
+				body, err := renderPlist(rel)
+				return body, contentTypePlist, err
+			}
+		}
+	}
+
+	return nil, "", nil
+}
+
+// projectList returns the project list page of the typ resource.
+func (s *Server) projectList(typ string) ([]byte, string, error) {
+	names := make([]string, 0, len(s.site.Projects))
+	for _, p := range s.site.Projects {
+		names = append(names, p.Name)
+	}
+	sort.Strings(names)
+
+	entries := make([]entry, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, dirEntry(name))
+	}
+
+	body, err := renderListing("Index of /"+typ, entries)
+	return body, contentTypeHTML, err
+}
+
+// tarballList returns the tarballs version list page of the proj.
+func (s *Server) tarballList(proj *Project) ([]byte, string, error) {
+	var entries []entry
+	for i := range proj.Versions {
+		v := &proj.Versions[i]
+		buf, err := s.versionTarball(proj, v)
+		if err != nil {
+			return nil, "", err
+		}
+		entries = append(entries, fileEntry(proj.Name+"-"+v.Version+tarballSuffix, len(buf)))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	body, err := renderListing("Index of /tarballs/"+proj.Name, entries)
+	return body, contentTypeHTML, err
+}
+
+// tarball returns the file tarball of the proj.
+func (s *Server) tarball(proj *Project, file string) ([]byte, string, error) {
+	if !strings.HasPrefix(file, proj.Name+"-") || !strings.HasSuffix(file, tarballSuffix) {
+		return nil, "", nil
+	}
+	v := proj.version(strings.TrimSuffix(strings.TrimPrefix(file, proj.Name+"-"), tarballSuffix))
+	if v == nil {
+		return nil, "", nil
+	}
+
+	body, err := s.versionTarball(proj, v)
+	return body, contentTypeTarball, err
+}
+
+// versionTarball returns the tarball of the v version of the proj, which is cached once generated.
+func (s *Server) versionTarball(proj *Project, v *Version) ([]byte, error) {
+	key := proj.Name + "/" + v.Version
+	if buf, ok := s.tarballs[key]; ok {
+		return buf, nil
+	}
+
+	buf, err := v.tarball(proj.Name, s.site.modified())
+	if err != nil {
+		return nil, err
+	}
+	s.tarballs[key] = buf
+
+	return buf, nil
+}
+
+// sourceList returns the source version list page of the proj.
+func (s *Server) sourceList(proj *Project) ([]byte, string, error) {
+	var entries []entry
+	for _, v := range proj.Versions {
+		entries = append(entries, dirEntry(proj.Name+"-"+v.Version))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	body, err := renderListing("Index of /source/"+proj.Name, entries)
+	return body, contentTypeHTML, err
+}
+
+// sourceTree returns the dir directory listing page or the file of the source tree of the proj version.
+func (s *Server) sourceTree(proj *Project, dir, name string) ([]byte, string, error) {
+	if !strings.HasPrefix(dir, proj.Name+"-") {
+		return nil, "", nil
+	}
+	v := proj.version(strings.TrimPrefix(dir, proj.Name+"-"))
+	if v == nil {
+		return nil, "", nil
+	}
+
+	if body, ok := v.Files[name]; ok && name != "" {
+		return []byte(body), contentTypeText, nil
+	}
+
+	prefix := ""
+	if name != "" {
+		prefix = name + "/"
+	}
+	seen := make(map[string]bool)
+	var entries []entry
+	for _, fname := range v.sortedFiles() {
+		if !strings.HasPrefix(fname, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(fname, prefix)
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			if child := rest[:i]; !seen[child] {
+				seen[child] = true
+				entries = append(entries, dirEntry(child))
+			}
+			continue
+		}
+		entries = append(entries, fileEntry(rest, len(v.Files[fname])))
+	}
+	if len(entries) == 0 && name != "" {
+		return nil, "", nil
+	}
+
+	body, err := renderListing("Index of /source/"+proj.Name+"/"+path.Join(dir, name), entries)
+	return body, contentTypeHTML, err
+}
+
+// truncateWriter is a http.ResponseWriter which discards the body after the rest bytes.
+type truncateWriter struct {
+	http.ResponseWriter
+	rest      int64
+	truncated bool
+}
+
+// Write implements a io.Writer interface.
+func (w *truncateWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) <= w.rest {
+		w.rest -= int64(len(p))
+		return w.ResponseWriter.Write(p)
+	}
+
+	w.truncated = true
+	n := w.rest
+	w.rest = 0
+	if n > 0 {
+		if _, err := w.ResponseWriter.Write(p[:n]); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// closeConn closes the underlying connection of w. The buffered response which is not flushed is discarded.
+func closeConn(w http.ResponseWriter) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		panic("aostest: the ResponseWriter does not support the hijacking")
+	}
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		panic("aostest: " + err.Error())
+	}
+	conn.Close()
+}
@@ -0,0 +1,291 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package aostest_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource"
+	"go-darwin.dev/appleopensource/pkg/appleopensource/aostest"
+)
+
+var testSite = &aostest.Site{
+	Projects: []aostest.Project{
+		{
+			Name: "xnu",
+			Versions: []aostest.Version{
+				{Version: "4903.221.2", Files: map[string]string{"README.md": "xnu\n", "bsd/conf/files": "OPTIONS/kdebug\n"}},
+				{Version: "3789.1.32", Files: map[string]string{"README.md": "old xnu\n"}},
+			},
+		},
+		{
+			Name:     "Csu",
+			Versions: []aostest.Version{{Version: "85", Tarball: []byte("Csu tarball")}},
+		},
+	},
+	Releases: []aostest.Release{
+		{
+			Name: "macos-1014",
+			Projects: []aostest.ReleaseProject{
+				{Name: "Csu", Version: "85"},
+				{Name: "xnu", Version: "4903.221.2", Updated: true},
+				{Name: "dyld", Version: "635.2", ComingSoon: true},
+			},
+		},
+	},
+}
+
+func TestServer_Index(t *testing.T) {
+	srv := aostest.NewServer(testSite)
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := &appleopensource.Client{BaseURL: srv.BaseURL()}
+
+	for _, typ := range []appleopensource.ResourceType{appleopensource.TarballsResource, appleopensource.SourceResource} {
+		buf, err := c.IndexProject(ctx, typ)
+		if err != nil {
+			t.Fatalf("IndexProject(%s) error = %v", typ, err)
+		}
+		projects, err := appleopensource.ListProject(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []appleopensource.Product{{Name: "Csu"}, {Name: "xnu"}}
+		if diff := cmp.Diff(want, projects); diff != "" {
+			t.Errorf("ListProject(%s) mismatch (-want +got):\n%s", typ, diff)
+		}
+
+		buf, err = c.IndexVersion(ctx, "xnu", typ)
+		if err != nil {
+			t.Fatalf("IndexVersion(%s) error = %v", typ, err)
+		}
+		versions, err := appleopensource.ListVersions(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"3789.1.32", "4903.221.2"}, versions); diff != "" {
+			t.Errorf("ListVersions(%s) mismatch (-want +got):\n%s", typ, diff)
+		}
+	}
+
+	buf, err := c.IndexRelease(ctx, appleopensource.MacOS, "10.14")
+	if err != nil {
+		t.Fatalf("IndexRelease() error = %v", err)
+	}
+	release, err := appleopensource.ListRelease(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []appleopensource.Product{
+		{Name: "Csu", Version: "85"},
+		{Name: "xnu", Version: "4903.221.2", Updated: true},
+		{Name: "dyld", Version: "635.2", ComingSoon: true},
+	}
+	if diff := cmp.Diff(want, release); diff != "" {
+		t.Errorf("ListRelease() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestServer_SourceTree(t *testing.T) {
+	srv := aostest.NewServer(testSite)
+	defer srv.Close()
+
+	dst := t.TempDir()
+	c := &appleopensource.Client{BaseURL: srv.BaseURL()}
+	p := appleopensource.Product{Name: "xnu", Version: "4903.221.2"}
+	if err := c.MirrorSource(context.Background(), dst, c.SourceURL(p), 2); err != nil {
+		t.Fatalf("MirrorSource() error = %v", err)
+	}
+
+	for name, want := range testSite.Projects[0].Versions[0].Files {
+		got, err := ioutil.ReadFile(filepath.Join(dst, "xnu-4903.221.2", filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestServer_Range(t *testing.T) {
+	srv := aostest.NewServer(testSite)
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/tarballs/Csu/Csu-85.tar.gz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Range", "bytes=4-10")
+
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusPartialContent || string(body) != "tarball" {
+		t.Errorf("got %d %q, want %d %q", resp.StatusCode, body, http.StatusPartialContent, "tarball")
+	}
+
+	want := []aostest.Request{{Method: http.MethodGet, Path: "/tarballs/Csu/Csu-85.tar.gz", Range: "bytes=4-10"}}
+	if diff := cmp.Diff(want, srv.Requests()); diff != "" {
+		t.Errorf("Requests() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestServer_AddFault(t *testing.T) {
+	const uri = "/tarballs/Csu/Csu-85.tar.gz"
+
+	tests := []struct {
+		name    string
+		fault   aostest.Fault
+		header  http.Header
+		wantErr bool
+		want    string
+		status  int
+	}{
+		{
+			name:   "status",
+			fault:  aostest.Fault{Path: "/tarballs/*/*.tar.gz", Status: http.StatusServiceUnavailable},
+			status: http.StatusServiceUnavailable,
+		},
+		{
+			name:   "unmatched",
+			fault:  aostest.Fault{Path: "/source/*", Status: http.StatusServiceUnavailable},
+			status: http.StatusOK,
+			want:   "Csu tarball",
+		},
+		{
+			name:   "unmatched method",
+			fault:  aostest.Fault{Method: http.MethodHead, Status: http.StatusServiceUnavailable},
+			status: http.StatusOK,
+			want:   "Csu tarball",
+		},
+		{
+			name:    "drop",
+			fault:   aostest.Fault{Drop: true},
+			wantErr: true,
+		},
+		{
+			name:    "truncate",
+			fault:   aostest.Fault{Truncate: 3},
+			status:  http.StatusOK,
+			want:    "Csu",
+			wantErr: true,
+		},
+		{
+			name:   "ignore range",
+			fault:  aostest.Fault{IgnoreRange: true},
+			header: http.Header{"Range": {"bytes=4-10"}},
+			status: http.StatusOK,
+			want:   "Csu tarball",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := aostest.NewServer(testSite)
+			defer srv.Close()
+			srv.AddFault(tt.fault)
+
+			req, err := http.NewRequest(http.MethodGet, srv.URL+uri, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				if !tt.wantErr {
+					t.Fatalf("Do() error = %v", err)
+				}
+				return
+			}
+			defer resp.Body.Close()
+
+			body, err := ioutil.ReadAll(resp.Body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadAll() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if tt.want != "" && string(body) != tt.want {
+				t.Errorf("body = %q, want %q", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_AddFaultTimes(t *testing.T) {
+	srv := aostest.NewServer(testSite)
+	defer srv.Close()
+	srv.AddFault(aostest.Fault{Status: http.StatusServiceUnavailable, Times: 2})
+
+	var got []int
+	for i := 0; i < 3; i++ {
+		resp, err := srv.Client().Get(srv.URL + "/tarballs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		got = append(got, resp.StatusCode)
+	}
+
+	want := []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("statuses mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLoadSite(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"source/xnu/xnu-4903.221.2/README.md":      "xnu\n",
+		"source/xnu/xnu-4903.221.2/bsd/conf/files": "OPTIONS/kdebug\n",
+		"tarballs/Csu/Csu-85.tar.gz":               "Csu tarball",
+		"release/macos-1014.yaml":                  "- name: xnu\n  version: 4903.221.2\n  updated: true\n",
+	}
+	for name, body := range files {
+		fname := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fname, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := aostest.LoadSite(dir)
+	if err != nil {
+		t.Fatalf("LoadSite() error = %v", err)
+	}
+
+	want := &aostest.Site{
+		Projects: []aostest.Project{
+			{Name: "Csu", Versions: []aostest.Version{{Version: "85", Tarball: []byte("Csu tarball")}}},
+			{Name: "xnu", Versions: []aostest.Version{{Version: "4903.221.2", Files: map[string]string{"README.md": "xnu\n", "bsd/conf/files": "OPTIONS/kdebug\n"}}}},
+		},
+		Releases: []aostest.Release{
+			{Name: "macos-1014", Projects: []aostest.ReleaseProject{{Name: "xnu", Version: "4903.221.2", Updated: true}}},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("LoadSite() mismatch (-want +got):\n%s", diff)
+	}
+}
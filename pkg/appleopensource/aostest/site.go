@@ -0,0 +1,283 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package aostest
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultModified is the Last-Modified time of the resources of the Site which has no Modified time.
+var DefaultModified = time.Date(2019, time.April, 9, 0, 0, 0, 0, time.UTC)
+
+// Site represents the model of the emulated opensource.apple.com.
+type Site struct {
+	// Projects is the projects served under the tarballs and the source resources.
+	Projects []Project `json:"projects" yaml:"projects"`
+
+	// Releases is the release pages and plists.
+	Releases []Release `json:"releases" yaml:"releases"`
+
+	// Modified is the Last-Modified time of all the resources. DefaultModified is used if zero.
+	Modified time.Time `json:"modified,omitempty" yaml:"modified,omitempty"`
+}
+
+// Project represents a project such as "xnu".
+type Project struct {
+	Name     string    `json:"name" yaml:"name"`
+	Versions []Version `json:"versions" yaml:"versions"`
+}
+
+// Version represents a version of the project.
+type Version struct {
+	Version string `json:"version" yaml:"version"`
+
+	// Files is the source tree of the version, keyed by the slash separated path such as "bsd/conf/files".
+	Files map[string]string `json:"files,omitempty" yaml:"files,omitempty"`
+
+	// Tarball is the tarball served as <name>-<version>.tar.gz. If nil, the tarball is generated from Files.
+	Tarball []byte `json:"-" yaml:"-"`
+}
+
+// Release represents a release page such as "macos-1012" served as /release/macos-1012.html and
+// /plist/macos-1012.plist, which is linked from the release list of the top page.
+type Release struct {
+	Name string `json:"name" yaml:"name"`
+
+	// Title is the link text of the release list such as "macOS 10.12". Name is used if empty.
+	Title string `json:"title,omitempty" yaml:"title,omitempty"`
+
+	Projects []ReleaseProject `json:"projects" yaml:"projects"`
+}
+
+// ReleaseProject represents a project row of the release page.
+type ReleaseProject struct {
+	Name       string `json:"name" yaml:"name"`
+	Version    string `json:"version" yaml:"version"`
+	Updated    bool   `json:"updated,omitempty" yaml:"updated,omitempty"`
+	ComingSoon bool   `json:"coming_soon,omitempty" yaml:"coming_soon,omitempty"`
+}
+
+// LoadSite loads the Site from the dir directory which has the same layout as the site:
+//
+//	dir/source/<name>/<name>-<version>/...      the source tree of the version
+//	dir/tarballs/<name>/<name>-<version>.tar.gz the tarball of the version, generated from the source tree if absent
+//	dir/release/<release>.yaml                  the projects of the release, the YAML of the []ReleaseProject
+func LoadSite(dir string) (*Site, error) {
+	projects := make(map[string]map[string]*Version)
+	version := func(name, v string) *Version {
+		if projects[name] == nil {
+			projects[name] = make(map[string]*Version)
+		}
+		if projects[name][v] == nil {
+			projects[name][v] = &Version{Version: v}
+		}
+		return projects[name][v]
+	}
+
+	// the source trees
+	srcDir := filepath.Join(dir, "source")
+	err := filepath.Walk(srcDir, func(fname string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && fname == srcDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(srcDir, fname)
+		if err != nil {
+			return err
+		}
+		elems := strings.SplitN(filepath.ToSlash(rel), "/", 3)
+		if len(elems) != 3 || !strings.HasPrefix(elems[1], elems[0]+"-") {
+			return fmt.Errorf("not a source tree file: %s", fname)
+		}
+
+		buf, err := ioutil.ReadFile(fname)
+		if err != nil {
+			return err
+		}
+		v := version(elems[0], strings.TrimPrefix(elems[1], elems[0]+"-"))
+		if v.Files == nil {
+			v.Files = make(map[string]string)
+		}
+		v.Files[elems[2]] = string(buf)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the tarballs
+	tarballs, err := filepath.Glob(filepath.Join(dir, "tarballs", "*", "*"+tarballSuffix))
+	if err != nil {
+		return nil, err
+	}
+	for _, fname := range tarballs {
+		name := filepath.Base(filepath.Dir(fname))
+		file := filepath.Base(fname)
+		if !strings.HasPrefix(file, name+"-") {
+			return nil, fmt.Errorf("not a tarball file: %s", fname)
+		}
+
+		buf, err := ioutil.ReadFile(fname)
+		if err != nil {
+			return nil, err
+		}
+		version(name, strings.TrimSuffix(strings.TrimPrefix(file, name+"-"), tarballSuffix)).Tarball = buf
+	}
+
+	site := &Site{}
+	for name, versions := range projects {
+		p := Project{Name: name}
+		for _, v := range versions {
+			p.Versions = append(p.Versions, *v)
+		}
+		sort.Slice(p.Versions, func(i, j int) bool { return p.Versions[i].Version < p.Versions[j].Version })
+		site.Projects = append(site.Projects, p)
+	}
+	sort.Slice(site.Projects, func(i, j int) bool { return site.Projects[i].Name < site.Projects[j].Name })
+
+	// the releases
+	releases, err := filepath.Glob(filepath.Join(dir, "release", "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	for _, fname := range releases {
+		buf, err := ioutil.ReadFile(fname)
+		if err != nil {
+			return nil, err
+		}
+
+		r := Release{Name: strings.TrimSuffix(filepath.Base(fname), ".yaml")}
+		if err := yaml.Unmarshal(buf, &r.Projects); err != nil {
+			return nil, fmt.Errorf("could not parse %s: %w", fname, err)
+		}
+		site.Releases = append(site.Releases, r)
+	}
+
+	return site, nil
+}
+
+// project returns the name project, or nil if not found.
+func (s *Site) project(name string) *Project {
+	for i := range s.Projects {
+		if s.Projects[i].Name == name {
+			return &s.Projects[i]
+		}
+	}
+
+	return nil
+}
+
+// version returns the v version of the project, or nil if not found.
+func (p *Project) version(v string) *Version {
+	for i := range p.Versions {
+		if p.Versions[i].Version == v {
+			return &p.Versions[i]
+		}
+	}
+
+	return nil
+}
+
+// release returns the name release, or nil if not found.
+func (s *Site) release(name string) *Release {
+	for i := range s.Releases {
+		if s.Releases[i].Name == name {
+			return &s.Releases[i]
+		}
+	}
+
+	return nil
+}
+
+// modified returns the Last-Modified time of the resources.
+func (s *Site) modified() time.Time {
+	if s.Modified.IsZero() {
+		return DefaultModified
+	}
+
+	return s.Modified
+}
+
+// sortedFiles returns the sorted paths of the source tree.
+func (v *Version) sortedFiles() []string {
+	names := make([]string, 0, len(v.Files))
+	for name := range v.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// tarball returns the tarball of the name project version.
+//
+// The generated tarball has the "<name>-<version>/" top-level directory as the real tarballs.
+func (v *Version) tarball(name string, modified time.Time) ([]byte, error) {
+	if v.Tarball != nil {
+		return v.Tarball, nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.ModTime = modified
+	tw := tar.NewWriter(zw)
+
+	top := name + "-" + v.Version
+	dirs := map[string]bool{}
+	for _, fname := range v.sortedFiles() {
+		// the parent directories entries
+		var parents []string
+		for dir := path.Dir(fname); dir != "."; dir = path.Dir(dir) {
+			parents = append([]string{dir}, parents...)
+		}
+		for _, dir := range append([]string{""}, parents...) {
+			if dirs[dir] {
+				continue
+			}
+			dirs[dir] = true
+			hdr := &tar.Header{Typeflag: tar.TypeDir, Name: path.Join(top, dir) + "/", Mode: 0755, ModTime: modified}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return nil, err
+			}
+		}
+
+		body := v.Files[fname]
+		hdr := &tar.Header{Typeflag: tar.TypeReg, Name: path.Join(top, fname), Mode: 0644, Size: int64(len(body)), ModTime: modified}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write([]byte(body)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
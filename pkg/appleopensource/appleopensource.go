@@ -6,10 +6,12 @@ package appleopensource
 
 import (
 	"bytes"
-	"errors"
+	"context"
 	"fmt"
+	"net/http"
 	"net/url"
 	"path"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -20,7 +22,8 @@ import (
 // const rooturi = "https://web.archive.org/web/20190421070850/https://opensource.apple.com/"
 const rooturi = "https://opensource.apple.com/"
 
-var rootURL, _ = url.Parse(rooturi)
+// DefaultBaseURL is the default base URL of the opensource.apple.com resources.
+const DefaultBaseURL = rooturi
 
 // ResourceType represents a resource type.
 type ResourceType int
@@ -45,20 +48,36 @@ func (r ResourceType) String() string {
 	}
 }
 
-func index(u *url.URL) ([]byte, error) {
-	dom, err := goquery.NewDocument(u.String())
+// index returns the index of the u page HTML DOM tree, and caches the page into c.Cache.
+func (c *Client) index(ctx context.Context, u *url.URL) ([]byte, error) {
+	buf, err := c.get(ctx, u.String())
 	if err != nil {
 		return nil, err
 	}
 
-	table, err := dom.Find("body #content > div.column").Html()
+	return c.extractIndex(u, buf)
+}
+
+// indexSelector is the selector of the index in the opensource.apple.com pages.
+const indexSelector = "body #content > div.column"
+
+// extractIndex extracts the index of the u page HTML DOM tree from the buf page.
+func (c *Client) extractIndex(u *url.URL, buf []byte) ([]byte, error) {
+	dom, err := goquery.NewDocumentFromReader(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+
+	sel := dom.Find(indexSelector)
+	c.log(LevelDebug, "extract index", "url", u.String(), "selector", indexSelector, "matches", sel.Length(), "rows", sel.Find("table > tbody > tr").Length())
+	table, err := sel.Html()
 	if err != nil {
 		return nil, err
 	}
 
 	// 0 is 404 not found
 	if len(strings.TrimSpace(table)) == 0 {
-		return nil, fmt.Errorf("Not found %s project", u.String())
+		return nil, &StatusError{URL: u.String(), Status: "404 Not Found", StatusCode: http.StatusNotFound}
 	}
 
 	return bytes.TrimSpace([]byte(table)), nil
@@ -66,18 +85,38 @@ func index(u *url.URL) ([]byte, error) {
 
 // IndexProject return the index of opensource.apple.com/<typ> HTML DOM tree.
 func IndexProject(typ ResourceType) ([]byte, error) {
-	u := *rootURL // copy
+	return DefaultClient.IndexProject(context.Background(), typ)
+}
+
+// IndexProject return the index of opensource.apple.com/<typ> HTML DOM tree.
+func (c *Client) IndexProject(ctx context.Context, typ ResourceType) ([]byte, error) {
+	return c.index(ctx, c.projectURL(typ))
+}
+
+// projectURL returns the url of the project list page.
+func (c *Client) projectURL(typ ResourceType) *url.URL {
+	u := c.baseURL()
 	u.Path = path.Join(u.Path, typ.String())
 
-	return index(&u)
+	return u
 }
 
 // IndexVersion return the index of all versions of the project HTML DOM tree.
 func IndexVersion(project string, typ ResourceType) ([]byte, error) {
-	u := *rootURL // copy
+	return DefaultClient.IndexVersion(context.Background(), project, typ)
+}
+
+// IndexVersion return the index of all versions of the project HTML DOM tree.
+func (c *Client) IndexVersion(ctx context.Context, project string, typ ResourceType) ([]byte, error) {
+	return c.index(ctx, c.versionURL(project, typ))
+}
+
+// versionURL returns the url of the version list page of the project.
+func (c *Client) versionURL(project string, typ ResourceType) *url.URL {
+	u := c.baseURL()
 	u.Path = path.Join(u.Path, typ.String(), project)
 
-	return index(&u)
+	return u
 }
 
 const (
@@ -88,38 +127,50 @@ const (
 
 // IndexRelease return the index of projects of the specified platforms release version.
 func IndexRelease(platform Platform, version string) ([]byte, error) {
+	return DefaultClient.IndexRelease(context.Background(), platform, version)
+}
+
+// IndexRelease return the index of projects of the specified platforms release version.
+func (c *Client) IndexRelease(ctx context.Context, platform Platform, version string) ([]byte, error) {
+	u, err := c.releaseURL(platform, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.index(ctx, u)
+}
+
+// releaseURL returns the url of the release page of the platform version.
+func (c *Client) releaseURL(platform Platform, version string) (*url.URL, error) {
+	name, err := releasePageName(platform, version)
+	if err != nil {
+		return nil, err
+	}
+
+	u := c.baseURL()
+	u.Path = path.Join(u.Path, "release", name+".html")
+
+	return u, nil
+}
+
+// releasePageName returns the name of the release page of the platform version such as "macos-10141".
+func releasePageName(platform Platform, version string) (string, error) {
 	var prefix string
 
 	switch platform {
 	case MacOS:
-		v, err := semver.ParseTolerant(version)
-		if err != nil {
-			return nil, err
-		}
 		// wtf why does not use unified url?
 		// 10.12 ~ newer:  Uses 'macos'
 		// 10.11.6 ~ 10.9: Uses 'os-x'
 		// 10.9 ~ older:   Uses 'mac-os-x'
-		threshold, err := semver.ParseTolerant("10.11.6")
-		if err != nil {
-			return nil, err
-		}
-		switch v.Compare(threshold) {
-		case 1: // 1 is greater than threshold, 10.12 or newer
+		// compareVersions also accepts the architecture suffixed versions such as "10.4.11.x86" and "10.2.8.G5".
+		switch {
+		case compareVersions(version, "10.11.6") > 0:
 			prefix = macOSPrefix
-		case 0: // 0 is equal, 10.11.6
+		case compareVersions(version, "10.9") >= 0:
 			prefix = osxPrefix
-		case -1: // -1 is less than threshold, 10.11.5 or older
-			secondThreshold, err := semver.ParseTolerant("10.9")
-			if err != nil {
-				return nil, err
-			}
-			switch v.Compare(secondThreshold) {
-			case 0, 1: // 0 is equal, 1 is greater than threshold
-				prefix = osxPrefix
-			case -1:
-				prefix = macOSXPrefix
-			}
+		default:
+			prefix = macOSXPrefix
 		}
 	case Xcode:
 		prefix = "developer-tools"
@@ -128,31 +179,103 @@ func IndexRelease(platform Platform, version string) ([]byte, error) {
 	case Server:
 		prefix = "os-x-server"
 	default:
-		return nil, errors.New("unknown platform")
+		return "", errUnknownPlatform
+	}
+
+	return prefix + "-" + strings.Replace(version, ".", "", -1), nil
+}
+
+// IndexReleases return the index of the release list of the top page HTML DOM tree.
+func (c *Client) IndexReleases(ctx context.Context) ([]byte, error) {
+	return c.index(ctx, c.baseURL())
+}
+
+// releasePrefixes is the prefixes of the release page names, the longer prefix first.
+var releasePrefixes = []struct {
+	prefix   string
+	platform Platform
+}{
+	{"os-x-server-", Server},
+	{"developer-tools-", Xcode},
+	{macOSXPrefix + "-", MacOS},
+	{osxPrefix + "-", MacOS},
+	{macOSPrefix + "-", MacOS},
+	{"ios-", IOS},
+}
+
+// versionPattern matches the versions in the link text of the release such as "macOS 10.14.1".
+var versionPattern = regexp.MustCompile(`[0-9]+(\.[0-9]+)*`)
+
+// parseReleaseLink parses the release page name such as "macos-10141" and the link text of the release.
+//
+// The version is the KnownRelease version whose page name is the name, or the version in the text followed by
+// the architecture suffix of the name such as "x86". It reports false if the name is not a release page.
+func parseReleaseLink(name, text string) (ReleaseVersion, bool) {
+	var (
+		platform Platform
+		rest     string
+	)
+	for _, p := range releasePrefixes {
+		if strings.HasPrefix(name, p.prefix) {
+			platform, rest = p.platform, strings.TrimPrefix(name, p.prefix)
+			break
+		}
+	}
+	if platform == Unknown || rest == "" {
+		return ReleaseVersion{}, false
 	}
 
-	u := *rootURL // copy
-	u.Path = path.Join(u.Path, "release", fmt.Sprintf("%s-%s.html", prefix, strings.Replace(version, ".", "", -1)))
+	candidates := append([]string{}, KnownRelease[platform]...)
+	for _, v := range versionPattern.FindAllString(text, -1) {
+		if suffix := strings.TrimPrefix(rest, strings.Replace(v, ".", "", -1)); suffix != rest && suffix != "" {
+			v += "." + suffix
+		}
+		candidates = append(candidates, v)
+	}
+	for _, v := range candidates {
+		// the page name of the version must be the name, such as "10.14.1" of "macos-10141"
+		if n, err := releasePageName(platform, v); err == nil && n == name {
+			return ReleaseVersion{Platform: platform, Version: v}, true
+		}
+	}
 
-	return index(&u)
+	return ReleaseVersion{}, false
 }
 
 // Product represents a Apple open source project.
 type Product struct {
-	Name       string
-	Version    string
-	Updated    bool // for release only
-	ComingSoon bool // for release only
+	Name       string `json:"name" yaml:"name"`
+	Version    string `json:"version,omitempty" yaml:"version,omitempty"`
+	Updated    bool   `json:"updated,omitempty" yaml:"updated,omitempty"`         // for release only
+	ComingSoon bool   `json:"coming_soon,omitempty" yaml:"coming_soon,omitempty"` // for release only
 }
 
 // Tarball return the tarballs resource download uri.
 func (p *Product) Tarball() string {
-	return rooturi + path.Join(TarballsResource.String(), p.Name, fmt.Sprintf("%s-%s.tar.gz", p.Name, p.Version))
+	return rooturi + p.tarballPath()
 }
 
 // Source return the source resource page uri.
 func (p *Product) Source() string {
-	return rooturi + path.Join(SourceResource.String(), p.Name, fmt.Sprintf("%s-%s", p.Name, p.Version))
+	return rooturi + p.sourcePath()
+}
+
+func (p *Product) tarballPath() string {
+	return path.Join(TarballsResource.String(), p.Name, fmt.Sprintf("%s-%s.tar.gz", p.Name, p.Version))
+}
+
+func (p *Product) sourcePath() string {
+	return path.Join(SourceResource.String(), p.Name, fmt.Sprintf("%s-%s", p.Name, p.Version))
+}
+
+// TarballURL return the tarballs resource download uri of p on c.BaseURL.
+func (c *Client) TarballURL(p Product) string {
+	return c.baseURI() + p.tarballPath()
+}
+
+// SourceURL return the source resource page uri of p on c.BaseURL.
+func (c *Client) SourceURL(p Product) string {
+	return c.baseURI() + p.sourcePath()
 }
 
 // ListProject parses the project list HTML DOM, and return the project list.
@@ -233,6 +356,32 @@ func trimZeros(version string) string {
 // ComingSoon is a Apple's comming soon message.
 const ComingSoon = "(coming soon!)"
 
+// ListReleases parses the release list HTML DOM of the top page, and return the releases in order of the links.
+//
+// The links which are not the release pages, or whose version is unknown, are ignored.
+func ListReleases(buf []byte) ([]ReleaseVersion, error) {
+	dom, err := goquery.NewDocumentFromReader(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+
+	var releases []ReleaseVersion
+	seen := make(map[ReleaseVersion]bool)
+	dom.Find("a[href]").Each(func(i int, s *goquery.Selection) {
+		u, err := url.Parse(s.AttrOr("href", ""))
+		if err != nil || path.Base(path.Dir(u.Path)) != "release" || path.Ext(u.Path) != ".html" {
+			return
+		}
+		name := strings.TrimSuffix(path.Base(u.Path), ".html")
+		if r, ok := parseReleaseLink(name, s.Text()); ok && !seen[r] {
+			seen[r] = true
+			releases = append(releases, r)
+		}
+	})
+
+	return releases, nil
+}
+
 // ListRelease parses the release page HTML DOM, and return the Project slice.
 func ListRelease(buf []byte) ([]Product, error) {
 	dom, err := goquery.NewDocumentFromReader(bytes.NewReader(buf))
@@ -5,43 +5,62 @@
 package appleopensource
 
 import (
-	"fmt"
-	"io/ioutil"
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
 	"os"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 )
 
-// timestamp date of created the testdata from https://opensource.apple.com.
-const timestamp = "2019-04-09"
+// fixtures is the directory of the opensource.apple.com responses replayed by the ReplayTransport.
+//
+// They are not recorded by the aos fixture command. The bodies are the legacy golden pages fetched at
+// 2019-04-09, which are wrapped by hand into the fixture layout, so that the URL, the Content-Length and
+// the other metadata of the .json files are made up. Record the real ones into the new directory by:
+//
+//	aos fixture record testdata/fixtures/<date> list
+//	aos fixture record testdata/fixtures/<date> list --source
+//	aos fixture record testdata/fixtures/<date> versions Csu
+//	aos fixture record testdata/fixtures/<date> versions --source xnu
+//	aos fixture record testdata/fixtures/<date> release macos 10.12
+//	aos fixture record testdata/fixtures/<date> release xcode 7.3.1
+const fixtures = "testdata/fixtures/2019-04-09"
+
+// replayClient is the Client which replays the fixtures.
+var replayClient = &Client{
+	HTTPClient: &http.Client{Transport: &ReplayTransport{Dir: fixtures}},
+}
 
 var (
-	wantTarballsIndex []byte
-	wantSourceIndex   []byte
+	tarballsIndex []byte
+	sourceIndex   []byte
 
-	wantIndexVersionCsu []byte
-	wantIndexVersionXnu []byte
+	versionIndexCsu []byte
+	versionIndexXnu []byte
 
-	wantIndexReleaseMacOS []byte
-	wantIndexReleaseXcode []byte
+	releaseIndexMacOS []byte
+	releaseIndexXcode []byte
 )
 
 func TestMain(m *testing.M) {
-	wantTarballsIndex = readTestFile(fmt.Sprintf("testdata/index_tarballs_%s.golden", timestamp))
-	wantSourceIndex = readTestFile(fmt.Sprintf("testdata/index_source_%s.golden", timestamp))
+	ctx := context.Background()
 
-	wantIndexVersionCsu = readTestFile(fmt.Sprintf("testdata/version_Csu_%s.golden", timestamp))
-	wantIndexVersionXnu = readTestFile(fmt.Sprintf("testdata/version_xnu_%s.golden", timestamp))
+	tarballsIndex = mustIndex(replayClient.IndexProject(ctx, TarballsResource))
+	sourceIndex = mustIndex(replayClient.IndexProject(ctx, SourceResource))
 
-	wantIndexReleaseMacOS = readTestFile(fmt.Sprintf("testdata/release_macos_1012_%s.golden", timestamp))
-	wantIndexReleaseXcode = readTestFile(fmt.Sprintf("testdata/release_xcode_731_%s.golden", timestamp))
+	versionIndexCsu = mustIndex(replayClient.IndexVersion(ctx, "Csu", TarballsResource))
+	versionIndexXnu = mustIndex(replayClient.IndexVersion(ctx, "xnu", SourceResource))
+
+	releaseIndexMacOS = mustIndex(replayClient.IndexRelease(ctx, MacOS, "10.12"))
+	releaseIndexXcode = mustIndex(replayClient.IndexRelease(ctx, Xcode, "7.3.1"))
 
 	os.Exit(m.Run())
 }
 
-func readTestFile(filename string) []byte {
-	buf, err := ioutil.ReadFile(filename)
+func mustIndex(buf []byte, err error) []byte {
 	if err != nil {
 		panic(err)
 	}
@@ -158,119 +177,235 @@ func TestProject_Source(t *testing.T) {
 }
 
 func TestIndexProject(t *testing.T) {
-	type args struct {
-		typ ResourceType
-	}
 	tests := []struct {
-		name    string
-		args    args
-		want    []byte
-		wantErr bool
+		name      string
+		typ       ResourceType
+		wantLen   int
+		wantFirst string
+		wantLast  string
 	}{
 		{
-			name:    "tarballs",
-			args:    args{typ: TarballsResource},
-			want:    wantTarballsIndex,
-			wantErr: false,
+			name:      "tarballs",
+			typ:       TarballsResource,
+			wantLen:   511,
+			wantFirst: "Apple16X50Serial",
+			wantLast:  "zsh",
 		},
 		{
-			name:    "source",
-			args:    args{typ: SourceResource},
-			want:    wantSourceIndex,
-			wantErr: false,
+			name:      "source",
+			typ:       SourceResource,
+			wantLen:   509,
+			wantFirst: "Apple16X50Serial",
+			wantLast:  "zsh",
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := IndexProject(tt.args.typ)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("IndexProject(%v) error = %v, wantErr %v", tt.args.typ, err, tt.wantErr)
-				return
+			buf, err := replayClient.IndexProject(context.Background(), tt.typ)
+			if err != nil {
+				t.Fatalf("IndexProject(%v) error = %v", tt.typ, err)
 			}
-			if diff := cmp.Diff(got, tt.want); diff != "" {
-				t.Errorf("%s: (-got, +want)\n%s", tt.name, diff)
-				return
+			if !bytes.HasPrefix(buf, []byte("<table>")) {
+				t.Errorf("IndexProject(%v) is not the index table: %.40q", tt.typ, buf)
+			}
+
+			got, err := ListProject(buf)
+			if err != nil {
+				t.Fatalf("ListProject() error = %v", err)
+			}
+			if len(got) != tt.wantLen {
+				t.Fatalf("ListProject() len = %d, want %d", len(got), tt.wantLen)
+			}
+			if got[0].Name != tt.wantFirst || got[len(got)-1].Name != tt.wantLast {
+				t.Errorf("ListProject() = [%s ... %s], want [%s ... %s]", got[0].Name, got[len(got)-1].Name, tt.wantFirst, tt.wantLast)
 			}
 		})
 	}
 }
 
 func TestIndexVersion(t *testing.T) {
-	type args struct {
-		project string
-		typ     ResourceType
-	}
 	tests := []struct {
 		name    string
-		args    args
-		want    []byte
+		project string
+		typ     ResourceType
+		want    []string
 		wantErr bool
 	}{
 		{
 			name:    "Csu (tarball)",
-			args:    args{project: "Csu", typ: TarballsResource},
-			want:    wantIndexVersionCsu,
-			wantErr: false,
+			project: "Csu",
+			typ:     TarballsResource,
+			want:    []string{"36", "37", "45", "46", "47", "57", "58", "58.1.1", "71", "75", "76", "79", "85"},
 		},
 		{
-			name:    "xnu (source)",
-			args:    args{project: "xnu", typ: SourceResource},
-			want:    wantIndexVersionXnu,
-			wantErr: false,
+			name:    "not recorded",
+			project: "dyld",
+			typ:     TarballsResource,
+			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := IndexVersion(tt.args.project, tt.args.typ)
+			buf, err := replayClient.IndexVersion(context.Background(), tt.project, tt.typ)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("IndexVersion(%v, %v) error = %v, wantErr %v", tt.args.project, tt.args.typ, err, tt.wantErr)
+				t.Fatalf("IndexVersion(%v, %v) error = %v, wantErr %v", tt.project, tt.typ, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("IndexVersion(%v, %v) error = %v, want os.ErrNotExist", tt.project, tt.typ, err)
+				}
 				return
 			}
-			got = append(got, byte('\n'))
 
-			if diff := cmp.Diff(string(got), string(tt.want)); diff != "" {
+			got, err := ListVersions(buf)
+			if err != nil {
+				t.Fatalf("ListVersions() error = %v", err)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
 				t.Errorf("%s: (-got, +want)\n%s", tt.name, diff)
-				return
 			}
 		})
 	}
 }
 
 func TestIndexRelease(t *testing.T) {
-	type args struct {
-		platform Platform
-		version  string
-	}
 	tests := []struct {
-		name    string
-		args    args
-		want    []byte
-		wantErr bool
+		name           string
+		platform       Platform
+		version        string
+		wantLen        int
+		wantUpdated    int
+		wantComingSoon int
+		want           Product
 	}{
 		{
-			name:    "macos 10.12",
-			args:    args{platform: MacOS, version: "10.12"},
-			want:    wantIndexReleaseMacOS,
-			wantErr: false,
+			name:           "macos 10.12",
+			platform:       MacOS,
+			version:        "10.12",
+			wantLen:        205,
+			wantComingSoon: 1,
+			want:           Product{Name: "xnu", Version: "3789.1.32"},
 		},
 		{
-			name:    "Xcode 7.3.1",
-			args:    args{platform: Xcode, version: "7.3.1"},
-			want:    wantIndexReleaseXcode,
-			wantErr: false,
+			name:        "Xcode 7.3.1",
+			platform:    Xcode,
+			version:     "7.3.1",
+			wantLen:     15,
+			wantUpdated: 3,
+			want:        Product{Name: "CoreOSMakefiles", Version: "77"},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := IndexRelease(tt.args.platform, tt.args.version)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("IndexRelease(%v, %v) error = %v, wantErr %v", tt.args.platform, tt.args.version, err, tt.wantErr)
-				return
+			buf, err := replayClient.IndexRelease(context.Background(), tt.platform, tt.version)
+			if err != nil {
+				t.Fatalf("IndexRelease(%v, %v) error = %v", tt.platform, tt.version, err)
 			}
-			if diff := cmp.Diff(string(got), string(tt.want)); diff != "" {
-				t.Errorf("%s: (-got, +want)\n%s", tt.name, diff)
-				return
+
+			got, err := ListRelease(buf)
+			if err != nil {
+				t.Fatalf("ListRelease() error = %v", err)
+			}
+			if len(got) != tt.wantLen {
+				t.Fatalf("ListRelease() len = %d, want %d", len(got), tt.wantLen)
+			}
+
+			var updated, comingSoon int
+			var found bool
+			for _, p := range got {
+				if p.Updated {
+					updated++
+				}
+				if p.ComingSoon {
+					comingSoon++
+				}
+				if p == tt.want {
+					found = true
+				}
+			}
+			if updated != tt.wantUpdated || comingSoon != tt.wantComingSoon {
+				t.Errorf("ListRelease() has %d updated and %d coming soon, want %d and %d", updated, comingSoon, tt.wantUpdated, tt.wantComingSoon)
+			}
+			if !found {
+				t.Errorf("ListRelease() does not have %+v", tt.want)
 			}
 		})
 	}
 }
+
+func TestClient_releaseURL(t *testing.T) {
+	tests := []struct {
+		platform Platform
+		version  string
+		want     string
+	}{
+		{MacOS, "11.0.1", "https://opensource.apple.com/release/macos-1101.html"},
+		{MacOS, "10.12", "https://opensource.apple.com/release/macos-1012.html"},
+		{MacOS, "10.11.6", "https://opensource.apple.com/release/os-x-10116.html"},
+		{MacOS, "10.9", "https://opensource.apple.com/release/os-x-109.html"},
+		{MacOS, "10.8.5", "https://opensource.apple.com/release/mac-os-x-1085.html"},
+		{MacOS, "10.4.11.x86", "https://opensource.apple.com/release/mac-os-x-10411x86.html"},
+		{MacOS, "10.2.8.G5", "https://opensource.apple.com/release/mac-os-x-1028G5.html"},
+		{Xcode, "7.3.1", "https://opensource.apple.com/release/developer-tools-731.html"},
+		{IOS, "10.2", "https://opensource.apple.com/release/ios-102.html"},
+		{Server, "5.2", "https://opensource.apple.com/release/os-x-server-52.html"},
+	}
+	c := &Client{}
+	for _, tt := range tests {
+		u, err := c.releaseURL(tt.platform, tt.version)
+		if err != nil {
+			t.Errorf("releaseURL(%v, %q) error = %v", tt.platform, tt.version, err)
+			continue
+		}
+		if got := u.String(); got != tt.want {
+			t.Errorf("releaseURL(%v, %q) = %q, want %q", tt.platform, tt.version, got, tt.want)
+		}
+	}
+
+	// all known releases have the release page
+	for _, r := range KnownReleases() {
+		if _, err := c.releaseURL(r.Platform, r.Version); err != nil {
+			t.Errorf("releaseURL(%v, %q) error = %v", r.Platform, r.Version, err)
+		}
+	}
+	if _, err := c.releaseURL(Unknown, "1.0"); err == nil {
+		t.Error("releaseURL() of the unknown platform error = nil, want error")
+	}
+}
+
+func TestListReleases(t *testing.T) {
+	buf := []byte(`<div class="release-list"><ul>
+<li><a href="/release/macos-1161.html">macOS 11.6.1</a></li>
+<li><a href="/release/macos-10141.html">macOS 10.14.1</a></li>
+<li><a href="/release/macos-10141.html">10.14.1</a></li>
+<li><a href="/release/os-x-1011.html">OS X 10.11</a></li>
+<li><a href="/release/mac-os-x-1011.html">Mac OS X 10.1.1</a></li>
+<li><a href="/release/mac-os-x-10411x86.html">Mac OS X 10.4.11 (x86)</a></li>
+<li><a href="/release/mac-os-x-1049ppc.html">Mac OS X 10.4.9 (PowerPC)</a></li>
+<li><a href="/release/developer-tools-1231.html">Xcode 12.3.1</a></li>
+<li><a href="https://opensource.apple.com/release/ios-151.html">iOS 15.1</a></li>
+<li><a href="/release/os-x-server-52.html">5.2</a></li>
+<li><a href="/release/macos-999.html">macOS Future</a></li>
+<li><a href="/release/watchos-80.html">watchOS 8.0</a></li>
+<li><a href="/tarballs/">Tarballs</a></li>
+</ul></div>`)
+
+	got, err := ListReleases(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ReleaseVersion{
+		{Platform: MacOS, Version: "11.6.1"},
+		{Platform: MacOS, Version: "10.14.1"},
+		{Platform: MacOS, Version: "10.11"},
+		{Platform: MacOS, Version: "10.1.1"},
+		{Platform: MacOS, Version: "10.4.11.x86"},
+		{Platform: MacOS, Version: "10.4.9.ppc"},
+		{Platform: Xcode, Version: "12.3.1"},
+		{Platform: IOS, Version: "15.1"},
+		{Platform: Server, Version: "5.2"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ListReleases() mismatch (-want +got):\n%s", diff)
+	}
+}
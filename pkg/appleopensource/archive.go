@@ -0,0 +1,187 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/multierr"
+)
+
+// walkArchive walks the regular files in the fname tarball archive, and calls fn for each file.
+//
+// The name passed to fn is the slash separated path of the file which is stripped the top-level
+// directory such as "xnu-4903.221.2/", so the same file of the different versions has the same name.
+func walkArchive(fname string, fn func(name string, r io.Reader) error) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			// nothing to do
+		default:
+			continue
+		}
+
+		name := stripTopDir(hdr.Name)
+		if name == "" {
+			continue
+		}
+		if err := fn(name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// stripTopDir strips the top-level directory of the archive entry name.
+func stripTopDir(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if i := strings.IndexByte(name, '/'); i >= 0 {
+		return name[i+1:]
+	}
+
+	return ""
+}
+
+// isLocalPath reports whether the slash separated relative path name is within the directory.
+func isLocalPath(name string) bool {
+	name = path.Clean(name)
+	return name != "." && name != ".." && !strings.HasPrefix(name, "../") && !path.IsAbs(name)
+}
+
+// isLocalLink reports whether the target of the symbolic link of the slash separated relative path name
+// is within the directory.
+func isLocalLink(name, linkname string) bool {
+	if path.IsAbs(linkname) {
+		return false
+	}
+	target := path.Join(path.Dir(name), linkname)
+
+	return target == "." || isLocalPath(target)
+}
+
+// checkSymlinks returns an error if any existing element of the slash separated relative path name in dir
+// is a symbolic link, so that writing to the path does not follow the link out of dir.
+func checkSymlinks(dir, name string) error {
+	p := dir
+	for _, elem := range strings.Split(path.Clean(name), "/") {
+		p = filepath.Join(p, elem)
+		fi, err := os.Lstat(p)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s: the path is through the symbolic link %s", name, p)
+		}
+	}
+
+	return nil
+}
+
+// extractArchive extracts the directories, the regular files and the symbolic links in the fname tarball
+// archive into dst with stripping the top-level directory, same as walkArchive.
+//
+// The symbolic links whose target is out of dst are rejected, and the entries are never written through
+// the extracted symbolic links.
+func extractArchive(fname, dst string) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := stripTopDir(hdr.Name)
+		if name == "" {
+			continue
+		}
+		if !isLocalPath(name) {
+			return fmt.Errorf("%s: the archive entry is out of the directory: %s", fname, hdr.Name)
+		}
+		if hdr.Typeflag == tar.TypeSymlink && !isLocalLink(name, hdr.Linkname) {
+			return fmt.Errorf("%s: the symbolic link is out of the directory: %s -> %s", fname, hdr.Name, hdr.Linkname)
+		}
+		if err := checkSymlinks(dst, name); err != nil {
+			return fmt.Errorf("%s: %w", fname, err)
+		}
+		target := filepath.Join(dst, filepath.FromSlash(name))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeReg, tar.TypeRegA:
+			err = extractFile(target, tr, hdr.FileInfo().Mode().Perm())
+		case tar.TypeSymlink:
+			if err = os.MkdirAll(filepath.Dir(target), 0755); err == nil {
+				err = os.Symlink(hdr.Linkname, target)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// extractFile writes r to the fname file with the mode.
+func extractFile(fname string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(fname, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode|0200)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		return multierr.Combine(err, f.Close())
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,119 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeArchiveEntries writes the tar headers into the fname tarball. The regular files have the contents "x".
+func writeArchiveEntries(t *testing.T, fname string, hdrs []*tar.Header) {
+	t.Helper()
+
+	f, err := os.Create(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	for _, hdr := range hdrs {
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Mode, hdr.Size = 0644, 1
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte("x")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractArchive(t *testing.T) {
+	tests := []struct {
+		name    string
+		hdrs    []*tar.Header
+		wantErr bool
+	}{
+		{
+			name: "local links",
+			hdrs: []*tar.Header{
+				{Name: "xnu/libkern/c++/OSKext.cpp", Typeflag: tar.TypeReg},
+				{Name: "xnu/libkern/kext.cpp", Typeflag: tar.TypeSymlink, Linkname: "c++/OSKext.cpp"},
+				{Name: "xnu/bsd/libkern", Typeflag: tar.TypeSymlink, Linkname: "../libkern"},
+				{Name: "xnu/self", Typeflag: tar.TypeSymlink, Linkname: "."},
+			},
+		},
+		{
+			name: "absolute link",
+			hdrs: []*tar.Header{
+				{Name: "xnu/escape", Typeflag: tar.TypeSymlink, Linkname: "/tmp"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "parent link",
+			hdrs: []*tar.Header{
+				{Name: "xnu/bsd/escape", Typeflag: tar.TypeSymlink, Linkname: "../../outside"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "file through the link",
+			hdrs: []*tar.Header{
+				{Name: "xnu/self", Typeflag: tar.TypeSymlink, Linkname: "."},
+				{Name: "xnu/escape", Typeflag: tar.TypeSymlink, Linkname: "self/.."},
+				{Name: "xnu/escape/outside/pwned", Typeflag: tar.TypeReg},
+			},
+			wantErr: true,
+		},
+		{
+			name: "file overwriting the link",
+			hdrs: []*tar.Header{
+				{Name: "xnu/file", Typeflag: tar.TypeReg},
+				{Name: "xnu/link", Typeflag: tar.TypeSymlink, Linkname: "file"},
+				{Name: "xnu/link", Typeflag: tar.TypeReg},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			fname := filepath.Join(root, "xnu.tar.gz")
+			writeArchiveEntries(t, fname, tt.hdrs)
+			dst := filepath.Join(root, "dst")
+
+			err := extractArchive(fname, dst)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("extractArchive() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, err := os.Stat(filepath.Join(root, "outside")); err == nil {
+				t.Error("extractArchive() wrote out of the directory")
+			}
+			if !tt.wantErr {
+				buf, err := ioutil.ReadFile(filepath.Join(dst, "bsd", "libkern", "kext.cpp"))
+				if err != nil || string(buf) != "x" {
+					t.Errorf("extracted file through the local link = %q, %v", buf, err)
+				}
+			}
+		})
+	}
+}
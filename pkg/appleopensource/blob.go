@@ -0,0 +1,327 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+// ErrBlobNotFound is returned by BlobStore.Lookup when the product version is not stored.
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore is a content-addressed store of the tarballs.
+//
+// Each blob is stored as <Dir>/sha256/<digest> which is the hex encoded SHA-256 of the contents,
+// and indexed by the <Dir>/index/<product>/<version> file which contains the digest.
+type BlobStore struct {
+	Dir string
+
+	usage diskUsage
+
+	mu   sync.Mutex
+	pins map[Product]int // the number of the users of each product blob, which is never evicted
+}
+
+// NewBlobStore returns the BlobStore which stores the blobs into the dir directory.
+func NewBlobStore(dir string) *BlobStore {
+	return &BlobStore{Dir: dir}
+}
+
+// Path returns the blob file path of the digest.
+func (s *BlobStore) Path(digest string) string {
+	return filepath.Join(s.Dir, "sha256", digest)
+}
+
+// indexPath returns the index file path of the product version.
+func (s *BlobStore) indexPath(product, version string) string {
+	return filepath.Join(s.Dir, "index", product, version)
+}
+
+// Lookup returns the digest of the product version blob, or ErrBlobNotFound if not stored.
+func (s *BlobStore) Lookup(product, version string) (string, error) {
+	digest, _, err := s.Stat(product, version)
+	if err != nil {
+		return "", err
+	}
+
+	// the modification time of the index file is the last used time of the blob for the eviction.
+	// the blob itself is not touched because it may be hard-linked to the fetched files.
+	now := time.Now()
+	_ = os.Chtimes(s.indexPath(product, version), now, now)
+
+	return digest, nil
+}
+
+// Stat returns the digest and the size of the product version blob, or ErrBlobNotFound if not stored.
+// Unlike Lookup, it does not update the last used time of the blob.
+func (s *BlobStore) Stat(product, version string) (string, int64, error) {
+	buf, err := ioutil.ReadFile(s.indexPath(product, version))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", 0, ErrBlobNotFound
+		}
+		return "", 0, err
+	}
+
+	digest := strings.TrimSpace(string(buf))
+	fi, err := os.Stat(s.Path(digest))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", 0, ErrBlobNotFound // the blob is removed but the index is left
+		}
+		return "", 0, err
+	}
+
+	return digest, fi.Size(), nil
+}
+
+// Put stores the r contents as the product version blob, and return the digest.
+func (s *BlobStore) Put(product, version string, r io.Reader) (string, error) {
+	digest, err := s.store(r)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.index(product, version, digest); err != nil {
+		return "", err
+	}
+
+	return digest, nil
+}
+
+// tempFile creates the temporary file in the store, which is renamed to the blob by putFile.
+func (s *BlobStore) tempFile() (*os.File, error) {
+	dir := filepath.Join(s.Dir, "sha256")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return ioutil.TempFile(dir, ".blob.*")
+}
+
+// putFile stores the fname file created by tempFile as the blob of the product version, and return the digest.
+// The fname file is moved into the store, or removed on failure.
+func (s *BlobStore) putFile(product, version, fname string) (string, error) {
+	digest, _, err := sumFile(fname)
+	if err != nil {
+		return "", multierr.Combine(err, os.Remove(fname))
+	}
+	if err := s.commit(fname, digest); err != nil {
+		return "", err
+	}
+
+	if err := s.index(product, version, digest); err != nil {
+		return "", err
+	}
+
+	return digest, nil
+}
+
+// store stores the r contents as the blob without any index, and return the digest.
+func (s *BlobStore) store(r io.Reader) (string, error) {
+	tmp, err := s.tempFile()
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), r); err != nil {
+		return "", multierr.Combine(err, tmp.Close(), os.Remove(tmp.Name()))
+	}
+	if err := tmp.Close(); err != nil {
+		return "", multierr.Combine(err, os.Remove(tmp.Name()))
+	}
+
+	digest := hex.EncodeToString(h.Sum(nil))
+	if err := s.commit(tmp.Name(), digest); err != nil {
+		return "", err
+	}
+
+	return digest, nil
+}
+
+// commit moves the tmp file created by tempFile to the digest blob. The tmp file is removed on failure.
+func (s *BlobStore) commit(tmp, digest string) error {
+	fi, err := os.Stat(tmp)
+	if err != nil {
+		return multierr.Combine(err, os.Remove(tmp))
+	}
+	// the blob is read-only, so that the hard-linked file can not modify the stored contents
+	if err := os.Chmod(tmp, 0444); err != nil {
+		return multierr.Combine(err, os.Remove(tmp))
+	}
+	if err := os.Rename(tmp, s.Path(digest)); err != nil {
+		return multierr.Combine(err, os.Remove(tmp))
+	}
+	s.usage.add(fi.Size())
+
+	return nil
+}
+
+// pin prevents the product version blob from the eviction until the returned unpin is called.
+// The product is pinned even if not stored yet, so that the blob stored by the caller is kept until it is used.
+func (s *BlobStore) pin(product, version string) (unpin func()) {
+	p := Product{Name: product, Version: version}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pins == nil {
+		s.pins = make(map[Product]int)
+	}
+	s.pins[p]++
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.pins[p]--; s.pins[p] == 0 {
+			delete(s.pins, p)
+		}
+	}
+}
+
+// pinned reports whether any product of the item is pinned.
+func (s *BlobStore) pinned(item *CacheItem) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range item.Products {
+		if s.pins[p] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// diskUsage implements a usageTracker interface.
+func (s *BlobStore) diskUsage() *diskUsage {
+	return &s.usage
+}
+
+// index indexes the digest blob as the product version.
+func (s *BlobStore) index(product, version, digest string) error {
+	fname := s.indexPath(product, version)
+	if err := os.MkdirAll(filepath.Dir(fname), 0700); err != nil {
+		return err
+	}
+
+	return writeFile(fname, strings.NewReader(digest+"\n"))
+}
+
+// Link makes the digest blob available as the dst file.
+//
+// It hard-links the blob to dst, or copies the blob if the hard-link is not possible such as the dst is
+// on the other filesystem. The existing dst file is replaced.
+func (s *BlobStore) Link(digest, dst string) error {
+	src := s.Path(digest)
+
+	tmp := filepath.Join(filepath.Dir(dst), fmt.Sprintf(".%s.%s", filepath.Base(dst), digest[:8]))
+	if err := os.Link(src, tmp); err == nil {
+		return os.Rename(tmp, dst)
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return writeFile(dst, f)
+}
+
+// Items implements a Evictable interface.
+func (s *BlobStore) Items() ([]*CacheItem, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(s.Dir, "sha256"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	blobs := make(map[string]*CacheItem)
+	for _, fi := range infos {
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+			continue // the temporary file of Put
+		}
+		blobs[fi.Name()] = &CacheItem{
+			Category: CategoryTarballs,
+			Key:      fi.Name(),
+			Size:     fi.Size(),
+			LastUsed: fi.ModTime(),
+		}
+	}
+
+	indexDir := filepath.Join(s.Dir, "index")
+	err = filepath.Walk(indexDir, func(fname string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+			return nil
+		}
+
+		buf, err := ioutil.ReadFile(fname)
+		if err != nil {
+			return err
+		}
+		item, ok := blobs[strings.TrimSpace(string(buf))]
+		if !ok {
+			return nil // the blob is removed but the index is left
+		}
+
+		rel, err := filepath.Rel(indexDir, fname)
+		if err != nil {
+			return err
+		}
+		product, version := filepath.Split(rel)
+		item.Products = append(item.Products, Product{Name: filepath.Clean(product), Version: version})
+		if fi.ModTime().After(item.LastUsed) {
+			item.LastUsed = fi.ModTime()
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	items := make([]*CacheItem, 0, len(blobs))
+	for _, item := range blobs {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+
+	return items, nil
+}
+
+// Evict implements a Evictable interface.
+//
+// It removes the blob and the index of its products. The files linked by Link are not removed.
+func (s *BlobStore) Evict(item *CacheItem) error {
+	for _, p := range item.Products {
+		fname := s.indexPath(p.Name, p.Version)
+		if err := os.Remove(fname); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		_ = os.Remove(filepath.Dir(fname)) // removes the product directory if empty
+	}
+
+	if err := os.Remove(s.Path(item.Key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
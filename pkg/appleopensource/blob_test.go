@@ -0,0 +1,109 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseTarball(t *testing.T) {
+	tests := []struct {
+		name    string
+		uri     string
+		want    Product
+		wantErr bool
+	}{
+		{
+			name: "xnu",
+			uri:  "https://opensource.apple.com/tarballs/xnu/xnu-4903.221.2.tar.gz",
+			want: Product{Name: "xnu", Version: "4903.221.2"},
+		},
+		{
+			name: "hyphenated name",
+			uri:  "https://opensource.apple.com/tarballs/libdispatch-legacy/libdispatch-legacy-1.tar.gz",
+			want: Product{Name: "libdispatch-legacy", Version: "1"},
+		},
+		{
+			name:    "source",
+			uri:     "https://opensource.apple.com/source/xnu/xnu-4903.221.2",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTarball(tt.uri)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTarball(%q) error = %v, wantErr %v", tt.uri, err, tt.wantErr)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("%s: (-got, +want)\n%s", tt.name, diff)
+			}
+		})
+	}
+}
+
+func TestClient_FetchBlobs(t *testing.T) {
+	content := []byte(strings.Repeat("xnu tarball contents\n", 100))
+
+	var gets int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tarballs/xnu/xnu-1.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodGet {
+			atomic.AddInt32(&gets, 1)
+		}
+		http.ServeContent(w, r, "xnu-1.tar.gz", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	c := &Client{Blobs: NewBlobStore(t.TempDir())}
+	uri := srv.URL + "/tarballs/xnu/xnu-1.tar.gz"
+
+	for _, dst := range []string{t.TempDir(), t.TempDir()} {
+		if err := c.Fetch(context.Background(), dst, uri); err != nil {
+			t.Fatalf("Fetch() error = %v", err)
+		}
+		got, err := ioutil.ReadFile(filepath.Join(dst, "xnu-1.tar.gz"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Errorf("Fetch() wrote %d bytes, want %d bytes", len(got), len(content))
+		}
+	}
+	if got := atomic.LoadInt32(&gets); got != DefaultConcurrency {
+		t.Errorf("Fetch() sent %d GET requests, want %d range requests of the first fetch only", got, DefaultConcurrency)
+	}
+
+	digest, err := c.Blobs.Lookup("xnu", "1")
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+	got, err := ioutil.ReadFile(c.Blobs.Path(digest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("stored blob has %d bytes, want %d bytes", len(got), len(content))
+	}
+
+	if _, err := c.Blobs.Lookup("xnu", "2"); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Lookup() not stored version error = %v, want ErrBlobNotFound", err)
+	}
+}
@@ -0,0 +1,602 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"go.uber.org/multierr"
+)
+
+// bundleVersion is the format version of the bundle.
+const bundleVersion = 1
+
+// list of the bundle entry names.
+const (
+	bundleManifest    = "manifest.json"
+	bundlePagesDir    = "pages"
+	bundleTarballsDir = "tarballs"
+)
+
+// BundleManifest represents the contents of the bundle.
+type BundleManifest struct {
+	Version   int              `json:"version" yaml:"version"`
+	CreatedAt time.Time        `json:"created_at" yaml:"created_at"`
+	Pages     []*BundlePage    `json:"pages" yaml:"pages"`
+	Tarballs  []*BundleTarball `json:"tarballs" yaml:"tarballs"`
+}
+
+// BundlePage represents the cached index page in the bundle.
+type BundlePage struct {
+	URL          string    `json:"url" yaml:"url"`
+	FetchedAt    time.Time `json:"fetched_at" yaml:"fetched_at"`
+	ETag         string    `json:"etag,omitempty" yaml:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty" yaml:"last_modified,omitempty"`
+	SHA256       string    `json:"sha256" yaml:"sha256"`
+	Size         int64     `json:"size" yaml:"size"`
+}
+
+// BundleTarball represents the stored tarball in the bundle.
+type BundleTarball struct {
+	Product Product `json:"product" yaml:"product"`
+	SHA256  string  `json:"sha256" yaml:"sha256"`
+	Size    int64   `json:"size" yaml:"size"`
+}
+
+// BundleOptions represents the options of ExportBundle.
+//
+// If Release is set, the bundle contains the release page, the project lists, and the version lists and
+// the tarballs of the projects in the release, which are fetched if not cached.
+// If only Projects is set, the bundle contains the project lists, and the version lists and all stored
+// tarballs of the projects. Otherwise the bundle contains all cached pages and stored tarballs.
+type BundleOptions struct {
+	// Platform is the platform of Release.
+	Platform Platform
+
+	// Release is the release version of Platform.
+	Release string
+
+	// Projects limits the projects of the bundle.
+	Projects []string
+}
+
+// ExportBundle writes the bundle of c.Cache and c.Blobs to w as the zstd compressed tar, and returns its manifest.
+//
+// The bundle consists of the "manifest.json", the "pages/<sha256>" bodies of the pages, and the
+// "tarballs/<sha256>" tarballs, and is imported by ImportBundle.
+func (c *Client) ExportBundle(ctx context.Context, w io.Writer, opts *BundleOptions) (*BundleManifest, error) {
+	if c.Cache == nil || c.Blobs == nil {
+		return nil, errors.New("could not export the bundle without the cache")
+	}
+	if opts == nil {
+		opts = &BundleOptions{}
+	}
+
+	b := &bundler{
+		c:        c,
+		pages:    make(map[string][]byte),
+		tarballs: make(map[string]bool),
+		manifest: &BundleManifest{
+			Version:   bundleVersion,
+			CreatedAt: time.Now().UTC(),
+			Pages:     []*BundlePage{},
+			Tarballs:  []*BundleTarball{},
+		},
+	}
+	defer func() {
+		for _, unpin := range b.unpins {
+			unpin()
+		}
+	}()
+
+	var err error
+	switch {
+	case opts.Release != "":
+		err = b.addRelease(ctx, opts.Platform, opts.Release, opts.Projects)
+	case len(opts.Projects) > 0:
+		err = b.addProjects(ctx, opts.Projects)
+	default:
+		err = b.addAll()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.write(w); err != nil {
+		return nil, err
+	}
+
+	return b.manifest, nil
+}
+
+// bundler collects the contents of the bundle.
+type bundler struct {
+	c        *Client
+	manifest *BundleManifest
+
+	pages    map[string][]byte // the bodies of the pages by the sha256
+	tarballs map[string]bool   // the added tarballs by the "<product>/<version>"
+	unpins   []func()          // unpins the tarballs stored while bundling, which must be kept until written
+}
+
+// addPage adds the uri page, and fetches it if not cached.
+func (b *bundler) addPage(ctx context.Context, uri string) error {
+	if _, err := b.c.get(ctx, uri); err != nil {
+		return err
+	}
+
+	return b.addCachedPage(uri)
+}
+
+// addCachedPage adds the cached uri page.
+func (b *bundler) addCachedPage(uri string) error {
+	for _, p := range b.manifest.Pages {
+		if p.URL == uri {
+			return nil
+		}
+	}
+
+	e, err := b.c.Cache.Get(uri)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(e.Body)
+	digest := hex.EncodeToString(sum[:])
+	b.pages[digest] = e.Body
+	b.manifest.Pages = append(b.manifest.Pages, &BundlePage{
+		URL:          e.URL,
+		FetchedAt:    e.FetchedAt,
+		ETag:         e.ETag,
+		LastModified: e.LastModified,
+		SHA256:       digest,
+		Size:         int64(len(e.Body)),
+	})
+
+	return nil
+}
+
+// addTarball adds the p tarball of digest.
+func (b *bundler) addTarball(p Product, digest string) error {
+	key := p.Name + "/" + p.Version
+	if b.tarballs[key] {
+		return nil
+	}
+
+	fi, err := os.Stat(b.c.Blobs.Path(digest))
+	if err != nil {
+		return err
+	}
+
+	b.tarballs[key] = true
+	b.manifest.Tarballs = append(b.manifest.Tarballs, &BundleTarball{
+		Product: Product{Name: p.Name, Version: p.Version},
+		SHA256:  digest,
+		Size:    fi.Size(),
+	})
+
+	return nil
+}
+
+// addProjectLists adds the project list pages of the tarballs and source resources.
+func (b *bundler) addProjectLists(ctx context.Context) error {
+	var errs []error
+	for _, typ := range []ResourceType{TarballsResource, SourceResource} {
+		errs = append(errs, b.addPage(ctx, b.c.projectURL(typ).String()))
+	}
+
+	return JoinNotCached(errs...)
+}
+
+// addRelease adds the platform release, and its projects filtered by the projects if not empty.
+func (b *bundler) addRelease(ctx context.Context, platform Platform, version string, projects []string) error {
+	u, err := b.c.releaseURL(platform, version)
+	if err != nil {
+		return err
+	}
+	if err := b.addPage(ctx, u.String()); err != nil {
+		return err
+	}
+	// reports all resources which are not cached in the offline mode
+	notCached := []error{b.addProjectLists(ctx)}
+	if err := notCached[0]; err != nil && !isNotCached(err) {
+		return err
+	}
+
+	index, err := b.c.IndexRelease(ctx, platform, version)
+	if err != nil {
+		return err
+	}
+	release, err := ListRelease(index)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range release {
+		if len(projects) > 0 && !containsString(projects, p.Name) {
+			continue
+		}
+		if err := b.addPage(ctx, b.c.versionURL(p.Name, TarballsResource).String()); err != nil {
+			if !isNotCached(err) {
+				return err
+			}
+			notCached = append(notCached, err)
+		}
+		if p.ComingSoon {
+			continue // the tarball is not published yet
+		}
+
+		p := Product{Name: p.Name, Version: p.Version}
+		b.unpins = append(b.unpins, b.c.Blobs.pin(p.Name, p.Version))
+		digest, err := b.c.storeTarball(ctx, p, b.c.TarballURL(p))
+		if err != nil {
+			if !isNotCached(err) {
+				return err
+			}
+			notCached = append(notCached, err)
+			continue
+		}
+		if err := b.addTarball(p, digest); err != nil {
+			return err
+		}
+	}
+
+	return JoinNotCached(notCached...)
+}
+
+// addProjects adds the version list pages and all stored tarballs of the projects.
+func (b *bundler) addProjects(ctx context.Context, projects []string) error {
+	errs := []error{b.addProjectLists(ctx)}
+	for _, name := range projects {
+		errs = append(errs, b.addPage(ctx, b.c.versionURL(name, TarballsResource).String()))
+	}
+	if err := JoinNotCached(errs...); err != nil {
+		return err
+	}
+
+	items, err := b.c.Blobs.Items()
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		for _, p := range item.Products {
+			if !containsString(projects, p.Name) {
+				continue
+			}
+			if err := b.addTarball(p, item.Key); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// addAll adds all cached pages and stored tarballs.
+func (b *bundler) addAll() error {
+	items, err := b.c.CacheItems()
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		switch item.Category {
+		case CategoryPages:
+			if err := b.addCachedPage(item.Key); err != nil {
+				return err
+			}
+		case CategoryTarballs:
+			for _, p := range item.Products {
+				if err := b.addTarball(p, item.Key); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// write writes the collected contents to w as the zstd compressed tar.
+func (b *bundler) write(w io.Writer) (err error) {
+	sort.Slice(b.manifest.Pages, func(i, j int) bool { return b.manifest.Pages[i].URL < b.manifest.Pages[j].URL })
+	sort.Slice(b.manifest.Tarballs, func(i, j int) bool {
+		ti, tj := b.manifest.Tarballs[i].Product, b.manifest.Tarballs[j].Product
+		if ti.Name != tj.Name {
+			return ti.Name < tj.Name
+		}
+		return ti.Version < tj.Version
+	})
+
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(zw)
+	defer func() {
+		err = multierr.Combine(err, tw.Close(), zw.Close())
+	}()
+
+	manifest, err := json.MarshalIndent(b.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeTarEntry(tw, bundleManifest, int64(len(manifest)), bytes.NewReader(manifest)); err != nil {
+		return err
+	}
+
+	written := make(map[string]bool)
+	for _, p := range b.manifest.Pages {
+		if written[p.SHA256] {
+			continue
+		}
+		written[p.SHA256] = true
+
+		body := b.pages[p.SHA256]
+		if err := writeTarEntry(tw, path.Join(bundlePagesDir, p.SHA256), int64(len(body)), bytes.NewReader(body)); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range b.manifest.Tarballs {
+		if written[t.SHA256] {
+			continue
+		}
+		written[t.SHA256] = true
+
+		if err := b.writeTarball(tw, t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeTarball writes the t tarball blob to tw.
+func (b *bundler) writeTarball(tw *tar.Writer, t *BundleTarball) error {
+	f, err := os.Open(b.c.Blobs.Path(t.SHA256))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return writeTarEntry(tw, path.Join(bundleTarballsDir, t.SHA256), t.Size, f)
+}
+
+// writeTarEntry writes the name regular file entry which has size bytes of r to tw.
+func writeTarEntry(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	_, err := io.Copy(tw, r)
+	return err
+}
+
+// ImportBundle verifies the bundle which is written by ExportBundle from r, and merges it into c.Cache and c.Blobs.
+//
+// The contents are staged until the whole bundle is verified, so the invalid bundle imports nothing.
+// The cached page which is fetched after the page in the bundle is kept.
+func (c *Client) ImportBundle(r io.Reader) (*BundleManifest, error) {
+	if c.Cache == nil || c.Blobs == nil {
+		return nil, errors.New("could not import the bundle without the cache")
+	}
+
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("could not read the bundle: %w", err)
+	}
+	if hdr.Name != bundleManifest {
+		return nil, fmt.Errorf("not a bundle: the first entry is %s", hdr.Name)
+	}
+	manifest := new(BundleManifest)
+	if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+		return nil, fmt.Errorf("could not decode the bundle manifest: %w", err)
+	}
+	if manifest.Version != bundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version: %d", manifest.Version)
+	}
+
+	pages := make(map[string][]*BundlePage)
+	for _, p := range manifest.Pages {
+		pages[p.SHA256] = append(pages[p.SHA256], p)
+	}
+	tarballs := make(map[string][]*BundleTarball)
+	for _, t := range manifest.Tarballs {
+		// the names are the paths of the blob index
+		if !isBundleName(t.Product.Name) || !isBundleName(t.Product.Version) {
+			return nil, fmt.Errorf("invalid tarball in the bundle manifest: %q %q", t.Product.Name, t.Product.Version)
+		}
+		tarballs[t.SHA256] = append(tarballs[t.SHA256], t)
+	}
+
+	st := &bundleStage{tarballs: make(map[string]string)}
+	defer st.cleanup()
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read the bundle: %w", err)
+		}
+
+		dir, digest := path.Split(hdr.Name)
+		switch path.Clean(dir) {
+		case bundlePagesDir:
+			ps, ok := pages[digest]
+			if !ok {
+				return nil, fmt.Errorf("unknown bundle entry: %s", hdr.Name)
+			}
+			if err := st.addPages(tr, digest, ps); err != nil {
+				return nil, err
+			}
+			delete(pages, digest)
+
+		case bundleTarballsDir:
+			ts, ok := tarballs[digest]
+			if !ok {
+				return nil, fmt.Errorf("unknown bundle entry: %s", hdr.Name)
+			}
+			if err := st.addTarball(c.Blobs, tr, digest, ts); err != nil {
+				return nil, err
+			}
+			delete(tarballs, digest)
+
+		default:
+			return nil, fmt.Errorf("unknown bundle entry: %s", hdr.Name)
+		}
+	}
+
+	if len(pages) > 0 || len(tarballs) > 0 {
+		return nil, fmt.Errorf("the bundle is truncated: %d pages and %d tarballs are missing", len(pages), len(tarballs))
+	}
+
+	if err := c.commitBundle(st); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// isBundleName reports whether the product name or version in the bundle manifest is a single path element.
+func isBundleName(s string) bool {
+	return s != "" && s != "." && s != ".." && !strings.ContainsAny(s, `/\`)
+}
+
+// bundleStage is the verified contents of the bundle which are not imported yet.
+type bundleStage struct {
+	pages    []*CacheEntry
+	tarballs map[string]string // the temporary files of c.Blobs keyed by the digest
+	indexes  []*BundleTarball
+}
+
+// addPages verifies the page body from r, and stages it as the ps pages.
+func (st *bundleStage) addPages(r io.Reader, digest string, ps []*BundlePage) error {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(body)
+	if got := hex.EncodeToString(sum[:]); got != digest {
+		return fmt.Errorf("checksum mismatch of the page %s: got %s", ps[0].URL, got)
+	}
+
+	for _, p := range ps {
+		st.pages = append(st.pages, &CacheEntry{
+			URL:          p.URL,
+			FetchedAt:    p.FetchedAt,
+			ETag:         p.ETag,
+			LastModified: p.LastModified,
+			Body:         body,
+		})
+	}
+
+	return nil
+}
+
+// addTarball verifies the tarball from r, and stages it into the temporary file of blobs as the ts tarballs.
+func (st *bundleStage) addTarball(blobs *BlobStore, r io.Reader, digest string, ts []*BundleTarball) error {
+	tmp, err := blobs.tempFile()
+	if err != nil {
+		return err
+	}
+	st.tarballs[digest] = tmp.Name()
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), r); err != nil {
+		return multierr.Combine(err, tmp.Close())
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != digest {
+		return fmt.Errorf("checksum mismatch of the tarball %s-%s: got %s", ts[0].Product.Name, ts[0].Product.Version, got)
+	}
+	st.indexes = append(st.indexes, ts...)
+
+	return nil
+}
+
+// cleanup removes the staged temporary files which are not committed.
+func (st *bundleStage) cleanup() {
+	for _, tmp := range st.tarballs {
+		os.Remove(tmp)
+	}
+}
+
+// commitBundle moves the staged tarballs into c.Blobs and indexes them, and then stores the staged pages
+// into c.Cache unless the cached page is newer.
+func (c *Client) commitBundle(st *bundleStage) error {
+	for digest, tmp := range st.tarballs {
+		if err := c.Blobs.commit(tmp, digest); err != nil {
+			return err
+		}
+		delete(st.tarballs, digest)
+	}
+	for _, t := range st.indexes {
+		if err := c.Blobs.index(t.Product.Name, t.Product.Version, t.SHA256); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range st.pages {
+		cached, err := c.Cache.Get(e.URL)
+		switch {
+		case err == nil:
+			if !cached.FetchedAt.Before(e.FetchedAt) {
+				continue // the cached page is newer
+			}
+		case !errors.Is(err, ErrCacheMiss):
+			return err
+		}
+
+		if err := c.Cache.Put(e.URL, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// containsString reports whether the s is in the list.
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,206 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/klauspost/compress/zstd"
+)
+
+func newBundleClient(t *testing.T) *Client {
+	t.Helper()
+
+	dir := t.TempDir()
+	return &Client{
+		Cache: NewFileCache(filepath.Join(dir, "pages")),
+		Blobs: NewBlobStore(filepath.Join(dir, "blobs")),
+	}
+}
+
+func TestClient_ExportImportBundle(t *testing.T) {
+	src := newBundleClient(t)
+
+	fetchedAt := time.Date(2019, 4, 9, 0, 0, 0, 0, time.UTC)
+	pages := map[string]string{
+		rooturi + "tarballs":     "<html>projects</html>",
+		rooturi + "tarballs/xnu": "<html>xnu</html>",
+	}
+	for uri, body := range pages {
+		if err := src.Cache.Put(uri, &CacheEntry{URL: uri, FetchedAt: fetchedAt, ETag: `"v1"`, Body: []byte(body)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tarball := strings.Repeat("xnu tarball contents\n", 100)
+	digest, err := src.Blobs.Put("xnu", "4903.221.2", strings.NewReader(tarball))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var bundle bytes.Buffer
+	exported, err := src.ExportBundle(context.Background(), &bundle, nil)
+	if err != nil {
+		t.Fatalf("ExportBundle() error = %v", err)
+	}
+	if len(exported.Pages) != 2 || len(exported.Tarballs) != 1 {
+		t.Fatalf("ExportBundle() exported %d pages and %d tarballs, want 2 pages and 1 tarball", len(exported.Pages), len(exported.Tarballs))
+	}
+
+	dst := newBundleClient(t)
+	imported, err := dst.ImportBundle(bytes.NewReader(bundle.Bytes()))
+	if err != nil {
+		t.Fatalf("ImportBundle() error = %v", err)
+	}
+	if diff := cmp.Diff(imported, exported); diff != "" {
+		t.Errorf("ImportBundle: manifest (-got, +want)\n%s", diff)
+	}
+
+	for uri, body := range pages {
+		e, err := dst.Cache.Get(uri)
+		if err != nil {
+			t.Fatalf("Get(%q) error = %v", uri, err)
+		}
+		if string(e.Body) != body || !e.FetchedAt.Equal(fetchedAt) || e.ETag != `"v1"` {
+			t.Errorf("Get(%q) = %+v, want the body %q fetched at %s", uri, e, body, fetchedAt)
+		}
+	}
+
+	got, err := dst.Blobs.Lookup("xnu", "4903.221.2")
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+	if got != digest {
+		t.Errorf("Lookup() = %s, want %s", got, digest)
+	}
+	buf, err := ioutil.ReadFile(dst.Blobs.Path(got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != tarball {
+		t.Errorf("imported tarball has %d bytes, want %d bytes", len(buf), len(tarball))
+	}
+}
+
+func TestClient_ImportBundleVerify(t *testing.T) {
+	const digest = "0000000000000000000000000000000000000000000000000000000000000000"
+
+	const valid = "tarball"
+	sum := sha256.Sum256([]byte(valid))
+	validDigest := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name     string
+		tarballs []*BundleTarball // the xnu-1 tarball of digest if nil
+		entries  map[string]string
+		wantErr  string
+	}{
+		{
+			name: "truncated after the valid tarball",
+			tarballs: []*BundleTarball{
+				{Product: Product{Name: "dyld", Version: "1"}, SHA256: validDigest, Size: int64(len(valid))},
+				{Product: Product{Name: "xnu", Version: "1"}, SHA256: digest, Size: 8},
+			},
+			entries: map[string]string{"tarballs/" + validDigest: valid},
+			wantErr: "truncated",
+		},
+		{
+			name: "parent directory name",
+			tarballs: []*BundleTarball{
+				{Product: Product{Name: "..", Version: "1"}, SHA256: validDigest, Size: int64(len(valid))},
+			},
+			entries: map[string]string{"tarballs/" + validDigest: valid},
+			wantErr: "invalid tarball",
+		},
+		{
+			name: "slash in version",
+			tarballs: []*BundleTarball{
+				{Product: Product{Name: "xnu", Version: "../../../escape"}, SHA256: validDigest, Size: int64(len(valid))},
+			},
+			entries: map[string]string{"tarballs/" + validDigest: valid},
+			wantErr: "invalid tarball",
+		},
+		{
+			name: "empty name",
+			tarballs: []*BundleTarball{
+				{Product: Product{Name: "", Version: "1"}, SHA256: validDigest, Size: int64(len(valid))},
+			},
+			entries: map[string]string{"tarballs/" + validDigest: valid},
+			wantErr: "invalid tarball",
+		},
+		{
+			name:    "checksum mismatch",
+			entries: map[string]string{"tarballs/" + digest: "tampered"},
+			wantErr: "checksum mismatch",
+		},
+		{
+			name:    "truncated",
+			entries: nil,
+			wantErr: "truncated",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bundle bytes.Buffer
+			zw, err := zstd.NewWriter(&bundle)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tw := tar.NewWriter(zw)
+			manifest := &BundleManifest{Version: bundleVersion, Pages: []*BundlePage{}, Tarballs: tt.tarballs}
+			if manifest.Tarballs == nil {
+				manifest.Tarballs = []*BundleTarball{{Product: Product{Name: "xnu", Version: "1"}, SHA256: digest, Size: 8}}
+			}
+			buf, err := json.Marshal(manifest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := writeTarEntry(tw, bundleManifest, int64(len(buf)), bytes.NewReader(buf)); err != nil {
+				t.Fatal(err)
+			}
+			for name, body := range tt.entries {
+				if err := writeTarEntry(tw, name, int64(len(body)), strings.NewReader(body)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := tw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := zw.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			c := newBundleClient(t)
+			if _, err := c.ImportBundle(&bundle); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ImportBundle() error = %v, want %q", err, tt.wantErr)
+			}
+
+			items, err := c.Blobs.Items()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != 0 {
+				t.Errorf("ImportBundle() stored %d tarballs of the invalid bundle", len(items))
+			}
+			staged, err := filepath.Glob(filepath.Join(c.Blobs.Dir, "sha256", ".blob.*"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(staged) != 0 {
+				t.Errorf("ImportBundle() left the staged files %v", staged)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+// ErrCacheMiss is returned by Cache.Get when the key is not cached.
+var ErrCacheMiss = errors.New("cache miss")
+
+// CacheEntry represents a cached response of opensource.apple.com.
+type CacheEntry struct {
+	URL          string    `json:"url"`
+	FetchedAt    time.Time `json:"fetched_at"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Body         []byte    `json:"-"`
+}
+
+// Fresh reports whether the entry is fetched within the ttl. The negative ttl is never fresh.
+func (e *CacheEntry) Fresh(ttl time.Duration) bool {
+	return ttl >= 0 && time.Since(e.FetchedAt) < ttl
+}
+
+// Cache is the interface that stores the responses of opensource.apple.com.
+//
+// The key is the request URL. The implementation must be safe for concurrent use.
+type Cache interface {
+	// Get returns the cached entry of the key, or ErrCacheMiss if the key is not cached.
+	Get(key string) (*CacheEntry, error)
+
+	// Put stores the entry as the key.
+	Put(key string, e *CacheEntry) error
+
+	// Delete deletes the entry of the key. It is not an error if the key is not cached.
+	Delete(key string) error
+}
+
+// FileCache is a Cache which stores the entries into the filesystem.
+//
+// Each entry is stored as the body file and its ".json" metadata file named by the SHA-256 of the key.
+type FileCache struct {
+	Dir string
+
+	usage diskUsage
+}
+
+var _ Cache = (*FileCache)(nil)
+
+// NewFileCache returns the FileCache which stores the entries into the dir directory.
+func NewFileCache(dir string) *FileCache {
+	return &FileCache{Dir: dir}
+}
+
+// path returns the body file path of the key.
+func (c *FileCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+
+	return filepath.Join(c.Dir, name[:2], name)
+}
+
+// Get implements a Cache interface.
+func (c *FileCache) Get(key string) (*CacheEntry, error) {
+	fname := c.path(key)
+
+	meta, err := ioutil.ReadFile(fname + ".json")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrCacheMiss
+		}
+		return nil, err
+	}
+
+	e := new(CacheEntry)
+	if err := json.Unmarshal(meta, e); err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadFile(fname)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrCacheMiss
+		}
+		return nil, err
+	}
+	e.Body = body
+
+	// the modification time of the body file is the last used time of the entry for the eviction.
+	// it is best effort, the entry is still usable even if the cache directory is read-only.
+	now := time.Now()
+	_ = os.Chtimes(fname, now, now)
+
+	return e, nil
+}
+
+// Put implements a Cache interface.
+func (c *FileCache) Put(key string, e *CacheEntry) error {
+	fname := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(fname), 0700); err != nil {
+		return err
+	}
+
+	meta, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	// writes the body first, the metadata file marks the entry is complete
+	if err := writeFile(fname, bytes.NewReader(e.Body)); err != nil {
+		return err
+	}
+
+	if err := writeFile(fname+".json", bytes.NewReader(meta)); err != nil {
+		return err
+	}
+	c.usage.add(int64(len(e.Body) + len(meta)))
+
+	return nil
+}
+
+// Delete implements a Cache interface.
+func (c *FileCache) Delete(key string) error {
+	fname := c.path(key)
+
+	err := multierr.Combine(os.Remove(fname+".json"), os.Remove(fname))
+	for _, err := range multierr.Errors(err) {
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Walk calls fn for the metadata of each cached entry. The Body of the entry passed to fn is nil.
+func (c *FileCache) Walk(fn func(e *CacheEntry) error) error {
+	err := filepath.Walk(c.Dir, func(fname string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() || !strings.HasSuffix(fname, ".json") {
+			return nil
+		}
+
+		meta, err := ioutil.ReadFile(fname)
+		if err != nil {
+			return err
+		}
+		e := new(CacheEntry)
+		if err := json.Unmarshal(meta, e); err != nil {
+			return err
+		}
+
+		return fn(e)
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// Items implements a Evictable interface.
+func (c *FileCache) Items() ([]*CacheItem, error) {
+	var items []*CacheItem
+	err := c.Walk(func(e *CacheEntry) error {
+		fname := c.path(e.URL)
+		body, err := os.Stat(fname)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil // the incomplete entry
+			}
+			return err
+		}
+		meta, err := os.Stat(fname + ".json")
+		if err != nil {
+			return err
+		}
+
+		items = append(items, &CacheItem{
+			Category: CategoryPages,
+			Key:      e.URL,
+			Products: pageProducts(e.URL),
+			Size:     body.Size() + meta.Size(),
+			LastUsed: body.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// Evict implements a Evictable interface.
+func (c *FileCache) Evict(item *CacheItem) error {
+	return c.Delete(item.Key)
+}
+
+// diskUsage implements a usageTracker interface.
+func (c *FileCache) diskUsage() *diskUsage {
+	return &c.usage
+}
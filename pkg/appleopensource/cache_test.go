@@ -0,0 +1,174 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFileCache(t *testing.T) {
+	c := NewFileCache(t.TempDir())
+	const key = "https://opensource.apple.com/tarballs/xnu"
+
+	if _, err := c.Get(key); !errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("Get() error = %v, want ErrCacheMiss", err)
+	}
+
+	want := &CacheEntry{
+		URL:          key,
+		FetchedAt:    time.Date(2019, 4, 9, 0, 0, 0, 0, time.UTC),
+		ETag:         `"5cac"`,
+		LastModified: "Tue, 09 Apr 2019 00:00:00 GMT",
+		Body:         []byte("<html></html>"),
+	}
+	if err := c.Put(key, want); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	got, err := c.Get(key)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Get: (-got, +want)\n%s", diff)
+	}
+
+	var urls []string
+	if err := c.Walk(func(e *CacheEntry) error {
+		urls = append(urls, e.URL)
+		return nil
+	}); err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	if diff := cmp.Diff(urls, []string{key}); diff != "" {
+		t.Errorf("Walk: (-got, +want)\n%s", diff)
+	}
+
+	if err := c.Delete(key); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := c.Get(key); !errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("Get() after Delete error = %v, want ErrCacheMiss", err)
+	}
+	if err := c.Delete(key); err != nil {
+		t.Fatalf("Delete() not cached key error = %v", err)
+	}
+}
+
+func TestClientRevalidation(t *testing.T) {
+	const etag = `"v1"`
+
+	var requests, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get(hdrIfNoneMatch) == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set(hdrETag, etag)
+		fmt.Fprint(w, "body")
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name            string
+		ttl             time.Duration
+		wantRequests    int
+		wantNotModified int
+	}{
+		{
+			name:            "fresh",
+			ttl:             time.Hour,
+			wantRequests:    1,
+			wantNotModified: 0,
+		},
+		{
+			name:            "always revalidate",
+			ttl:             -1,
+			wantRequests:    3,
+			wantNotModified: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests, notModified = 0, 0
+			c := &Client{
+				Cache:    NewFileCache(t.TempDir()),
+				CacheTTL: tt.ttl,
+			}
+
+			for i := 0; i < 3; i++ {
+				got, err := c.get(context.Background(), srv.URL)
+				if err != nil {
+					t.Fatalf("get() error = %v", err)
+				}
+				if string(got) != "body" {
+					t.Fatalf("get() = %q, want %q", got, "body")
+				}
+			}
+			if requests != tt.wantRequests || notModified != tt.wantNotModified {
+				t.Errorf("requests = %d (not modified %d), want %d (not modified %d)", requests, notModified, tt.wantRequests, tt.wantNotModified)
+			}
+		})
+	}
+}
+
+func TestClientOffline(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, "body")
+	}))
+	defer srv.Close()
+
+	c := &Client{
+		Cache:   NewFileCache(t.TempDir()),
+		Blobs:   NewBlobStore(t.TempDir()),
+		Offline: true,
+	}
+
+	// the stale entry is served without the revalidation
+	cached := srv.URL + "/tarballs/xnu"
+	if err := c.Cache.Put(cached, &CacheEntry{URL: cached, FetchedAt: time.Unix(0, 0), Body: []byte("cached")}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.get(context.Background(), cached)
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	if string(got) != "cached" {
+		t.Errorf("get() = %q, want %q", got, "cached")
+	}
+
+	var nc *NotCachedError
+	if _, err := c.get(context.Background(), srv.URL+"/tarballs/dyld"); !errors.As(err, &nc) {
+		t.Errorf("get() not cached error = %v, want NotCachedError", err)
+	}
+
+	uris := []string{
+		srv.URL + "/tarballs/xnu/xnu-1.tar.gz",
+		srv.URL + "/tarballs/xnu/xnu-2.tar.gz",
+	}
+	err = c.Fetch(context.Background(), t.TempDir(), uris...)
+	if !errors.As(err, &nc) {
+		t.Fatalf("Fetch() error = %v, want NotCachedError", err)
+	}
+	if diff := cmp.Diff(nc.URLs, uris); diff != "" {
+		t.Errorf("Fetch: not cached URLs (-got, +want)\n%s", diff)
+	}
+
+	if requests != 0 {
+		t.Errorf("sent %d requests in the offline mode", requests)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"context"
+	"sync"
+)
+
+// Catalog is the interface that lists the projects, the versions and the releases of opensource.apple.com
+// without the raw index pages.
+//
+// The implementation must be safe for concurrent use.
+type Catalog interface {
+	// Projects returns the project names.
+	Projects(ctx context.Context) ([]string, error)
+
+	// Versions returns the available versions of the project, sorted from the oldest.
+	// The error matches ErrNotFound if the project is not found.
+	Versions(ctx context.Context, name string) ([]string, error)
+
+	// Releases returns the release versions of the platform, sorted from the newest.
+	Releases(ctx context.Context, platform Platform) ([]string, error)
+
+	// Release returns the projects of the platform release version.
+	// The error matches ErrNotFound if the release is not found.
+	Release(ctx context.Context, platform Platform, version string) ([]Product, error)
+
+	// Latest returns the latest version of the project. The error matches ErrNotFound if the project is not
+	// found, and is ErrNoVersion if the project has no version.
+	Latest(ctx context.Context, name string) (string, error)
+}
+
+// ClientCatalog is a Catalog which fetches and parses the index pages by the Client.
+//
+// The pages are cached by the Client.Cache, and the parsed results are kept in memory for the lifetime of
+// the ClientCatalog. Create the new ClientCatalog to see the updates.
+type ClientCatalog struct {
+	client *Client
+	typ    ResourceType
+
+	mu       sync.Mutex
+	projects []string
+	versions map[string][]string
+	releases map[ReleaseVersion][]Product
+}
+
+var _ Catalog = (*ClientCatalog)(nil)
+
+// NewCatalog returns the ClientCatalog of the typ resources fetched by c. DefaultClient is used if c is nil.
+func NewCatalog(c *Client, typ ResourceType) *ClientCatalog {
+	if c == nil {
+		c = DefaultClient
+	}
+
+	return &ClientCatalog{
+		client:   c,
+		typ:      typ,
+		versions: make(map[string][]string),
+		releases: make(map[ReleaseVersion][]Product),
+	}
+}
+
+// Projects implements a Catalog interface.
+func (c *ClientCatalog) Projects(ctx context.Context) ([]string, error) {
+	c.mu.Lock()
+	projects := c.projects
+	c.mu.Unlock()
+	if projects != nil {
+		return projects, nil
+	}
+
+	projects, err := c.client.Projects(ctx, c.typ)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.projects = projects
+	c.mu.Unlock()
+
+	return projects, nil
+}
+
+// Versions implements a Catalog interface.
+func (c *ClientCatalog) Versions(ctx context.Context, name string) ([]string, error) {
+	c.mu.Lock()
+	versions, ok := c.versions[name]
+	c.mu.Unlock()
+	if ok {
+		return versions, nil
+	}
+
+	buf, err := c.client.IndexVersion(ctx, name, c.typ)
+	if err != nil {
+		return nil, err
+	}
+	versions, err = ListVersions(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.versions[name] = versions
+	c.mu.Unlock()
+
+	return versions, nil
+}
+
+// Releases implements a Catalog interface. It returns the KnownRelease versions of the platform.
+func (c *ClientCatalog) Releases(ctx context.Context, platform Platform) ([]string, error) {
+	if platform == Unknown || int(platform) >= len(KnownRelease) {
+		return nil, errUnknownPlatform
+	}
+
+	releases := KnownReleases(platform)
+	versions := make([]string, len(releases))
+	for i, r := range releases {
+		versions[i] = r.Version
+	}
+
+	return versions, nil
+}
+
+// Release implements a Catalog interface. The empty rows of the release page are omitted.
+func (c *ClientCatalog) Release(ctx context.Context, platform Platform, version string) ([]Product, error) {
+	key := ReleaseVersion{Platform: platform, Version: version}
+	c.mu.Lock()
+	list, ok := c.releases[key]
+	c.mu.Unlock()
+	if ok {
+		return list, nil
+	}
+
+	buf, err := c.client.IndexRelease(ctx, platform, version)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := ListRelease(buf)
+	if err != nil {
+		return nil, err
+	}
+	list = make([]Product, 0, len(rows))
+	for _, p := range rows {
+		if p.Name != "" {
+			list = append(list, p)
+		}
+	}
+
+	c.mu.Lock()
+	c.releases[key] = list
+	c.mu.Unlock()
+
+	return list, nil
+}
+
+// Latest implements a Catalog interface.
+func (c *ClientCatalog) Latest(ctx context.Context, name string) (string, error) {
+	versions, err := c.Versions(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if len(versions) == 0 {
+		return "", ErrNoVersion
+	}
+
+	return versions[len(versions)-1], nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource/aostest"
+)
+
+func TestClientCatalog(t *testing.T) {
+	srv := aostest.NewServer(&aostest.Site{
+		Projects: []aostest.Project{
+			{Name: "xnu", Versions: []aostest.Version{{Version: "4903.221.2"}, {Version: "3789.1.32"}}},
+			{Name: "dyld", Versions: []aostest.Version{{Version: "635.2"}}},
+		},
+		Releases: []aostest.Release{
+			{
+				Name: "macos-1014",
+				Projects: []aostest.ReleaseProject{
+					{Name: "dyld", Version: "635.2", ComingSoon: true},
+					{Name: "xnu", Version: "4903.221.2", Updated: true},
+				},
+			},
+		},
+	})
+	defer srv.Close()
+
+	ctx := context.Background()
+	var catalog Catalog = NewCatalog(&Client{BaseURL: srv.BaseURL()}, TarballsResource)
+
+	projects, err := catalog.Projects(ctx)
+	if err != nil {
+		t.Fatalf("Projects() error = %v", err)
+	}
+	if diff := cmp.Diff([]string{"dyld", "xnu"}, projects); diff != "" {
+		t.Errorf("Projects() mismatch (-want +got):\n%s", diff)
+	}
+
+	versions, err := catalog.Versions(ctx, "xnu")
+	if err != nil {
+		t.Fatalf("Versions() error = %v", err)
+	}
+	if diff := cmp.Diff([]string{"3789.1.32", "4903.221.2"}, versions); diff != "" {
+		t.Errorf("Versions() mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := catalog.Versions(ctx, "xun"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Versions() of the unknown project error = %v, want ErrNotFound", err)
+	}
+
+	latest, err := catalog.Latest(ctx, "xnu")
+	if err != nil {
+		t.Fatalf("Latest() error = %v", err)
+	}
+	if latest != "4903.221.2" {
+		t.Errorf("Latest() = %q, want %q", latest, "4903.221.2")
+	}
+
+	release, err := catalog.Release(ctx, MacOS, "10.14")
+	if err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	wantRelease := []Product{
+		{Name: "dyld", Version: "635.2", ComingSoon: true},
+		{Name: "xnu", Version: "4903.221.2", Updated: true},
+	}
+	if diff := cmp.Diff(wantRelease, release); diff != "" {
+		t.Errorf("Release() mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := catalog.Release(ctx, MacOS, "10.14.1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Release() of the unknown release error = %v, want ErrNotFound", err)
+	}
+
+	releases, err := catalog.Releases(ctx, Server)
+	if err != nil {
+		t.Fatalf("Releases() error = %v", err)
+	}
+	if diff := cmp.Diff([]string{"3.0.2", "2.2.2"}, releases); diff != "" {
+		t.Errorf("Releases() mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := catalog.Releases(ctx, Unknown); err == nil {
+		t.Error("Releases() of the unknown platform succeeded")
+	}
+
+	// the parsed results are kept in memory
+	srv.ResetRequests()
+	if _, err := catalog.Projects(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := catalog.Latest(ctx, "xnu"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := catalog.Release(ctx, MacOS, "10.14"); err != nil {
+		t.Fatal(err)
+	}
+	if reqs := srv.Requests(); len(reqs) != 0 {
+		t.Errorf("the catalog sent %d requests for the fetched resources: %v", len(reqs), reqs)
+	}
+}
@@ -0,0 +1,441 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultCacheTTL is the default duration while the cached entry is served without the revalidation.
+const DefaultCacheTTL = 24 * time.Hour
+
+// DefaultUserAgent is the default User-Agent header of the requests, which identifies the package.
+const DefaultUserAgent = "appleopensource (+https://go-darwin.dev/appleopensource)"
+
+const (
+	hdrETag            = "ETag"
+	hdrLastModified    = "Last-Modified"
+	hdrIfNoneMatch     = "If-None-Match"
+	hdrIfModifiedSince = "If-Modified-Since"
+	hdrUserAgent       = "User-Agent"
+)
+
+// Client is an opensource.apple.com client.
+//
+// The zero value is a valid client which does not cache any responses.
+type Client struct {
+	// HTTPClient is the HTTP client to send the requests. http.DefaultClient is used if nil.
+	HTTPClient *http.Client
+
+	// Cache stores the index pages. The pages are always fetched if nil.
+	Cache Cache
+
+	// CacheTTL is the duration while the cached entry is served without the request.
+	// DefaultCacheTTL is used if zero. The stale entry is revalidated by the conditional request,
+	// so the negative CacheTTL always revalidates the cached entry.
+	CacheTTL time.Duration
+
+	// Blobs stores the fetched tarballs. The tarballs are always fetched if nil.
+	Blobs *BlobStore
+
+	// MaxCacheSize is the total bytes limit of Cache and Blobs. The least recently used items are
+	// evicted down to the 90% of the limit when storing the new item exceeds the limit. Zero means no limit.
+	MaxCacheSize int64
+
+	// Offline serves the pages and the tarballs only from Cache and Blobs regardless of CacheTTL,
+	// and never sends any requests. The resources which are not cached are reported by NotCachedError.
+	Offline bool
+
+	// BaseURL is the base URL of the opensource.apple.com resources. DefaultBaseURL is used if empty.
+	BaseURL string
+
+	// Providers is the alternative base URLs such as the mirrors. The request is sent to each provider
+	// in order when the request to BaseURL fails or the resource is not found.
+	Providers []string
+
+	// Retry is the retry policy of the failed requests. The requests are not retried if zero.
+	Retry RetryPolicy
+
+	// Concurrency is the number of concurrent requests of the downloads. DefaultConcurrency is used if zero.
+	Concurrency int
+
+	// Limits limits the rate of the requests and the download throughput. Nothing is limited if nil.
+	Limits *Limits
+
+	// UserAgent is the User-Agent header of the requests. DefaultUserAgent is used if empty.
+	UserAgent string
+
+	// Logger logs the requests, the cache lookups and the parsing. Nothing is logged if nil.
+	Logger Logger
+}
+
+// RetryPolicy represents the retry policy of the requests which fail by the network errors,
+// the 429 Too Many Requests or the 5xx server errors.
+type RetryPolicy struct {
+	// Max is the maximum number of retries.
+	Max int `json:"max" yaml:"max" toml:"max"`
+
+	// Backoff is the wait duration before the first retry, and is doubled for each retry.
+	Backoff time.Duration `json:"backoff" yaml:"backoff" toml:"backoff"`
+}
+
+// NotCachedError is returned in the offline mode when the resources are not cached.
+type NotCachedError struct {
+	// URLs is the resources which would need to be fetched.
+	URLs []string
+}
+
+// Error implements a error interface.
+func (e *NotCachedError) Error() string {
+	return "not cached: " + strings.Join(e.URLs, ", ")
+}
+
+// isNotCached reports whether the err is NotCachedError.
+func isNotCached(err error) bool {
+	var nc *NotCachedError
+	return errors.As(err, &nc)
+}
+
+// JoinNotCached returns the NotCachedError of all URLs in errs, or the first other error in errs.
+// It is used to report all resources which would need to be fetched at once.
+func JoinNotCached(errs ...error) error {
+	var urls []string
+	for _, err := range errs {
+		var nc *NotCachedError
+		switch {
+		case err == nil:
+		case errors.As(err, &nc):
+			urls = append(urls, nc.URLs...)
+		default:
+			return err
+		}
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+
+	return &NotCachedError{URLs: urls}
+}
+
+// ErrNotFound is matched by errors.Is when the resource is not found.
+var ErrNotFound = errors.New("not found")
+
+// StatusError is returned when the response status is not successful.
+type StatusError struct {
+	URL        string
+	Status     string // e.g. "404 Not Found"
+	StatusCode int    // e.g. 404
+}
+
+// Error implements a error interface.
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("could not fetch %s: %s", e.URL, e.Status)
+}
+
+// Is reports whether the e matches the target. The 404 StatusError matches ErrNotFound.
+func (e *StatusError) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// statusError returns the StatusError of the uri resp.
+func statusError(uri string, resp *http.Response) error {
+	return &StatusError{URL: uri, Status: resp.Status, StatusCode: resp.StatusCode}
+}
+
+// DefaultClient is the default Client and is used by the package level functions.
+var DefaultClient = &Client{}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+
+	return http.DefaultClient
+}
+
+// baseURI returns the base URL which ends with "/".
+func (c *Client) baseURI() string {
+	if c.BaseURL == "" {
+		return DefaultBaseURL
+	}
+
+	return strings.TrimSuffix(c.BaseURL, "/") + "/"
+}
+
+// baseURL returns the copy of the base URL.
+func (c *Client) baseURL() *url.URL {
+	u, err := url.Parse(c.baseURI())
+	if err != nil {
+		u, _ = url.Parse(DefaultBaseURL)
+	}
+
+	return u
+}
+
+func (c *Client) userAgent() string {
+	if c.UserAgent == "" {
+		return DefaultUserAgent
+	}
+
+	return c.UserAgent
+}
+
+func (c *Client) concurrency() int {
+	if c.Concurrency < 1 {
+		return DefaultConcurrency
+	}
+
+	return c.Concurrency
+}
+
+// do sends the req by c.Retry, and sends it to c.Providers in order if the request to c.BaseURL fails
+// or the resource is not found.
+//
+// The req must not have the body.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	uris := []string{req.URL.String()}
+	if base := c.baseURI(); strings.HasPrefix(uris[0], base) {
+		for _, p := range c.Providers {
+			uris = append(uris, strings.TrimSuffix(p, "/")+"/"+strings.TrimPrefix(uris[0], base))
+		}
+	}
+
+	var (
+		resp *http.Response
+		err  error
+	)
+	for i, uri := range uris {
+		if i > 0 {
+			c.log(LevelInfo, "fallback to provider", "url", uri)
+		}
+		resp, err = c.doRetry(req, uri)
+		if i == len(uris)-1 {
+			break
+		}
+		if err == nil && resp.StatusCode != http.StatusNotFound && !retryableStatus(resp.StatusCode) {
+			break
+		}
+		if req.Context().Err() != nil {
+			break
+		}
+		if err == nil {
+			resp.Body.Close() // try the next provider
+		}
+	}
+
+	return resp, err
+}
+
+// doRetry sends the req to the uri, and retries it by c.Retry.
+func (c *Client) doRetry(req *http.Request, uri string) (*http.Response, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	ctx := req.Context()
+	r := req.Clone(ctx)
+	r.URL = u
+	r.Host = ""
+	if r.Header.Get(hdrUserAgent) == "" {
+		r.Header.Set(hdrUserAgent, c.userAgent())
+	}
+
+	backoff := c.Retry.Backoff
+	for retry := 0; ; retry++ {
+		if err := c.Limits.waitRequest(ctx, u.Hostname()); err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		resp, err := c.httpClient().Do(r)
+		if err != nil {
+			c.log(LevelWarn, "request failed", "method", r.Method, "url", uri, "elapsed", time.Since(start), "error", err)
+		} else {
+			resp.Body = c.Limits.limitBody(ctx, u.Hostname(), resp.Body)
+			kv := []interface{}{"method", r.Method, "url", uri, "status", resp.StatusCode, "elapsed", time.Since(start)}
+			if rng := r.Header.Get("Range"); rng != "" {
+				kv = append(kv, "range", rng)
+			}
+			c.log(LevelDebug, "request", kv...)
+		}
+
+		if retry >= c.Retry.Max || ctx.Err() != nil {
+			return resp, err
+		}
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+		c.log(LevelWarn, "retry", "method", r.Method, "url", uri, "attempt", retry+1, "wait", backoff)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// retryableStatus reports whether the request which responded the code status may succeed by the retry.
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+func (c *Client) cacheTTL() time.Duration {
+	if c.CacheTTL == 0 {
+		return DefaultCacheTTL
+	}
+
+	return c.CacheTTL
+}
+
+// get fetches the uri page through the Cache.
+//
+// The fresh cached entry is returned as is, and the stale entry is revalidated by the conditional request.
+func (c *Client) get(ctx context.Context, uri string) ([]byte, error) {
+	var cached *CacheEntry
+	if c.Cache != nil {
+		e, err := c.Cache.Get(uri)
+		switch {
+		case err == nil:
+			if c.Offline || e.Fresh(c.cacheTTL()) {
+				c.log(LevelDebug, "cache hit", "url", uri, "age", time.Since(e.FetchedAt).Round(time.Second))
+				return e.Body, nil
+			}
+			c.log(LevelDebug, "cache stale", "url", uri, "age", time.Since(e.FetchedAt).Round(time.Second))
+			cached = e
+		case errors.Is(err, ErrCacheMiss):
+			c.log(LevelDebug, "cache miss", "url", uri)
+		default:
+			return nil, err
+		}
+	}
+	if c.Offline {
+		return nil, &NotCachedError{URLs: []string{uri}}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set(hdrIfNoneMatch, cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set(hdrIfModifiedSince, cached.LastModified)
+		}
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var e *CacheEntry
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		c.log(LevelDebug, "cache revalidated", "url", uri)
+		e = cached
+		e.FetchedAt = time.Now()
+		if etag := resp.Header.Get(hdrETag); etag != "" {
+			e.ETag = etag
+		}
+		if lm := resp.Header.Get(hdrLastModified); lm != "" {
+			e.LastModified = lm
+		}
+
+	case resp.StatusCode == http.StatusOK:
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		e = &CacheEntry{
+			URL:          uri,
+			FetchedAt:    time.Now(),
+			ETag:         resp.Header.Get(hdrETag),
+			LastModified: resp.Header.Get(hdrLastModified),
+			Body:         body,
+		}
+
+	default:
+		return nil, statusError(uri, resp)
+	}
+
+	if c.Cache != nil {
+		if err := c.Cache.Put(uri, e); err != nil {
+			return nil, err
+		}
+		if err := c.limitCache(uri); err != nil {
+			return nil, err
+		}
+	}
+
+	return e.Body, nil
+}
+
+// open issues a GET request to the uri, and return the response which status is 200 OK.
+//
+// The caller must close the response body.
+func (c *Client) open(ctx context.Context, uri string) (*http.Response, error) {
+	if c.Offline {
+		return nil, &NotCachedError{URLs: []string{uri}}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, statusError(uri, resp)
+	}
+
+	return resp, nil
+}
+
+// page fetches the uri page without the Cache.
+func (c *Client) page(ctx context.Context, uri string) ([]byte, error) {
+	resp, err := c.open(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// head issues a HEAD request to the uri.
+func (c *Client) head(ctx context.Context, uri string) (*http.Response, error) {
+	if c.Offline {
+		return nil, &NotCachedError{URLs: []string{uri}}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	return resp, nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		max          int
+		wantRequests int
+		wantErr      bool
+	}{
+		{
+			name:         "recovered",
+			failures:     2,
+			max:          2,
+			wantRequests: 3,
+		},
+		{
+			name:         "exhausted",
+			failures:     3,
+			max:          2,
+			wantRequests: 3,
+			wantErr:      true,
+		},
+		{
+			name:         "no retry",
+			failures:     1,
+			max:          0,
+			wantRequests: 1,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests <= tt.failures {
+					http.Error(w, "unavailable", http.StatusServiceUnavailable)
+					return
+				}
+				fmt.Fprint(w, "body")
+			}))
+			defer srv.Close()
+
+			c := &Client{
+				BaseURL: srv.URL,
+				Retry:   RetryPolicy{Max: tt.max, Backoff: time.Millisecond},
+			}
+			_, err := c.get(context.Background(), srv.URL+"/tarballs")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if requests != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestClientProviders(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer primary.Close()
+
+	var paths []string
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		fmt.Fprint(w, "mirrored")
+	}))
+	defer mirror.Close()
+
+	c := &Client{
+		Cache:     NewFileCache(t.TempDir()),
+		BaseURL:   primary.URL,
+		Providers: []string{mirror.URL + "/mirror/"},
+	}
+
+	uri := c.baseURI() + "tarballs/xnu"
+	got, err := c.get(context.Background(), uri)
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	if string(got) != "mirrored" {
+		t.Errorf("get() = %q, want %q", got, "mirrored")
+	}
+	if len(paths) != 1 || paths[0] != "/mirror/tarballs/xnu" {
+		t.Errorf("mirror requested paths = %q, want [/mirror/tarballs/xnu]", paths)
+	}
+
+	// the page served by the provider is cached as the BaseURL page
+	if _, err := c.Cache.Get(uri); err != nil {
+		t.Errorf("Cache.Get(%q) error = %v", uri, err)
+	}
+}
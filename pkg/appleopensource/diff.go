@@ -0,0 +1,290 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ChangeKind represents a kind of the file change.
+type ChangeKind int
+
+const (
+	// Added is a file which only exists in the new archive.
+	Added ChangeKind = iota + 1
+	// Removed is a file which only exists in the old archive.
+	Removed
+	// Modified is a file which contents are changed.
+	Modified
+)
+
+// String implements a fmt.Stringer interface.
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Modified:
+		return "modified"
+	default:
+		return strconv.FormatInt(int64(k), 10)
+	}
+}
+
+// MarshalText implements a encoding.TextMarshaler interface.
+func (k ChangeKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText implements a encoding.TextUnmarshaler interface.
+func (k *ChangeKind) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "added":
+		*k = Added
+	case "removed":
+		*k = Removed
+	case "modified":
+		*k = Modified
+	default:
+		return fmt.Errorf("unknown change kind: %q", text)
+	}
+
+	return nil
+}
+
+// FileDiff represents a change of the file between two archives.
+type FileDiff struct {
+	Path    string     `json:"path" yaml:"path"`
+	Kind    ChangeKind `json:"kind" yaml:"kind"`
+	Binary  bool       `json:"binary,omitempty" yaml:"binary,omitempty"`
+	Added   int        `json:"added" yaml:"added"`     // number of added lines
+	Removed int        `json:"removed" yaml:"removed"` // number of removed lines
+	Patch   []byte     `json:"-" yaml:"-"`             // unified diff of the file, only if DiffOptions.Patch is set
+}
+
+// DefaultDiffContext is the number of context lines of the unified diff same as diff(1).
+const DefaultDiffContext = 3
+
+// DiffOptions represents an options of DiffArchives.
+type DiffOptions struct {
+	// Include is the path patterns of the files to compare, all files are compared if it is empty.
+	Include []string
+	// Exclude is the path patterns of the files to ignore.
+	Exclude []string
+	// Patch computes the unified diff of each file.
+	Patch bool
+	// Context is the number of context lines of the unified diff. DefaultDiffContext lines are used if negative.
+	Context int
+}
+
+// match reports whether the name file should be compared.
+func (o *DiffOptions) match(name string) bool {
+	if o == nil {
+		return true
+	}
+	if len(o.Include) > 0 && !matchPath(o.Include, name) {
+		return false
+	}
+
+	return !matchPath(o.Exclude, name)
+}
+
+// matchPath reports whether the name matches any of the patterns.
+//
+// The pattern syntax is the same as path.Match, and matches the name itself or any of its parent
+// directories, e.g. "bsd/kern" matches "bsd/kern/kern_exec.c". The pattern without any slash also
+// matches the base name, e.g. "*.s" matches "osfmk/x86_64/locore.s".
+func matchPath(patterns []string, name string) bool {
+	for _, pat := range patterns {
+		pat = strings.Trim(pat, "/")
+		for p := name; p != "."; p = path.Dir(p) {
+			if ok, _ := path.Match(pat, p); ok {
+				return true
+			}
+		}
+		if !strings.Contains(pat, "/") {
+			if ok, _ := path.Match(pat, path.Base(name)); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// fileSum represents a summary of the file in the archive.
+type fileSum struct {
+	sum    [sha256.Size]byte
+	lines  int
+	binary bool
+}
+
+// DiffArchives compares the files of the oldArchive and newArchive tarballs, and return the changed files sorted by the path.
+//
+// The archives are read without the extraction to disk. Only the contents of the changed files are held in memory.
+func DiffArchives(oldArchive, newArchive string, opts *DiffOptions) ([]FileDiff, error) {
+	olds, err := sumArchive(oldArchive, opts)
+	if err != nil {
+		return nil, err
+	}
+	news, err := sumArchive(newArchive, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	patch := opts != nil && opts.Patch
+	needOld, needNew := make(map[string]bool), make(map[string]bool)
+
+	var diffs []FileDiff
+	for name, o := range olds {
+		n, ok := news[name]
+		switch {
+		case !ok:
+			diffs = append(diffs, FileDiff{Path: name, Kind: Removed, Binary: o.binary, Removed: o.lines})
+			needOld[name] = patch && !o.binary
+		case o.sum != n.sum:
+			binary := o.binary || n.binary
+			diffs = append(diffs, FileDiff{Path: name, Kind: Modified, Binary: binary})
+			needOld[name], needNew[name] = !binary, !binary
+		}
+	}
+	for name, n := range news {
+		if _, ok := olds[name]; !ok {
+			diffs = append(diffs, FileDiff{Path: name, Kind: Added, Binary: n.binary, Added: n.lines})
+			needNew[name] = patch && !n.binary
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Path < diffs[j].Path })
+
+	oldFiles, err := readArchiveFiles(oldArchive, needOld)
+	if err != nil {
+		return nil, err
+	}
+	newFiles, err := readArchiveFiles(newArchive, needNew)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range diffs {
+		d := &diffs[i]
+		if d.Binary {
+			if patch {
+				d.Patch = []byte(fmt.Sprintf("Binary files %s and %s differ\n", patchName("a", d, Added), patchName("b", d, Removed)))
+			}
+			continue
+		}
+
+		a, b := splitLines(oldFiles[d.Path]), splitLines(newFiles[d.Path])
+		ops := diffLines(a, b)
+		if d.Kind == Modified {
+			d.Added, d.Removed = countChanges(ops)
+		}
+		if patch {
+			var buf bytes.Buffer
+			fmt.Fprintf(&buf, "--- %s\n+++ %s\n", patchName("a", d, Added), patchName("b", d, Removed))
+			context := opts.Context
+			if context < 0 {
+				context = DefaultDiffContext
+			}
+			unified(&buf, a, b, ops, context)
+			d.Patch = buf.Bytes()
+		}
+	}
+
+	return diffs, nil
+}
+
+// patchName returns the file name of the patch header, or "/dev/null" if the file is the missing kind.
+func patchName(prefix string, d *FileDiff, missing ChangeKind) string {
+	if d.Kind == missing {
+		return "/dev/null"
+	}
+
+	return prefix + "/" + d.Path
+}
+
+// sumArchive summarizes the files in the fname archive which matches to opts.
+func sumArchive(fname string, opts *DiffOptions) (map[string]fileSum, error) {
+	sums := make(map[string]fileSum)
+	err := walkArchive(fname, func(name string, r io.Reader) error {
+		if !opts.match(name) {
+			return nil
+		}
+
+		buf, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		sums[name] = fileSum{
+			sum:    sha256.Sum256(buf),
+			lines:  countLines(buf),
+			binary: isBinary(buf),
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s archive: %w", fname, err)
+	}
+
+	return sums, nil
+}
+
+// readArchiveFiles reads the contents of the files in the fname archive which need is true.
+func readArchiveFiles(fname string, need map[string]bool) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	if !hasTrue(need) {
+		return files, nil
+	}
+
+	err := walkArchive(fname, func(name string, r io.Reader) error {
+		if !need[name] {
+			return nil
+		}
+
+		buf, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		files[name] = buf
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s archive: %w", fname, err)
+	}
+
+	return files, nil
+}
+
+// hasTrue reports whether m has any true value.
+func hasTrue(m map[string]bool) bool {
+	for _, v := range m {
+		if v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isBinary reports whether buf looks like a binary, same heuristics as the git.
+func isBinary(buf []byte) bool {
+	const sniffLen = 8000
+	if len(buf) > sniffLen {
+		buf = buf[:sniffLen]
+	}
+
+	return bytes.IndexByte(buf, 0) >= 0
+}
@@ -0,0 +1,191 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// writeArchive writes the files into the fname tarball under the top directory.
+func writeArchive(t *testing.T, fname, top string, files map[string]string) {
+	t.Helper()
+
+	f, err := os.Create(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		hdr := &tar.Header{
+			Name:     top + "/" + name,
+			Mode:     0644,
+			Size:     int64(len(files[name])),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiffArchives(t *testing.T) {
+	dir := t.TempDir()
+	oldArchive := filepath.Join(dir, "xnu-1.tar.gz")
+	newArchive := filepath.Join(dir, "xnu-2.tar.gz")
+
+	writeArchive(t, oldArchive, "xnu-1", map[string]string{
+		"README":         "xnu\n",
+		"bsd/kern/a.c":   "int a;\nint b;\nint c;\n",
+		"bsd/kern/old.c": "old\nfile\n",
+		"osfmk/bin.o":    "\x00\x01",
+	})
+	writeArchive(t, newArchive, "xnu-2", map[string]string{
+		"README":         "xnu\n",
+		"bsd/kern/a.c":   "int a;\nint B;\nint c;\nint d;\n",
+		"bsd/kern/new.c": "new\n",
+		"osfmk/bin.o":    "\x00\x02",
+	})
+
+	tests := []struct {
+		name string
+		opts *DiffOptions
+		want []FileDiff
+	}{
+		{
+			name: "summary",
+			want: []FileDiff{
+				{Path: "bsd/kern/a.c", Kind: Modified, Added: 2, Removed: 1},
+				{Path: "bsd/kern/new.c", Kind: Added, Added: 1},
+				{Path: "bsd/kern/old.c", Kind: Removed, Removed: 2},
+				{Path: "osfmk/bin.o", Kind: Modified, Binary: true},
+			},
+		},
+		{
+			name: "include and exclude",
+			opts: &DiffOptions{Include: []string{"bsd"}, Exclude: []string{"old.c"}},
+			want: []FileDiff{
+				{Path: "bsd/kern/a.c", Kind: Modified, Added: 2, Removed: 1},
+				{Path: "bsd/kern/new.c", Kind: Added, Added: 1},
+			},
+		},
+		{
+			name: "patch",
+			opts: &DiffOptions{Include: []string{"*.c"}, Exclude: []string{"bsd/kern/old.c"}, Patch: true, Context: 1},
+			want: []FileDiff{
+				{
+					Path: "bsd/kern/a.c", Kind: Modified, Added: 2, Removed: 1,
+					Patch: []byte("--- a/bsd/kern/a.c\n+++ b/bsd/kern/a.c\n@@ -1,3 +1,4 @@\n int a;\n-int b;\n+int B;\n int c;\n+int d;\n"),
+				},
+				{
+					Path: "bsd/kern/new.c", Kind: Added, Added: 1,
+					Patch: []byte("--- /dev/null\n+++ b/bsd/kern/new.c\n@@ -0,0 +1 @@\n+new\n"),
+				},
+			},
+		},
+		{
+			name: "patch without context",
+			opts: &DiffOptions{Include: []string{"a.c"}, Patch: true, Context: 0},
+			want: []FileDiff{
+				{
+					Path: "bsd/kern/a.c", Kind: Modified, Added: 2, Removed: 1,
+					Patch: []byte("--- a/bsd/kern/a.c\n+++ b/bsd/kern/a.c\n@@ -2 +2 @@\n-int b;\n+int B;\n@@ -3,0 +4 @@\n+int d;\n"),
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DiffArchives(oldArchive, newArchive, tt.opts)
+			if err != nil {
+				t.Fatalf("DiffArchives() error = %v", err)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("%s: (-got, +want)\n%s", tt.name, diff)
+			}
+		})
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		context int
+		want    string
+	}{
+		{
+			name:    "separated hunks",
+			a:       "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			b:       "1\nX\n3\n4\n5\n6\n7\n8\nY\n",
+			context: 1,
+			want:    "@@ -1,3 +1,3 @@\n 1\n-2\n+X\n 3\n@@ -8,2 +8,2 @@\n 8\n-9\n+Y\n",
+		},
+		{
+			name:    "no context deletion",
+			a:       "1\n2\n3\n",
+			b:       "1\n3\n",
+			context: 0,
+			want:    "@@ -2 +1,0 @@\n-2\n",
+		},
+		{
+			name:    "no newline at end of file",
+			a:       "1\n2",
+			b:       "1\n2\n",
+			context: 2,
+			want:    "@@ -1,2 +1,2 @@\n 1\n-2\n\\ No newline at end of file\n+2\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := splitLines([]byte(tt.a)), splitLines([]byte(tt.b))
+
+			var buf bytes.Buffer
+			unified(&buf, a, b, diffLines(a, b), tt.context)
+			if diff := cmp.Diff(buf.String(), tt.want); diff != "" {
+				t.Errorf("%s: (-got, +want)\n%s", tt.name, diff)
+			}
+		})
+	}
+}
+
+func TestDiffLines_maxEditCost(t *testing.T) {
+	defer func(n int) { maxEditCost = n }(maxEditCost)
+	maxEditCost = 2
+
+	a, b := splitLines([]byte("1\n2\n3\n4\n")), splitLines([]byte("1\nX\n3\nY\n"))
+	var buf bytes.Buffer
+	unified(&buf, a, b, diffLines(a, b), 0)
+	want := "@@ -2,3 +2,3 @@\n-2\n-3\n-4\n+X\n+3\n+Y\n"
+	if diff := cmp.Diff(buf.String(), want); diff != "" {
+		t.Errorf("(-got, +want)\n%s", diff)
+	}
+}
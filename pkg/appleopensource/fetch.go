@@ -5,16 +5,17 @@
 package appleopensource
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	progressbar "github.com/schollz/progressbar/v3"
 	"go.uber.org/multierr"
@@ -25,26 +26,154 @@ const (
 	hdrContentLength = "Content-Length"
 )
 
+// tarballSuffix is the file extension of the tarballs resource.
+const tarballSuffix = ".tar.gz"
+
+// ParseTarball parses the tarballs resource download uri such as the Product.Tarball returns.
+func ParseTarball(uri string) (Product, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return Product{}, err
+	}
+
+	dir, file := path.Split(u.Path)
+	dir = path.Clean(dir)
+	name := path.Base(dir)
+	if path.Base(path.Dir(dir)) != TarballsResource.String() || !strings.HasPrefix(file, name+"-") || !strings.HasSuffix(file, tarballSuffix) {
+		return Product{}, fmt.Errorf("not a tarballs resource uri: %s", uri)
+	}
+
+	return Product{
+		Name:    name,
+		Version: strings.TrimSuffix(strings.TrimPrefix(file, name+"-"), tarballSuffix),
+	}, nil
+}
+
 // Fetch fetchs the uri file to dst with multiple progress bars.
 func Fetch(ctx context.Context, dst string, uris ...string) (err error) {
+	return DefaultClient.Fetch(ctx, dst, uris...)
+}
+
+// Fetch fetchs the uri file to dst with multiple progress bars.
+//
+// If c.Blobs is set, the tarballs resource is served from the BlobStore, and the fetched
+// tarball is stored into the BlobStore before placing into dst.
+func (c *Client) Fetch(ctx context.Context, dst string, uris ...string) (err error) {
 	if _, err := os.Stat(dst); err != nil && os.IsNotExist(err) {
 		return fmt.Errorf("no such %s dist directory: %w", dst, err)
 	}
 
+	// reports all uris which are not cached in the offline mode
+	var notCached []error
 	for _, uri := range uris {
-		if err := fetch(ctx, dst, uri); err != nil {
-			return err
+		if err := c.fetch(ctx, dst, uri); err != nil {
+			if !isNotCached(err) {
+				return err
+			}
+			notCached = append(notCached, err)
 		}
 	}
 
-	return nil
+	return JoinNotCached(notCached...)
+}
+
+func (c *Client) fetch(ctx context.Context, dst, uri string) error {
+	fname := filepath.Join(dst, path.Base(uri))
+
+	p, err := ParseTarball(uri)
+	if c.Blobs == nil || err != nil {
+		return writeFileFunc(fname, func(f *os.File) error {
+			return c.download(ctx, uri, f)
+		})
+	}
+
+	// the blob is pinned until linked, so that the other goroutines storing the tarballs do not evict it
+	defer c.Blobs.pin(p.Name, p.Version)()
+	digest, err := c.storeTarball(ctx, p, uri)
+	if err != nil {
+		return err
+	}
+
+	return c.Blobs.Link(digest, fname)
+}
+
+// Tarball returns the file path of the p tarball in c.Blobs, and fetches it if not stored.
+func (c *Client) Tarball(ctx context.Context, p Product) (string, error) {
+	if c.Blobs == nil {
+		return "", errors.New("no blob store")
+	}
+
+	digest, err := c.storeTarball(ctx, p, c.TarballURL(p))
+	if err != nil {
+		return "", err
+	}
+
+	return c.Blobs.Path(digest), nil
+}
+
+// tarballFile returns the file path of the p tarball, which is in c.Blobs or fetched to tmp.
+func (c *Client) tarballFile(ctx context.Context, p Product, tmp string) (string, error) {
+	if c.Blobs != nil {
+		return c.Tarball(ctx, p)
+	}
+
+	uri := c.TarballURL(p)
+	if err := c.fetch(ctx, tmp, uri); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(tmp, path.Base(uri)), nil
+}
+
+// storeTarball returns the digest of the p tarball in c.Blobs, and fetches the uri if not stored.
+func (c *Client) storeTarball(ctx context.Context, p Product, uri string) (string, error) {
+	digest, err := c.Blobs.Lookup(p.Name, p.Version)
+	if err == nil {
+		c.log(LevelDebug, "blob hit", "product", p.Name, "version", p.Version, "digest", digest)
+		return digest, nil
+	}
+	if !errors.Is(err, ErrBlobNotFound) {
+		return "", err
+	}
+	c.log(LevelDebug, "blob miss", "product", p.Name, "version", p.Version)
+
+	tmp, err := c.Blobs.tempFile()
+	if err != nil {
+		return "", err
+	}
+	if err := c.download(ctx, uri, tmp); err != nil {
+		return "", multierr.Combine(err, tmp.Close(), os.Remove(tmp.Name()))
+	}
+	if err := tmp.Close(); err != nil {
+		return "", multierr.Combine(err, os.Remove(tmp.Name()))
+	}
+
+	digest, err = c.Blobs.putFile(p.Name, p.Version, tmp.Name())
+	if err != nil {
+		return "", err
+	}
+
+	if err := c.limitCache(digest); err != nil {
+		return "", err
+	}
+
+	return digest, nil
 }
 
-func fetch(ctx context.Context, dst, uri string) error {
-	resp, err := http.Head(uri) // 187 MB file of random numbers per line
+// errRangeIgnored is returned by the range request when the server ignores the Range header.
+var errRangeIgnored = errors.New("range request is not supported")
+
+// download downloads the uri file into f by the multiple range requests with the progress bar.
+//
+// The file is downloaded by a single request if the length is unknown, or the server ignores the Range header.
+func (c *Client) download(ctx context.Context, uri string, f *os.File) error {
+	resp, err := c.head(ctx, uri) // 187 MB file of random numbers per line
 	if err != nil {
 		return err
 	}
+	if resp.StatusCode != http.StatusOK {
+		return statusError(uri, resp)
+	}
 
 	sz := resp.Header.Get(hdrContentLength)
 	var length int64
@@ -55,15 +184,19 @@ func fetch(ctx context.Context, dst, uri string) error {
 		}
 	}
 
+	if length <= 0 {
+		// unknown length, can not split into the range requests
+		return c.downloadWhole(ctx, uri, f, -1)
+	}
+
 	filename := path.Base(uri)
-	pb := progressbar.NewOptions(int(length), progressbar.OptionShowBytes(true), progressbar.OptionSetDescription(filename))
+	pb := progressbar.NewOptions(int(length), progressbar.OptionSetWriter(os.Stderr), progressbar.OptionShowBytes(true), progressbar.OptionSetDescription(filename))
 
-	const limit = int64(10)    // 10 Go-routines for the process so each downloads 18.7MB
-	lenSub := length / limit   // Bytes for each Go-routine
-	diff := length % limit     // Get the remaining for the last request
-	body := make([][]byte, 11) // Make up a temporary array to hold the data to be written to the file
+	limit := int64(c.concurrency()) // Go-routines for the process so each downloads the 1/limit of the file
+	lenSub := length / limit        // Bytes for each Go-routine
+	diff := length % limit          // Get the remaining for the last request
 
-	eg, ctx := errgroup.WithContext(ctx)
+	eg, ectx := errgroup.WithContext(ctx)
 	for i := int64(0); i < limit; i++ {
 		min := lenSub * i       // Min range
 		max := lenSub * (i + 1) // Max range
@@ -71,9 +204,12 @@ func fetch(ctx context.Context, dst, uri string) error {
 		if i == limit-1 {
 			max += diff // Add the remaining bytes in the last request
 		}
+		if min == max {
+			continue // the file is smaller than limit bytes
+		}
 
 		eg.Go(func() error {
-			req, err := http.NewRequest(http.MethodGet, uri, nil)
+			req, err := http.NewRequestWithContext(ectx, http.MethodGet, uri, nil)
 			if err != nil {
 				return err
 			}
@@ -81,28 +217,81 @@ func fetch(ctx context.Context, dst, uri string) error {
 			rangeHdr := "bytes=" + strconv.FormatInt(min, 10) + "-" + strconv.FormatInt(max-1, 10) // Add the data for the Range header of the form "bytes=0-100"
 			req.Header.Add("Range", rangeHdr)
 
-			hc := http.DefaultClient
-			resp, err := hc.Do(req.WithContext(ctx))
+			resp, err := c.do(req)
 			if err != nil {
 				return err
 			}
 			defer resp.Body.Close()
 
-			var buf bytes.Buffer
-			out := io.MultiWriter(&buf, pb)
-			if _, err := io.Copy(out, resp.Body); err != nil {
-				return err
+			switch resp.StatusCode {
+			case http.StatusPartialContent:
+			case http.StatusOK:
+				return errRangeIgnored
+			default:
+				return fmt.Errorf("could not fetch %s %s: %s", uri, rangeHdr, resp.Status)
 			}
 
-			body[i] = buf.Bytes()
+			// writes the part at its offset of f, so that the parts are never held in memory
+			out := io.MultiWriter(&offsetWriter{f: f, off: min}, pb)
+			n, err := io.Copy(out, resp.Body)
+			if err != nil {
+				return err
+			}
+			if n != max-min {
+				return fmt.Errorf("could not fetch %s %s: got %d bytes", uri, rangeHdr, n)
+			}
 
 			return nil
 		})
 	}
 
-	if err := multierr.Combine(eg.Wait(), pb.Finish()); err != nil {
+	err = multierr.Combine(eg.Wait(), pb.Finish())
+	if !errors.Is(err, errRangeIgnored) {
 		return err
 	}
 
-	return ioutil.WriteFile(filepath.Join(dst, filename), bytes.Join(body, nil), 0644)
+	c.log(LevelDebug, "range ignored", "url", uri)
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	return c.downloadWhole(ctx, uri, f, length)
+}
+
+// downloadWhole downloads the uri file into f by a single request with the progress bar.
+// The length is the expected size of the file, or negative if unknown.
+func (c *Client) downloadWhole(ctx context.Context, uri string, f *os.File, length int64) error {
+	resp, err := c.open(ctx, uri)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	pb := progressbar.NewOptions64(length, progressbar.OptionSetWriter(os.Stderr), progressbar.OptionShowBytes(true), progressbar.OptionSetDescription(path.Base(uri)))
+	n, err := io.Copy(io.MultiWriter(f, pb), resp.Body)
+	if err := multierr.Combine(err, pb.Finish()); err != nil {
+		return err
+	}
+	if length >= 0 && n != length {
+		return fmt.Errorf("could not fetch %s: got %d bytes, want %d bytes", uri, n, length)
+	}
+
+	return nil
+}
+
+// offsetWriter writes to f at the offset which advances by each Write.
+type offsetWriter struct {
+	f   *os.File
+	off int64
+}
+
+// Write implements a io.Writer interface.
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.f.WriteAt(p, w.off)
+	w.off += int64(n)
+
+	return n, err
 }
@@ -0,0 +1,120 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource/aostest"
+)
+
+func TestClient_Fetch(t *testing.T) {
+	tarball := bytes.Repeat([]byte("xnu tarball contents\n"), 100)
+	site := &aostest.Site{
+		Projects: []aostest.Project{
+			{Name: "xnu", Versions: []aostest.Version{{Version: "4903.221.2", Tarball: tarball}}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		product Product
+		faults  []aostest.Fault
+		retry   int
+		blobs   bool
+		wantErr bool
+	}{
+		{
+			name:    "fetch",
+			product: Product{Name: "xnu", Version: "4903.221.2"},
+		},
+		{
+			name:    "retried range request",
+			product: Product{Name: "xnu", Version: "4903.221.2"},
+			faults:  []aostest.Fault{{Method: http.MethodGet, Status: http.StatusServiceUnavailable, Times: 2}},
+			retry:   2,
+		},
+		{
+			name:    "failed range request",
+			product: Product{Name: "xnu", Version: "4903.221.2"},
+			faults:  []aostest.Fault{{Method: http.MethodGet, Status: http.StatusServiceUnavailable, Times: 1}},
+			wantErr: true,
+		},
+		{
+			name:    "range not supported",
+			product: Product{Name: "xnu", Version: "4903.221.2"},
+			faults:  []aostest.Fault{{IgnoreRange: true}},
+		},
+		{
+			name:    "range not supported with blobs",
+			product: Product{Name: "xnu", Version: "4903.221.2"},
+			faults:  []aostest.Fault{{IgnoreRange: true}},
+			blobs:   true,
+		},
+		{
+			name:    "truncated whole request",
+			product: Product{Name: "xnu", Version: "4903.221.2"},
+			faults:  []aostest.Fault{{IgnoreRange: true, Truncate: 10}},
+			blobs:   true,
+			wantErr: true,
+		},
+		{
+			name:    "truncated",
+			product: Product{Name: "xnu", Version: "4903.221.2"},
+			faults:  []aostest.Fault{{Method: http.MethodGet, Truncate: 10, Times: 1}},
+			wantErr: true,
+		},
+		{
+			name:    "not found",
+			product: Product{Name: "xnu", Version: "1"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := aostest.NewServer(site)
+			defer srv.Close()
+			for _, f := range tt.faults {
+				srv.AddFault(f)
+			}
+
+			c := &Client{
+				BaseURL: srv.BaseURL(),
+				Retry:   RetryPolicy{Max: tt.retry, Backoff: time.Millisecond},
+			}
+			if tt.blobs {
+				c.Blobs = NewBlobStore(t.TempDir())
+			}
+			dst := t.TempDir()
+			err := c.Fetch(context.Background(), dst, c.TarballURL(tt.product))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fetch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if c.Blobs != nil {
+					if _, err := c.Blobs.Lookup(tt.product.Name, tt.product.Version); !errors.Is(err, ErrBlobNotFound) {
+						t.Errorf("Lookup() of the failed fetch error = %v, want ErrBlobNotFound", err)
+					}
+				}
+				return
+			}
+
+			got, err := ioutil.ReadFile(filepath.Join(dst, "xnu-4903.221.2.tar.gz"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tarball) {
+				t.Errorf("fetched tarball mismatch: got %d bytes, want %d bytes", len(got), len(tarball))
+			}
+		})
+	}
+}
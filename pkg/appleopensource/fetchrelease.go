@@ -0,0 +1,217 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+)
+
+// FetchManifestName is the file name of the FetchManifest written by FetchRelease.
+const FetchManifestName = "fetch-manifest.json"
+
+// FetchManifest represents the tarballs fetched by FetchRelease.
+type FetchManifest struct {
+	Platform  string           `json:"platform" yaml:"platform"`
+	Release   string           `json:"release" yaml:"release"`
+	FetchedAt time.Time        `json:"fetched_at" yaml:"fetched_at"`
+	Tarballs  []FetchedTarball `json:"tarballs" yaml:"tarballs"`
+	Skipped   []SkippedProduct `json:"skipped" yaml:"skipped"`
+}
+
+// FetchedTarball represents the fetched tarball of the project.
+type FetchedTarball struct {
+	Name    string `json:"name" yaml:"name"`
+	Version string `json:"version" yaml:"version"`
+	URL     string `json:"url" yaml:"url"`
+	File    string `json:"file" yaml:"file"` // the file name in the dst directory
+	Size    int64  `json:"size" yaml:"size"`
+	SHA256  string `json:"sha256" yaml:"sha256"`
+}
+
+// SkippedProduct represents the project of the release which is not fetched.
+type SkippedProduct struct {
+	Name    string `json:"name" yaml:"name"`
+	Version string `json:"version" yaml:"version"`
+	Reason  string `json:"reason" yaml:"reason"`
+}
+
+// FetchReleaseOptions represents an options of FetchRelease.
+type FetchReleaseOptions struct {
+	// Projects is the projects of the release to fetch. All projects are fetched if empty.
+	Projects []string
+
+	// Jobs is the number of the tarballs fetched in parallel. Client.Concurrency is used if zero.
+	Jobs int
+}
+
+// FetchRelease fetches the tarballs of the projects in the platform release version to dst in parallel, and
+// writes the FetchManifest of them to the FetchManifestName file in dst.
+//
+// The versions of the projects are resolved from the release page. The projects which are coming soon are
+// skipped, and reported in FetchManifest.Skipped.
+func (c *Client) FetchRelease(ctx context.Context, dst string, platform Platform, version string, opts *FetchReleaseOptions) (*FetchManifest, error) {
+	if opts == nil {
+		opts = &FetchReleaseOptions{}
+	}
+	if _, err := os.Stat(dst); err != nil && os.IsNotExist(err) {
+		return nil, fmt.Errorf("no such %s dist directory: %w", dst, err)
+	}
+
+	list, err := NewCatalog(c, TarballsResource).Release(ctx, platform, version)
+	if err != nil {
+		return nil, err
+	}
+	products, err := selectProjects(list, opts.Projects)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", platform, version, err)
+	}
+
+	m := &FetchManifest{
+		Platform:  platform.String(),
+		Release:   version,
+		FetchedAt: time.Now().UTC(),
+		Tarballs:  []FetchedTarball{},
+		Skipped:   []SkippedProduct{},
+	}
+	var targets []Product
+	for _, p := range products {
+		if p.ComingSoon {
+			c.log(LevelWarn, "skip coming soon project", "product", p.Name, "version", p.Version)
+			m.Skipped = append(m.Skipped, SkippedProduct{Name: p.Name, Version: p.Version, Reason: "coming soon"})
+			continue
+		}
+		targets = append(targets, p)
+	}
+
+	jobs := opts.Jobs
+	if jobs < 1 {
+		jobs = c.concurrency()
+	}
+	fetched := make([]FetchedTarball, len(targets))
+	notCached := make([]error, len(targets))
+
+	sem := semaphore.NewWeighted(int64(jobs))
+	eg, ctx := errgroup.WithContext(ctx)
+	for i, p := range targets {
+		i, p := i, p
+		eg.Go(func() error {
+			if err := sem.Acquire(ctx, 1); err != nil {
+				return err
+			}
+			defer sem.Release(1)
+
+			uri := c.TarballURL(p)
+			if err := c.fetch(ctx, dst, uri); err != nil {
+				if !isNotCached(err) {
+					return err
+				}
+				notCached[i] = err
+				return nil
+			}
+
+			t, err := fetchedTarball(dst, p, uri)
+			if err != nil {
+				return err
+			}
+			fetched[i] = t
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	if err := JoinNotCached(notCached...); err != nil {
+		return nil, err
+	}
+	m.Tarballs = append(m.Tarballs, fetched...)
+
+	if err := m.write(filepath.Join(dst, FetchManifestName)); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// selectProjects returns the projects of the release list in the order of the names, or all projects of
+// the list if names is empty.
+func selectProjects(list []Product, names []string) ([]Product, error) {
+	if len(names) == 0 {
+		return list, nil
+	}
+
+	projects := make(map[string]Product, len(list))
+	for _, p := range list {
+		projects[p.Name] = p
+	}
+
+	selected := make([]Product, len(names))
+	for i, name := range names {
+		p, ok := projects[name]
+		if !ok {
+			return nil, fmt.Errorf("no such project in the release: %s", name)
+		}
+		selected[i] = p
+	}
+
+	return selected, nil
+}
+
+// fetchedTarball returns the FetchedTarball of the p tarball fetched to dst.
+func fetchedTarball(dst string, p Product, uri string) (FetchedTarball, error) {
+	file := path.Base(uri)
+	digest, n, err := sumFile(filepath.Join(dst, file))
+	if err != nil {
+		return FetchedTarball{}, err
+	}
+
+	return FetchedTarball{
+		Name:    p.Name,
+		Version: p.Version,
+		URL:     uri,
+		File:    file,
+		Size:    n,
+		SHA256:  digest,
+	}, nil
+}
+
+// sumFile returns the hex encoded SHA-256 digest and the size of the fname file.
+func sumFile(fname string) (string, int64, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// write writes m as JSON to fname.
+func (m *FetchManifest) write(fname string) error {
+	buf, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fname, append(buf, '\n'), 0644)
+}
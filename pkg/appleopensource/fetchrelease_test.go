@@ -0,0 +1,145 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource/aostest"
+)
+
+func TestClient_FetchRelease(t *testing.T) {
+	xnu := bytes.Repeat([]byte("xnu\n"), 100)
+	libplatform := bytes.Repeat([]byte("libplatform\n"), 10)
+	srv := aostest.NewServer(&aostest.Site{
+		Projects: []aostest.Project{
+			{Name: "xnu", Versions: []aostest.Version{{Version: "4903.221.2", Tarball: xnu}}},
+			{Name: "libplatform", Versions: []aostest.Version{{Version: "177.200.16", Tarball: libplatform}}},
+		},
+		Releases: []aostest.Release{
+			{
+				Name: "macos-10141",
+				Projects: []aostest.ReleaseProject{
+					{Name: "dtrace", Version: "284.200.15", ComingSoon: true},
+					{Name: "libplatform", Version: "177.200.16"},
+					{Name: "xnu", Version: "4903.221.2"},
+				},
+			},
+		},
+	})
+	defer srv.Close()
+
+	sum := func(b []byte) string {
+		h := sha256.Sum256(b)
+		return hex.EncodeToString(h[:])
+	}
+	want := &FetchManifest{
+		Platform: "macos",
+		Release:  "10.14.1",
+		Tarballs: []FetchedTarball{
+			{
+				Name:    "libplatform",
+				Version: "177.200.16",
+				URL:     srv.BaseURL() + "tarballs/libplatform/libplatform-177.200.16.tar.gz",
+				File:    "libplatform-177.200.16.tar.gz",
+				Size:    int64(len(libplatform)),
+				SHA256:  sum(libplatform),
+			},
+			{
+				Name:    "xnu",
+				Version: "4903.221.2",
+				URL:     srv.BaseURL() + "tarballs/xnu/xnu-4903.221.2.tar.gz",
+				File:    "xnu-4903.221.2.tar.gz",
+				Size:    int64(len(xnu)),
+				SHA256:  sum(xnu),
+			},
+		},
+		Skipped: []SkippedProduct{{Name: "dtrace", Version: "284.200.15", Reason: "coming soon"}},
+	}
+	ignoreTime := cmpopts.IgnoreFields(FetchManifest{}, "FetchedAt")
+
+	ctx := context.Background()
+	c := &Client{BaseURL: srv.BaseURL()}
+	dst := t.TempDir()
+	got, err := c.FetchRelease(ctx, dst, MacOS, "10.14.1", &FetchReleaseOptions{Jobs: 2})
+	if err != nil {
+		t.Fatalf("FetchRelease() error = %v", err)
+	}
+	if diff := cmp.Diff(want, got, ignoreTime); diff != "" {
+		t.Errorf("FetchRelease() mismatch (-want +got):\n%s", diff)
+	}
+
+	buf, err := ioutil.ReadFile(filepath.Join(dst, FetchManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written FetchManifest
+	if err := json.Unmarshal(buf, &written); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got, &written, cmpopts.EquateApproxTime(0)); diff != "" {
+		t.Errorf("written manifest mismatch (-want +got):\n%s", diff)
+	}
+	for _, tb := range want.Tarballs {
+		if _, err := ioutil.ReadFile(filepath.Join(dst, tb.File)); err != nil {
+			t.Errorf("tarball is not fetched: %v", err)
+		}
+	}
+
+	got, err = c.FetchRelease(ctx, t.TempDir(), MacOS, "10.14.1", &FetchReleaseOptions{Projects: []string{"xnu"}})
+	if err != nil {
+		t.Fatalf("FetchRelease() of the projects error = %v", err)
+	}
+	if diff := cmp.Diff(want.Tarballs[1:], got.Tarballs); diff != "" {
+		t.Errorf("FetchRelease() of the projects mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := c.FetchRelease(ctx, t.TempDir(), MacOS, "10.14.1", &FetchReleaseOptions{Projects: []string{"Libsystem"}}); err == nil {
+		t.Error("FetchRelease() of the project not in the release succeeded")
+	}
+}
+
+func TestClient_FetchRelease_limitCache(t *testing.T) {
+	site := &aostest.Site{Releases: []aostest.Release{{Name: "macos-10141"}}}
+	for i := 0; i < 32; i++ {
+		name := fmt.Sprintf("project%d", i)
+		site.Projects = append(site.Projects, aostest.Project{Name: name, Versions: []aostest.Version{{Version: "1", Tarball: bytes.Repeat([]byte(name), 100)}}})
+		site.Releases[0].Projects = append(site.Releases[0].Projects, aostest.ReleaseProject{Name: name, Version: "1"})
+	}
+	srv := aostest.NewServer(site)
+	defer srv.Close()
+
+	// the half of the tarballs are stored, which are evicted by the other fetched tarballs
+	c := &Client{BaseURL: srv.BaseURL(), Blobs: NewBlobStore(t.TempDir())}
+	for i, p := range site.Projects {
+		if i%2 == 0 {
+			if _, err := c.Blobs.Put(p.Name, "1", bytes.NewReader(p.Versions[0].Tarball)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// each stored tarball exceeds the limit, so the other tarballs being fetched are evicted unless in use
+	c.MaxCacheSize = 1
+	dst := t.TempDir()
+	got, err := c.FetchRelease(context.Background(), dst, MacOS, "10.14.1", &FetchReleaseOptions{Jobs: 16})
+	if err != nil {
+		t.Fatalf("FetchRelease() error = %v", err)
+	}
+	if len(got.Tarballs) != len(site.Projects) {
+		t.Errorf("FetchRelease() fetched %d tarballs, want %d", len(got.Tarballs), len(site.Projects))
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultHARMaxBodySize is the default maximum bytes of the recorded response body of HARRecorder.
+const DefaultHARMaxBodySize = 1 << 20
+
+// HARRecorder is a http.RoundTripper which records the requests and the responses in the HTTP Archive
+// (HAR) 1.2 format, to attach the traffic to the bug reports.
+//
+// The response body is recorded up to MaxBodySize bytes, so the large tarballs are truncated.
+type HARRecorder struct {
+	// Transport is the underlying http.RoundTripper. http.DefaultTransport is used if nil.
+	Transport http.RoundTripper
+
+	// MaxBodySize is the maximum bytes of the recorded response body. DefaultHARMaxBodySize is used if zero,
+	// and the body is not recorded if negative.
+	MaxBodySize int64
+
+	mu      sync.Mutex
+	entries []*harEntry
+}
+
+var _ http.RoundTripper = (*HARRecorder)(nil)
+
+// RoundTrip implements a http.RoundTripper interface.
+func (h *HARRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := h.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	start := time.Now()
+	e := &harEntry{
+		StartedDateTime: start,
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: req.Proto,
+			Headers:     harHeaders(req.Header),
+			QueryString: []harNameValue{},
+			Cookies:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Cache: struct{}{},
+	}
+	if e.Request.HTTPVersion == "" {
+		e.Request.HTTPVersion = "HTTP/1.1"
+	}
+	for name, values := range req.URL.Query() {
+		for _, v := range values {
+			e.Request.QueryString = append(e.Request.QueryString, harNameValue{Name: name, Value: v})
+		}
+	}
+
+	h.mu.Lock()
+	h.entries = append(h.entries, e)
+	h.mu.Unlock()
+
+	resp, err := transport.RoundTrip(req)
+	wait := time.Since(start)
+	if err != nil {
+		h.mu.Lock()
+		e.Time = ms(wait)
+		e.Timings = harTimings{Send: 0, Wait: ms(wait), Receive: 0}
+		e.Comment = err.Error()
+		h.mu.Unlock()
+		return nil, err
+	}
+
+	h.mu.Lock()
+	e.Response = harResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: resp.Proto,
+		Headers:     harHeaders(resp.Header),
+		Cookies:     []harNameValue{},
+		Content:     harContent{Size: 0, MimeType: resp.Header.Get("Content-Type")},
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	e.Time = ms(wait)
+	e.Timings = harTimings{Send: 0, Wait: ms(wait), Receive: 0}
+	h.mu.Unlock()
+
+	resp.Body = &harBody{
+		ReadCloser: resp.Body,
+		h:          h,
+		e:          e,
+		max:        h.maxBodySize(),
+		start:      start,
+		wait:       wait,
+	}
+
+	return resp, nil
+}
+
+func (h *HARRecorder) maxBodySize() int64 {
+	if h.MaxBodySize == 0 {
+		return DefaultHARMaxBodySize
+	}
+
+	return h.MaxBodySize
+}
+
+// WriteHAR writes the recorded entries to w as the HAR JSON.
+func (h *HARRecorder) WriteHAR(w io.Writer) error {
+	h.mu.Lock()
+	entries := make([]*harEntry, len(h.entries))
+	copy(entries, h.entries)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].StartedDateTime.Before(entries[j].StartedDateTime) })
+
+	har := harFile{
+		Log: harLog{
+			Version: "1.2",
+			Creator: harCreator{Name: "appleopensource", Version: "1"},
+			Entries: entries,
+		},
+	}
+	buf, err := json.MarshalIndent(har, "", "  ")
+	h.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(buf, '\n'))
+	return err
+}
+
+// harBody records the response body while the client reads it.
+type harBody struct {
+	io.ReadCloser
+
+	h     *HARRecorder
+	e     *harEntry
+	max   int64
+	buf   bytes.Buffer
+	size  int64
+	start time.Time
+	wait  time.Duration
+	done  bool
+}
+
+// Read implements a io.Reader interface.
+func (b *harBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	if rest := b.max - int64(b.buf.Len()); rest > 0 {
+		if int64(n) < rest {
+			rest = int64(n)
+		}
+		b.buf.Write(p[:rest])
+	}
+	if err == io.EOF {
+		b.finish()
+	}
+
+	return n, err
+}
+
+// Close implements a io.Closer interface.
+func (b *harBody) Close() error {
+	b.finish()
+	return b.ReadCloser.Close()
+}
+
+// finish records the read body into the entry.
+func (b *harBody) finish() {
+	if b.done {
+		return
+	}
+	b.done = true
+
+	b.h.mu.Lock()
+	defer b.h.mu.Unlock()
+
+	total := time.Since(b.start)
+	b.e.Time = ms(total)
+	b.e.Timings.Receive = ms(total - b.wait)
+	b.e.Response.BodySize = b.size
+
+	c := &b.e.Response.Content
+	c.Size = b.size
+	body := b.buf.Bytes()
+	if utf8.Valid(body) {
+		c.Text = string(body)
+	} else {
+		c.Text = base64.StdEncoding.EncodeToString(body)
+		c.Encoding = "base64"
+	}
+	if int64(len(body)) < b.size {
+		c.Comment = "truncated"
+	}
+}
+
+// ms returns the d in milliseconds.
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func harHeaders(h http.Header) []harNameValue {
+	headers := []harNameValue{}
+	for name, values := range h {
+		for _, v := range values {
+			headers = append(headers, harNameValue{Name: name, Value: v})
+		}
+	}
+	sort.SliceStable(headers, func(i, j int) bool { return headers[i].Name < headers[j].Name })
+
+	return headers
+}
+
+// list of the HAR 1.2 objects, see http://www.softwareishard.com/blog/har-12-spec/.
+
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string      `json:"version"`
+	Creator harCreator  `json:"creator"`
+	Entries []*harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	Cookies     []harNameValue `json:"cookies"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	Cookies     []harNameValue `json:"cookies"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
@@ -0,0 +1,97 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHARRecorder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tarballs/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<html>tarballs</html>")
+		case "/binary":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte{0xff, 0xfe, 0x00, 0x01, 0x02, 0x03})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	har := &HARRecorder{MaxBodySize: 4}
+	c := &Client{
+		HTTPClient: &http.Client{Transport: har},
+		BaseURL:    srv.URL,
+	}
+	if _, err := c.get(context.Background(), srv.URL+"/tarballs/?q=1"); err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	if _, err := c.get(context.Background(), srv.URL+"/binary"); err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := har.WriteHAR(&buf); err != nil {
+		t.Fatalf("WriteHAR() error = %v", err)
+	}
+
+	var got harFile
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("could not unmarshal the HAR: %v", err)
+	}
+	if got.Log.Version != "1.2" {
+		t.Errorf("version = %q, want 1.2", got.Log.Version)
+	}
+	if len(got.Log.Entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(got.Log.Entries))
+	}
+
+	type summary struct {
+		Method, URL string
+		Query       []harNameValue
+		Status      int
+		Content     harContent
+	}
+	var sums []summary
+	for _, e := range got.Log.Entries {
+		sums = append(sums, summary{
+			Method:  e.Request.Method,
+			URL:     e.Request.URL,
+			Query:   e.Request.QueryString,
+			Status:  e.Response.Status,
+			Content: e.Response.Content,
+		})
+	}
+	want := []summary{
+		{
+			Method:  http.MethodGet,
+			URL:     srv.URL + "/tarballs/?q=1",
+			Query:   []harNameValue{{Name: "q", Value: "1"}},
+			Status:  http.StatusOK,
+			Content: harContent{Size: 21, MimeType: "text/html", Text: "<htm", Comment: "truncated"},
+		},
+		{
+			Method:  http.MethodGet,
+			URL:     srv.URL + "/binary",
+			Query:   []harNameValue{},
+			Status:  http.StatusOK,
+			Content: harContent{Size: 6, MimeType: "application/octet-stream", Text: "//4AAQ==", Encoding: "base64", Comment: "truncated"},
+		},
+	}
+	if diff := cmp.Diff(want, sums); diff != "" {
+		t.Errorf("entries mismatch (-want +got):\n%s", diff)
+	}
+}
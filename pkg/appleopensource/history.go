@@ -0,0 +1,75 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"sort"
+)
+
+// HistoryEntry represents the project in a release of the project history.
+type HistoryEntry struct {
+	Platform Platform
+	Release  string
+
+	// Product is the project shipped in the release, or the zero Product if the release does not ship it.
+	Product Product
+
+	// Change is the change from the previous release of the platform: Added if the project first appears
+	// or reappears, Removed if the project disappears, Modified if the version is changed, or zero if unchanged.
+	Change ChangeKind
+}
+
+// Shipped reports whether the release ships the project.
+func (e HistoryEntry) Shipped() bool {
+	return e.Product.Name != ""
+}
+
+// Indexed returns the indexed releases ordered by the platform, and from the oldest release of each platform.
+func (x *ReleaseIndex) Indexed() []ReleaseVersion {
+	releases := make([]ReleaseVersion, len(x.releases))
+	copy(releases, x.releases)
+	sort.SliceStable(releases, func(i, j int) bool {
+		a, b := releases[i], releases[j]
+		if a.Platform != b.Platform {
+			return a.Platform < b.Platform
+		}
+		return compareVersions(a.Version, b.Version) < 0
+	})
+
+	return releases
+}
+
+// History returns the project in every indexed release in the order of Indexed, with the changes from the
+// previous release of the same platform.
+func (x *ReleaseIndex) History(project string) []HistoryEntry {
+	shipped := make(map[ReleaseVersion]Product)
+	for _, e := range x.projects[project] {
+		shipped[ReleaseVersion{Platform: e.Platform, Version: e.Release}] = e.Product
+	}
+
+	releases := x.Indexed()
+	history := make([]HistoryEntry, len(releases))
+	var prev *HistoryEntry
+	for i, r := range releases {
+		e := &history[i]
+		e.Platform, e.Release, e.Product = r.Platform, r.Version, shipped[r]
+		if prev != nil && prev.Platform != e.Platform {
+			prev = nil
+		}
+
+		wasShipped := prev != nil && prev.Shipped()
+		switch {
+		case e.Shipped() && !wasShipped:
+			e.Change = Added
+		case !e.Shipped() && wasShipped:
+			e.Change = Removed
+		case e.Shipped() && prev.Product.Version != e.Product.Version:
+			e.Change = Modified
+		}
+		prev = e
+	}
+
+	return history
+}
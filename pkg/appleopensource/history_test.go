@@ -0,0 +1,72 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReleaseIndex_History(t *testing.T) {
+	x := NewReleaseIndex()
+	x.Add(MacOS, "10.13", []Product{{Name: "xnu", Version: "4570.1.46"}})
+	x.Add(IOS, "12", []Product{{Name: "xnu", Version: "4903.222.5"}})
+	x.Add(MacOS, "10.12.1", []Product{{Name: "xnu", Version: "3789.21.4"}, {Name: "dyld", Version: "421.2"}})
+	x.Add(MacOS, "10.12", []Product{{Name: "xnu", Version: "3789.1.32"}, {Name: "dyld", Version: "421.1"}})
+	x.Add(MacOS, "10.12.2", []Product{{Name: "xnu", Version: "3789.21.4"}, {Name: "dyld", Version: "421.2"}})
+	x.Add(IOS, "11", nil)
+
+	wantIndexed := []ReleaseVersion{
+		{Platform: MacOS, Version: "10.12"},
+		{Platform: MacOS, Version: "10.12.1"},
+		{Platform: MacOS, Version: "10.12.2"},
+		{Platform: MacOS, Version: "10.13"},
+		{Platform: IOS, Version: "11"},
+		{Platform: IOS, Version: "12"},
+	}
+	if diff := cmp.Diff(wantIndexed, x.Indexed()); diff != "" {
+		t.Errorf("Indexed() mismatch (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]string{"dyld", "xnu"}, x.Projects()); diff != "" {
+		t.Errorf("Projects() mismatch (-want +got):\n%s", diff)
+	}
+
+	tests := []struct {
+		project string
+		want    []HistoryEntry
+	}{
+		{
+			project: "xnu",
+			want: []HistoryEntry{
+				{Platform: MacOS, Release: "10.12", Product: Product{Name: "xnu", Version: "3789.1.32"}, Change: Added},
+				{Platform: MacOS, Release: "10.12.1", Product: Product{Name: "xnu", Version: "3789.21.4"}, Change: Modified},
+				{Platform: MacOS, Release: "10.12.2", Product: Product{Name: "xnu", Version: "3789.21.4"}},
+				{Platform: MacOS, Release: "10.13", Product: Product{Name: "xnu", Version: "4570.1.46"}, Change: Modified},
+				{Platform: IOS, Release: "11"},
+				{Platform: IOS, Release: "12", Product: Product{Name: "xnu", Version: "4903.222.5"}, Change: Added},
+			},
+		},
+		{
+			project: "dyld",
+			want: []HistoryEntry{
+				{Platform: MacOS, Release: "10.12", Product: Product{Name: "dyld", Version: "421.1"}, Change: Added},
+				{Platform: MacOS, Release: "10.12.1", Product: Product{Name: "dyld", Version: "421.2"}, Change: Modified},
+				{Platform: MacOS, Release: "10.12.2", Product: Product{Name: "dyld", Version: "421.2"}},
+				{Platform: MacOS, Release: "10.13", Change: Removed},
+				{Platform: IOS, Release: "11"},
+				{Platform: IOS, Release: "12"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.project, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, x.History(tt.project)); diff != "" {
+				t.Errorf("History(%q) mismatch (-want +got):\n%s", tt.project, diff)
+			}
+		})
+	}
+}
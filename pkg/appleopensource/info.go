@@ -0,0 +1,163 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+)
+
+// ProductInfo represents everything known about a project.
+type ProductInfo struct {
+	Name string `json:"name" yaml:"name"`
+
+	// TarballVersions and SourceVersions are the available versions of the tarballs and the source resources,
+	// sorted from the oldest.
+	TarballVersions []string `json:"tarball_versions" yaml:"tarball_versions"`
+	SourceVersions  []string `json:"source_versions" yaml:"source_versions"`
+
+	// Latest is the latest version of either resources.
+	Latest string `json:"latest" yaml:"latest"`
+
+	// Releases is the releases which ship the project, only if InfoOptions.Releases is set.
+	Releases []ReleaseEntry `json:"releases,omitempty" yaml:"releases,omitempty"`
+
+	// Tarballs is the tarball of each TarballVersions.
+	Tarballs []TarballInfo `json:"tarballs" yaml:"tarballs"`
+}
+
+// TarballInfo represents the tarball of the project version.
+type TarballInfo struct {
+	Version string `json:"version" yaml:"version"`
+	URL     string `json:"url" yaml:"url"`
+
+	// Size is the bytes size of the tarball, or zero if unknown.
+	Size int64 `json:"size,omitempty" yaml:"size,omitempty"`
+
+	// Cached reports whether the tarball is stored in Client.Blobs, and Digest is its digest.
+	Cached bool   `json:"cached" yaml:"cached"`
+	Digest string `json:"digest,omitempty" yaml:"digest,omitempty"`
+}
+
+// InfoOptions represents an options of ProductInfo.
+type InfoOptions struct {
+	// Releases is the releases to search the project. The releases are not searched if empty.
+	Releases []ReleaseVersion
+
+	// Sizes requests the sizes of the tarballs which are not cached.
+	Sizes bool
+}
+
+// ProductInfo aggregates the versions, the releases and the tarballs of the project.
+//
+// The project may have only either the tarballs or the source resources, so ProductInfo returns the error
+// matching ErrNotFound only if neither is found.
+func (c *Client) ProductInfo(ctx context.Context, name string, opts *InfoOptions) (*ProductInfo, error) {
+	if opts == nil {
+		opts = &InfoOptions{}
+	}
+
+	info := &ProductInfo{Name: name}
+
+	var tarballsErr, sourceErr error
+	info.TarballVersions, tarballsErr = c.versions(ctx, name, TarballsResource)
+	info.SourceVersions, sourceErr = c.versions(ctx, name, SourceResource)
+	switch {
+	case tarballsErr != nil && !errors.Is(tarballsErr, ErrNotFound):
+		return nil, tarballsErr
+	case sourceErr != nil && !errors.Is(sourceErr, ErrNotFound):
+		return nil, sourceErr
+	case tarballsErr != nil && sourceErr != nil:
+		return nil, tarballsErr
+	}
+
+	for _, v := range append(append([]string{}, info.TarballVersions...), info.SourceVersions...) {
+		if info.Latest == "" || compareVersions(v, info.Latest) > 0 {
+			info.Latest = v
+		}
+	}
+
+	if len(opts.Releases) > 0 {
+		index, err := c.BuildReleaseIndex(ctx, opts.Releases)
+		if err != nil {
+			return nil, err
+		}
+		info.Releases = index.Entries(name)
+	}
+
+	info.Tarballs = make([]TarballInfo, len(info.TarballVersions))
+	for i, v := range info.TarballVersions {
+		info.Tarballs[i] = TarballInfo{
+			Version: v,
+			URL:     c.TarballURL(Product{Name: name, Version: v}),
+		}
+	}
+	if err := c.statTarballs(ctx, name, info.Tarballs, opts.Sizes); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// versions returns the available versions of the project, or the empty list if it has no version.
+func (c *Client) versions(ctx context.Context, name string, typ ResourceType) ([]string, error) {
+	buf, err := c.IndexVersion(ctx, name, typ)
+	if err != nil {
+		return []string{}, err
+	}
+
+	return ListVersions(buf)
+}
+
+// statTarballs fills the cache status and the sizes of the tarballs. The sizes of the tarballs which are not
+// cached are requested only if request is true, and are left unknown in the offline mode.
+func (c *Client) statTarballs(ctx context.Context, name string, tarballs []TarballInfo, request bool) error {
+	if c.Blobs != nil {
+		for i := range tarballs {
+			t := &tarballs[i]
+			digest, size, err := c.Blobs.Stat(name, t.Version)
+			switch {
+			case err == nil:
+				t.Cached, t.Digest, t.Size = true, digest, size
+			case !errors.Is(err, ErrBlobNotFound):
+				return err
+			}
+		}
+	}
+	if !request || c.Offline {
+		return nil
+	}
+
+	sem := semaphore.NewWeighted(int64(c.concurrency()))
+	eg, ctx := errgroup.WithContext(ctx)
+	for i := range tarballs {
+		t := &tarballs[i]
+		if t.Cached {
+			continue
+		}
+
+		eg.Go(func() error {
+			if err := sem.Acquire(ctx, 1); err != nil {
+				return err
+			}
+			defer sem.Release(1)
+
+			resp, err := c.head(ctx, t.URL)
+			if err != nil {
+				return err
+			}
+			if resp.StatusCode == http.StatusOK && resp.ContentLength > 0 {
+				t.Size = resp.ContentLength
+			}
+			return nil
+		})
+	}
+
+	return eg.Wait()
+}
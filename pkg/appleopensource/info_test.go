@@ -0,0 +1,91 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource/aostest"
+)
+
+func TestClient_ProductInfo(t *testing.T) {
+	srv := aostest.NewServer(&aostest.Site{
+		Projects: []aostest.Project{
+			{
+				Name: "dyld",
+				Versions: []aostest.Version{
+					{Version: "551.3", Tarball: bytes.Repeat([]byte("a"), 100)},
+					{Version: "635.2", Tarball: bytes.Repeat([]byte("b"), 200)},
+				},
+			},
+		},
+		Releases: []aostest.Release{
+			{Name: "macos-1014", Projects: []aostest.ReleaseProject{{Name: "dyld", Version: "635.2"}}},
+		},
+	})
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := &Client{BaseURL: srv.BaseURL(), Blobs: NewBlobStore(t.TempDir())}
+	if _, err := c.Tarball(ctx, Product{Name: "dyld", Version: "635.2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.ProductInfo(ctx, "dyld", &InfoOptions{
+		Releases: []ReleaseVersion{{Platform: MacOS, Version: "10.14"}},
+		Sizes:    true,
+	})
+	if err != nil {
+		t.Fatalf("ProductInfo() error = %v", err)
+	}
+
+	want := &ProductInfo{
+		Name:            "dyld",
+		TarballVersions: []string{"551.3", "635.2"},
+		SourceVersions:  []string{"551.3", "635.2"},
+		Latest:          "635.2",
+		Releases: []ReleaseEntry{
+			{Platform: MacOS, Release: "10.14", Product: Product{Name: "dyld", Version: "635.2"}},
+		},
+		Tarballs: []TarballInfo{
+			{Version: "551.3", URL: srv.BaseURL() + "tarballs/dyld/dyld-551.3.tar.gz", Size: 100},
+			{Version: "635.2", URL: srv.BaseURL() + "tarballs/dyld/dyld-635.2.tar.gz", Size: 200, Cached: true},
+		},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(TarballInfo{}, "Digest")); diff != "" {
+		t.Errorf("ProductInfo() mismatch (-want +got):\n%s", diff)
+	}
+	if got.Tarballs[1].Digest == "" {
+		t.Error("ProductInfo() has no digest of the cached tarball")
+	}
+
+	// the releases are encoded with the platform name
+	buf, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"releases":[{"platform":"macos","release":"10.14","product":{"name":"dyld","version":"635.2"}}]`; !strings.Contains(string(buf), want) {
+		t.Errorf("json.Marshal() = %s, want %s", buf, want)
+	}
+	decoded := new(ProductInfo)
+	if err := json.Unmarshal(buf, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got.Releases, decoded.Releases); diff != "" {
+		t.Errorf("json.Unmarshal() releases mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := c.ProductInfo(ctx, "dyle", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ProductInfo() of the unknown project error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"context"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket which is refilled by rate tokens per second up to burst tokens.
+//
+// WaitN takes the tokens in advance even if more than available, and waits until the debt is refilled,
+// so that the large n such as the bytes of a read is limited on average.
+// The nil Limiter does not limit anything.
+type Limiter struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex // guards below
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns the Limiter which allows rate events per second and the bursts of at most burst events.
+// The burst less than 1 is 1. The rate less than or equal to zero does not limit anything.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &Limiter{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// Wait is shorthand for WaitN(ctx, 1).
+func (l *Limiter) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN blocks until the n events are allowed, or the ctx is done.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil || l.rate <= 0 || n <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if !l.last.IsZero() {
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		// returns the tokens which are not used
+		l.mu.Lock()
+		l.tokens += float64(n)
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Limits represents the rate limits of the requests and the bandwidth limits of the downloads.
+//
+// The limits are shared by all requests of the Clients which have the same Limits, including the index
+// pages and the range requests of Fetch. The retries and the requests to the providers are also limited.
+// The zero value does not limit anything.
+type Limits struct {
+	// RequestsPerSecond is the maximum number of the requests per second to all hosts. Zero is unlimited.
+	RequestsPerSecond float64
+
+	// BytesPerSecond is the maximum download throughput from all hosts. Zero is unlimited.
+	BytesPerSecond int64
+
+	// Hosts is the limits per host keyed by the host name such as "opensource.apple.com", which are
+	// applied in addition to the limits of all hosts.
+	Hosts map[string]HostLimits
+
+	mu       sync.Mutex // guards below
+	limiters map[string]*hostLimiters
+}
+
+// HostLimits represents the limits of the requests to a host.
+type HostLimits struct {
+	// RequestsPerSecond is the maximum number of the requests per second. Zero is unlimited.
+	RequestsPerSecond float64
+
+	// BytesPerSecond is the maximum download throughput. Zero is unlimited.
+	BytesPerSecond int64
+}
+
+// hostLimiters represents the Limiters of the HostLimits.
+type hostLimiters struct {
+	requests *Limiter
+	bytes    *Limiter
+}
+
+// allHosts is the key of the Limits.limiters of all hosts, which is not a valid host name.
+const allHosts = "*"
+
+// newHostLimiters returns the Limiters of the hl. The bursts are the limits of a second.
+func newHostLimiters(hl HostLimits) *hostLimiters {
+	return &hostLimiters{
+		requests: NewLimiter(hl.RequestsPerSecond, int(math.Ceil(hl.RequestsPerSecond))),
+		bytes:    NewLimiter(float64(hl.BytesPerSecond), int(hl.BytesPerSecond)),
+	}
+}
+
+// hostLimiters returns the Limiters of all hosts and of the host if limited.
+func (l *Limits) hostLimiters(host string) []*hostLimiters {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limiters == nil {
+		l.limiters = map[string]*hostLimiters{
+			allHosts: newHostLimiters(HostLimits{RequestsPerSecond: l.RequestsPerSecond, BytesPerSecond: l.BytesPerSecond}),
+		}
+	}
+	limiters := []*hostLimiters{l.limiters[allHosts]}
+
+	hl, ok := l.Hosts[host]
+	if !ok {
+		return limiters
+	}
+	hls, ok := l.limiters[host]
+	if !ok {
+		hls = newHostLimiters(hl)
+		l.limiters[host] = hls
+	}
+
+	return append(limiters, hls)
+}
+
+// waitRequest blocks until the request to the host is allowed, or the ctx is done.
+func (l *Limits) waitRequest(ctx context.Context, host string) error {
+	if l == nil {
+		return nil
+	}
+
+	for _, hls := range l.hostLimiters(host) {
+		if err := hls.requests.Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// limitBody returns the body of the response from the host which reads at the bandwidth limits.
+func (l *Limits) limitBody(ctx context.Context, host string, body io.ReadCloser) io.ReadCloser {
+	if l == nil {
+		return body
+	}
+
+	var limiters []*Limiter
+	for _, hls := range l.hostLimiters(host) {
+		if hls.bytes.rate > 0 {
+			limiters = append(limiters, hls.bytes)
+		}
+	}
+	if len(limiters) == 0 {
+		return body
+	}
+
+	return &limitedBody{ReadCloser: body, ctx: ctx, limiters: limiters}
+}
+
+// limitedBody is a response body which reads at the rate of the limiters.
+type limitedBody struct {
+	io.ReadCloser
+	ctx      context.Context
+	limiters []*Limiter
+}
+
+// Read implements a io.Reader interface.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	for _, l := range b.limiters {
+		if werr := l.WaitN(b.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+
+	return n, err
+}
@@ -0,0 +1,114 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource/aostest"
+)
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+
+	var nilLimiter *Limiter
+	if err := nilLimiter.WaitN(ctx, 100); err != nil {
+		t.Errorf("WaitN() of the nil Limiter error = %v", err)
+	}
+
+	l := NewLimiter(50, 1)
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if err := l.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("6 events at 50/s with the burst 1 took %v, want at least 100ms", elapsed)
+	}
+
+	// the debt of the large n is waited by the next WaitN
+	l = NewLimiter(1000, 1000)
+	if err := l.WaitN(ctx, 1100); err != nil {
+		t.Fatal(err)
+	}
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := l.WaitN(cctx, 1000); !errors.Is(err, context.Canceled) {
+		t.Errorf("WaitN() with the canceled context error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestClient_Limits(t *testing.T) {
+	tarball := bytes.Repeat([]byte("xnu tarball\n"), 12500) // 150KB
+	srv := aostest.NewServer(&aostest.Site{
+		Projects: []aostest.Project{{Name: "xnu", Versions: []aostest.Version{{Version: "1", Tarball: tarball}}}},
+	})
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := &Client{
+		BaseURL: srv.BaseURL(),
+		Limits:  &Limits{Hosts: map[string]HostLimits{"127.0.0.1": {RequestsPerSecond: 10}}},
+	}
+	start := time.Now()
+	for i := 0; i < 13; i++ {
+		if _, err := c.IndexProject(ctx, TarballsResource); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 270*time.Millisecond {
+		t.Errorf("13 requests at 10/s took %v, want at least 300ms", elapsed)
+	}
+
+	// the range requests of Fetch share the bandwidth limit
+	c.Limits = &Limits{BytesPerSecond: 100 << 10}
+	start = time.Now()
+	if err := c.Fetch(ctx, t.TempDir(), c.TarballURL(Product{Name: "xnu", Version: "1"})); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("150KB at 100KiB/s took %v, want at least 450ms", elapsed)
+	}
+}
+
+func TestClient_UserAgent(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		agents []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		agents = append(agents, r.UserAgent())
+		mu.Unlock()
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	for _, tt := range []struct {
+		userAgent string
+		want      string
+	}{
+		{"", DefaultUserAgent},
+		{"aos/test", "aos/test"},
+	} {
+		agents = nil
+		c := &Client{BaseURL: srv.URL, UserAgent: tt.userAgent}
+		if _, err := c.IndexProject(ctx, TarballsResource); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("IndexProject() error = %v, want ErrNotFound", err)
+		}
+		if len(agents) != 1 || agents[0] != tt.want {
+			t.Errorf("User-Agent = %q, want %q", agents, tt.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLevel represents a level of the log.
+type LogLevel int
+
+// list of LogLevel.
+const (
+	LevelDebug LogLevel = iota - 1
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String implements a fmt.Stringer interface.
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return strconv.Itoa(int(l))
+	}
+}
+
+// Logger is the interface of the leveled structured logger.
+//
+// The kv is the alternating key and value pairs, such as "url", u, "status", 200.
+// The implementation must be safe for concurrent use.
+type Logger interface {
+	Log(level LogLevel, msg string, kv ...interface{})
+}
+
+// textLogger is a Logger which writes the logfmt style lines.
+type textLogger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level LogLevel
+}
+
+// NewTextLogger returns the Logger which writes the logs at least the level to w as the logfmt style lines
+// such as:
+//
+//	time=2021-04-09T00:00:00Z level=debug msg=request method=GET url=https://opensource.apple.com/tarballs status=200 elapsed=120ms
+func NewTextLogger(w io.Writer, level LogLevel) Logger {
+	return &textLogger{w: w, level: level}
+}
+
+// Log implements a Logger interface.
+func (l *textLogger) Log(level LogLevel, msg string, kv ...interface{}) {
+	if level < l.level {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("time=")
+	b.WriteString(time.Now().UTC().Format(time.RFC3339Nano))
+	b.WriteString(" level=")
+	b.WriteString(level.String())
+	b.WriteString(" msg=")
+	b.WriteString(logfmtValue(msg))
+	for i := 0; i < len(kv); i += 2 {
+		b.WriteByte(' ')
+		b.WriteString(fmt.Sprint(kv[i]))
+		b.WriteByte('=')
+		if i+1 < len(kv) {
+			b.WriteString(logfmtValue(fmt.Sprint(kv[i+1])))
+		}
+	}
+	b.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.w, b.String())
+}
+
+// logfmtValue quotes s if it contains the spaces, the quotes or the equal signs.
+func logfmtValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
+
+// log logs the msg by c.Logger if not nil.
+func (c *Client) log(level LogLevel, msg string, kv ...interface{}) {
+	if c.Logger == nil {
+		return
+	}
+
+	c.Logger.Log(level, msg, kv...)
+}
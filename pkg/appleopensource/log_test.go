@@ -0,0 +1,29 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTextLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewTextLogger(&buf, LevelInfo)
+
+	l.Log(LevelDebug, "ignored", "k", "v")
+	l.Log(LevelInfo, "cache hit", "url", "https://opensource.apple.com/tarballs", "query", "a=b c", "n", 3)
+
+	got := buf.String()
+	if strings.Contains(got, "ignored") {
+		t.Errorf("the debug log is written at the info level: %q", got)
+	}
+
+	const want = ` level=info msg="cache hit" url=https://opensource.apple.com/tarballs query="a=b c" n=3` + "\n"
+	if !strings.HasPrefix(got, "time=") || !strings.HasSuffix(got, want) {
+		t.Errorf("Log() = %q, want suffix %q", got, want)
+	}
+}
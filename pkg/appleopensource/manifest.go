@@ -0,0 +1,196 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ManifestName is the default file name of the Manifest.
+const ManifestName = "aos.yaml"
+
+// Manifest represents the projects to sync, such as the aos.yaml file:
+//
+//	release:
+//	  platform: macos
+//	  version: 10.14.1
+//	dir: src
+//	projects:
+//	  - dtrace
+//	  - AvailabilityVersions@33.200.4
+//	  - name: xnu
+//	    dir: xnu
+//	    patches:
+//	      - patches/xnu/0001-fix-build.patch
+type Manifest struct {
+	// Release is the release which resolves the versions of the projects without the version.
+	Release *ManifestRelease `yaml:"release,omitempty"`
+
+	// Dir is the directory to extract the projects, relative to the manifest file. The default is the
+	// directory of the manifest file.
+	Dir string `yaml:"dir,omitempty"`
+
+	// Projects is the projects to sync.
+	Projects []ManifestProject `yaml:"projects"`
+
+	// path is the manifest file path.
+	path string
+}
+
+// ManifestRelease represents the release of the Manifest.
+type ManifestRelease struct {
+	Platform string `yaml:"platform"`
+	Version  string `yaml:"version"`
+}
+
+// ManifestProject represents a project of the Manifest. It is written as the mapping, or the "name" or
+// the "name@version" string.
+type ManifestProject struct {
+	Name string `yaml:"name"`
+
+	// Version pins the version. The version is resolved from Manifest.Release if empty.
+	Version string `yaml:"version,omitempty"`
+
+	// Dir is the directory to extract the project, relative to Manifest.Dir. The default is "<name>-<version>".
+	Dir string `yaml:"dir,omitempty"`
+
+	// SHA256 is the hex encoded SHA-256 digest of the tarball to verify, if not empty.
+	SHA256 string `yaml:"sha256,omitempty"`
+
+	// Patches is the patch files, relative to the manifest file, applied in order after the extraction
+	// with stripping the first path component, such as patch -p1.
+	Patches []string `yaml:"patches,omitempty"`
+}
+
+// UnmarshalYAML implements a yaml.Unmarshaler interface.
+func (p *ManifestProject) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*p = ManifestProject{}
+		p.Name = node.Value
+		if i := strings.IndexByte(node.Value, '@'); i >= 0 {
+			p.Name, p.Version = node.Value[:i], node.Value[i+1:]
+		}
+		return nil
+	}
+
+	// node.Decode does not inherit the KnownFields of the decoder
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i < len(node.Content); i += 2 {
+			switch key := node.Content[i]; key.Value {
+			case "name", "version", "dir", "sha256", "patches":
+			default:
+				return fmt.Errorf("line %d: field %s not found in project", key.Line, key.Value)
+			}
+		}
+	}
+
+	type plain ManifestProject
+	return node.Decode((*plain)(p))
+}
+
+// ParseManifest parses the Manifest in the YAML format.
+func ParseManifest(buf []byte) (*Manifest, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(buf))
+	dec.KnownFields(true)
+
+	m := &Manifest{}
+	if err := dec.Decode(m); err != nil {
+		return nil, err
+	}
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// LoadManifest loads the Manifest from the fname file.
+func LoadManifest(fname string) (*Manifest, error) {
+	buf, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := ParseManifest(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fname, err)
+	}
+	m.path = fname
+
+	return m, nil
+}
+
+// validate validates the manifest.
+func (m *Manifest) validate() error {
+	if m.Release != nil {
+		if _, err := ParsePlatform(m.Release.Platform); err != nil {
+			return fmt.Errorf("release: %w", err)
+		}
+		if m.Release.Version == "" {
+			return errors.New("release: no version")
+		}
+	}
+
+	seen := make(map[string]bool)
+	dirs := make(map[string]string) // the project names by the dir
+	for i, p := range m.Projects {
+		switch {
+		case p.Name == "":
+			return fmt.Errorf("projects[%d]: no name", i)
+		case seen[p.Name]:
+			return fmt.Errorf("projects[%d]: duplicated project: %s", i, p.Name)
+		case p.Version == "" && m.Release == nil:
+			return fmt.Errorf("projects[%d]: no version of %s without the release", i, p.Name)
+		case p.Dir != "" && !isLocalPath(filepath.ToSlash(p.Dir)):
+			return fmt.Errorf("projects[%d]: the dir of %s is out of the manifest dir: %s", i, p.Name, p.Dir)
+		}
+		seen[p.Name] = true
+
+		// the default dir of the project resolved from the release is checked by Client.Sync
+		if p.Dir != "" || p.Version != "" {
+			dir := p.dir()
+			if name, ok := dirs[dir]; ok {
+				return fmt.Errorf("projects[%d]: the dir of %s is also the dir of %s: %s", i, p.Name, name, dir)
+			}
+			dirs[dir] = p.Name
+		}
+	}
+
+	return nil
+}
+
+// dir returns the cleaned directory to extract the project, relative to Manifest.Dir.
+func (p ManifestProject) dir() string {
+	if p.Dir == "" {
+		return p.Name + "-" + p.Version
+	}
+
+	return filepath.Clean(p.Dir)
+}
+
+// baseDir returns the directory of the manifest file.
+func (m *Manifest) baseDir() string {
+	if m.path == "" {
+		return "."
+	}
+
+	return filepath.Dir(m.path)
+}
+
+// root returns the directory to extract the projects.
+func (m *Manifest) root() string {
+	if filepath.IsAbs(m.Dir) {
+		return m.Dir
+	}
+
+	return filepath.Join(m.baseDir(), m.Dir)
+}
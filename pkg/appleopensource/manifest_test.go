@@ -0,0 +1,110 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestParseManifest(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    *Manifest
+		wantErr bool
+	}{
+		{
+			name: "release",
+			yaml: `
+release:
+  platform: macos
+  version: 10.14.1
+dir: src
+projects:
+  - dtrace
+  - AvailabilityVersions@33.200.4
+  - name: xnu
+    dir: xnu
+    sha256: abc
+    patches:
+      - patches/xnu.patch
+`,
+			want: &Manifest{
+				Release: &ManifestRelease{Platform: "macos", Version: "10.14.1"},
+				Dir:     "src",
+				Projects: []ManifestProject{
+					{Name: "dtrace"},
+					{Name: "AvailabilityVersions", Version: "33.200.4"},
+					{Name: "xnu", Dir: "xnu", SHA256: "abc", Patches: []string{"patches/xnu.patch"}},
+				},
+			},
+		},
+		{
+			name: "pins",
+			yaml: `
+projects:
+  - xnu@4903.221.2
+  - name: libplatform
+    version: 177.200.16
+`,
+			want: &Manifest{
+				Projects: []ManifestProject{
+					{Name: "xnu", Version: "4903.221.2"},
+					{Name: "libplatform", Version: "177.200.16"},
+				},
+			},
+		},
+		{
+			name:    "no version",
+			yaml:    "projects: [xnu]\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown platform",
+			yaml:    "release: {platform: foo, version: 1}\nprojects: [xnu]\n",
+			wantErr: true,
+		},
+		{
+			name:    "duplicated",
+			yaml:    "projects: [xnu@1, xnu@2]\n",
+			wantErr: true,
+		},
+		{
+			name:    "dir out of the manifest dir",
+			yaml:    "projects: [{name: xnu, version: 1, dir: ../xnu}]\n",
+			wantErr: true,
+		},
+		{
+			name:    "duplicated dir",
+			yaml:    "projects: [{name: xnu, version: 1, dir: src}, {name: dtrace, version: 1, dir: ./src}]\n",
+			wantErr: true,
+		},
+		{
+			name:    "dir of the other project",
+			yaml:    "projects: [xnu@1, {name: dtrace, version: 1, dir: xnu-1}]\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			yaml:    "projects: [{name: xnu, version: 1, patch: x.patch}]\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseManifest([]byte(tt.yaml))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseManifest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got, cmpopts.IgnoreUnexported(Manifest{})); diff != "" {
+				t.Errorf("ParseManifest() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
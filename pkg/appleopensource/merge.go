@@ -0,0 +1,147 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+// Conflict markers of the merged lines.
+const (
+	conflictOurs   = "<<<<<<< ours\n"
+	conflictSep    = "=======\n"
+	conflictTheirs = ">>>>>>> theirs\n"
+)
+
+// lineChange represents the base[start:end] lines replaced by the lines.
+type lineChange struct {
+	start, end int
+	lines      []string
+}
+
+// lineChanges returns the changes from base to other, sorted by the position.
+func lineChanges(base, other []string) []lineChange {
+	var changes []lineChange
+	ops := diffLines(base, other)
+	for i := 0; i < len(ops); {
+		if ops[i].kind == opEqual {
+			i++
+			continue
+		}
+
+		c := lineChange{start: ops[i].a, end: ops[i].a}
+		for ; i < len(ops) && ops[i].kind != opEqual; i++ {
+			switch ops[i].kind {
+			case opDelete:
+				c.end = ops[i].a + 1
+			case opInsert:
+				c.lines = append(c.lines, other[ops[i].b])
+			}
+		}
+		changes = append(changes, c)
+	}
+
+	return changes
+}
+
+// applyChanges returns the base[start:end] lines applied the changes within them.
+func applyChanges(base []string, start, end int, changes []lineChange) []string {
+	lines := []string{}
+	pos := start
+	for _, c := range changes {
+		lines = append(lines, base[pos:c.start]...)
+		lines = append(lines, c.lines...)
+		pos = c.end
+	}
+
+	return append(lines, base[pos:end]...)
+}
+
+// merge3 merges the changes from base to ours and from base to theirs by the three-way merge, and reports
+// whether they conflict. The conflicting lines are marked by the conflict markers such as diff3(1).
+//
+// The changes of the both sides conflict when they overlap or touch, unless they are the same.
+func merge3(base, ours, theirs []string) ([]string, bool) {
+	oc, tc := lineChanges(base, ours), lineChanges(base, theirs)
+
+	var (
+		merged   []string
+		conflict bool
+	)
+	pos := 0
+	for len(oc) > 0 || len(tc) > 0 {
+		// collects the overlapping changes of the both sides from the first change
+		var og, tg []lineChange
+		var start, end int
+		if len(tc) == 0 || (len(oc) > 0 && oc[0].start <= tc[0].start) {
+			start, end = oc[0].start, oc[0].end
+			og, oc = append(og, oc[0]), oc[1:]
+		} else {
+			start, end = tc[0].start, tc[0].end
+			tg, tc = append(tg, tc[0]), tc[1:]
+		}
+		for {
+			if len(oc) > 0 && oc[0].start <= end {
+				if oc[0].end > end {
+					end = oc[0].end
+				}
+				og, oc = append(og, oc[0]), oc[1:]
+				continue
+			}
+			if len(tc) > 0 && tc[0].start <= end {
+				if tc[0].end > end {
+					end = tc[0].end
+				}
+				tg, tc = append(tg, tc[0]), tc[1:]
+				continue
+			}
+			break
+		}
+
+		merged = append(merged, base[pos:start]...)
+		switch {
+		case len(tg) == 0:
+			merged = append(merged, applyChanges(base, start, end, og)...)
+		case len(og) == 0:
+			merged = append(merged, applyChanges(base, start, end, tg)...)
+		default:
+			o, t := applyChanges(base, start, end, og), applyChanges(base, start, end, tg)
+			if equalLines(o, t) {
+				merged = append(merged, o...)
+				break
+			}
+			conflict = true
+			merged = append(merged, conflictOurs)
+			merged = append(merged, terminateLines(o)...)
+			merged = append(merged, conflictSep)
+			merged = append(merged, terminateLines(t)...)
+			merged = append(merged, conflictTheirs)
+		}
+		pos = end
+	}
+	merged = append(merged, base[pos:]...)
+
+	return merged, conflict
+}
+
+// equalLines reports whether a and b are the same lines.
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// terminateLines adds the trailing newline to the last line if missing, so the conflict marker starts
+// the line.
+func terminateLines(lines []string) []string {
+	if n := len(lines); n > 0 && lines[n-1] != "" && lines[n-1][len(lines[n-1])-1] != '\n' {
+		lines = append(lines[:n-1:n-1], lines[n-1]+"\n")
+	}
+
+	return lines
+}
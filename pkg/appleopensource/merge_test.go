@@ -0,0 +1,73 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMerge3(t *testing.T) {
+	tests := []struct {
+		name         string
+		base         string
+		ours         string
+		theirs       string
+		want         string
+		wantConflict bool
+	}{
+		{
+			name:   "both sides",
+			base:   "a\nb\nc\nd\ne\n",
+			ours:   "a\nB\nc\nd\ne\n",
+			theirs: "a\nb\nc\nd\nE\nf\n",
+			want:   "a\nB\nc\nd\nE\nf\n",
+		},
+		{
+			name:   "same change",
+			base:   "a\nb\nc\n",
+			ours:   "a\nB\nc\n",
+			theirs: "a\nB\nc\n",
+			want:   "a\nB\nc\n",
+		},
+		{
+			name:   "moved by theirs",
+			base:   "a\nb\nc\n",
+			ours:   "a\nb\nC\n",
+			theirs: "0\n0\na\nb\nc\n",
+			want:   "0\n0\na\nb\nC\n",
+		},
+		{
+			name:         "conflict",
+			base:         "a\nb\nc\n",
+			ours:         "a\nX\nc\n",
+			theirs:       "a\nY\nc\n",
+			want:         "a\n<<<<<<< ours\nX\n=======\nY\n>>>>>>> theirs\nc\n",
+			wantConflict: true,
+		},
+		{
+			name:         "conflict without newline",
+			base:         "a",
+			ours:         "b",
+			theirs:       "c",
+			want:         "<<<<<<< ours\nb\n=======\nc\n>>>>>>> theirs\n",
+			wantConflict: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflict := merge3(splitLines([]byte(tt.base)), splitLines([]byte(tt.ours)), splitLines([]byte(tt.theirs)))
+			if conflict != tt.wantConflict {
+				t.Errorf("merge3() conflict = %v, want %v", conflict, tt.wantConflict)
+			}
+			if diff := cmp.Diff(tt.want, strings.Join(got, "")); diff != "" {
+				t.Errorf("merge3() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
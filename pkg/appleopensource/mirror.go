@@ -0,0 +1,465 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+)
+
+// MirrorStateName is the file name of the crawl state written by Mirror into the mirror directory.
+const MirrorStateName = ".aos-mirror.json"
+
+// indexName is the file name of the directory listing pages in the mirror directory, which the static web
+// servers serve as the directory.
+const indexName = "index.html"
+
+// MirrorOptions represents an options of Mirror.
+type MirrorOptions struct {
+	// Platform mirrors the tarballs of the projects in the releases of the platform. All versions of all
+	// projects in the project index are mirrored if Unknown.
+	Platform Platform
+
+	// Since is the oldest release version of the Platform to mirror. All releases are mirrored if empty.
+	Since string
+
+	// Projects is the projects to mirror. All projects are mirrored if empty.
+	Projects []string
+
+	// Jobs is the number of the pages and the tarballs fetched in parallel. Client.Concurrency is used if zero.
+	Jobs int
+
+	// Rate is the maximum number of the pages and the tarballs fetched per second. Zero is unlimited.
+	Rate float64
+}
+
+// MirrorResult represents the result of Mirror.
+type MirrorResult struct {
+	Releases []string         `json:"releases" yaml:"releases"` // the paths of the mirrored release pages
+	Tarballs int              `json:"tarballs" yaml:"tarballs"` // the number of the tarballs in the mirror
+	Fetched  []FetchedTarball `json:"fetched" yaml:"fetched"`   // the tarballs fetched by this Mirror
+	Skipped  []SkippedProduct `json:"skipped" yaml:"skipped"`
+}
+
+// mirrorState represents the tarballs mirrored by Mirror, which is written to the MirrorStateName file.
+type mirrorState struct {
+	Tarballs map[string]*mirrorEntry `json:"tarballs"` // keyed by the path such as "tarballs/<name>/<file>"
+}
+
+// mirrorEntry represents the mirrored tarball.
+type mirrorEntry struct {
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// Mirror crawls the project index, the version lists and the tarballs, and mirrors them into dir with the
+// same layout as opensource.apple.com, so that dir can be served by CacheServer or any static web server.
+//
+// Only the tarballs which are not mirrored yet are fetched. The mirrored tarballs are recorded in the
+// MirrorStateName file in dir as soon as fetched, so that the interrupted Mirror resumes from there.
+// The directory listing pages are generated from the mirrored tarballs as the index.html of each directory,
+// and the release pages are written as is.
+func (c *Client) Mirror(ctx context.Context, dir string, opts *MirrorOptions) (*MirrorResult, error) {
+	if opts == nil {
+		opts = &MirrorOptions{}
+	}
+	if opts.Since != "" && opts.Platform == Unknown {
+		return nil, errors.New("the since release requires the platform")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	stateFile := filepath.Join(dir, MirrorStateName)
+	state, err := readMirrorState(stateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := opts.Jobs
+	if jobs < 1 {
+		jobs = c.concurrency()
+	}
+	m := &mirrorer{
+		c:         c,
+		dir:       dir,
+		stateFile: stateFile,
+		state:     state,
+		res:       &MirrorResult{Releases: []string{}, Fetched: []FetchedTarball{}, Skipped: []SkippedProduct{}},
+		sem:       semaphore.NewWeighted(int64(jobs)),
+	}
+	if opts.Rate > 0 {
+		m.limit = NewLimiter(opts.Rate, 1)
+	}
+
+	var targets []Product
+	if opts.Platform != Unknown {
+		targets, err = m.crawlReleases(ctx, opts.Platform, opts.Since)
+	} else {
+		targets, err = m.crawlProjects(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if targets, err = selectTargets(targets, opts.Projects); err != nil {
+		return nil, err
+	}
+
+	eg, ectx := errgroup.WithContext(ctx)
+	for _, p := range targets {
+		p := p
+		eg.Go(func() error {
+			return m.fetch(ectx, p)
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	if err := state.write(stateFile); err != nil {
+		return nil, err
+	}
+	if err := m.writeListings(); err != nil {
+		return nil, err
+	}
+
+	m.res.Tarballs = len(state.Tarballs)
+	sort.Slice(m.res.Fetched, func(i, j int) bool { return m.res.Fetched[i].File < m.res.Fetched[j].File })
+	sort.Slice(m.res.Skipped, func(i, j int) bool {
+		if m.res.Skipped[i].Name != m.res.Skipped[j].Name {
+			return m.res.Skipped[i].Name < m.res.Skipped[j].Name
+		}
+		return m.res.Skipped[i].Version < m.res.Skipped[j].Version
+	})
+
+	return m.res, nil
+}
+
+// mirrorer mirrors the resources into the dir directory.
+type mirrorer struct {
+	c         *Client
+	dir       string
+	stateFile string
+	sem       *semaphore.Weighted
+	limit     *Limiter // limits the rate of the pages and the tarballs if not nil
+
+	mu    sync.Mutex // guards below
+	state *mirrorState
+	res   *MirrorResult
+}
+
+// acquire waits for the slot of the jobs and the rate limit. The caller must call m.sem.Release(1) when done.
+func (m *mirrorer) acquire(ctx context.Context) error {
+	if err := m.sem.Acquire(ctx, 1); err != nil {
+		return err
+	}
+	if err := m.limit.Wait(ctx); err != nil {
+		m.sem.Release(1)
+		return err
+	}
+
+	return nil
+}
+
+// get fetches the uri page through the Cache of the client.
+func (m *mirrorer) get(ctx context.Context, uri string) ([]byte, error) {
+	if err := m.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer m.sem.Release(1)
+
+	return m.c.get(ctx, uri)
+}
+
+// skip records the product which is not mirrored.
+func (m *mirrorer) skip(p Product, reason string) {
+	m.c.log(LevelWarn, "skip mirror", "product", p.Name, "version", p.Version, "reason", reason)
+
+	m.mu.Lock()
+	m.res.Skipped = append(m.res.Skipped, SkippedProduct{Name: p.Name, Version: p.Version, Reason: reason})
+	m.mu.Unlock()
+}
+
+// crawlReleases mirrors the release pages of the platform since the version, and returns the projects of them.
+// The releases which are not found or have no release page URL are ignored because KnownRelease contains
+// the releases without the page.
+func (m *mirrorer) crawlReleases(ctx context.Context, platform Platform, since string) ([]Product, error) {
+	var targets []Product
+	for _, r := range KnownReleases(platform) {
+		if since != "" && compareVersions(r.Version, since) < 0 {
+			continue
+		}
+
+		u, err := m.c.releaseURL(r.Platform, r.Version)
+		if err != nil {
+			m.c.log(LevelDebug, "skip release", "platform", r.Platform, "release", r.Version, "err", err)
+			continue
+		}
+		buf, err := m.get(ctx, u.String())
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				m.c.log(LevelDebug, "no release page", "platform", r.Platform, "version", r.Version)
+				continue
+			}
+			return nil, err
+		}
+		rel, err := m.writePage(u.String(), buf)
+		if err != nil {
+			return nil, err
+		}
+		m.res.Releases = append(m.res.Releases, rel)
+
+		list, err := ListRelease(buf)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range list {
+			if p.Name != "" {
+				targets = append(targets, Product{Name: p.Name, Version: p.Version, ComingSoon: p.ComingSoon})
+			}
+		}
+	}
+	if len(m.res.Releases) == 0 {
+		if since != "" {
+			return nil, fmt.Errorf("no release of %s since %s", platform, since)
+		}
+		return nil, fmt.Errorf("no release of %s", platform)
+	}
+
+	return targets, nil
+}
+
+// crawlProjects crawls the project index and the version lists, and returns all versions of the projects.
+func (m *mirrorer) crawlProjects(ctx context.Context) ([]Product, error) {
+	buf, err := m.get(ctx, m.c.projectURL(TarballsResource).String())
+	if err != nil {
+		return nil, err
+	}
+	list, err := ListProject(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([][]Product, len(list))
+	eg, ctx := errgroup.WithContext(ctx)
+	for i, p := range list {
+		i, name := i, p.Name
+		if name == "" {
+			continue
+		}
+		eg.Go(func() error {
+			buf, err := m.get(ctx, m.c.versionURL(name, TarballsResource).String())
+			if err != nil {
+				return err
+			}
+			versions[i], err = listTarballs(buf, name)
+			return err
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	var targets []Product
+	for _, vs := range versions {
+		targets = append(targets, vs...)
+	}
+
+	return targets, nil
+}
+
+// listTarballs parses the tarballs version list page of the project, and returns the products of the listed
+// tarballs. Unlike ListVersions, the versions are exactly as the file names.
+func listTarballs(buf []byte, name string) ([]Product, error) {
+	dom, err := goquery.NewDocumentFromReader(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Product
+	dom.Find("table > tbody > tr td > a").Each(func(_ int, s *goquery.Selection) {
+		file := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(file, name+"-") && strings.HasSuffix(file, tarballSuffix) {
+			list = append(list, Product{Name: name, Version: strings.TrimSuffix(strings.TrimPrefix(file, name+"-"), tarballSuffix)})
+		}
+	})
+
+	return list, nil
+}
+
+// selectTargets returns the deduplicated targets of the names projects, or all targets if names is empty.
+func selectTargets(targets []Product, names []string) ([]Product, error) {
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		selected[name] = false
+	}
+
+	seen := make(map[Product]bool)
+	var list []Product
+	for _, p := range targets {
+		if _, ok := selected[p.Name]; len(names) > 0 && !ok {
+			continue
+		}
+		selected[p.Name] = true
+		if !seen[p] {
+			seen[p] = true
+			list = append(list, p)
+		}
+	}
+	for _, name := range names {
+		if !selected[name] {
+			return nil, fmt.Errorf("no such project to mirror: %s", name)
+		}
+	}
+
+	return list, nil
+}
+
+// writePage writes the uri page into the mirror directory, and returns the path of it.
+func (m *mirrorer) writePage(uri string, buf []byte) (string, error) {
+	rel := strings.TrimPrefix(strings.TrimPrefix(uri, m.c.baseURI()), "/")
+	fname := filepath.Join(m.dir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+		return "", err
+	}
+
+	return rel, writeFile(fname, bytes.NewReader(buf))
+}
+
+// fetch fetches the p tarball into the mirror directory if not mirrored yet.
+func (m *mirrorer) fetch(ctx context.Context, p Product) error {
+	if p.ComingSoon {
+		m.skip(p, "coming soon")
+		return nil
+	}
+
+	rel := p.tarballPath()
+	fname := filepath.Join(m.dir, filepath.FromSlash(rel))
+
+	m.mu.Lock()
+	e, ok := m.state.Tarballs[rel]
+	m.mu.Unlock()
+	if fi, err := os.Stat(fname); err == nil && (!ok || fi.Size() == e.Size) {
+		if ok {
+			return nil
+		}
+		// fetched but not recorded by the interrupted Mirror
+		return m.record(rel, fname, nil)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+		return err
+	}
+	if err := m.acquire(ctx); err != nil {
+		return err
+	}
+	uri := m.c.TarballURL(p)
+	err := m.c.fetch(ctx, filepath.Dir(fname), uri)
+	m.sem.Release(1)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			m.skip(p, "not found")
+			return nil
+		}
+		return err
+	}
+
+	return m.record(rel, fname, &FetchedTarball{Name: p.Name, Version: p.Version, URL: uri, File: rel})
+}
+
+// record records the fname tarball of the rel path into the state, and into the result as fetched if t is
+// not nil.
+func (m *mirrorer) record(rel, fname string, t *FetchedTarball) error {
+	digest, n, err := sumFile(fname)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state.Tarballs[rel] = &mirrorEntry{Size: n, SHA256: digest, FetchedAt: time.Now().UTC()}
+	if t != nil {
+		t.Size, t.SHA256 = n, digest
+		m.res.Fetched = append(m.res.Fetched, *t)
+	}
+
+	return m.state.write(m.stateFile)
+}
+
+// writeListings writes the directory listing pages of the mirrored tarballs.
+func (m *mirrorer) writeListings() error {
+	dirs := make(map[string][]listingEntry) // entries by the directory
+	projects := make(map[string]bool)
+	for rel, e := range m.state.Tarballs {
+		dir, file := path.Split(rel)
+		dir = path.Clean(dir)
+		dirs[dir] = append(dirs[dir], (&listingEntry{Name: file, Href: "/" + rel, size: e.Size}).finish())
+		projects[path.Base(dir)] = true
+	}
+	root := TarballsResource.String()
+	for name := range projects {
+		dirs[root] = append(dirs[root], (&listingEntry{Name: name, Href: "/" + root + "/" + name, dir: true}).finish())
+	}
+
+	for dir, entries := range dirs {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+		buf, err := renderListing(dir, entries)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(filepath.Join(m.dir, filepath.FromSlash(dir), indexName), bytes.NewReader(buf)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readMirrorState reads the mirror state from the fname file, or returns the empty state if not exist.
+func readMirrorState(fname string) (*mirrorState, error) {
+	state := &mirrorState{}
+	buf, err := ioutil.ReadFile(fname)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		// nothing to do
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(buf, state); err != nil {
+			return nil, fmt.Errorf("%s: %w", fname, err)
+		}
+	}
+	if state.Tarballs == nil {
+		state.Tarballs = make(map[string]*mirrorEntry)
+	}
+
+	return state, nil
+}
+
+// write writes the mirror state to the fname file atomically.
+func (s *mirrorState) write(fname string) error {
+	buf, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(fname, bytes.NewReader(append(buf, '\n')))
+}
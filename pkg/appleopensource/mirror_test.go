@@ -0,0 +1,159 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource/aostest"
+)
+
+// tarballRequests returns the paths of the tarballs downloaded from srv, which are counted by the HEAD requests.
+func tarballRequests(srv *aostest.Server) []string {
+	var paths []string
+	for _, r := range srv.Requests() {
+		if r.Method == http.MethodHead && strings.HasSuffix(r.Path, tarballSuffix) {
+			paths = append(paths, r.Path)
+		}
+	}
+
+	return paths
+}
+
+func TestClient_Mirror(t *testing.T) {
+	srv := aostest.NewServer(&aostest.Site{
+		Projects: []aostest.Project{
+			{Name: "dyld", Versions: []aostest.Version{{Version: "635.2"}}},
+			{Name: "xnu", Versions: []aostest.Version{{Version: "4570.1.46"}, {Version: "4903.221.2"}}},
+		},
+		Releases: []aostest.Release{
+			{Name: "macos-10122", Projects: []aostest.ReleaseProject{{Name: "dyld", Version: "635.2", ComingSoon: true}, {Name: "xnu", Version: "4903.221.2"}}},
+		},
+	})
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := &Client{BaseURL: srv.BaseURL()}
+	dir := t.TempDir()
+	ignore := cmpopts.IgnoreFields(FetchedTarball{}, "Size", "SHA256")
+
+	res, err := c.Mirror(ctx, dir, &MirrorOptions{Jobs: 2, Rate: 1000})
+	if err != nil {
+		t.Fatalf("Mirror() error = %v", err)
+	}
+	want := &MirrorResult{
+		Releases: []string{},
+		Tarballs: 3,
+		Fetched: []FetchedTarball{
+			{Name: "dyld", Version: "635.2", URL: srv.BaseURL() + "tarballs/dyld/dyld-635.2.tar.gz", File: "tarballs/dyld/dyld-635.2.tar.gz"},
+			{Name: "xnu", Version: "4570.1.46", URL: srv.BaseURL() + "tarballs/xnu/xnu-4570.1.46.tar.gz", File: "tarballs/xnu/xnu-4570.1.46.tar.gz"},
+			{Name: "xnu", Version: "4903.221.2", URL: srv.BaseURL() + "tarballs/xnu/xnu-4903.221.2.tar.gz", File: "tarballs/xnu/xnu-4903.221.2.tar.gz"},
+		},
+		Skipped: []SkippedProduct{},
+	}
+	if diff := cmp.Diff(want, res, ignore); diff != "" {
+		t.Errorf("Mirror() mismatch (-want +got):\n%s", diff)
+	}
+
+	// the mirror is served by a static web server
+	mirror := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer mirror.Close()
+	catalog := NewCatalog(&Client{BaseURL: mirror.URL + "/"}, TarballsResource)
+	projects, err := catalog.Projects(ctx)
+	if err != nil {
+		t.Fatalf("Projects() of the mirror error = %v", err)
+	}
+	if diff := cmp.Diff([]string{"dyld", "xnu"}, projects); diff != "" {
+		t.Errorf("Projects() of the mirror mismatch (-want +got):\n%s", diff)
+	}
+	versions, err := catalog.Versions(ctx, "xnu")
+	if err != nil {
+		t.Fatalf("Versions() of the mirror error = %v", err)
+	}
+	if diff := cmp.Diff([]string{"4570.1.46", "4903.221.2"}, versions); diff != "" {
+		t.Errorf("Versions() of the mirror mismatch (-want +got):\n%s", diff)
+	}
+
+	// fetches only the missing tarball
+	if err := os.Remove(filepath.Join(dir, "tarballs", "xnu", "xnu-4570.1.46.tar.gz")); err != nil {
+		t.Fatal(err)
+	}
+	srv.ResetRequests()
+	res, err = c.Mirror(ctx, dir, nil)
+	if err != nil {
+		t.Fatalf("Mirror() to resume error = %v", err)
+	}
+	want.Fetched = want.Fetched[1:2]
+	if diff := cmp.Diff(want, res, ignore); diff != "" {
+		t.Errorf("Mirror() to resume mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"/tarballs/xnu/xnu-4570.1.46.tar.gz"}, tarballRequests(srv)); diff != "" {
+		t.Errorf("Mirror() to resume requested tarballs mismatch (-want +got):\n%s", diff)
+	}
+
+	// records the tarball which is fetched but not recorded by the interrupted Mirror
+	if err := os.Remove(filepath.Join(dir, MirrorStateName)); err != nil {
+		t.Fatal(err)
+	}
+	srv.ResetRequests()
+	res, err = c.Mirror(ctx, dir, nil)
+	if err != nil {
+		t.Fatalf("Mirror() without the state error = %v", err)
+	}
+	want.Fetched = []FetchedTarball{}
+	if diff := cmp.Diff(want, res, ignore); diff != "" {
+		t.Errorf("Mirror() without the state mismatch (-want +got):\n%s", diff)
+	}
+	if reqs := tarballRequests(srv); len(reqs) != 0 {
+		t.Errorf("Mirror() without the state requested tarballs: %v", reqs)
+	}
+
+	// mirrors the projects of the releases
+	relDir := t.TempDir()
+	res, err = c.Mirror(ctx, relDir, &MirrorOptions{Platform: MacOS, Since: "10.12.2"})
+	if err != nil {
+		t.Fatalf("Mirror() of the releases error = %v", err)
+	}
+	wantRel := &MirrorResult{
+		Releases: []string{"release/macos-10122.html"},
+		Tarballs: 1,
+		Fetched:  []FetchedTarball{{Name: "xnu", Version: "4903.221.2", URL: srv.BaseURL() + "tarballs/xnu/xnu-4903.221.2.tar.gz", File: "tarballs/xnu/xnu-4903.221.2.tar.gz"}},
+		Skipped:  []SkippedProduct{{Name: "dyld", Version: "635.2", Reason: "coming soon"}},
+	}
+	if diff := cmp.Diff(wantRel, res, ignore); diff != "" {
+		t.Errorf("Mirror() of the releases mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := os.Stat(filepath.Join(relDir, "release", "macos-10122.html")); err != nil {
+		t.Errorf("Mirror() of the releases did not write the release page: %v", err)
+	}
+
+	// the old releases such as "10.4.11.x86" are crawled too
+	res, err = c.Mirror(ctx, t.TempDir(), &MirrorOptions{Platform: MacOS, Since: "10.4"})
+	if err != nil {
+		t.Fatalf("Mirror() of the old releases error = %v", err)
+	}
+	if diff := cmp.Diff(wantRel.Releases, res.Releases); diff != "" {
+		t.Errorf("Mirror() of the old releases mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := c.Mirror(ctx, t.TempDir(), &MirrorOptions{Platform: MacOS, Since: "10.12.3"}); err == nil {
+		t.Error("Mirror() of the releases without the page succeeded")
+	}
+	if _, err := c.Mirror(ctx, t.TempDir(), &MirrorOptions{Projects: []string{"libc"}}); err == nil {
+		t.Error("Mirror() of the unknown project succeeded")
+	}
+	if _, err := c.Mirror(ctx, t.TempDir(), &MirrorOptions{Since: "10.12.2"}); err == nil {
+		t.Error("Mirror() since the release without the platform succeeded")
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+)
+
+// Notifier delivers the WatchEvents.
+type Notifier interface {
+	Notify(ctx context.Context, events []WatchEvent) error
+}
+
+// Notifiers is a Notifier which delivers the events to all Notifiers in order.
+type Notifiers []Notifier
+
+// Notify implements a Notifier interface. It stops at the first error, so that the Notifiers before the
+// failed one have delivered the events, which are delivered again by the retry of the whole Notifiers.
+func (ns Notifiers) Notify(ctx context.Context, events []WatchEvent) error {
+	for _, n := range ns {
+		if err := n.Notify(ctx, events); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// JSONNotifier writes the events to W as the JSON lines, one JSON object per event.
+type JSONNotifier struct {
+	W io.Writer
+}
+
+// Notify implements a Notifier interface.
+func (n *JSONNotifier) Notify(ctx context.Context, events []WatchEvent) error {
+	enc := json.NewEncoder(n.W)
+	for _, ev := range events {
+		if err := enc.Encode(ev); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CommandNotifier runs the command for each event. The JSON of the event is written to the standard input
+// of the command, and its fields are set to the AOS_EVENT_TYPE, AOS_EVENT_PROJECT, AOS_EVENT_VERSION,
+// AOS_EVENT_PLATFORM and AOS_EVENT_RELEASE environment variables.
+type CommandNotifier struct {
+	// Name and Args is the command such as "sh", "-c", "notify-send ...".
+	Name string
+	Args []string
+
+	// Stdout and Stderr is the output of the command. The output is discarded if nil.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Notify implements a Notifier interface. The command which exits with the non-zero status is an error.
+func (n *CommandNotifier) Notify(ctx context.Context, events []WatchEvent) error {
+	for _, ev := range events {
+		buf, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+
+		cmd := exec.CommandContext(ctx, n.Name, n.Args...)
+		cmd.Stdin = bytes.NewReader(append(buf, '\n'))
+		cmd.Stdout, cmd.Stderr = n.Stdout, n.Stderr
+		cmd.Env = append(os.Environ(),
+			"AOS_EVENT_TYPE="+ev.Type.String(),
+			"AOS_EVENT_PROJECT="+ev.Project,
+			"AOS_EVENT_VERSION="+ev.Version,
+			"AOS_EVENT_PLATFORM="+ev.Platform,
+			"AOS_EVENT_RELEASE="+ev.Release,
+		)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("could not run the hook %s of the %s event: %w", n.Name, ev.Type, err)
+		}
+	}
+
+	return nil
+}
+
+// WebhookNotifier posts the JSON of each event to URL.
+type WebhookNotifier struct {
+	URL string
+
+	// HTTPClient is the HTTP client to send the requests. http.DefaultClient is used if nil.
+	HTTPClient *http.Client
+
+	// UserAgent is the User-Agent header of the requests. DefaultUserAgent is used if empty.
+	UserAgent string
+}
+
+// Notify implements a Notifier interface. The response status other than 2xx is an error.
+func (n *WebhookNotifier) Notify(ctx context.Context, events []WatchEvent) error {
+	hc := n.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	ua := n.UserAgent
+	if ua == "" {
+		ua = DefaultUserAgent
+	}
+
+	for _, ev := range events {
+		buf, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(buf))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(hdrUserAgent, ua)
+
+		resp, err := hc.Do(req)
+		if err != nil {
+			return err
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("could not post the %s event to %s: %s", ev.Type, n.URL, resp.Status)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var testEvents = []WatchEvent{
+	{Type: EventNewVersion, Project: "xnu", Version: "4903.221.2", Time: time.Date(2021, time.April, 9, 0, 0, 0, 0, time.UTC)},
+	{Type: EventNewRelease, Platform: "macos", Release: "10.14.1", Time: time.Date(2021, time.April, 9, 0, 0, 0, 0, time.UTC)},
+}
+
+func TestJSONNotifier(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (&JSONNotifier{W: &buf}).Notify(context.Background(), testEvents); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"type":"new_version","project":"xnu","version":"4903.221.2","time":"2021-04-09T00:00:00Z"}
+{"type":"new_release","platform":"macos","release":"10.14.1","time":"2021-04-09T00:00:00Z"}
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Notify() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCommandNotifier(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not found")
+	}
+
+	ctx := context.Background()
+	var buf bytes.Buffer
+	n := &CommandNotifier{Name: "sh", Args: []string{"-c", `echo "$AOS_EVENT_TYPE $AOS_EVENT_PROJECT$AOS_EVENT_PLATFORM"; cat`}, Stdout: &buf}
+	if err := n.Notify(ctx, testEvents); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `new_version xnu
+{"type":"new_version","project":"xnu","version":"4903.221.2","time":"2021-04-09T00:00:00Z"}
+new_release macos
+{"type":"new_release","platform":"macos","release":"10.14.1","time":"2021-04-09T00:00:00Z"}
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Notify() mismatch (-want +got):\n%s", diff)
+	}
+
+	n = &CommandNotifier{Name: "sh", Args: []string{"-c", "exit 1"}}
+	if err := n.Notify(ctx, testEvents); err == nil {
+		t.Error("Notify() of the failing hook error = nil, want error")
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []WatchEvent
+		status   = http.StatusNoContent
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || !strings.HasPrefix(r.UserAgent(), "aos/") {
+			t.Errorf("got %s request with Content-Type %q and User-Agent %q", r.Method, r.Header.Get("Content-Type"), r.UserAgent())
+		}
+		buf, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		var ev WatchEvent
+		if err := json.Unmarshal(buf, &ev); err != nil {
+			t.Errorf("could not decode the event %q: %v", buf, err)
+		}
+		received = append(received, ev)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	n := &WebhookNotifier{URL: srv.URL, UserAgent: "aos/test"}
+	if err := n.Notify(ctx, testEvents); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(testEvents, received); diff != "" {
+		t.Errorf("received events mismatch (-want +got):\n%s", diff)
+	}
+
+	status = http.StatusInternalServerError
+	if err := n.Notify(ctx, testEvents); err == nil {
+		t.Error("Notify() to the failing receiver error = nil, want error")
+	}
+}
@@ -0,0 +1,473 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// devNull is the file name of the missing side of the patch.
+const devNull = "/dev/null"
+
+// DefaultFuzz is the default maximum fuzz factor, which is same as patch(1).
+const DefaultFuzz = 2
+
+// Patch represents a unified diff of the files.
+type Patch struct {
+	// Header is the text before the first file patch, such as the commit message of git format-patch.
+	Header string
+
+	Files []*FilePatch
+}
+
+// FilePatch represents a unified diff of the file.
+type FilePatch struct {
+	// OldName and NewName are the file names of the "---" and the "+++" headers without the timestamps.
+	// OldName is "/dev/null" for the added file, and NewName is "/dev/null" for the removed file.
+	OldName string
+	NewName string
+
+	Hunks []*Hunk
+}
+
+// Hunk represents a hunk of the unified diff.
+type Hunk struct {
+	// OldStart and NewStart are the one based line numbers of the hunk, or the line just before the hunk
+	// if the range is empty.
+	OldStart, OldLines int
+	NewStart, NewLines int
+
+	// Lines is the lines of the hunk prefixed by ' ', '-' or '+', each line keeps the trailing newline
+	// except the line marked with "\ No newline at end of file".
+	Lines []string
+}
+
+// oldLines returns the context and the removed lines of the hunk.
+func (h *Hunk) oldLines() []string {
+	return h.side('-')
+}
+
+// newLines returns the context and the added lines of the hunk.
+func (h *Hunk) newLines() []string {
+	return h.side('+')
+}
+
+func (h *Hunk) side(prefix byte) []string {
+	var lines []string
+	for _, l := range h.Lines {
+		if l[0] == ' ' || l[0] == prefix {
+			lines = append(lines, l[1:])
+		}
+	}
+
+	return lines
+}
+
+// ParsePatch parses the unified diff such as diff -u and git diff generate. The lines out of the file
+// patches such as the commit message are ignored.
+func ParsePatch(buf []byte) (*Patch, error) {
+	p := &Patch{}
+	lines := splitLines(buf)
+
+	for i := 0; i < len(lines); i++ {
+		if !strings.HasPrefix(lines[i], "--- ") || i+1 >= len(lines) || !strings.HasPrefix(lines[i+1], "+++ ") {
+			continue
+		}
+		if len(p.Files) == 0 {
+			p.Header = patchHeader(lines[:i])
+		}
+
+		fp := &FilePatch{
+			OldName: headerName(lines[i][len("--- "):]),
+			NewName: headerName(lines[i+1][len("+++ "):]),
+		}
+		i += 2
+
+		for i < len(lines) && strings.HasPrefix(lines[i], "@@ ") {
+			h, n, err := parseHunk(lines[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fp.name(), err)
+			}
+			fp.Hunks = append(fp.Hunks, h)
+			i += n
+		}
+		i-- // the loop increments i
+
+		p.Files = append(p.Files, fp)
+	}
+	if len(p.Files) == 0 {
+		return nil, errors.New("no file patch found")
+	}
+
+	return p, nil
+}
+
+// patchHeader returns the lines before the first file patch without the "diff" and the "index" lines of
+// the file patch.
+func patchHeader(lines []string) string {
+	end := len(lines)
+	for i, l := range lines {
+		if strings.HasPrefix(l, "diff ") || strings.HasPrefix(l, "Index: ") {
+			end = i
+			break
+		}
+	}
+
+	return strings.Join(lines[:end], "")
+}
+
+// headerName returns the file name of the "---" and "+++" header without the timestamp.
+func headerName(s string) string {
+	s = strings.TrimRight(s, "\r\n")
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i]
+	}
+
+	return strings.TrimSpace(s)
+}
+
+// parseHunk parses the hunk at the head of lines, and returns the number of the lines of the hunk.
+func parseHunk(lines []string) (*Hunk, int, error) {
+	h := &Hunk{}
+	header := strings.TrimRight(lines[0], "\r\n")
+	fields := strings.Fields(header)
+	if len(fields) < 4 || fields[0] != "@@" || fields[3] != "@@" {
+		return nil, 0, fmt.Errorf("invalid hunk header: %q", header)
+	}
+
+	var err error
+	if h.OldStart, h.OldLines, err = parseRange(fields[1], '-'); err != nil {
+		return nil, 0, err
+	}
+	if h.NewStart, h.NewLines, err = parseRange(fields[2], '+'); err != nil {
+		return nil, 0, err
+	}
+
+	n := 1
+	oldLeft, newLeft := h.OldLines, h.NewLines
+	for n < len(lines) && (oldLeft > 0 || newLeft > 0) {
+		l := lines[n]
+		switch l[0] {
+		case ' ', '\n':
+			if l[0] == '\n' {
+				l = " \n" // the empty context line which trailing space is trimmed
+			}
+			oldLeft--
+			newLeft--
+		case '-':
+			oldLeft--
+		case '+':
+			newLeft--
+		case '\\':
+			n++
+			continue
+		default:
+			return nil, 0, fmt.Errorf("invalid hunk line: %q", l)
+		}
+		h.Lines = append(h.Lines, l)
+		n++
+
+		// "\ No newline at end of file" marks the previous line
+		if n < len(lines) && strings.HasPrefix(lines[n], `\`) {
+			last := &h.Lines[len(h.Lines)-1]
+			*last = strings.TrimSuffix(*last, "\n")
+			n++
+		}
+	}
+	if oldLeft != 0 || newLeft != 0 {
+		return nil, 0, fmt.Errorf("truncated hunk: %q", header)
+	}
+
+	return h, n, nil
+}
+
+// parseRange parses the "-start,lines" or "+start,lines" hunk range.
+func parseRange(s string, prefix byte) (start, lines int, err error) {
+	if s == "" || s[0] != prefix {
+		return 0, 0, fmt.Errorf("invalid hunk range: %q", s)
+	}
+	s = s[1:]
+
+	lines = 1
+	if i := strings.IndexByte(s, ','); i >= 0 {
+		if lines, err = strconv.Atoi(s[i+1:]); err != nil {
+			return 0, 0, fmt.Errorf("invalid hunk range: %q", s)
+		}
+		s = s[:i]
+	}
+	if start, err = strconv.Atoi(s); err != nil {
+		return 0, 0, fmt.Errorf("invalid hunk range: %q", s)
+	}
+
+	return start, lines, nil
+}
+
+// name returns the file name of the patch, which is the NewName or the OldName for the removed file.
+func (fp *FilePatch) name() string {
+	if fp.NewName == devNull {
+		return fp.OldName
+	}
+
+	return fp.NewName
+}
+
+// Path returns the file path of the patch stripped the strip leading path components, such as patch -p.
+func (fp *FilePatch) Path(strip int) string {
+	_, name := splitPrefix(fp.name(), strip)
+	return name
+}
+
+// splitPrefix splits the strip leading path components of name.
+func splitPrefix(name string, strip int) (prefix, rest string) {
+	rest = name
+	for i := 0; i < strip; i++ {
+		j := strings.IndexByte(rest, '/')
+		if j < 0 {
+			break
+		}
+		rest = rest[j+1:]
+	}
+
+	return name[:len(name)-len(rest)], rest
+}
+
+// HunkResult represents the result of applying the hunk.
+type HunkResult struct {
+	Path string `json:"path" yaml:"path"`
+	Hunk int    `json:"hunk" yaml:"hunk"` // one based index of the hunk in the file patch
+
+	// Offset is the number of the lines the hunk is moved from the line number of the hunk header.
+	Offset int `json:"offset,omitempty" yaml:"offset,omitempty"`
+
+	// Fuzz is the number of the leading and the trailing context lines ignored to apply the hunk.
+	Fuzz int `json:"fuzz,omitempty" yaml:"fuzz,omitempty"`
+}
+
+// ApplyOptions represents an options of Patch.Apply.
+type ApplyOptions struct {
+	// Strip is the number of the leading path components stripped from the file names, such as patch -p.
+	Strip int
+
+	// Fuzz is the maximum number of the leading and the trailing context lines which may be ignored to
+	// apply the hunk, such as patch -F.
+	Fuzz int
+
+	// DryRun reports the results without changing any file.
+	DryRun bool
+}
+
+// PatchError is returned by Patch.Apply when the hunk does not apply.
+type PatchError struct {
+	Path string
+	Hunk int
+	Line int // the line number of the hunk header
+}
+
+// Error implements a error interface.
+func (e *PatchError) Error() string {
+	return fmt.Sprintf("%s: hunk #%d FAILED at %d", e.Path, e.Hunk, e.Line)
+}
+
+// Apply applies the patch to the files in dir, and returns the result of each hunk.
+//
+// The hunk is searched from the line number of the hunk header to the both directions, so that the hunk
+// applies with the offset when the lines are moved. If the hunk does not match, the context lines up to
+// opts.Fuzz are ignored. No file is changed if any hunk does not apply.
+func (p *Patch) Apply(dir string, opts *ApplyOptions) ([]HunkResult, error) {
+	if opts == nil {
+		opts = &ApplyOptions{}
+	}
+
+	// the files are patched in memory, so that the later sections of the same file apply on top of the
+	// earlier sections instead of the original file
+	type change struct {
+		fname  string
+		lines  []string
+		remove bool
+	}
+
+	var (
+		results []HunkResult
+		changes []*change
+	)
+	patched := make(map[string]*change) // the changes by the path
+	for _, fp := range p.Files {
+		path := fp.Path(opts.Strip)
+		if !isLocalPath(path) {
+			return nil, fmt.Errorf("%s: the patch file is out of the directory", path)
+		}
+		if err := checkSymlinks(dir, path); err != nil {
+			return nil, err
+		}
+
+		c, ok := patched[path]
+		if !ok {
+			c = &change{fname: filepath.Join(dir, filepath.FromSlash(path))}
+			if fp.OldName != devNull {
+				buf, err := ioutil.ReadFile(c.fname)
+				if err != nil {
+					return nil, err
+				}
+				c.lines = splitLines(buf)
+			}
+			patched[path] = c
+			changes = append(changes, c)
+		}
+		switch {
+		case fp.OldName == devNull:
+			c.lines = nil
+		case c.remove:
+			return nil, fmt.Errorf("%s: the patch file is removed by the previous section", path)
+		}
+
+		lines, rs, err := applyHunks(path, c.lines, fp.Hunks, opts.Fuzz)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, rs...)
+		c.lines, c.remove = lines, fp.NewName == devNull
+	}
+	if opts.DryRun {
+		return results, nil
+	}
+
+	for _, c := range changes {
+		if c.remove {
+			if err := os.Remove(c.fname); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(c.fname), 0755); err != nil {
+			return nil, err
+		}
+		mode := os.FileMode(0644)
+		if fi, err := os.Stat(c.fname); err == nil {
+			mode = fi.Mode().Perm()
+		}
+		if err := ioutil.WriteFile(c.fname, []byte(strings.Join(c.lines, "")), mode); err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+// applyHunks applies the hunks to the lines of the path file with the maximum fuzz factor.
+func applyHunks(path string, lines []string, hunks []*Hunk, maxFuzz int) ([]string, []HunkResult, error) {
+	var (
+		patched []string
+		results []HunkResult
+	)
+	pos, delta := 0, 0 // the next line of lines to copy, and the offset of the previous hunk
+	for i, h := range hunks {
+		start := h.OldStart - 1
+		if h.OldLines == 0 {
+			start++ // the empty range is denoted by the line just before it
+		}
+
+		before, after := h.oldLines(), h.newLines()
+		at, fuzz := -1, 0
+		for ; fuzz <= maxFuzz; fuzz++ {
+			lead, trail := h.fuzz(fuzz)
+			if fuzz > 0 && lead+trail == 0 {
+				break // no more context lines to ignore
+			}
+			if lead+trail >= len(before) && len(before) > 0 {
+				break // the hunk would match anywhere
+			}
+
+			at = findLines(lines, before[lead:len(before)-trail], start+delta+lead, pos)
+			if at >= 0 {
+				before, after = before[lead:len(before)-trail], after[lead:len(after)-trail]
+				start += lead
+				break
+			}
+		}
+		if at < 0 {
+			return nil, nil, &PatchError{Path: path, Hunk: i + 1, Line: h.OldStart}
+		}
+
+		patched = append(patched, lines[pos:at]...)
+		patched = append(patched, after...)
+		pos = at + len(before)
+
+		offset := at - start
+		results = append(results, HunkResult{Path: path, Hunk: i + 1, Offset: offset, Fuzz: fuzz})
+		delta = offset
+	}
+	patched = append(patched, lines[pos:]...)
+
+	return patched, results, nil
+}
+
+// fuzz returns the number of the leading and the trailing context lines of the hunk ignored by the fuzz
+// factor.
+func (h *Hunk) fuzz(fuzz int) (lead, trail int) {
+	for lead < fuzz && lead < len(h.Lines) && h.Lines[lead][0] == ' ' {
+		lead++
+	}
+	for trail < fuzz && trail < len(h.Lines)-lead && h.Lines[len(h.Lines)-1-trail][0] == ' ' {
+		trail++
+	}
+
+	return lead, trail
+}
+
+// findLines finds the position of the old lines in lines at or after the min position, which is the nearest
+// to the want position.
+func findLines(lines, old []string, want, min int) int {
+	if want < min {
+		want = min
+	}
+
+	for d := 0; ; d++ {
+		before, after := want-d, want+d
+		if before < min && after+len(old) > len(lines) {
+			return -1
+		}
+		if before >= min && matchLines(lines, old, before) {
+			return before
+		}
+		if d > 0 && after+len(old) <= len(lines) && matchLines(lines, old, after) {
+			return after
+		}
+	}
+}
+
+// matchLines reports whether the old lines are at the pos of lines.
+func matchLines(lines, old []string, pos int) bool {
+	if pos < 0 || pos+len(old) > len(lines) {
+		return false
+	}
+	for i, l := range old {
+		if lines[pos+i] != l {
+			return false
+		}
+	}
+
+	return true
+}
+
+// readPatchFile reads and parses the fname patch file.
+func readPatchFile(fname string) (*Patch, error) {
+	buf, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := ParsePatch(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fname, err)
+	}
+
+	return p, nil
+}
@@ -0,0 +1,215 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testPatch = `From 1234567 Mon Sep 17 00:00:00 2001
+Subject: [PATCH] fix the build
+
+---
+diff --git a/bsd/kern/kern_exit.c b/bsd/kern/kern_exit.c
+--- a/bsd/kern/kern_exit.c	2018-10-30 12:00:00.000000000 +0900
++++ b/bsd/kern/kern_exit.c	2018-10-30 12:00:00.000000000 +0900
+@@ -2,3 +2,3 @@
+ b
+-c
++C
+ d
+@@ -8,2 +8,3 @@
+ h
+ i
++j
+diff --git a/new.h b/new.h
+--- /dev/null
++++ b/new.h
+@@ -0,0 +1 @@
++#define NEW 1
+\ No newline at end of file
+`
+
+func TestParsePatch(t *testing.T) {
+	p, err := ParsePatch([]byte(testPatch))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Patch{
+		Header: "From 1234567 Mon Sep 17 00:00:00 2001\nSubject: [PATCH] fix the build\n\n---\n",
+		Files: []*FilePatch{
+			{
+				OldName: "a/bsd/kern/kern_exit.c",
+				NewName: "b/bsd/kern/kern_exit.c",
+				Hunks: []*Hunk{
+					{OldStart: 2, OldLines: 3, NewStart: 2, NewLines: 3, Lines: []string{" b\n", "-c\n", "+C\n", " d\n"}},
+					{OldStart: 8, OldLines: 2, NewStart: 8, NewLines: 3, Lines: []string{" h\n", " i\n", "+j\n"}},
+				},
+			},
+			{
+				OldName: "/dev/null",
+				NewName: "b/new.h",
+				Hunks: []*Hunk{
+					{OldStart: 0, OldLines: 0, NewStart: 1, NewLines: 1, Lines: []string{"+#define NEW 1"}},
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, p); diff != "" {
+		t.Errorf("ParsePatch() mismatch (-want +got):\n%s", diff)
+	}
+	if got := p.Files[0].Path(1); got != "bsd/kern/kern_exit.c" {
+		t.Errorf("Path(1) = %q", got)
+	}
+
+	if _, err := ParsePatch([]byte("no patch\n")); err == nil {
+		t.Error("ParsePatch() of no file patch succeeded")
+	}
+	if _, err := ParsePatch([]byte("--- a/x\n+++ b/x\n@@ -1,2 +1,2 @@\n a\n")); err == nil {
+		t.Error("ParsePatch() of the truncated hunk succeeded")
+	}
+}
+
+func TestPatch_Apply(t *testing.T) {
+	p, err := ParsePatch([]byte(testPatch))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		results []HunkResult
+		wantErr bool
+	}{
+		{
+			name:    "exact",
+			content: "a\nb\nc\nd\ne\nf\ng\nh\ni\n",
+			want:    "a\nb\nC\nd\ne\nf\ng\nh\ni\nj\n",
+			results: []HunkResult{{Path: "bsd/kern/kern_exit.c", Hunk: 1}, {Path: "bsd/kern/kern_exit.c", Hunk: 2}, {Path: "new.h", Hunk: 1}},
+		},
+		{
+			name:    "offset",
+			content: "0\n0\na\nb\nc\nd\ne\nf\ng\nh\ni\n",
+			want:    "0\n0\na\nb\nC\nd\ne\nf\ng\nh\ni\nj\n",
+			results: []HunkResult{{Path: "bsd/kern/kern_exit.c", Hunk: 1, Offset: 2}, {Path: "bsd/kern/kern_exit.c", Hunk: 2, Offset: 2}, {Path: "new.h", Hunk: 1}},
+		},
+		{
+			name:    "fuzz",
+			content: "a\nB\nc\nd\ne\nf\ng\nh\ni\n",
+			want:    "a\nB\nC\nd\ne\nf\ng\nh\ni\nj\n",
+			results: []HunkResult{{Path: "bsd/kern/kern_exit.c", Hunk: 1, Fuzz: 1}, {Path: "bsd/kern/kern_exit.c", Hunk: 2}, {Path: "new.h", Hunk: 1}},
+		},
+		{
+			name:    "failed",
+			content: "a\nb\nx\nd\n",
+			want:    "a\nb\nx\nd\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			fname := filepath.Join(dir, "bsd", "kern", "kern_exit.c")
+			if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(fname, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			results, err := p.Apply(dir, &ApplyOptions{Strip: 1, Fuzz: DefaultFuzz})
+			if tt.wantErr {
+				var perr *PatchError
+				if !errors.As(err, &perr) || perr.Hunk != 1 || perr.Line != 2 {
+					t.Errorf("Apply() error = %v, want hunk #1 FAILED at 2", err)
+				}
+				if _, err := os.Stat(filepath.Join(dir, "new.h")); err == nil {
+					t.Error("Apply() created the file of the failed patch")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Apply() error = %v", err)
+				}
+				if diff := cmp.Diff(tt.results, results); diff != "" {
+					t.Errorf("Apply() mismatch (-want +got):\n%s", diff)
+				}
+				buf, err := ioutil.ReadFile(filepath.Join(dir, "new.h"))
+				if err != nil || string(buf) != "#define NEW 1" {
+					t.Errorf("new.h = %q, %v", buf, err)
+				}
+			}
+
+			buf, err := ioutil.ReadFile(fname)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, string(buf)); diff != "" {
+				t.Errorf("patched file mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPatch_Apply_Symlink(t *testing.T) {
+	p, err := ParsePatch([]byte(testPatch))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	outside := filepath.Join(root, "outside")
+	if err := os.MkdirAll(filepath.Join(outside, "kern"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	fname := filepath.Join(outside, "kern", "kern_exit.c")
+	content := "a\nb\nc\nd\ne\nf\ng\nh\ni\n"
+	if err := ioutil.WriteFile(fname, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(root, "xnu")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "bsd")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Apply(dir, &ApplyOptions{Strip: 1}); err == nil {
+		t.Error("Apply() through the symbolic link error = nil, want error")
+	}
+	if buf, err := ioutil.ReadFile(fname); err != nil || string(buf) != content {
+		t.Errorf("the file out of the directory = %q, %v, want unchanged", buf, err)
+	}
+}
+
+func TestPatch_Apply_Repeated(t *testing.T) {
+	// the sections of the same file, such as the concatenated patches
+	p, err := ParsePatch([]byte("--- a/x\n+++ b/x\n@@ -1,2 +1,2 @@\n-a\n+A\n b\n--- a/x\n+++ b/x\n@@ -2,2 +2,2 @@\n b\n-c\n+C\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "x")
+	if err := ioutil.WriteFile(fname, []byte("a\nb\nc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Apply(dir, &ApplyOptions{Strip: 1}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if buf, err := ioutil.ReadFile(fname); err != nil || string(buf) != "A\nb\nC\n" {
+		t.Errorf("patched file = %q, %v, want %q", buf, err, "A\nb\nC\n")
+	}
+}
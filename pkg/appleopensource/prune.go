@@ -0,0 +1,264 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// list of cache categories.
+const (
+	// CategoryPages is the category of the cached index pages.
+	CategoryPages = "pages"
+
+	// CategoryTarballs is the category of the stored tarballs.
+	CategoryTarballs = "tarballs"
+)
+
+// CacheItem is an item of the cache storage, which is the unit of the eviction.
+type CacheItem struct {
+	// Category is the category of the item. One of CategoryPages or CategoryTarballs.
+	Category string `json:"category" yaml:"category"`
+
+	// Key is the URL of the cached page, or the digest of the stored tarball.
+	Key string `json:"key" yaml:"key"`
+
+	// Products is the products which the item belongs to.
+	Products []Product `json:"products,omitempty" yaml:"products,omitempty"`
+
+	// Size is the disk usage of the item in bytes.
+	Size int64 `json:"size" yaml:"size"`
+
+	// LastUsed is the time when the item is stored or used last.
+	LastUsed time.Time `json:"last_used" yaml:"last_used"`
+}
+
+// Evictable is the interface implemented by the cache storages which can be pruned.
+type Evictable interface {
+	// Items returns all items of the storage.
+	Items() ([]*CacheItem, error)
+
+	// Evict removes the item from the storage.
+	Evict(item *CacheItem) error
+}
+
+var (
+	_ Evictable = (*FileCache)(nil)
+	_ Evictable = (*BlobStore)(nil)
+)
+
+// PruneOptions represents the options of Prune.
+type PruneOptions struct {
+	// OlderThan evicts the items which are not used for longer than the duration. Zero disables it.
+	OlderThan time.Duration
+
+	// MaxSize evicts the least recently used items until the total size is under the bytes. Zero disables it.
+	MaxSize int64
+}
+
+// pageProducts returns the products of the index page uri such as "/tarballs/<product>" and "/source/<product>/...".
+func pageProducts(uri string) []Product {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil
+	}
+
+	elems := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(elems) < 2 || (elems[0] != TarballsResource.String() && elems[0] != SourceResource.String()) {
+		return nil
+	}
+
+	return []Product{{Name: elems[1]}}
+}
+
+// evictables returns the cache storages of c.
+func (c *Client) evictables() map[string]Evictable {
+	stores := make(map[string]Evictable)
+	if e, ok := c.Cache.(Evictable); ok {
+		stores[CategoryPages] = e
+	}
+	if c.Blobs != nil {
+		stores[CategoryTarballs] = c.Blobs
+	}
+
+	return stores
+}
+
+// CacheItems returns the items of c.Cache and c.Blobs sorted by the least recently used.
+//
+// The items of c.Cache are not included if it does not implement Evictable.
+func (c *Client) CacheItems() ([]*CacheItem, error) {
+	var items []*CacheItem
+	for _, s := range c.evictables() {
+		its, err := s.Items()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, its...)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if !items[i].LastUsed.Equal(items[j].LastUsed) {
+			return items[i].LastUsed.Before(items[j].LastUsed)
+		}
+		return items[i].Key < items[j].Key
+	})
+
+	return items, nil
+}
+
+// Evict removes the items from the cache storage of its category.
+func (c *Client) Evict(items ...*CacheItem) error {
+	stores := c.evictables()
+	for _, item := range items {
+		s, ok := stores[item.Category]
+		if !ok {
+			continue
+		}
+		if err := s.Evict(item); err != nil {
+			return err
+		}
+		c.log(LevelInfo, "evict", "category", item.Category, "key", item.Key, "size", item.Size)
+	}
+
+	return nil
+}
+
+// Prune evicts the items of c.Cache and c.Blobs by opts, and returns the evicted items.
+func (c *Client) Prune(opts *PruneOptions) ([]*CacheItem, error) {
+	if opts == nil {
+		opts = &PruneOptions{}
+	}
+
+	return c.prune(opts, "", opts.MaxSize)
+}
+
+// prune evicts the items by opts except the keep key item, which is just stored. The items are evicted
+// by opts.MaxSize only if the total size exceeds the threshold bytes.
+func (c *Client) prune(opts *PruneOptions, keep string, threshold int64) ([]*CacheItem, error) {
+	items, err := c.CacheItems()
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	for _, item := range items {
+		total += item.Size
+	}
+
+	exceeded := total > threshold
+	now := time.Now()
+	var evicted []*CacheItem
+	for _, item := range items {
+		if item.Key == keep {
+			continue
+		}
+		if item.Category == CategoryTarballs && c.Blobs != nil && c.Blobs.pinned(item) {
+			continue // being fetched or exported
+		}
+
+		expired := opts.OlderThan > 0 && now.Sub(item.LastUsed) > opts.OlderThan
+		over := opts.MaxSize > 0 && exceeded && total > opts.MaxSize
+		if !expired && !over {
+			continue
+		}
+
+		if err := c.Evict(item); err != nil {
+			return evicted, err
+		}
+		evicted = append(evicted, item)
+		total -= item.Size
+	}
+
+	// the scan gives the exact usage of each storage
+	usage := make(map[string]int64)
+	for _, item := range items {
+		usage[item.Category] += item.Size
+	}
+	for _, item := range evicted {
+		usage[item.Category] -= item.Size
+	}
+	for category, s := range c.evictables() {
+		if t, ok := s.(usageTracker); ok {
+			t.diskUsage().set(usage[category])
+		}
+	}
+
+	return evicted, nil
+}
+
+// limitCache evicts the least recently used items if the cache exceeds c.MaxCacheSize.
+//
+// The storages are scanned only when the tracked usage exceeds c.MaxCacheSize, and the items are evicted down
+// to the 90% of c.MaxCacheSize, so that storing many items does not scan the storages for each item.
+func (c *Client) limitCache(keep string) error {
+	if c.MaxCacheSize <= 0 {
+		return nil
+	}
+	if total, ok := c.diskUsage(); ok && total <= c.MaxCacheSize {
+		return nil
+	}
+
+	_, err := c.prune(&PruneOptions{MaxSize: c.MaxCacheSize - c.MaxCacheSize/10}, keep, c.MaxCacheSize)
+	return err
+}
+
+// diskUsage returns the tracked usage of c.Cache and c.Blobs. It reports false if any storage is not scanned yet,
+// or does not track its usage.
+func (c *Client) diskUsage() (int64, bool) {
+	var total int64
+	for _, s := range c.evictables() {
+		t, ok := s.(usageTracker)
+		if !ok {
+			return 0, false
+		}
+		n, ok := t.diskUsage().get()
+		if !ok {
+			return 0, false
+		}
+		total += n
+	}
+
+	return total, true
+}
+
+// usageTracker is implemented by the Evictable storages which track their diskUsage.
+type usageTracker interface {
+	diskUsage() *diskUsage
+}
+
+// diskUsage tracks the upper bound of the disk usage of a storage from the last scan by prune and the bytes
+// stored since then. The items overwritten or removed other than by prune only make the bound looser.
+type diskUsage struct {
+	mu      sync.Mutex // guards below
+	scanned bool
+	bytes   int64
+}
+
+// add adds the n bytes stored into the storage.
+func (u *diskUsage) add(n int64) {
+	u.mu.Lock()
+	u.bytes += n
+	u.mu.Unlock()
+}
+
+// set sets the n bytes of the scanned storage.
+func (u *diskUsage) set(n int64) {
+	u.mu.Lock()
+	u.scanned, u.bytes = true, n
+	u.mu.Unlock()
+}
+
+// get returns the bytes of the storage, and reports whether the storage is scanned.
+func (u *diskUsage) get() (int64, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.bytes, u.scanned
+}
@@ -0,0 +1,208 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// newPruneClient returns the Client which has the xnu page, the dyld page, and the xnu-1 tarball
+// last used 3, 2 and 1 hours ago respectively.
+func newPruneClient(t *testing.T) *Client {
+	t.Helper()
+
+	dir := t.TempDir()
+	c := &Client{
+		Cache: NewFileCache(filepath.Join(dir, "pages")),
+		Blobs: NewBlobStore(filepath.Join(dir, "blobs")),
+	}
+
+	now := time.Now()
+	for i, name := range []string{"xnu", "dyld"} {
+		uri := rooturi + "tarballs/" + name
+		if err := c.Cache.Put(uri, &CacheEntry{URL: uri, FetchedAt: now, Body: []byte(strings.Repeat("p", 100))}); err != nil {
+			t.Fatal(err)
+		}
+		used := now.Add(-time.Duration(3-i) * time.Hour)
+		if err := os.Chtimes(c.Cache.(*FileCache).path(uri), used, used); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := c.Blobs.Put("xnu", "1", strings.NewReader(strings.Repeat("t", 1000))); err != nil {
+		t.Fatal(err)
+	}
+	used := now.Add(-time.Hour)
+	if err := os.Chtimes(c.Blobs.indexPath("xnu", "1"), used, used); err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestClient_Prune(t *testing.T) {
+	tests := []struct {
+		name string
+		opts *PruneOptions
+		want []string
+	}{
+		{
+			name: "older than",
+			opts: &PruneOptions{OlderThan: 90 * time.Minute},
+			want: []string{"pages dyld", "pages xnu"},
+		},
+		{
+			name: "max size",
+			opts: &PruneOptions{MaxSize: 1300},
+			want: []string{"pages xnu"},
+		},
+		{
+			name: "max size smaller than the newest",
+			opts: &PruneOptions{MaxSize: 10},
+			want: []string{"pages dyld", "pages xnu", "tarballs xnu"},
+		},
+		{
+			name: "no limit",
+			opts: &PruneOptions{},
+			want: nil,
+		},
+		{
+			name: "nil options",
+			opts: nil,
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newPruneClient(t)
+
+			evicted, err := c.Prune(tt.opts)
+			if err != nil {
+				t.Fatalf("Prune() error = %v", err)
+			}
+
+			var got []string
+			for _, item := range evicted {
+				got = append(got, item.Category+" "+item.Products[0].Name)
+			}
+			sort.Strings(got)
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("%s: (-got, +want)\n%s", tt.name, diff)
+			}
+
+			items, err := c.CacheItems()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items)+len(evicted) != 3 {
+				t.Errorf("CacheItems() returns %d items after evicted %d items, want 3 items in total", len(items), len(evicted))
+			}
+		})
+	}
+}
+
+func TestClient_limitCache(t *testing.T) {
+	c := newPruneClient(t)
+	c.MaxCacheSize = 10
+
+	digest, err := c.Blobs.Lookup("xnu", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.limitCache(digest); err != nil {
+		t.Fatalf("limitCache() error = %v", err)
+	}
+
+	if _, err := c.Blobs.Lookup("xnu", "1"); err != nil {
+		t.Errorf("Lookup() the kept tarball error = %v", err)
+	}
+	items, err := c.CacheItems()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Key != digest {
+		t.Errorf("CacheItems() = %d items, want only the kept tarball", len(items))
+	}
+}
+
+func TestClient_limitCache_pinned(t *testing.T) {
+	c := newPruneClient(t)
+	c.MaxCacheSize = 10
+
+	unpin := c.Blobs.pin("xnu", "1")
+	if err := c.limitCache(""); err != nil {
+		t.Fatalf("limitCache() error = %v", err)
+	}
+	if _, err := c.Blobs.Lookup("xnu", "1"); err != nil {
+		t.Errorf("Lookup() the pinned tarball error = %v", err)
+	}
+
+	unpin()
+	if err := c.limitCache(""); err != nil {
+		t.Fatalf("limitCache() error = %v", err)
+	}
+	if _, err := c.Blobs.Lookup("xnu", "1"); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Lookup() the unpinned tarball error = %v, want ErrBlobNotFound", err)
+	}
+}
+
+func TestClient_limitCache_usage(t *testing.T) {
+	c := newPruneClient(t)
+
+	items, err := c.CacheItems()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total int64
+	for _, item := range items {
+		total += item.Size
+	}
+	if _, ok := c.diskUsage(); ok {
+		t.Fatal("diskUsage() before the scan is reported, want not scanned")
+	}
+
+	// the first store scans the storages
+	c.MaxCacheSize = total + 1000
+	if err := c.limitCache(""); err != nil {
+		t.Fatalf("limitCache() error = %v", err)
+	}
+	if got, ok := c.diskUsage(); !ok || got != total {
+		t.Fatalf("diskUsage() after the scan = %d, %v, want %d, true", got, ok, total)
+	}
+
+	// the stored items are tracked without the scan
+	uri := rooturi + "tarballs/Libc"
+	if err := c.Cache.Put(uri, &CacheEntry{URL: uri, FetchedAt: time.Now(), Body: []byte(strings.Repeat("p", 50))}); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := c.diskUsage()
+	if !ok || got <= total+50 {
+		t.Fatalf("diskUsage() after Put = %d, %v, want more than %d", got, ok, total+50)
+	}
+	if err := c.limitCache(""); err != nil {
+		t.Fatalf("limitCache() error = %v", err)
+	}
+	if items, err := c.CacheItems(); err != nil || len(items) != 4 {
+		t.Fatalf("CacheItems() = %d items, %v, want 4 items within the limit", len(items), err)
+	}
+
+	// the items are evicted down to the 90% of the limit
+	c.MaxCacheSize = got - 1
+	if err := c.limitCache(""); err != nil {
+		t.Fatalf("limitCache() error = %v", err)
+	}
+	left, ok := c.diskUsage()
+	if !ok || left > c.MaxCacheSize-c.MaxCacheSize/10 {
+		t.Errorf("diskUsage() after the eviction = %d, %v, want at most %d", left, ok, c.MaxCacheSize-c.MaxCacheSize/10)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"sort"
+)
+
+// ProductChange represents a change of the project between two releases.
+type ProductChange struct {
+	Name string  `json:"name" yaml:"name"`
+	Old  Product `json:"old" yaml:"old"`
+	New  Product `json:"new" yaml:"new"`
+}
+
+// VersionChanged reports whether the version of the project is changed.
+func (c ProductChange) VersionChanged() bool {
+	return c.Old.Version != c.New.Version
+}
+
+// ComingSoonChanged reports whether the coming soon state of the project is changed.
+func (c ProductChange) ComingSoonChanged() bool {
+	return c.Old.ComingSoon != c.New.ComingSoon
+}
+
+// ReleaseDiff represents the differences of the projects between two releases.
+type ReleaseDiff struct {
+	Added   []Product       `json:"added" yaml:"added"`
+	Removed []Product       `json:"removed" yaml:"removed"`
+	Changed []ProductChange `json:"changed" yaml:"changed"`
+}
+
+// Empty reports whether the two releases have the same projects.
+func (d *ReleaseDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffReleases compares the projects of the oldRelease and newRelease such as the ListRelease returns.
+//
+// The projects are compared by the name, so it can also compare the releases of the different platforms.
+// Each list of the result is sorted by the project name.
+func DiffReleases(oldRelease, newRelease []Product) *ReleaseDiff {
+	olds, news := releaseProjects(oldRelease), releaseProjects(newRelease)
+
+	d := &ReleaseDiff{
+		Added:   []Product{},
+		Removed: []Product{},
+		Changed: []ProductChange{},
+	}
+	for name, o := range olds {
+		n, ok := news[name]
+		switch {
+		case !ok:
+			d.Removed = append(d.Removed, o)
+		case o.Version != n.Version || o.ComingSoon != n.ComingSoon:
+			d.Changed = append(d.Changed, ProductChange{Name: name, Old: o, New: n})
+		}
+	}
+	for name, n := range news {
+		if _, ok := olds[name]; !ok {
+			d.Added = append(d.Added, n)
+		}
+	}
+
+	sort.Slice(d.Added, func(i, j int) bool { return d.Added[i].Name < d.Added[j].Name })
+	sort.Slice(d.Removed, func(i, j int) bool { return d.Removed[i].Name < d.Removed[j].Name })
+	sort.Slice(d.Changed, func(i, j int) bool { return d.Changed[i].Name < d.Changed[j].Name })
+
+	return d
+}
+
+// releaseProjects indexes the projects by the name, and ignores the empty rows of the release page.
+func releaseProjects(list []Product) map[string]Product {
+	m := make(map[string]Product, len(list))
+	for _, p := range list {
+		if p.Name == "" {
+			continue
+		}
+		if _, ok := m[p.Name]; !ok {
+			m[p.Name] = p
+		}
+	}
+
+	return m
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiffReleases(t *testing.T) {
+	oldRelease := []Product{
+		{}, // empty row of the release page
+		{Name: "Libc", Version: "1244.1.7"},
+		{Name: "dtrace", Version: "284.200.15", ComingSoon: true},
+		{Name: "removed", Version: "1"},
+		{Name: "xnu", Version: "4903.221.2"},
+	}
+	newRelease := []Product{
+		{Name: "xnu", Version: "4903.241.1", Updated: true},
+		{Name: "added", Version: "2"},
+		{Name: "dtrace", Version: "284.200.15"},
+		{Name: "Libc", Version: "1244.1.7"},
+	}
+
+	want := &ReleaseDiff{
+		Added:   []Product{{Name: "added", Version: "2"}},
+		Removed: []Product{{Name: "removed", Version: "1"}},
+		Changed: []ProductChange{
+			{
+				Name: "dtrace",
+				Old:  Product{Name: "dtrace", Version: "284.200.15", ComingSoon: true},
+				New:  Product{Name: "dtrace", Version: "284.200.15"},
+			},
+			{
+				Name: "xnu",
+				Old:  Product{Name: "xnu", Version: "4903.221.2"},
+				New:  Product{Name: "xnu", Version: "4903.241.1", Updated: true},
+			},
+		},
+	}
+
+	got := DiffReleases(oldRelease, newRelease)
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("DiffReleases: (-got, +want)\n%s", diff)
+	}
+	if got.Changed[0].VersionChanged() || !got.Changed[0].ComingSoonChanged() {
+		t.Errorf("dtrace change = %+v, want only coming soon state changed", got.Changed[0])
+	}
+
+	if got := DiffReleases(newRelease, newRelease); !got.Empty() {
+		t.Errorf("DiffReleases(same) = %+v, want empty", got)
+	}
+}
+
+func TestParsePlatform(t *testing.T) {
+	for _, p := range []Platform{MacOS, Xcode, IOS, Server} {
+		got, err := ParsePlatform(p.String())
+		if err != nil {
+			t.Fatalf("ParsePlatform(%q) error = %v", p, err)
+		}
+		if got != p {
+			t.Errorf("ParsePlatform(%q) = %v, want %v", p, got, p)
+		}
+	}
+
+	if _, err := ParsePlatform("watchos"); err == nil {
+		t.Error("ParsePlatform(watchos) error = nil, want error")
+	}
+}
@@ -4,6 +4,12 @@
 
 package appleopensource
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
 // Platform represents a release version platform type.
 type Platform int
 
@@ -25,7 +31,7 @@ func (p Platform) String() string {
 	case MacOS:
 		return "macos"
 	case Xcode:
-		return "developer-tools"
+		return "xcode"
 	case IOS:
 		return "ios"
 	case Server:
@@ -35,6 +41,45 @@ func (p Platform) String() string {
 	}
 }
 
+// MarshalText implements a encoding.TextMarshaler interface. The text is the String of the platform.
+func (p Platform) MarshalText() ([]byte, error) {
+	if p.String() == "" {
+		return nil, errUnknownPlatform
+	}
+
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText implements a encoding.TextUnmarshaler interface by ParsePlatform.
+func (p *Platform) UnmarshalText(text []byte) error {
+	platform, err := ParsePlatform(string(text))
+	if err != nil {
+		return err
+	}
+	*p = platform
+
+	return nil
+}
+
+// errUnknownPlatform is returned for the Unknown or the out of range Platform.
+var errUnknownPlatform = errors.New("unknown platform")
+
+// ParsePlatform parses the platform name such as the Platform.String returns, or the prefix of the release page.
+func ParsePlatform(s string) (Platform, error) {
+	switch strings.ToLower(s) {
+	case "macos", "osx", "os-x", "mac-os-x":
+		return MacOS, nil
+	case "xcode", "developer-tools":
+		return Xcode, nil
+	case "ios":
+		return IOS, nil
+	case "server", "os-x-server":
+		return Server, nil
+	default:
+		return Unknown, fmt.Errorf("unknown platform: %q", s)
+	}
+}
+
 // KnownRelease known release versions.
 var KnownRelease = [...][]string{
 	MacOS:  releaseMacOS,
@@ -45,6 +90,36 @@ var KnownRelease = [...][]string{
 
 var (
 	releaseMacOS = []string{
+		"11.5",
+		"11.4",
+		"11.3",
+		"11.2",
+		"11.1",
+		"11.0.1",
+		"10.15.6",
+		"10.15.5",
+		"10.15.4",
+		"10.15.3",
+		"10.15.2",
+		"10.15.1",
+		"10.15",
+		"10.14.6",
+		"10.14.5",
+		"10.14.4",
+		"10.14.3",
+		"10.14.2",
+		"10.14.1",
+		"10.14",
+		"10.13.6",
+		"10.13.5",
+		"10.13.4",
+		"10.13.3",
+		"10.13.2",
+		"10.13.1",
+		"10.13",
+		"10.12.6",
+		"10.12.5",
+		"10.12.4",
 		"10.12.3",
 		"10.12.2",
 		"10.12.1",
@@ -53,31 +128,31 @@ var (
 		"10.11.5",
 		"10.11.4",
 		"10.11.3",
-		"10.11.3",
+		"10.11.2",
 		"10.11.1",
 		"10.11",
 		"10.10.5",
 		"10.10.4",
 		"10.10.3",
-		"10.10.3",
+		"10.10.2",
 		"10.10.1",
 		"10.10",
 		"10.9.5",
 		"10.9.4",
 		"10.9.3",
-		"10.9.3",
+		"10.9.2",
 		"10.9.1",
 		"10.9",
 		"10.8.5",
 		"10.8.4",
 		"10.8.3",
-		"10.8.3",
+		"10.8.2",
 		"10.8.1",
 		"10.8",
 		"10.7.5",
 		"10.7.4",
 		"10.7.3",
-		"10.7.3",
+		"10.7.2",
 		"10.7.1",
 		"10.7",
 		"10.6.8",
@@ -86,7 +161,7 @@ var (
 		"10.6.5",
 		"10.6.4",
 		"10.6.3",
-		"10.6.3",
+		"10.6.2",
 		"10.6.1",
 		"10.6",
 		"10.5.8",
@@ -95,7 +170,7 @@ var (
 		"10.5.5",
 		"10.5.4",
 		"10.5.3",
-		"10.5.3",
+		"10.5.2",
 		"10.5.1",
 		"10.5",
 		"10.4.11.x86",
@@ -115,7 +190,7 @@ var (
 		"10.4.4.x86",
 		"10.4.4.ppc",
 		"10.4.3",
-		"10.4.3",
+		"10.4.2",
 		"10.4.1",
 		"10.4",
 		"10.3.9",
@@ -125,7 +200,7 @@ var (
 		"10.3.5",
 		"10.3.4",
 		"10.3.3",
-		"10.3.3",
+		"10.3.2",
 		"10.3.1",
 		"10.3",
 		"10.2.8",
@@ -135,18 +210,18 @@ var (
 		"10.2.5",
 		"10.2.4",
 		"10.2.3",
-		"10.2.3",
+		"10.2.2",
 		"10.2.1",
 		"10.2",
 		"10.1.5",
 		"10.1.4",
 		"10.1.3",
-		"10.1.3",
+		"10.1.2",
 		"10.1.1",
 		"10.1",
 		"10.0.4",
 		"10.0.3",
-		"10.0.3",
+		"10.0.2",
 		"10.0.1",
 		"10.0",
 	}
@@ -48,3 +48,19 @@ func TestPlatform_String(t *testing.T) {
 		})
 	}
 }
+
+func TestPlatform_MarshalText(t *testing.T) {
+	for _, p := range []Platform{MacOS, Xcode, IOS, Server} {
+		text, err := p.MarshalText()
+		if err != nil || string(text) != p.String() {
+			t.Errorf("%v.MarshalText() = %q, %v, want %q", p, text, err, p.String())
+		}
+		var got Platform
+		if err := got.UnmarshalText(text); err != nil || got != p {
+			t.Errorf("UnmarshalText(%q) = %v, %v, want %v", text, got, err, p)
+		}
+	}
+	if _, err := Unknown.MarshalText(); err == nil {
+		t.Error("Unknown.MarshalText() error = nil, want error")
+	}
+}
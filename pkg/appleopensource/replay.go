@@ -0,0 +1,200 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// list of the file extensions of the fixture files.
+const (
+	fixtureMetaExt = ".json"
+	fixtureBodyExt = ".body"
+)
+
+// fixtureHeaders is the response headers which are recorded into the fixtures.
+// The other headers such as Date are dropped, so that the fixtures are deterministic.
+var fixtureHeaders = []string{
+	"Accept-Ranges",
+	"Content-Length",
+	"Content-Range",
+	"Content-Type",
+	"ETag",
+	"Last-Modified",
+	"Location",
+}
+
+// fixture represents the metadata of the recorded response.
+type fixture struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+}
+
+// FixtureKey returns the base name of the fixture files of the req.
+//
+// The key consists of the method, the path, the query and the Range header of the req, and not the host,
+// so the fixtures recorded from opensource.apple.com are replayed on any Client.BaseURL.
+// For example, GET https://opensource.apple.com/tarballs/xnu is "tarballs_xnu".
+func FixtureKey(req *http.Request) string {
+	key := strings.Trim(req.URL.Path, "/")
+	if key == "" {
+		key = "index"
+	}
+	key = strings.Replace(key, "/", "_", -1)
+
+	if req.URL.RawQuery != "" {
+		key += "_" + url.QueryEscape(req.URL.RawQuery)
+	}
+	if rng := req.Header.Get("Range"); rng != "" {
+		key += "_" + strings.Replace(rng, "=", "-", -1)
+	}
+	if req.Method != "" && req.Method != http.MethodGet {
+		key = req.Method + "_" + key
+	}
+
+	return key
+}
+
+// RecordTransport is a http.RoundTripper which records the responses into the fixture files in Dir,
+// which are replayed by the ReplayTransport.
+//
+// Each response is recorded into the <key>.json metadata file and the <key>.body file, where the key is
+// the FixtureKey of the request.
+type RecordTransport struct {
+	// Transport is the underlying http.RoundTripper. http.DefaultTransport is used if nil.
+	Transport http.RoundTripper
+
+	// Dir is the fixture directory. It is created if not exists.
+	Dir string
+}
+
+var _ http.RoundTripper = (*RecordTransport)(nil)
+
+// RoundTrip implements a http.RoundTripper interface.
+func (t *RecordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	fx := fixture{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Status: resp.StatusCode,
+		Header: make(http.Header),
+	}
+	if fx.Method == "" {
+		fx.Method = http.MethodGet
+	}
+	for _, key := range fixtureHeaders {
+		if v := resp.Header.Values(key); len(v) > 0 {
+			fx.Header[key] = v
+		}
+	}
+	if fx.Header.Get(hdrContentLength) == "" && resp.ContentLength >= 0 {
+		fx.Header.Set(hdrContentLength, strconv.FormatInt(resp.ContentLength, 10))
+	}
+
+	meta, err := json.MarshalIndent(fx, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(t.Dir, 0755); err != nil {
+		return nil, err
+	}
+	base := filepath.Join(t.Dir, FixtureKey(req))
+	if err := writeFile(base+fixtureBodyExt, bytes.NewReader(body)); err != nil {
+		return nil, err
+	}
+	if err := writeFile(base+fixtureMetaExt, bytes.NewReader(append(meta, '\n'))); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// ReplayTransport is a http.RoundTripper which replays the responses recorded by the RecordTransport
+// in Dir, without any network access.
+//
+// The request which has no fixture fails with the error wrapping os.ErrNotExist.
+type ReplayTransport struct {
+	// Dir is the fixture directory.
+	Dir string
+}
+
+var _ http.RoundTripper = (*ReplayTransport)(nil)
+
+// RoundTrip implements a http.RoundTripper interface.
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := filepath.Join(t.Dir, FixtureKey(req))
+
+	meta, err := ioutil.ReadFile(base + fixtureMetaExt)
+	if err != nil {
+		return nil, fmt.Errorf("no fixture of %s %s: %w", req.Method, req.URL, err)
+	}
+	var fx fixture
+	if err := json.Unmarshal(meta, &fx); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", base+fixtureMetaExt, err)
+	}
+
+	body, err := ioutil.ReadFile(base + fixtureBodyExt)
+	if err != nil {
+		return nil, fmt.Errorf("no fixture of %s %s: %w", req.Method, req.URL, err)
+	}
+
+	header := fx.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	contentLength := int64(len(body))
+	if req.Method == http.MethodHead {
+		// the body of HEAD is empty, and the Content-Length is the recorded one
+		contentLength = -1
+		if sz := header.Get(hdrContentLength); sz != "" {
+			if contentLength, err = strconv.ParseInt(sz, 10, 64); err != nil {
+				return nil, fmt.Errorf("invalid fixture %s: %w", base+fixtureMetaExt, err)
+			}
+		}
+		body = nil
+	} else {
+		header.Set(hdrContentLength, strconv.Itoa(len(body)))
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fx.Status, http.StatusText(fx.Status)),
+		StatusCode:    fx.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: contentLength,
+		Request:       req,
+	}, nil
+}
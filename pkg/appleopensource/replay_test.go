@@ -0,0 +1,135 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource/aostest"
+)
+
+func TestFixtureKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		rng    string
+		want   string
+	}{
+		{
+			name:   "root",
+			method: http.MethodGet,
+			url:    "https://opensource.apple.com/",
+			want:   "index",
+		},
+		{
+			name:   "versions",
+			method: http.MethodGet,
+			url:    "https://opensource.apple.com/tarballs/xnu/",
+			want:   "tarballs_xnu",
+		},
+		{
+			name:   "head",
+			method: http.MethodHead,
+			url:    "http://127.0.0.1:8080/tarballs/xnu/xnu-1.tar.gz",
+			want:   "HEAD_tarballs_xnu_xnu-1.tar.gz",
+		},
+		{
+			name:   "range with query",
+			method: http.MethodGet,
+			url:    "https://opensource.apple.com/tarballs/xnu/xnu-1.tar.gz?a=b",
+			rng:    "bytes=0-99",
+			want:   "tarballs_xnu_xnu-1.tar.gz_a%3Db_bytes-0-99",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.rng != "" {
+				req.Header.Set("Range", tt.rng)
+			}
+			if got := FixtureKey(req); got != tt.want {
+				t.Errorf("FixtureKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	tarball := bytes.Repeat([]byte("xnu tarball contents\n"), 100)
+	srv := aostest.NewServer(&aostest.Site{
+		Projects: []aostest.Project{
+			{Name: "xnu", Versions: []aostest.Version{{Version: "4903.221.2", Tarball: tarball}}},
+		},
+	})
+	defer srv.Close()
+
+	dir := t.TempDir()
+	ctx := context.Background()
+	p := Product{Name: "xnu", Version: "4903.221.2"}
+
+	session := func(c *Client) ([]string, []byte) {
+		t.Helper()
+
+		buf, err := c.IndexVersion(ctx, "xnu", TarballsResource)
+		if err != nil {
+			t.Fatalf("IndexVersion() error = %v", err)
+		}
+		versions, err := ListVersions(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dst := t.TempDir()
+		if err := c.Fetch(ctx, dst, c.TarballURL(p)); err != nil {
+			t.Fatalf("Fetch() error = %v", err)
+		}
+		body, err := ioutil.ReadFile(filepath.Join(dst, "xnu-4903.221.2.tar.gz"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return versions, body
+	}
+
+	recorder := &Client{
+		HTTPClient:  &http.Client{Transport: &RecordTransport{Dir: dir}},
+		BaseURL:     srv.BaseURL(),
+		Concurrency: 2,
+	}
+	wantVersions, wantBody := session(recorder)
+	srv.Close()
+
+	// replays on the other BaseURL without the server
+	replayer := &Client{
+		HTTPClient:  &http.Client{Transport: &ReplayTransport{Dir: dir}},
+		BaseURL:     "http://replay.invalid/",
+		Concurrency: 2,
+	}
+	gotVersions, gotBody := session(replayer)
+
+	if diff := cmp.Diff(wantVersions, gotVersions); diff != "" {
+		t.Errorf("versions mismatch (-want +got):\n%s", diff)
+	}
+	if !bytes.Equal(gotBody, tarball) || !bytes.Equal(wantBody, tarball) {
+		t.Errorf("replayed tarball mismatch: got %d bytes, want %d bytes", len(gotBody), len(tarball))
+	}
+
+	// the other concurrency sends the unrecorded range requests
+	replayer.Concurrency = 3
+	if err := replayer.Fetch(ctx, t.TempDir(), replayer.TarballURL(p)); err == nil {
+		t.Error("Fetch() of the unrecorded ranges succeeded")
+	}
+}
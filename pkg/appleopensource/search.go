@@ -0,0 +1,204 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MatchKind represents a kind of the Search match. The smaller kind is the better match.
+type MatchKind int
+
+// list of MatchKind.
+const (
+	// MatchExact is the case-insensitive exact match.
+	MatchExact MatchKind = iota
+	// MatchPrefix is the case-insensitive prefix match.
+	MatchPrefix
+	// MatchSubstring is the case-insensitive substring match.
+	MatchSubstring
+	// MatchFuzzy is the match within the edit distance.
+	MatchFuzzy
+)
+
+// String implements a fmt.Stringer interface.
+func (k MatchKind) String() string {
+	switch k {
+	case MatchExact:
+		return "exact"
+	case MatchPrefix:
+		return "prefix"
+	case MatchSubstring:
+		return "substring"
+	case MatchFuzzy:
+		return "fuzzy"
+	default:
+		return strconv.Itoa(int(k))
+	}
+}
+
+// MarshalText implements a encoding.TextMarshaler interface.
+func (k MatchKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Match represents a result of Search.
+type Match struct {
+	Name     string    `json:"name" yaml:"name"`
+	Kind     MatchKind `json:"match" yaml:"match"`
+	Distance int       `json:"distance" yaml:"distance"` // the edit distance between the query and the name
+}
+
+// maxDistance returns the default maximum edit distance of the fuzzy match of the query,
+// which allows one typo per four characters.
+func maxDistance(query string) int {
+	return 1 + len([]rune(query))/4
+}
+
+// Search returns the names matching the query in the ranked order.
+//
+// The names are matched case-insensitively by the exact, the prefix, the substring and the fuzzy match in
+// order, and the fuzzy match allows the edit distance up to maxDist, or one typo per four characters of the
+// query if maxDist is less than 1. The matches of the same kind are ranked by the edit distance and the name.
+func Search(names []string, query string, maxDist int) []Match {
+	if maxDist < 1 {
+		maxDist = maxDistance(query)
+	}
+	q := strings.ToLower(query)
+
+	var matches []Match
+	for _, name := range names {
+		n := strings.ToLower(name)
+		m := Match{Name: name, Distance: editDistance(q, n)}
+		switch {
+		case n == q:
+			m.Kind = MatchExact
+		case strings.HasPrefix(n, q):
+			m.Kind = MatchPrefix
+		case strings.Contains(n, q):
+			m.Kind = MatchSubstring
+		case m.Distance <= maxDist:
+			m.Kind = MatchFuzzy
+		default:
+			continue
+		}
+		matches = append(matches, m)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Distance != b.Distance {
+			return a.Distance < b.Distance
+		}
+		return a.Name < b.Name
+	})
+
+	return matches
+}
+
+// Suggest returns at most n names similar to the name, for the "did you mean" suggestions.
+// The name itself and the duplicated names are not suggested.
+func Suggest(names []string, name string, n int) []string {
+	var suggestions []string
+	seen := map[string]bool{name: true}
+	for _, m := range Search(names, name, 0) {
+		if len(suggestions) >= n {
+			break
+		}
+		if seen[m.Name] {
+			continue
+		}
+		seen[m.Name] = true
+		suggestions = append(suggestions, m.Name)
+	}
+
+	return suggestions
+}
+
+// editDistance returns the optimal string alignment distance between a and b, which counts the insertion,
+// the deletion, the substitution and the transposition of the adjacent characters as one edit.
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+
+	// d[i][j] is the distance between s[:i] and t[:j]
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(s)][len(t)]
+}
+
+func minInt(v int, vs ...int) int {
+	for _, x := range vs {
+		if x < v {
+			v = x
+		}
+	}
+
+	return v
+}
+
+// Projects returns the project names of the typ resource.
+func (c *Client) Projects(ctx context.Context, typ ResourceType) ([]string, error) {
+	buf, err := c.IndexProject(ctx, typ)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ListProject(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(list))
+	for i, p := range list {
+		names[i] = p.Name
+	}
+
+	return names, nil
+}
+
+// SearchProject searches the query in the project index of the typ resource. See Search for the matching.
+func (c *Client) SearchProject(ctx context.Context, typ ResourceType, query string, maxDist int) ([]Match, error) {
+	names, err := c.Projects(ctx, typ)
+	if err != nil {
+		return nil, err
+	}
+
+	return Search(names, query, maxDist), nil
+}
+
+// ErrNoVersion is returned by LatestVersion and Catalog.Latest when the project has no version.
+var ErrNoVersion = errors.New("no version")
+
+// LatestVersion returns the latest version of the project in the typ resource.
+func (c *Client) LatestVersion(ctx context.Context, project string, typ ResourceType) (string, error) {
+	return NewCatalog(c, typ).Latest(ctx, project)
+}
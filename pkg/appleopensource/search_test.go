@@ -0,0 +1,160 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource/aostest"
+)
+
+var searchNames = []string{"xnu", "XNU-legacy", "libdispatch", "libplatform", "dyld", "Libc", "libclosure", "objc4", "objc4"}
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		maxDist int
+		want    []Match
+	}{
+		{
+			name:  "exact and prefix",
+			query: "xnu",
+			want: []Match{
+				{Name: "xnu", Kind: MatchExact, Distance: 0},
+				{Name: "XNU-legacy", Kind: MatchPrefix, Distance: 7},
+			},
+		},
+		{
+			name:  "case-insensitive",
+			query: "libc",
+			want: []Match{
+				{Name: "Libc", Kind: MatchExact, Distance: 0},
+				{Name: "libclosure", Kind: MatchPrefix, Distance: 6},
+			},
+		},
+		{
+			name:  "substring",
+			query: "dispatch",
+			want: []Match{
+				{Name: "libdispatch", Kind: MatchSubstring, Distance: 3},
+			},
+		},
+		{
+			name:  "transposition",
+			query: "xun",
+			want: []Match{
+				{Name: "xnu", Kind: MatchFuzzy, Distance: 1},
+			},
+		},
+		{
+			name:  "typos",
+			query: "libdispach",
+			want: []Match{
+				{Name: "libdispatch", Kind: MatchFuzzy, Distance: 1},
+			},
+		},
+		{
+			name:    "max distance",
+			query:   "dyl",
+			maxDist: 1,
+			want: []Match{
+				{Name: "dyld", Kind: MatchPrefix, Distance: 1},
+			},
+		},
+		{
+			name:  "no match",
+			query: "launchd",
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Search(searchNames, tt.query, tt.maxDist)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Search(%q) mismatch (-want +got):\n%s", tt.query, diff)
+			}
+		})
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		want []string
+	}{
+		{name: "xun", n: 3, want: []string{"xnu"}},
+		{name: "XNU", n: 3, want: []string{"xnu", "XNU-legacy"}},
+		{name: "XNU", n: 1, want: []string{"xnu"}},
+		{name: "xnu", n: 3, want: []string{"XNU-legacy"}},
+		{name: "objc", n: 3, want: []string{"objc4"}},
+		{name: "launchd", n: 3, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Suggest(searchNames, tt.name, tt.n)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Suggest(%q, %d) mismatch (-want +got):\n%s", tt.name, tt.n, diff)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"xnu", "", 3},
+		{"xnu", "xnu", 0},
+		{"xnu", "xun", 1},
+		{"kitten", "sitting", 3},
+		{"ca", "abc", 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestClient_SearchProject(t *testing.T) {
+	srv := aostest.NewServer(&aostest.Site{
+		Projects: []aostest.Project{
+			{Name: "xnu", Versions: []aostest.Version{{Version: "3789.1.32"}, {Version: "4903.221.2"}}},
+			{Name: "dyld", Versions: []aostest.Version{{Version: "635.2"}}},
+		},
+	})
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := &Client{BaseURL: srv.BaseURL()}
+
+	got, err := c.SearchProject(ctx, TarballsResource, "xun", 0)
+	if err != nil {
+		t.Fatalf("SearchProject() error = %v", err)
+	}
+	if diff := cmp.Diff([]Match{{Name: "xnu", Kind: MatchFuzzy, Distance: 1}}, got); diff != "" {
+		t.Errorf("SearchProject() mismatch (-want +got):\n%s", diff)
+	}
+
+	latest, err := c.LatestVersion(ctx, "xnu", TarballsResource)
+	if err != nil {
+		t.Fatalf("LatestVersion() error = %v", err)
+	}
+	if latest != "4903.221.2" {
+		t.Errorf("LatestVersion() = %q, want %q", latest, "4903.221.2")
+	}
+
+	if _, err := c.LatestVersion(ctx, "xun", TarballsResource); !errors.Is(err, ErrNotFound) {
+		t.Errorf("LatestVersion() of the unknown project error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,472 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SeriesName is the file name which lists the patch files of the Series in the applied order, same as quilt.
+const SeriesName = "series"
+
+// Series represents a quilt style series of the patches of the product version.
+type Series struct {
+	// Dir is the directory of the SeriesName file and the patch files.
+	Dir string
+
+	Patches []SeriesPatch
+}
+
+// SeriesPatch represents the patch file of the Series.
+type SeriesPatch struct {
+	// Name is the patch file name relative to Series.Dir.
+	Name string
+
+	// Strip is the number of the leading path components stripped from the file names, which is
+	// written as the "-pN" option in the series file. The default is 1.
+	Strip int
+}
+
+// SeriesDir returns the directory of the series of the p product version in root, such as
+// "patches/xnu-4903.221.2".
+func SeriesDir(root string, p Product) string {
+	return filepath.Join(root, p.Name+"-"+p.Version)
+}
+
+// ReadSeries reads the series from the SeriesName file in dir.
+//
+// The series file lists a patch file name and its options per line. The empty lines and the lines starting
+// with "#" are ignored. Only the "-pN" option is supported.
+func ReadSeries(dir string) (*Series, error) {
+	fname := filepath.Join(dir, SeriesName)
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := &Series{Dir: dir}
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		sp := SeriesPatch{Name: fields[0], Strip: 1}
+		for _, opt := range fields[1:] {
+			if !strings.HasPrefix(opt, "-p") {
+				return nil, fmt.Errorf("%s:%d: unsupported option: %s", fname, n, opt)
+			}
+			strip, err := strconv.Atoi(opt[len("-p"):])
+			if err != nil || strip < 0 {
+				return nil, fmt.Errorf("%s:%d: invalid option: %s", fname, n, opt)
+			}
+			sp.Strip = strip
+		}
+		if !isLocalPath(filepath.ToSlash(sp.Name)) {
+			return nil, fmt.Errorf("%s:%d: the patch is out of the series dir: %s", fname, n, sp.Name)
+		}
+		s.Patches = append(s.Patches, sp)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Write writes the SeriesName file to s.Dir.
+func (s *Series) Write() error {
+	var buf bytes.Buffer
+	for _, sp := range s.Patches {
+		buf.WriteString(sp.Name)
+		if sp.Strip != 1 {
+			fmt.Fprintf(&buf, " -p%d", sp.Strip)
+		}
+		buf.WriteByte('\n')
+	}
+
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(s.Dir, SeriesName), buf.Bytes(), 0644)
+}
+
+// path returns the file path of the sp patch.
+func (s *Series) path(sp SeriesPatch) string {
+	return filepath.Join(s.Dir, filepath.FromSlash(sp.Name))
+}
+
+// ReadPatch reads and parses the sp patch file of the series.
+func (s *Series) ReadPatch(sp SeriesPatch) (*Patch, error) {
+	return readPatchFile(s.path(sp))
+}
+
+// SeriesResult represents the result of applying the patch of the series.
+type SeriesResult struct {
+	Patch string       `json:"patch" yaml:"patch"`
+	Hunks []HunkResult `json:"hunks" yaml:"hunks"`
+}
+
+// Apply applies the patches of the series to the files in dir in order, with the maximum fuzz factor.
+//
+// Apply stops at the patch which does not apply, and returns the results of the applied patches and the
+// error. The files are not changed by the patch which does not apply.
+func (s *Series) Apply(dir string, fuzz int) ([]SeriesResult, error) {
+	var results []SeriesResult
+	for _, sp := range s.Patches {
+		p, err := s.ReadPatch(sp)
+		if err != nil {
+			return results, err
+		}
+
+		hunks, err := p.Apply(dir, &ApplyOptions{Strip: sp.Strip, Fuzz: fuzz})
+		if err != nil {
+			return results, fmt.Errorf("%s: %w", sp.Name, err)
+		}
+		results = append(results, SeriesResult{Patch: sp.Name, Hunks: hunks})
+	}
+
+	return results, nil
+}
+
+// Extract extracts the p tarball to dst with stripping the top-level directory such as "xnu-4903.221.2/".
+func (c *Client) Extract(ctx context.Context, p Product, dst string) error {
+	tmp, err := ioutil.TempDir("", "aos-extract.*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	tarball, err := c.tarballFile(ctx, p, tmp)
+	if err != nil {
+		return err
+	}
+
+	return extractArchive(tarball, dst)
+}
+
+// CheckSeries applies the s series to the pristine sources of the p product version in the temporary
+// directory, and returns the results same as Series.Apply. It detects the patches which no longer apply,
+// such as the series of the older version checked against the newer version.
+func (c *Client) CheckSeries(ctx context.Context, s *Series, p Product, fuzz int) ([]SeriesResult, error) {
+	tmp, err := ioutil.TempDir("", "aos-series.*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := c.Extract(ctx, p, tmp); err != nil {
+		return nil, err
+	}
+
+	return s.Apply(tmp, fuzz)
+}
+
+// RefreshSeries regenerates the patches of the s series against the pristine sources of the p product
+// version, so that each patch applies without the offset and the fuzz, same as quilt refresh. The header of
+// the patch such as the commit message is kept. It returns the names of the changed patches.
+func (c *Client) RefreshSeries(ctx context.Context, s *Series, p Product) ([]string, error) {
+	tmp, err := ioutil.TempDir("", "aos-series.*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := c.Extract(ctx, p, tmp); err != nil {
+		return nil, err
+	}
+
+	var refreshed []string
+	for _, sp := range s.Patches {
+		fname := s.path(sp)
+		buf, err := ioutil.ReadFile(fname)
+		if err != nil {
+			return nil, err
+		}
+		patch, err := ParsePatch(buf)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fname, err)
+		}
+
+		files := patch.files(sp.Strip)
+		before, err := readFiles(tmp, files)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := patch.Apply(tmp, &ApplyOptions{Strip: sp.Strip, Fuzz: DefaultFuzz}); err != nil {
+			return nil, fmt.Errorf("%s: %w", sp.Name, err)
+		}
+		after, err := readFiles(tmp, files)
+		if err != nil {
+			return nil, err
+		}
+
+		out := patch.format(sp.Strip, before, after)
+		if bytes.Equal(out, buf) {
+			continue
+		}
+		if err := ioutil.WriteFile(fname, out, 0644); err != nil {
+			return nil, err
+		}
+		refreshed = append(refreshed, sp.Name)
+	}
+
+	return refreshed, nil
+}
+
+// RebasedPatch represents the patch rebased by RebaseSeries.
+type RebasedPatch struct {
+	Patch string `json:"patch" yaml:"patch"`
+
+	// Merged is the files which are changed by the both of the patch and the new version, and merged by
+	// the three-way merge.
+	Merged []string `json:"merged,omitempty" yaml:"merged,omitempty"`
+
+	// Conflicts is the files which changes of the patch conflict with the new version.
+	Conflicts []string `json:"conflicts,omitempty" yaml:"conflicts,omitempty"`
+}
+
+// ErrRebaseConflict is returned by RebaseSeries when the patch conflicts with the new version.
+var ErrRebaseConflict = errors.New("rebase conflict")
+
+// RebaseSeries rebases the s series of the from version to the to version of the product, and writes the
+// rebased series to dst.
+//
+// Each patch is merged by the three-way merge of the pristine sources of the from version applied the
+// preceding patches as the base, the base applied the patch as ours, and the pristine sources of the to
+// version applied the preceding rebased patches as theirs. If any file conflicts, RebaseSeries returns the
+// results until the conflicting patch and the error wrapping ErrRebaseConflict, and writes nothing.
+func (c *Client) RebaseSeries(ctx context.Context, s *Series, from, to Product, dst string) ([]RebasedPatch, error) {
+	if _, err := os.Stat(filepath.Join(dst, SeriesName)); err == nil {
+		return nil, fmt.Errorf("the series already exists: %s", dst)
+	}
+
+	tmp, err := ioutil.TempDir("", "aos-rebase.*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	base, theirs := filepath.Join(tmp, "base"), filepath.Join(tmp, "theirs")
+	if err := c.Extract(ctx, from, base); err != nil {
+		return nil, err
+	}
+	if err := c.Extract(ctx, to, theirs); err != nil {
+		return nil, err
+	}
+
+	var results []RebasedPatch
+	outs := make([][]byte, len(s.Patches))
+	for i, sp := range s.Patches {
+		patch, err := s.ReadPatch(sp)
+		if err != nil {
+			return nil, err
+		}
+
+		files := patch.files(sp.Strip)
+		before, err := readFiles(base, files)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := patch.Apply(base, &ApplyOptions{Strip: sp.Strip, Fuzz: DefaultFuzz}); err != nil {
+			return nil, fmt.Errorf("%s does not apply to %s-%s: %w", sp.Name, from.Name, from.Version, err)
+		}
+		ours, err := readFiles(base, files)
+		if err != nil {
+			return nil, err
+		}
+		current, err := readFiles(theirs, files)
+		if err != nil {
+			return nil, err
+		}
+
+		r := RebasedPatch{Patch: sp.Name}
+		merged := make(map[string][]byte, len(files))
+		for _, name := range files {
+			b, bok := before[name]
+			o, ook := ours[name]
+			t, tok := current[name]
+			switch {
+			case bok == tok && bytes.Equal(b, t):
+				// the new version does not change the file
+				if ook {
+					merged[name] = o
+				}
+			case ook == tok && bytes.Equal(o, t):
+				// the new version already has the change of the patch
+				if ook {
+					merged[name] = o
+				}
+				r.Merged = append(r.Merged, name)
+			case !ook || !tok:
+				// the file is removed by the one side and changed by the other side
+				r.Conflicts = append(r.Conflicts, name)
+			default:
+				lines, conflict := merge3(splitLines(b), splitLines(o), splitLines(t))
+				if conflict {
+					r.Conflicts = append(r.Conflicts, name)
+					continue
+				}
+				merged[name] = []byte(strings.Join(lines, ""))
+				r.Merged = append(r.Merged, name)
+			}
+		}
+		results = append(results, r)
+		if len(r.Conflicts) > 0 {
+			return results, fmt.Errorf("%s: %w in %s", sp.Name, ErrRebaseConflict, strings.Join(r.Conflicts, ", "))
+		}
+
+		if err := writeFiles(theirs, files, merged); err != nil {
+			return nil, err
+		}
+		outs[i] = patch.format(sp.Strip, current, merged)
+	}
+
+	for i, sp := range s.Patches {
+		fname := filepath.Join(dst, filepath.FromSlash(sp.Name))
+		if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(fname, outs[i], 0644); err != nil {
+			return nil, err
+		}
+	}
+	rebased := &Series{Dir: dst, Patches: s.Patches}
+	if err := rebased.Write(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// files returns the unique file paths of the patch stripped the strip leading path components.
+func (p *Patch) files(strip int) []string {
+	var files []string
+	seen := make(map[string]bool)
+	for _, fp := range p.Files {
+		path := fp.Path(strip)
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	return files
+}
+
+// format formats the patch of the changes of the files from before to after, with the header and the file
+// names of p. The files missing in before or after are the added or the removed files.
+func (p *Patch) format(strip int, before, after map[string][]byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(p.Header)
+
+	seen := make(map[string]bool)
+	for _, fp := range p.Files {
+		path := fp.Path(strip)
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		a, aok := before[path]
+		b, bok := after[path]
+		if aok == bok && bytes.Equal(a, b) {
+			continue
+		}
+
+		oldPrefix, newPrefix := fp.prefixes(strip)
+		oldName, newName := oldPrefix+path, newPrefix+path
+		if !aok {
+			oldName = devNull
+		}
+		if !bok {
+			newName = devNull
+		}
+		fmt.Fprintf(&buf, "--- %s\n+++ %s\n", oldName, newName)
+
+		al, bl := splitLines(a), splitLines(b)
+		unified(&buf, al, bl, diffLines(al, bl), 3)
+	}
+
+	return buf.Bytes()
+}
+
+// prefixes returns the stripped path prefixes of the old and the new file names, such as "a/" and "b/".
+func (fp *FilePatch) prefixes(strip int) (oldPrefix, newPrefix string) {
+	if fp.OldName != devNull {
+		oldPrefix, _ = splitPrefix(fp.OldName, strip)
+	}
+	if fp.NewName != devNull {
+		newPrefix, _ = splitPrefix(fp.NewName, strip)
+	}
+
+	switch {
+	case fp.OldName == devNull:
+		oldPrefix = newPrefix
+		if newPrefix == "b/" {
+			oldPrefix = "a/"
+		}
+	case fp.NewName == devNull:
+		newPrefix = oldPrefix
+		if oldPrefix == "a/" {
+			newPrefix = "b/"
+		}
+	}
+
+	return oldPrefix, newPrefix
+}
+
+// readFiles reads the slash separated path files in dir. The missing files are not in the returned map.
+func readFiles(dir string, files []string) (map[string][]byte, error) {
+	contents := make(map[string][]byte, len(files))
+	for _, name := range files {
+		buf, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		contents[name] = buf
+	}
+
+	return contents, nil
+}
+
+// writeFiles writes the contents of the files to dir, and removes the files missing in contents.
+func writeFiles(dir string, files []string, contents map[string][]byte) error {
+	for _, name := range files {
+		fname := filepath.Join(dir, filepath.FromSlash(name))
+		buf, ok := contents[name]
+		if !ok {
+			if err := os.Remove(fname); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(fname, buf, 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource/aostest"
+)
+
+// writeSeries writes the series file and the patch files to dir.
+func writeSeries(t *testing.T, dir, series string, patches map[string]string) {
+	t.Helper()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, SeriesName), []byte(series), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, patch := range patches {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(patch), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadSeries(t *testing.T) {
+	dir := t.TempDir()
+	writeSeries(t, dir, "# comment\n\n0001-fix.patch\n0002-raw.patch -p0\n", nil)
+
+	s, err := ReadSeries(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Series{Dir: dir, Patches: []SeriesPatch{{Name: "0001-fix.patch", Strip: 1}, {Name: "0002-raw.patch", Strip: 0}}}
+	if diff := cmp.Diff(want, s); diff != "" {
+		t.Errorf("ReadSeries() mismatch (-want +got):\n%s", diff)
+	}
+
+	s.Dir = filepath.Join(t.TempDir(), "copy")
+	if err := s.Write(); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(s.Dir, SeriesName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "0001-fix.patch\n0002-raw.patch -p0\n"; string(buf) != want {
+		t.Errorf("Write() = %q, want %q", buf, want)
+	}
+
+	for _, series := range []string{"0001-fix.patch -R\n", "../0001-fix.patch\n"} {
+		writeSeries(t, dir, series, nil)
+		if _, err := ReadSeries(dir); err == nil {
+			t.Errorf("ReadSeries() of %q succeeded", series)
+		}
+	}
+}
+
+func TestClient_Series(t *testing.T) {
+	v1 := Product{Name: "xnu", Version: "4903.221.2"}
+	v2 := Product{Name: "xnu", Version: "4903.231.4"}
+	srv := aostest.NewServer(&aostest.Site{
+		Projects: []aostest.Project{
+			{
+				Name: "xnu",
+				Versions: []aostest.Version{
+					{Version: v1.Version, Tarball: readArchive(t, "xnu-"+v1.Version, map[string]string{"README": "v1\n", "bsd/kern.c": "a\nb\nc\nd\ne\nf\ng\nh\n"})},
+					{Version: v2.Version, Tarball: readArchive(t, "xnu-"+v2.Version, map[string]string{"README": "v2\n", "bsd/kern.c": "0\n0\na\nb\nc\nd\ne\nf\ng\nh\n"})},
+				},
+			},
+		},
+	})
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := &Client{BaseURL: srv.BaseURL()}
+	root := t.TempDir()
+	patches := map[string]string{
+		"0001-kern.patch": "Subject: kern\n\n--- a/bsd/kern.c\n+++ b/bsd/kern.c\n@@ -1,5 +1,5 @@\n a\n b\n-c\n+C\n d\n e\n",
+		"0002-new.patch":  "--- /dev/null\n+++ b/new.h\n@@ -0,0 +1 @@\n+new\n",
+	}
+	writeSeries(t, SeriesDir(root, v1), "0001-kern.patch\n0002-new.patch\n", patches)
+	s, err := ReadSeries(SeriesDir(root, v1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the offset of the newer version
+	results, err := c.CheckSeries(ctx, s, v2, DefaultFuzz)
+	if err != nil {
+		t.Fatalf("CheckSeries() error = %v", err)
+	}
+	want := []SeriesResult{
+		{Patch: "0001-kern.patch", Hunks: []HunkResult{{Path: "bsd/kern.c", Hunk: 1, Offset: 2}}},
+		{Patch: "0002-new.patch", Hunks: []HunkResult{{Path: "new.h", Hunk: 1}}},
+	}
+	if diff := cmp.Diff(want, results); diff != "" {
+		t.Errorf("CheckSeries() mismatch (-want +got):\n%s", diff)
+	}
+
+	rebased, err := c.RebaseSeries(ctx, s, v1, v2, SeriesDir(root, v2))
+	if err != nil {
+		t.Fatalf("RebaseSeries() error = %v", err)
+	}
+	wantRebased := []RebasedPatch{{Patch: "0001-kern.patch", Merged: []string{"bsd/kern.c"}}, {Patch: "0002-new.patch"}}
+	if diff := cmp.Diff(wantRebased, rebased); diff != "" {
+		t.Errorf("RebaseSeries() mismatch (-want +got):\n%s", diff)
+	}
+	wantKern := "Subject: kern\n\n--- a/bsd/kern.c\n+++ b/bsd/kern.c\n@@ -2,7 +2,7 @@\n 0\n a\n b\n-c\n+C\n d\n e\n f\n"
+	buf, err := ioutil.ReadFile(filepath.Join(SeriesDir(root, v2), "0001-kern.patch"))
+	if err != nil || string(buf) != wantKern {
+		t.Errorf("rebased patch = %q, %v, want %q", buf, err, wantKern)
+	}
+	s2, err := ReadSeries(SeriesDir(root, v2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err = c.CheckSeries(ctx, s2, v2, 0)
+	if err != nil {
+		t.Fatalf("CheckSeries() of the rebased series error = %v", err)
+	}
+	want[0].Hunks[0].Offset = 0
+	if diff := cmp.Diff(want, results); diff != "" {
+		t.Errorf("CheckSeries() of the rebased series mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := c.RebaseSeries(ctx, s, v1, v2, SeriesDir(root, v2)); err == nil {
+		t.Error("RebaseSeries() to the existing series succeeded")
+	}
+
+	// refreshes the copy of the series against the newer version
+	copyDir := filepath.Join(root, "copy")
+	writeSeries(t, copyDir, "0001-kern.patch\n0002-new.patch\n", patches)
+	refreshed, err := c.RefreshSeries(ctx, &Series{Dir: copyDir, Patches: s.Patches}, v2)
+	if err != nil {
+		t.Fatalf("RefreshSeries() error = %v", err)
+	}
+	if diff := cmp.Diff([]string{"0001-kern.patch"}, refreshed); diff != "" {
+		t.Errorf("RefreshSeries() mismatch (-want +got):\n%s", diff)
+	}
+	buf, err = ioutil.ReadFile(filepath.Join(copyDir, "0001-kern.patch"))
+	if err != nil || string(buf) != wantKern {
+		t.Errorf("refreshed patch = %q, %v, want %q", buf, err, wantKern)
+	}
+
+	// the change of the patch conflicts with the newer version
+	conflictDir := filepath.Join(root, "conflict")
+	writeSeries(t, conflictDir, "0001-readme.patch\n", map[string]string{"0001-readme.patch": "--- a/README\n+++ b/README\n@@ -1 +1 @@\n-v1\n+patched\n"})
+	cs, err := ReadSeries(conflictDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CheckSeries(ctx, cs, v2, DefaultFuzz); err == nil {
+		t.Error("CheckSeries() of the patch which does not apply succeeded")
+	}
+	dst := filepath.Join(root, "conflict-rebased")
+	rebased, err = c.RebaseSeries(ctx, cs, v1, v2, dst)
+	if !errors.Is(err, ErrRebaseConflict) {
+		t.Errorf("RebaseSeries() error = %v, want %v", err, ErrRebaseConflict)
+	}
+	if diff := cmp.Diff([]RebasedPatch{{Patch: "0001-readme.patch", Conflicts: []string{"README"}}}, rebased); diff != "" {
+		t.Errorf("RebaseSeries() of the conflict mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("RebaseSeries() of the conflict wrote the series: %v", err)
+	}
+}
@@ -0,0 +1,286 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// list of the Content-Type of the served resources.
+const (
+	contentTypeHTML    = "text/html; charset=utf-8"
+	contentTypeTarball = "application/x-gzip"
+	contentTypePlist   = "application/xml"
+)
+
+// CacheServer is a http.Handler which serves the pages of the Client.Cache and the tarballs of the
+// Client.Blobs with the same URL layout as opensource.apple.com, so that the other Client can use it as
+// the BaseURL.
+//
+// The cached pages are served as is. The directory listing pages which are not cached, such as the
+// version list of the project which only the tarballs are fetched, are generated from the cached pages
+// and the stored tarballs. CacheServer never requests to the Client.BaseURL.
+type CacheServer struct {
+	c *Client
+}
+
+var _ http.Handler = (*CacheServer)(nil)
+
+// NewCacheServer returns the CacheServer serving the cache of c.
+func NewCacheServer(c *Client) *CacheServer {
+	return &CacheServer{c: c}
+}
+
+// ServeHTTP implements a http.Handler interface.
+func (s *CacheServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	p := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	s.c.log(LevelDebug, "serve", "method", r.Method, "path", p, "range", r.Header.Get("Range"))
+
+	var err error
+	if product, perr := ParseTarball("/" + p); perr == nil {
+		err = s.serveTarball(w, r, product)
+	} else {
+		err = s.servePage(w, r, p)
+	}
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrBlobNotFound), errors.Is(err, ErrCacheMiss):
+		http.NotFound(w, r)
+	default:
+		s.c.log(LevelError, "serve", "path", p, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// serveTarball serves the tarball of p from the Blobs.
+func (s *CacheServer) serveTarball(w http.ResponseWriter, r *http.Request, p Product) error {
+	if s.c.Blobs == nil {
+		return ErrBlobNotFound
+	}
+
+	digest, err := s.c.Blobs.Lookup(p.Name, p.Version)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(s.c.Blobs.Path(digest))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrBlobNotFound
+		}
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", contentTypeTarball)
+	w.Header().Set(hdrETag, `"`+digest+`"`)
+	http.ServeContent(w, r, path.Base(r.URL.Path), fi.ModTime(), f)
+
+	return nil
+}
+
+// servePage serves the cached p page, or the generated directory listing page if not cached.
+func (s *CacheServer) servePage(w http.ResponseWriter, r *http.Request, p string) error {
+	if s.c.Cache != nil {
+		e, err := s.c.Cache.Get(s.c.baseURI() + p)
+		switch {
+		case err == nil:
+			contentType := contentTypeHTML
+			if strings.HasSuffix(p, ".plist") {
+				contentType = contentTypePlist
+			}
+			w.Header().Set("Content-Type", contentType)
+			if e.ETag != "" {
+				w.Header().Set(hdrETag, e.ETag)
+			}
+			http.ServeContent(w, r, path.Base(p), e.FetchedAt, bytes.NewReader(e.Body))
+			return nil
+		case !errors.Is(err, ErrCacheMiss):
+			return err
+		}
+	}
+
+	entries, err := s.listing(p)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return ErrCacheMiss
+	}
+
+	buf, err := renderListing(p, entries)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", contentTypeHTML)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(buf))
+
+	return nil
+}
+
+// listing returns the entries of the dir directory listing page generated from the cached pages and the
+// stored tarballs. It returns no entries if nothing is cached under the dir.
+func (s *CacheServer) listing(dir string) ([]listingEntry, error) {
+	items, err := s.c.CacheItems()
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[string]int64) // the sizes of the files by the path
+	var paths []string
+	for _, item := range items {
+		switch item.Category {
+		case CategoryPages:
+			if strings.HasPrefix(item.Key, s.c.baseURI()) {
+				paths = append(paths, strings.TrimPrefix(item.Key, s.c.baseURI()))
+			}
+		case CategoryTarballs:
+			for _, p := range item.Products {
+				paths = append(paths, p.tarballPath())
+				sizes[p.tarballPath()] = item.Size
+			}
+		}
+	}
+
+	prefix := ""
+	if dir != "" {
+		prefix = dir + "/"
+	}
+	children := make(map[string]*listingEntry)
+	for _, p := range paths {
+		if !strings.HasPrefix(p, prefix) || p == prefix {
+			continue
+		}
+		rest := strings.TrimPrefix(p, prefix)
+		name := rest
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			name = rest[:i]
+		}
+		e, ok := children[name]
+		if !ok {
+			e = &listingEntry{Name: name, Href: "/" + prefix + name}
+			children[name] = e
+		}
+		// the cached index pages such as "tarballs/<product>" are the directories on opensource.apple.com
+		if name != rest || !isListingFile(name) {
+			e.dir = true
+			continue
+		}
+		if size, ok := sizes[p]; ok {
+			e.size = size
+		}
+	}
+
+	entries := make([]listingEntry, 0, len(children))
+	for _, e := range children {
+		entries = append(entries, e.finish())
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	return entries, nil
+}
+
+// isListingFile reports whether the name is listed as the file rather than the directory.
+func isListingFile(name string) bool {
+	return strings.HasSuffix(name, tarballSuffix) || strings.HasSuffix(name, ".html") || strings.HasSuffix(name, ".plist")
+}
+
+// listingEntry represents an entry of the directory listing page.
+type listingEntry struct {
+	Name string // has "/" suffix if directory
+	Href string
+	Size string
+	Icon string
+	Alt  string
+
+	dir  bool
+	size int64
+}
+
+// finish fills the listed fields of e.
+func (e *listingEntry) finish() listingEntry {
+	switch {
+	case e.dir:
+		e.Name += "/"
+		e.Href += "/"
+		e.Size, e.Icon, e.Alt = "  - ", "/static/images/icons/folder.png", "[DIR]"
+	case strings.HasSuffix(e.Name, tarballSuffix):
+		e.Size, e.Icon, e.Alt = listingSize(e.size), "/static/images/icons/gz.png", "[GZ]"
+	default:
+		e.Size, e.Icon, e.Alt = listingSize(e.size), "/static/images/icons/text.png", "[TXT]"
+	}
+
+	return *e
+}
+
+// listingSize formats n as the directory listing of opensource.apple.com does, such as "11.8K".
+func listingSize(n int64) string {
+	switch {
+	case n < 1<<10:
+		return fmt.Sprint(n)
+	case n < 1<<20:
+		return fmt.Sprintf("%.1fK", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%.1fM", float64(n)/(1<<20))
+	}
+}
+
+// listingTemplate is the directory listing page in the opensource.apple.com layout, which ListProject
+// and ListVersions parse from "body #content > div.column".
+const listingTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+</head>
+<body>
+<div id="header"><h1>Apple Open Source</h1></div>
+<div id="content">
+<div class="column">
+<table>
+<tbody><tr><th><img src="/icons/blank.gif" alt="[ICO]" height="25"/></th><th><a href="">Name</a></th><th><a href="">Size</a></th></tr>
+<tr><th colspan="3"><hr/></th></tr>
+<tr><td valign="top"><a href="./../"><img src="/icons/back.gif" alt="[DIR]" height="25"/></a></td><td><a href="./../">Parent Directory</a></td><td align="right">  - </td></tr>
+{{ range .Entries }}<tr><td valign="top"><a href="{{ .Href }}"><img src="{{ .Icon }}" alt="{{ .Alt }}" height="25"/></a></td><td><a href="{{ .Href }}">{{ .Name }}</a></td><td align="right">{{ .Size }}</td></tr>
+{{ end }}<tr><th colspan="3"><hr/></th></tr>
+</tbody></table>
+</div>
+</div>
+</body>
+</html>
+`
+
+var listingPage = template.Must(template.New("listing").Parse(listingTemplate))
+
+// renderListing renders the directory listing page of the dir path.
+func renderListing(dir string, entries []listingEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	err := listingPage.Execute(&buf, struct {
+		Title   string
+		Entries []listingEntry
+	}{"Index of /" + dir, entries})
+
+	return buf.Bytes(), err
+}
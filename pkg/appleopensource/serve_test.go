@@ -0,0 +1,141 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource/aostest"
+)
+
+func TestCacheServer(t *testing.T) {
+	xnu := Product{Name: "xnu", Version: "4903.221.2"}
+	dyld := Product{Name: "dyld", Version: "635.2"}
+	xnuTarball := readArchive(t, "xnu-"+xnu.Version, map[string]string{"README": "xnu\n"})
+	srv := aostest.NewServer(&aostest.Site{
+		Projects: []aostest.Project{
+			{Name: "dyld", Versions: []aostest.Version{{Version: dyld.Version, Files: map[string]string{"README": "dyld\n"}}}},
+			{Name: "xnu", Versions: []aostest.Version{{Version: "4570.1.46"}, {Version: xnu.Version, Tarball: xnuTarball}}},
+		},
+		Releases: []aostest.Release{
+			{Name: "macos-1014", Projects: []aostest.ReleaseProject{{Name: "dyld", Version: dyld.Version}, {Name: "xnu", Version: xnu.Version}}},
+		},
+	})
+	defer srv.Close()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	c := &Client{
+		BaseURL: srv.BaseURL(),
+		Cache:   NewFileCache(filepath.Join(dir, "pages")),
+		Blobs:   NewBlobStore(filepath.Join(dir, "tarballs")),
+	}
+	catalog := NewCatalog(c, TarballsResource)
+	if _, err := catalog.Versions(ctx, "xnu"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := catalog.Release(ctx, MacOS, "10.14"); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []Product{xnu, dyld} {
+		if err := c.Fetch(ctx, t.TempDir(), c.TarballURL(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mirror := httptest.NewServer(NewCacheServer(c))
+	defer mirror.Close()
+	srv.ResetRequests()
+
+	mc := &Client{BaseURL: mirror.URL + "/"}
+	mcatalog := NewCatalog(mc, TarballsResource)
+
+	// the project list is generated from the cached pages and the stored tarballs
+	projects, err := mcatalog.Projects(ctx)
+	if err != nil {
+		t.Fatalf("Projects() error = %v", err)
+	}
+	if diff := cmp.Diff([]string{"dyld", "xnu"}, projects); diff != "" {
+		t.Errorf("Projects() mismatch (-want +got):\n%s", diff)
+	}
+
+	// the cached version list is served as is
+	versions, err := mcatalog.Versions(ctx, "xnu")
+	if err != nil {
+		t.Fatalf("Versions() error = %v", err)
+	}
+	if diff := cmp.Diff([]string{"4570.1.46", xnu.Version}, versions); diff != "" {
+		t.Errorf("Versions() mismatch (-want +got):\n%s", diff)
+	}
+
+	// the version list of the project which only the tarball is fetched is generated
+	versions, err = mcatalog.Versions(ctx, "dyld")
+	if err != nil {
+		t.Fatalf("Versions() of the generated listing error = %v", err)
+	}
+	if diff := cmp.Diff([]string{dyld.Version}, versions); diff != "" {
+		t.Errorf("Versions() of the generated listing mismatch (-want +got):\n%s", diff)
+	}
+
+	release, err := mcatalog.Release(ctx, MacOS, "10.14")
+	if err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if diff := cmp.Diff([]Product{dyld, xnu}, release); diff != "" {
+		t.Errorf("Release() mismatch (-want +got):\n%s", diff)
+	}
+
+	dst := t.TempDir()
+	if err := mc.Fetch(ctx, dst, mc.TarballURL(xnu)); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(dst, "xnu-"+xnu.Version+".tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(xnuTarball, got); diff != "" {
+		t.Errorf("fetched tarball mismatch (-want +got):\n%s", diff)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, mc.TarballURL(xnu), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Range", "bytes=0-9")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusPartialContent || string(body) != string(xnuTarball[:10]) {
+		t.Errorf("range request = %s %q, want %d %q", resp.Status, body, http.StatusPartialContent, xnuTarball[:10])
+	}
+
+	for _, p := range []string{"/tarballs/xnu/xnu-4570.1.46.tar.gz", "/tarballs/libc", "/plist/macos-1014.plist"} {
+		resp, err := http.Get(mirror.URL + p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s = %s, want %d", p, resp.Status, http.StatusNotFound)
+		}
+	}
+
+	if reqs := srv.Requests(); len(reqs) != 0 {
+		t.Errorf("CacheServer sent %d requests to the upstream: %v", len(reqs), reqs)
+	}
+}
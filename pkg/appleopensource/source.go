@@ -0,0 +1,240 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	progressbar "github.com/schollz/progressbar/v3"
+	"go.uber.org/multierr"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+)
+
+// DefaultConcurrency is the default number of concurrent requests of MirrorSource and Fetch.
+const DefaultConcurrency = 8
+
+// SourceEntry represents an entry of the source resource directory listing.
+type SourceEntry struct {
+	Name string
+	Dir  bool
+	Size string // human readable size, empty if the entry is directory
+}
+
+// ListSource parses the source resource directory listing HTML DOM, and return the entries of the directory.
+//
+// The entry names are taken from the links, and the links which are not the children of the directory, such as
+// "../" or the absolute paths, are skipped, so that the names are safe to join to the local directory.
+func ListSource(buf []byte) ([]SourceEntry, error) {
+	dom, err := goquery.NewDocumentFromReader(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+
+	var list []SourceEntry
+	dom.Find("table > tbody > tr").Each(func(i int, s *goquery.Selection) {
+		a := s.Find("td > a")
+		if text := a.Text(); text == "" || text == "Parent Directory" {
+			return
+		}
+		href, ok := a.Attr("href")
+		if !ok {
+			return
+		}
+		name, dir, ok := sourceEntryName(href)
+		if !ok {
+			return
+		}
+
+		e := SourceEntry{Name: name, Dir: dir}
+		if !dir {
+			e.Size = strings.TrimSpace(s.Find(`td[align="right"]`).Text())
+		}
+		list = append(list, e)
+	})
+
+	return list, nil
+}
+
+// sourceEntryName returns the name of the href link in the directory listing, and whether it is a directory.
+// It reports false if the href is not a child of the directory.
+func sourceEntryName(href string) (string, bool, bool) {
+	u, err := url.Parse(href)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return "", false, false
+	}
+
+	dir := strings.HasSuffix(u.Path, "/")
+	name := path.Clean(strings.TrimSuffix(u.Path, "/"))
+	if !isLocalPath(name) || strings.Contains(name, "/") {
+		return "", false, false
+	}
+
+	return name, dir, true
+}
+
+// MirrorSource recursively crawls the uri source resource tree and reproduces it into the dst directory.
+func MirrorSource(ctx context.Context, dst, uri string, concurrency int) error {
+	return DefaultClient.MirrorSource(ctx, dst, uri, concurrency)
+}
+
+// MirrorSource recursively crawls the uri source resource tree and reproduces it into the dst directory.
+//
+// The uri is the source resource page uri such as the Product.Source returns, and the tree is written into
+// the dst/<base of uri> directory. The files already present in dst with the same size are skipped.
+// The concurrency limits the number of concurrent requests, c.Concurrency is used if it is less than 1.
+// The directory listings are not cached into c.Cache.
+func (c *Client) MirrorSource(ctx context.Context, dst, uri string, concurrency int) error {
+	if _, err := os.Stat(dst); err != nil && os.IsNotExist(err) {
+		return fmt.Errorf("no such %s dist directory: %w", dst, err)
+	}
+	if concurrency < 1 {
+		concurrency = c.concurrency()
+	}
+
+	root, err := url.Parse(strings.TrimSuffix(uri, "/") + "/")
+	if err != nil {
+		return err
+	}
+
+	m := &sourceMirror{
+		c:    c,
+		root: root,
+		dst:  filepath.Join(dst, path.Base(root.Path)),
+		sem:  semaphore.NewWeighted(int64(concurrency)),
+		pb:   progressbar.NewOptions(-1, progressbar.OptionSetWriter(os.Stderr), progressbar.OptionSetDescription(path.Base(root.Path)), progressbar.OptionShowCount()),
+	}
+	m.eg, m.ctx = errgroup.WithContext(ctx)
+
+	m.eg.Go(func() error { return m.walk("") })
+
+	return multierr.Combine(m.eg.Wait(), m.pb.Finish())
+}
+
+// sourceMirror represents a state of the MirrorSource crawl.
+type sourceMirror struct {
+	c    *Client
+	ctx  context.Context
+	eg   *errgroup.Group
+	sem  *semaphore.Weighted
+	pb   *progressbar.ProgressBar
+	root *url.URL
+	dst  string
+}
+
+// walk mirrors the dir directory relative to the root, and schedules the crawl of its children.
+func (m *sourceMirror) walk(dir string) error {
+	u := m.root
+	if dir != "" {
+		u = m.resolve(dir + "/")
+	}
+
+	if err := m.sem.Acquire(m.ctx, 1); err != nil {
+		return err
+	}
+	buf, err := m.c.page(m.ctx, u.String())
+	m.sem.Release(1)
+	if err != nil {
+		return err
+	}
+	if buf, err = m.c.extractIndex(u, buf); err != nil {
+		return err
+	}
+
+	entries, err := ListSource(buf)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Join(m.dst, filepath.FromSlash(dir)), 0755); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		name := path.Join(dir, e.Name)
+		if e.Dir {
+			m.eg.Go(func() error { return m.walk(name) })
+			continue
+		}
+		m.eg.Go(func() error { return m.download(name) })
+	}
+
+	return nil
+}
+
+// download downloads the name file relative to the root unless the same size file already exists.
+func (m *sourceMirror) download(name string) error {
+	if err := m.sem.Acquire(m.ctx, 1); err != nil {
+		return err
+	}
+	defer m.sem.Release(1)
+
+	uri := m.resolve(name).String()
+	fname := filepath.Join(m.dst, filepath.FromSlash(name))
+
+	if fi, err := os.Stat(fname); err == nil {
+		resp, err := m.c.head(m.ctx, uri)
+		if err != nil {
+			return err
+		}
+		if resp.ContentLength >= 0 && resp.ContentLength == fi.Size() {
+			return m.pb.Add(1)
+		}
+	}
+
+	resp, err := m.c.open(m.ctx, uri)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := writeFile(fname, resp.Body); err != nil {
+		return err
+	}
+
+	return m.pb.Add(1)
+}
+
+// resolve resolves the name relative to the root uri.
+func (m *sourceMirror) resolve(name string) *url.URL {
+	return m.root.ResolveReference(&url.URL{Path: name})
+}
+
+// writeFile writes r to the fname file through the temporary file, so that the partial file never remains.
+func writeFile(fname string, r io.Reader) error {
+	return writeFileFunc(fname, func(f *os.File) error {
+		_, err := io.Copy(f, r)
+		return err
+	})
+}
+
+// writeFileFunc writes the fname file by the write function through the temporary file same as writeFile.
+func writeFileFunc(fname string, write func(f *os.File) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fname), "."+filepath.Base(fname)+".*")
+	if err != nil {
+		return err
+	}
+
+	if err := write(tmp); err != nil {
+		return multierr.Combine(err, tmp.Close(), os.Remove(tmp.Name()))
+	}
+	if err := tmp.Close(); err != nil {
+		return multierr.Combine(err, os.Remove(tmp.Name()))
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return multierr.Combine(err, os.Remove(tmp.Name()))
+	}
+
+	return os.Rename(tmp.Name(), fname)
+}
@@ -0,0 +1,157 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestListSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		buf     []byte
+		wantLen int
+		want    SourceEntry
+	}{
+		{
+			name:    "xnu (directories)",
+			buf:     versionIndexXnu,
+			wantLen: 107,
+			want:    SourceEntry{Name: "xnu-1228.0.2", Dir: true},
+		},
+		{
+			name:    "Csu (files)",
+			buf:     versionIndexCsu,
+			wantLen: 13,
+			want:    SourceEntry{Name: "Csu-36.tar.gz", Size: "11.8K"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ListSource(tt.buf)
+			if err != nil {
+				t.Fatalf("ListSource() error = %v", err)
+			}
+			if len(got) != tt.wantLen {
+				t.Fatalf("ListSource() len = %d, want %d", len(got), tt.wantLen)
+			}
+			if diff := cmp.Diff(got[0], tt.want); diff != "" {
+				t.Errorf("%s: (-got, +want)\n%s", tt.name, diff)
+			}
+		})
+	}
+}
+
+// sourceListing returns the opensource.apple.com like directory listing page of the names.
+func sourceListing(names ...string) string {
+	var b strings.Builder
+	b.WriteString(`<html><body><div id="content"><div class="column"><table><tbody>`)
+	b.WriteString(`<tr><th>Name</th></tr><tr><th colspan="3"><hr/></th></tr>`)
+	b.WriteString(`<tr><td><a href="./../">Parent Directory</a></td><td align="right">  - </td></tr>`)
+	for _, name := range names {
+		size := "  - "
+		if !strings.HasSuffix(name, "/") {
+			size = "1K"
+		}
+		fmt.Fprintf(&b, `<tr><td><a href="%[1]s">%[1]s</a></td><td align="right">%s</td></tr>`, name, size)
+	}
+	b.WriteString(`<tr><th colspan="3"><hr/></th></tr></tbody></table></div></div></body></html>`)
+
+	return b.String()
+}
+
+func TestListSource_Unsafe(t *testing.T) {
+	buf := []byte(sourceListing("README", "bsd/", "../escape", "..%2F..%2Fescape", "/etc/passwd", "a/b", "http://example.com/x", "./osfmk/"))
+	got, err := ListSource(buf)
+	if err != nil {
+		t.Fatalf("ListSource() error = %v", err)
+	}
+
+	want := []SourceEntry{
+		{Name: "README", Size: "1K"},
+		{Name: "bsd", Dir: true},
+		{Name: "osfmk", Dir: true},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ListSource() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMirrorSource(t *testing.T) {
+	files := map[string]string{
+		"/source/xnu/xnu-1/README":         "xnu\n",
+		"/source/xnu/xnu-1/bsd/kern/a.c":   "int a;\n",
+		"/source/xnu/xnu-1/bsd/kern/b.c":   "int b;\n",
+		"/source/xnu/xnu-1/osfmk/Makefile": "all:\n",
+	}
+	dirs := map[string]string{
+		"/source/xnu/xnu-1/":          sourceListing("README", "bsd/", "osfmk/"),
+		"/source/xnu/xnu-1/bsd/":      sourceListing("kern/"),
+		"/source/xnu/xnu-1/bsd/kern/": sourceListing("a.c", "b.c"),
+		"/source/xnu/xnu-1/osfmk/":    sourceListing("Makefile"),
+	}
+
+	var gets int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if page, ok := dirs[r.URL.Path]; ok {
+			fmt.Fprint(w, page)
+			return
+		}
+		body, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodGet {
+			atomic.AddInt32(&gets, 1)
+		}
+		w.Header().Set(hdrContentLength, fmt.Sprint(len(body)))
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+
+	dst := t.TempDir()
+	uri := srv.URL + "/source/xnu/xnu-1"
+
+	if err := MirrorSource(context.Background(), dst, uri, 2); err != nil {
+		t.Fatalf("MirrorSource() error = %v", err)
+	}
+	if got, want := atomic.LoadInt32(&gets), int32(len(files)); got != want {
+		t.Errorf("MirrorSource() downloaded %d files, want %d", got, want)
+	}
+	for name, want := range files {
+		got, err := ioutil.ReadFile(filepath.Join(dst, filepath.FromSlash(strings.TrimPrefix(name, "/source/xnu/"))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(string(got), want); diff != "" {
+			t.Errorf("%s: (-got, +want)\n%s", name, diff)
+		}
+	}
+
+	// modifies the size of one file, only that file should be downloaded again
+	if err := os.WriteFile(filepath.Join(dst, "xnu-1", "README"), []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&gets, 0)
+
+	if err := MirrorSource(context.Background(), dst, uri, 2); err != nil {
+		t.Fatalf("MirrorSource() error = %v", err)
+	}
+	if got := atomic.LoadInt32(&gets); got != 1 {
+		t.Errorf("MirrorSource() downloaded %d files, want 1", got)
+	}
+}
@@ -0,0 +1,371 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"go.uber.org/multierr"
+)
+
+// SyncStateName is the file name of the sync state written by Sync to the extract directory of the Manifest.
+const SyncStateName = ".aos-sync.json"
+
+// SyncAction represents an action of Sync for the project.
+type SyncAction int
+
+const (
+	// SyncAdded is a project which is extracted newly.
+	SyncAdded SyncAction = iota + 1
+	// SyncUpdated is a project which is extracted again because the version, the directory, the digest or
+	// the patches are changed.
+	SyncUpdated
+	// SyncUnchanged is a project which is already extracted.
+	SyncUnchanged
+	// SyncRemoved is a project which is removed from the manifest, and its directory is removed.
+	SyncRemoved
+)
+
+// String implements a fmt.Stringer interface.
+func (a SyncAction) String() string {
+	switch a {
+	case SyncAdded:
+		return "added"
+	case SyncUpdated:
+		return "updated"
+	case SyncUnchanged:
+		return "unchanged"
+	case SyncRemoved:
+		return "removed"
+	default:
+		return strconv.FormatInt(int64(a), 10)
+	}
+}
+
+// MarshalText implements a encoding.TextMarshaler interface.
+func (a SyncAction) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// SyncedProject represents the result of Sync for the project.
+type SyncedProject struct {
+	Name    string     `json:"name" yaml:"name"`
+	Version string     `json:"version" yaml:"version"`
+	Dir     string     `json:"dir" yaml:"dir"` // the directory relative to the extract directory of the Manifest
+	SHA256  string     `json:"sha256,omitempty" yaml:"sha256,omitempty"`
+	Action  SyncAction `json:"action" yaml:"action"`
+}
+
+// SyncOptions represents an options of Sync.
+type SyncOptions struct {
+	// DryRun reports the actions without fetching, extracting and removing anything.
+	DryRun bool
+}
+
+// syncState represents the projects extracted by Sync, which is written to the SyncStateName file.
+type syncState struct {
+	Projects map[string]*syncEntry `json:"projects"`
+}
+
+// syncEntry represents the extracted project.
+type syncEntry struct {
+	Version string   `json:"version"`
+	Dir     string   `json:"dir"`
+	SHA256  string   `json:"sha256"`
+	Patches []string `json:"patches,omitempty"` // the digests of the applied patch files
+}
+
+// Sync fetches, verifies and extracts the projects of the manifest m, and applies their patches.
+//
+// Sync is idempotent: the projects which version, directory, digest and patches are not changed since the
+// last Sync are not extracted again, and the directories of the projects removed from m are removed. The
+// extracted projects are recorded in the SyncStateName file in the extract directory.
+func (c *Client) Sync(ctx context.Context, m *Manifest, opts *SyncOptions) ([]SyncedProject, error) {
+	if opts == nil {
+		opts = &SyncOptions{}
+	}
+
+	projects, err := c.resolveManifest(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+
+	root := m.root()
+	statePath := filepath.Join(root, SyncStateName)
+	state, err := readSyncState(statePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// the directories of the projects, which are not removed as the old directory of the other project
+	dirs := make([]string, len(projects))
+	used := make(map[string]bool, len(projects))
+	for i, p := range projects {
+		dir := p.dir()
+		if !isLocalPath(filepath.ToSlash(dir)) {
+			return nil, fmt.Errorf("%s: the dir is out of the manifest dir: %s", p.Name, dir)
+		}
+		if used[dir] {
+			return nil, fmt.Errorf("%s: the dir is also the dir of the other project: %s", p.Name, dir)
+		}
+		dirs[i] = dir
+		used[dir] = true
+	}
+
+	var results []SyncedProject
+	for i, p := range projects {
+		patches, err := m.patchDigests(p)
+		if err != nil {
+			return nil, err
+		}
+
+		dir := dirs[i]
+		r := SyncedProject{Name: p.Name, Version: p.Version, Dir: dir, Action: SyncAdded}
+		old := state.Projects[p.Name]
+		if old != nil {
+			r.SHA256 = old.SHA256
+			if old.unchanged(root, p, dir, patches) {
+				r.Action = SyncUnchanged
+				results = append(results, r)
+				continue
+			}
+			r.Action = SyncUpdated
+		}
+		if opts.DryRun {
+			results = append(results, r)
+			continue
+		}
+
+		c.log(LevelDebug, "sync project", "product", p.Name, "version", p.Version, "dir", dir)
+		digest, err := c.syncProject(ctx, m, p, filepath.Join(root, dir))
+		if err != nil {
+			return nil, fmt.Errorf("%s-%s: %w", p.Name, p.Version, err)
+		}
+		if old != nil && !used[old.Dir] {
+			if err := os.RemoveAll(filepath.Join(root, old.Dir)); err != nil {
+				return nil, err
+			}
+		}
+		r.SHA256 = digest
+		results = append(results, r)
+
+		state.Projects[p.Name] = &syncEntry{Version: p.Version, Dir: dir, SHA256: digest, Patches: patches}
+		if err := state.write(statePath); err != nil {
+			return nil, err
+		}
+	}
+
+	// removes the projects which are removed from the manifest
+	inManifest := make(map[string]bool, len(projects))
+	for _, p := range projects {
+		inManifest[p.Name] = true
+	}
+	var removed []string
+	for name := range state.Projects {
+		if !inManifest[name] {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+
+	for _, name := range removed {
+		e := state.Projects[name]
+		results = append(results, SyncedProject{Name: name, Version: e.Version, Dir: e.Dir, SHA256: e.SHA256, Action: SyncRemoved})
+		if opts.DryRun {
+			continue
+		}
+
+		c.log(LevelDebug, "remove project", "product", name, "version", e.Version, "dir", e.Dir)
+		if !used[e.Dir] {
+			if err := os.RemoveAll(filepath.Join(root, e.Dir)); err != nil {
+				return nil, err
+			}
+		}
+		delete(state.Projects, name)
+		if err := state.write(statePath); err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+// resolveManifest returns the projects of m which versions are resolved from the release of m.
+func (c *Client) resolveManifest(ctx context.Context, m *Manifest) ([]ManifestProject, error) {
+	projects := make([]ManifestProject, len(m.Projects))
+	copy(projects, m.Projects)
+
+	var release map[string]Product
+	for i, p := range projects {
+		if p.Version != "" {
+			continue
+		}
+
+		if release == nil {
+			platform, err := ParsePlatform(m.Release.Platform)
+			if err != nil {
+				return nil, err
+			}
+			list, err := NewCatalog(c, TarballsResource).Release(ctx, platform, m.Release.Version)
+			if err != nil {
+				return nil, err
+			}
+			release = make(map[string]Product, len(list))
+			for _, rp := range list {
+				release[rp.Name] = rp
+			}
+		}
+
+		rp, ok := release[p.Name]
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("no such project in the release %s %s: %s", m.Release.Platform, m.Release.Version, p.Name)
+		case rp.ComingSoon:
+			return nil, fmt.Errorf("the project of the release %s %s is coming soon: %s-%s", m.Release.Platform, m.Release.Version, p.Name, rp.Version)
+		}
+		projects[i].Version = rp.Version
+	}
+
+	return projects, nil
+}
+
+// patchDigests returns the digests of the patch files of the p project.
+func (m *Manifest) patchDigests(p ManifestProject) ([]string, error) {
+	var digests []string
+	for _, patch := range p.Patches {
+		digest, _, err := sumFile(filepath.Join(m.baseDir(), patch))
+		if err != nil {
+			return nil, err
+		}
+		digests = append(digests, digest)
+	}
+
+	return digests, nil
+}
+
+// syncProject extracts the p tarball to dir with applying the patches, and returns the digest of the
+// tarball. The tarball is extracted to the temporary directory next to dir first, so dir is not changed if
+// any step fails.
+func (c *Client) syncProject(ctx context.Context, m *Manifest, p ManifestProject, dir string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(dir), ".aos-sync.*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	tarball, err := c.tarballFile(ctx, Product{Name: p.Name, Version: p.Version}, tmp)
+	if err != nil {
+		return "", err
+	}
+
+	digest, _, err := sumFile(tarball)
+	if err != nil {
+		return "", err
+	}
+	if p.SHA256 != "" && p.SHA256 != digest {
+		return "", fmt.Errorf("sha256 mismatch: want %s, got %s", p.SHA256, digest)
+	}
+
+	src := filepath.Join(tmp, "src")
+	if err := extractArchive(tarball, src); err != nil {
+		return "", err
+	}
+	for _, fname := range p.Patches {
+		patch, err := readPatchFile(filepath.Join(m.baseDir(), fname))
+		if err != nil {
+			return "", err
+		}
+		results, err := patch.Apply(src, &ApplyOptions{Strip: 1, Fuzz: DefaultFuzz})
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", fname, err)
+		}
+		for _, r := range results {
+			if r.Offset != 0 || r.Fuzz != 0 {
+				c.log(LevelDebug, "hunk applied with offset", "patch", fname, "path", r.Path, "hunk", r.Hunk, "offset", r.Offset, "fuzz", r.Fuzz)
+			}
+		}
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return "", err
+	}
+	if err := os.Rename(src, dir); err != nil {
+		return "", err
+	}
+
+	return digest, nil
+}
+
+// unchanged reports whether the extracted project e is same as the p project extracted to dir.
+func (e *syncEntry) unchanged(root string, p ManifestProject, dir string, patches []string) bool {
+	if e.Version != p.Version || e.Dir != dir || (p.SHA256 != "" && e.SHA256 != p.SHA256) || len(e.Patches) != len(patches) {
+		return false
+	}
+	for i := range patches {
+		if e.Patches[i] != patches[i] {
+			return false
+		}
+	}
+
+	fi, err := os.Stat(filepath.Join(root, dir))
+	return err == nil && fi.IsDir()
+}
+
+// readSyncState reads the sync state from the fname file, or returns the empty state if it does not exist.
+func readSyncState(fname string) (*syncState, error) {
+	state := &syncState{}
+	buf, err := ioutil.ReadFile(fname)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		// nothing to do
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(buf, state); err != nil {
+			return nil, fmt.Errorf("%s: %w", fname, err)
+		}
+	}
+	if state.Projects == nil {
+		state.Projects = make(map[string]*syncEntry)
+	}
+	// the dirs are removed when the projects are updated or removed, so must be in the synced dir
+	for name, e := range state.Projects {
+		if e == nil || !isLocalPath(filepath.ToSlash(e.Dir)) {
+			return nil, fmt.Errorf("%s: the dir of %s is out of the synced dir", fname, name)
+		}
+		e.Dir = filepath.Clean(e.Dir)
+	}
+
+	return state, nil
+}
+
+// write writes the sync state to the fname file atomically.
+func (s *syncState) write(fname string) error {
+	buf, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := fname + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(buf, '\n'), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, fname); err != nil {
+		return multierr.Combine(err, os.Remove(tmp))
+	}
+
+	return nil
+}
@@ -0,0 +1,203 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource/aostest"
+)
+
+// readArchive returns the tarball of the files under the top directory.
+func readArchive(t *testing.T, top string, files map[string]string) []byte {
+	t.Helper()
+
+	fname := filepath.Join(t.TempDir(), top+".tar.gz")
+	writeArchive(t, fname, top, files)
+	buf, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf
+}
+
+func TestClient_Sync(t *testing.T) {
+	srv := aostest.NewServer(&aostest.Site{
+		Projects: []aostest.Project{
+			{
+				Name: "xnu",
+				Versions: []aostest.Version{
+					{Version: "4903.221.2", Tarball: readArchive(t, "xnu-4903.221.2", map[string]string{"README": "a\nb\nc\n"})},
+					{Version: "4903.231.4", Tarball: readArchive(t, "xnu-4903.231.4", map[string]string{"README": "a\nb\nc\nd\n"})},
+				},
+			},
+			{
+				Name:     "libplatform",
+				Versions: []aostest.Version{{Version: "177.200.16", Tarball: readArchive(t, "libplatform-177.200.16", map[string]string{"include/os/base.h": "base\n"})}},
+			},
+		},
+		Releases: []aostest.Release{
+			{
+				Name: "macos-10141",
+				Projects: []aostest.ReleaseProject{
+					{Name: "libplatform", Version: "177.200.16"},
+					{Name: "xnu", Version: "4903.221.2"},
+				},
+			},
+		},
+	})
+	defer srv.Close()
+
+	base := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(base, "xnu.patch"), []byte("--- a/README\n+++ b/README\n@@ -2,2 +2,2 @@\n b\n-c\n+C\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fname := filepath.Join(base, ManifestName)
+	writeManifest := func(s string) *Manifest {
+		t.Helper()
+		if err := ioutil.WriteFile(fname, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+		m, err := LoadManifest(fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	readFile := func(name string) string {
+		t.Helper()
+		buf, err := ioutil.ReadFile(filepath.Join(base, "src", filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(buf)
+	}
+	ignoreDigest := cmpopts.IgnoreFields(SyncedProject{}, "SHA256")
+
+	ctx := context.Background()
+	c := &Client{BaseURL: srv.BaseURL()}
+	m := writeManifest(`
+release:
+  platform: macos
+  version: 10.14.1
+dir: src
+projects:
+  - libplatform
+  - name: xnu
+    dir: xnu
+    patches: [xnu.patch]
+`)
+
+	dryRun, err := c.Sync(ctx, m, &SyncOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Sync() of the dry run error = %v", err)
+	}
+	want := []SyncedProject{
+		{Name: "libplatform", Version: "177.200.16", Dir: "libplatform-177.200.16", Action: SyncAdded},
+		{Name: "xnu", Version: "4903.221.2", Dir: "xnu", Action: SyncAdded},
+	}
+	if diff := cmp.Diff(want, dryRun); diff != "" {
+		t.Errorf("Sync() of the dry run mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := os.Stat(filepath.Join(base, "src")); err == nil {
+		t.Error("Sync() of the dry run extracted the projects")
+	}
+
+	got, err := c.Sync(ctx, m, nil)
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if diff := cmp.Diff(want, got, ignoreDigest); diff != "" {
+		t.Errorf("Sync() mismatch (-want +got):\n%s", diff)
+	}
+	if got := readFile("xnu/README"); got != "a\nb\nC\n" {
+		t.Errorf("patched README = %q", got)
+	}
+	if got := readFile("libplatform-177.200.16/include/os/base.h"); got != "base\n" {
+		t.Errorf("base.h = %q", got)
+	}
+
+	srv.ResetRequests()
+	got, err = c.Sync(ctx, m, nil)
+	if err != nil {
+		t.Fatalf("Sync() again error = %v", err)
+	}
+	for i := range want {
+		want[i].Action = SyncUnchanged
+	}
+	if diff := cmp.Diff(want, got, ignoreDigest); diff != "" {
+		t.Errorf("Sync() again mismatch (-want +got):\n%s", diff)
+	}
+	for _, r := range srv.Requests() {
+		if filepath.Ext(r.Path) == ".gz" {
+			t.Errorf("Sync() again fetched the tarball: %s", r.Path)
+		}
+	}
+
+	// pins the newer xnu without the patch, and removes libplatform
+	m = writeManifest(`
+dir: src
+projects:
+  - name: xnu
+    version: 4903.231.4
+    dir: xnu
+`)
+	got, err = c.Sync(ctx, m, nil)
+	if err != nil {
+		t.Fatalf("Sync() of the updated manifest error = %v", err)
+	}
+	want = []SyncedProject{
+		{Name: "xnu", Version: "4903.231.4", Dir: "xnu", Action: SyncUpdated},
+		{Name: "libplatform", Version: "177.200.16", Dir: "libplatform-177.200.16", Action: SyncRemoved},
+	}
+	if diff := cmp.Diff(want, got, ignoreDigest); diff != "" {
+		t.Errorf("Sync() of the updated manifest mismatch (-want +got):\n%s", diff)
+	}
+	if got := readFile("xnu/README"); got != "a\nb\nc\nd\n" {
+		t.Errorf("updated README = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(base, "src", "libplatform-177.200.16")); !os.IsNotExist(err) {
+		t.Errorf("Sync() did not remove the project: %v", err)
+	}
+
+	m = writeManifest("dir: src\nprojects:\n  - {name: xnu, version: 4903.221.2, dir: xnu, sha256: '0000'}\n")
+	if _, err := c.Sync(ctx, m, nil); err == nil {
+		t.Error("Sync() of the sha256 mismatch succeeded")
+	}
+	if got := readFile("xnu/README"); got != "a\nb\nc\nd\n" {
+		t.Errorf("README is changed by the failed sync: %q", got)
+	}
+
+	// the dir resolved from the release is the dir of the other project
+	m = writeManifest("release: {platform: macos, version: 10.14.1}\ndir: src\nprojects:\n  - libplatform\n  - {name: xnu, dir: libplatform-177.200.16}\n")
+	if _, err := c.Sync(ctx, m, nil); err == nil {
+		t.Error("Sync() of the duplicated dir succeeded")
+	}
+
+	// the dir of the state is removed on the update, which must not be out of the synced dir
+	outside := filepath.Join(base, "outside")
+	if err := os.Mkdir(outside, 0755); err != nil {
+		t.Fatal(err)
+	}
+	state := `{"projects": {"xnu": {"version": "4903.231.4", "dir": "../outside"}}}`
+	if err := ioutil.WriteFile(filepath.Join(base, "src", SyncStateName), []byte(state), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m = writeManifest("dir: src\nprojects:\n  - {name: xnu, version: 4903.221.2, dir: xnu}\n")
+	if _, err := c.Sync(ctx, m, nil); err == nil {
+		t.Error("Sync() of the state with the dir out of the synced dir succeeded")
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("Sync() removed the dir out of the synced dir: %v", err)
+	}
+}
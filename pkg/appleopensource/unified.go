@@ -0,0 +1,291 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// opKind represents a kind of the line edit operation.
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+// lineOp represents a line edit operation.
+//
+// a and b are the line index of the old and new lines. For opInsert a is the position of the old lines
+// where the line is inserted, for opDelete b is the position of the new lines where the line is deleted.
+type lineOp struct {
+	kind opKind
+	a, b int
+}
+
+// splitLines splits buf into the lines, each line keeps the trailing newline.
+func splitLines(buf []byte) []string {
+	if len(buf) == 0 {
+		return nil
+	}
+
+	lines := strings.SplitAfter(string(buf), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// countLines returns the number of lines of buf.
+func countLines(buf []byte) int {
+	n := bytes.Count(buf, []byte{'\n'})
+	if len(buf) > 0 && buf[len(buf)-1] != '\n' {
+		n++
+	}
+
+	return n
+}
+
+// diffLines computes the shortest edit script from a to b by the Myers' O(ND) algorithm.
+func diffLines(a, b []string) []lineOp {
+	// trims the common prefix and suffix, they are usually most of the lines
+	var prefix int
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	var suffix int
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]lineOp, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, lineOp{kind: opEqual, a: i, b: i})
+	}
+	for _, op := range myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		op.a += prefix
+		op.b += prefix
+		ops = append(ops, op)
+	}
+	for i := 0; i < suffix; i++ {
+		ops = append(ops, lineOp{kind: opEqual, a: len(a) - suffix + i, b: len(b) - suffix + i})
+	}
+
+	return ops
+}
+
+// maxEditCost is the maximum number of the edits searched by myers. The trace of the search takes
+// O(D^2) memory for the D edits, so that the larger difference is replaced entirely instead.
+var maxEditCost = 1000
+
+// myers implements the Myers' O(ND) difference algorithm.
+//
+// If the edit script is longer than maxEditCost, it returns the script which deletes all lines of a and
+// inserts all lines of b, which is not the shortest but valid.
+func myers(a, b []string) []lineOp {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+	if max > maxEditCost {
+		max = maxEditCost
+	}
+
+	off := max + 1
+	v := make([]int, 2*max+3)
+	// trace[d] holds the v[-d-1:d+2] before the d step
+	var trace [][]int
+
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[off-d-1:off+d+2]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1] // down, insertion
+			} else {
+				x = v[off+k-1] + 1 // right, deletion
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(trace, n, m)
+			}
+		}
+	}
+
+	return replaceLines(n, m)
+}
+
+// replaceLines returns the edit script which deletes all n lines and inserts all m lines.
+func replaceLines(n, m int) []lineOp {
+	ops := make([]lineOp, 0, n+m)
+	for i := 0; i < n; i++ {
+		ops = append(ops, lineOp{kind: opDelete, a: i, b: 0})
+	}
+	for j := 0; j < m; j++ {
+		ops = append(ops, lineOp{kind: opInsert, a: n, b: j})
+	}
+
+	return ops
+}
+
+// backtrack walks the trace of myers back from (n, m), and return the edit script.
+func backtrack(trace [][]int, n, m int) []lineOp {
+	var ops []lineOp
+	x, y := n, m
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		at := func(k int) int { return v[k+d+1] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, lineOp{kind: opEqual, a: x, b: y})
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, lineOp{kind: opInsert, a: x, b: y - 1})
+			} else {
+				ops = append(ops, lineOp{kind: opDelete, a: x - 1, b: y})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+
+	return ops
+}
+
+// countChanges returns the number of the inserted and deleted lines of ops.
+func countChanges(ops []lineOp) (added, removed int) {
+	for _, op := range ops {
+		switch op.kind {
+		case opInsert:
+			added++
+		case opDelete:
+			removed++
+		}
+	}
+
+	return added, removed
+}
+
+// unified formats the ops as the unified diff hunks with the context lines.
+func unified(w *bytes.Buffer, a, b []string, ops []lineOp, context int) {
+	if context < 0 {
+		context = 0
+	}
+
+	for i := 0; i < len(ops); {
+		// seeks to the next change
+		for i < len(ops) && ops[i].kind == opEqual {
+			i++
+		}
+		if i == len(ops) {
+			return
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+
+		// extends the hunk while the next change is within the 2*context lines
+		end := i
+		for end < len(ops) {
+			for end < len(ops) && ops[end].kind != opEqual {
+				end++
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == opEqual {
+				next++
+			}
+			if next == len(ops) || next-end > 2*context {
+				end += context
+				if end > len(ops) {
+					end = len(ops)
+				}
+				break
+			}
+			end = next
+		}
+
+		writeHunk(w, a, b, ops[start:end])
+		i = end
+	}
+}
+
+// writeHunk writes the ops as a unified diff hunk.
+func writeHunk(w *bytes.Buffer, a, b []string, ops []lineOp) {
+	var aLen, bLen int
+	for _, op := range ops {
+		if op.kind != opInsert {
+			aLen++
+		}
+		if op.kind != opDelete {
+			bLen++
+		}
+	}
+
+	fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(ops[0].a, aLen), hunkRange(ops[0].b, bLen))
+	for _, op := range ops {
+		switch op.kind {
+		case opEqual:
+			writeLine(w, ' ', a[op.a])
+		case opDelete:
+			writeLine(w, '-', a[op.a])
+		case opInsert:
+			writeLine(w, '+', b[op.b])
+		}
+	}
+}
+
+// hunkRange formats the zero based start line and the length as the unified diff range.
+//
+// The empty range is denoted by the line just before it, same as the diff(1).
+func hunkRange(start, length int) string {
+	switch length {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, length)
+	}
+}
+
+// writeLine writes the line with the prefix, and marks the missing newline at end of file.
+func writeLine(w *bytes.Buffer, prefix byte, line string) {
+	w.WriteByte(prefix)
+	w.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		w.WriteString("\n\\ No newline at end of file\n")
+	}
+}
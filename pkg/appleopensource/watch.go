@@ -0,0 +1,309 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+)
+
+// WatchEventType represents a type of WatchEvent.
+type WatchEventType int
+
+const (
+	// EventNewVersion is a version of the project which is added to the version list.
+	EventNewVersion WatchEventType = iota + 1
+	// EventNewRelease is a release of the platform whose release page is published.
+	EventNewRelease
+	// EventAvailable is a project of the release which was coming soon and became available.
+	EventAvailable
+)
+
+// String implements a fmt.Stringer interface.
+func (t WatchEventType) String() string {
+	switch t {
+	case EventNewVersion:
+		return "new_version"
+	case EventNewRelease:
+		return "new_release"
+	case EventAvailable:
+		return "available"
+	default:
+		return strconv.FormatInt(int64(t), 10)
+	}
+}
+
+// MarshalText implements a encoding.TextMarshaler interface.
+func (t WatchEventType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText implements a encoding.TextUnmarshaler interface, so that the receivers of the events decode them.
+func (t *WatchEventType) UnmarshalText(text []byte) error {
+	for _, typ := range []WatchEventType{EventNewVersion, EventNewRelease, EventAvailable} {
+		if typ.String() == string(text) {
+			*t = typ
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown watch event type: %q", text)
+}
+
+// WatchEvent represents a change of the site found by CheckUpdates.
+type WatchEvent struct {
+	Type     WatchEventType `json:"type" yaml:"type"`
+	Project  string         `json:"project,omitempty" yaml:"project,omitempty"`
+	Version  string         `json:"version,omitempty" yaml:"version,omitempty"`   // the project version
+	Platform string         `json:"platform,omitempty" yaml:"platform,omitempty"` // for the release events only
+	Release  string         `json:"release,omitempty" yaml:"release,omitempty"`   // for the release events only
+	Time     time.Time      `json:"time" yaml:"time"`
+}
+
+// WatchOptions represents an options of CheckUpdates.
+type WatchOptions struct {
+	// Projects is the projects whose versions are watched. All projects in the project index are watched if empty.
+	// The available events are also reported only for them.
+	Projects []string
+
+	// Platforms is the platforms whose releases are watched. All platforms are watched if empty.
+	Platforms []Platform
+}
+
+// WatchState represents the versions and the releases seen by CheckUpdates, which is persisted between
+// the checks by ReadWatchState and Write.
+type WatchState struct {
+	// Projects is the versions of the watched projects keyed by the project name.
+	Projects map[string][]string `json:"projects"`
+
+	// Platforms is the watched platforms such as "macos".
+	Platforms map[string]bool `json:"platforms"`
+
+	// Releases is the published releases keyed by "<platform>/<version>" such as "macos/10.14.1".
+	Releases map[string]*WatchedRelease `json:"releases"`
+}
+
+// WatchedRelease represents a published release in WatchState.
+type WatchedRelease struct {
+	// ComingSoon is the projects of the release which are not available yet.
+	ComingSoon []string `json:"coming_soon,omitempty"`
+}
+
+// ReadWatchState reads the WatchState from the fname file. The empty WatchState is returned if fname does not exist.
+func ReadWatchState(fname string) (*WatchState, error) {
+	state := &WatchState{}
+	buf, err := ioutil.ReadFile(fname)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		// nothing to do
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(buf, state); err != nil {
+			return nil, fmt.Errorf("%s: %w", fname, err)
+		}
+	}
+	state.init()
+
+	return state, nil
+}
+
+// init allocates the nil maps of s.
+func (s *WatchState) init() {
+	if s.Projects == nil {
+		s.Projects = make(map[string][]string)
+	}
+	if s.Platforms == nil {
+		s.Platforms = make(map[string]bool)
+	}
+	if s.Releases == nil {
+		s.Releases = make(map[string]*WatchedRelease)
+	}
+}
+
+// Write writes the WatchState to the fname file atomically.
+func (s *WatchState) Write(fname string) error {
+	buf, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(fname, bytes.NewReader(append(buf, '\n')))
+}
+
+// CheckUpdates revalidates the version lists of the projects and the release pages of the platforms regardless
+// of CacheTTL, compares them with state, and returns the events of the changes. The state is updated in place,
+// so write it after the events are delivered.
+//
+// The projects and the platforms which are not in state yet are recorded as the baseline without the events.
+// The releases are the KnownRelease versions and the releases listed on the top page of the site, which are
+// reported when their release pages are published. The published releases are fetched again only while they
+// have the coming soon projects.
+func (c *Client) CheckUpdates(ctx context.Context, state *WatchState, opts *WatchOptions) ([]WatchEvent, error) {
+	if opts == nil {
+		opts = &WatchOptions{}
+	}
+	state.init()
+
+	rc := *c
+	rc.CacheTTL = -1 // always revalidates the cached pages
+	catalog := NewCatalog(&rc, TarballsResource)
+	now := time.Now().UTC()
+	events := []WatchEvent{}
+
+	projects := opts.Projects
+	if len(projects) == 0 {
+		var err error
+		if projects, err = catalog.Projects(ctx); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range projects {
+		versions, err := catalog.Versions(ctx, name)
+		if err != nil {
+			if len(opts.Projects) == 0 && errors.Is(err, ErrNotFound) {
+				continue // the project in the index which has no version list
+			}
+			return nil, err
+		}
+
+		if known, ok := state.Projects[name]; ok {
+			seen := make(map[string]bool, len(known))
+			for _, v := range known {
+				seen[v] = true
+			}
+			for _, v := range versions {
+				if !seen[v] {
+					events = append(events, WatchEvent{Type: EventNewVersion, Project: name, Version: v, Time: now})
+				}
+			}
+		}
+		state.Projects[name] = versions
+	}
+
+	watched := make(map[string]bool, len(opts.Projects))
+	for _, name := range opts.Projects {
+		watched[name] = true
+	}
+	releases, err := rc.watchedReleases(ctx, opts.Platforms)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range releases {
+		platform := r.Platform.String()
+		key := platform + "/" + r.Version
+		known, found := state.Releases[key]
+		if found && len(known.ComingSoon) == 0 {
+			continue // the complete release is not changed anymore
+		}
+
+		list, err := catalog.Release(ctx, r.Platform, r.Version)
+		if errors.Is(err, ErrNotFound) {
+			continue // not published yet
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if !found && state.Platforms[platform] {
+			events = append(events, WatchEvent{Type: EventNewRelease, Platform: platform, Release: r.Version, Time: now})
+		}
+		rel := &WatchedRelease{}
+		for _, p := range list {
+			if p.ComingSoon {
+				rel.ComingSoon = append(rel.ComingSoon, p.Name)
+			}
+		}
+		if found {
+			events = append(events, availableEvents(known, rel, list, r, watched, now)...)
+		}
+		state.Releases[key] = rel
+	}
+
+	platforms := opts.Platforms
+	if len(platforms) == 0 {
+		platforms = []Platform{MacOS, Xcode, IOS, Server}
+	}
+	for _, p := range platforms {
+		state.Platforms[p.String()] = true
+	}
+
+	return events, nil
+}
+
+// watchedReleases returns the KnownReleases of the platforms followed by the releases which are listed on
+// the top page of the site but not known. Only KnownReleases are returned if the top page is not available.
+func (c *Client) watchedReleases(ctx context.Context, platforms []Platform) ([]ReleaseVersion, error) {
+	releases := KnownReleases(platforms...)
+
+	buf, err := c.IndexReleases(ctx)
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrNotFound), isNotCached(err):
+		c.log(LevelDebug, "no release list", "err", err)
+		return releases, nil
+	default:
+		return nil, err
+	}
+	listed, err := ListReleases(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	watched := make(map[Platform]bool, len(platforms))
+	for _, p := range platforms {
+		watched[p] = true
+	}
+	seen := make(map[ReleaseVersion]bool, len(releases))
+	for _, r := range releases {
+		seen[r] = true
+	}
+	for _, r := range listed {
+		if !seen[r] && (len(platforms) == 0 || watched[r.Platform]) {
+			seen[r] = true
+			releases = append(releases, r)
+		}
+	}
+
+	return releases, nil
+}
+
+// availableEvents returns the events of the projects which were coming soon in old and are not in rel.
+// The events are only for the watched projects unless watched is empty.
+func availableEvents(old, rel *WatchedRelease, list []Product, r ReleaseVersion, watched map[string]bool, now time.Time) []WatchEvent {
+	comingSoon := make(map[string]bool, len(rel.ComingSoon))
+	for _, name := range rel.ComingSoon {
+		comingSoon[name] = true
+	}
+	versions := make(map[string]string, len(list))
+	for _, p := range list {
+		versions[p.Name] = p.Version
+	}
+
+	var events []WatchEvent
+	for _, name := range old.ComingSoon {
+		v, ok := versions[name]
+		if !ok || comingSoon[name] || (len(watched) > 0 && !watched[name]) {
+			continue
+		}
+		events = append(events, WatchEvent{
+			Type:     EventAvailable,
+			Project:  name,
+			Version:  v,
+			Platform: r.Platform.String(),
+			Release:  r.Version,
+			Time:     now,
+		})
+	}
+
+	return events
+}
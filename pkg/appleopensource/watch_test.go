@@ -0,0 +1,114 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource/aostest"
+)
+
+func TestClient_CheckUpdates(t *testing.T) {
+	srv := aostest.NewServer(&aostest.Site{
+		Projects: []aostest.Project{
+			{Name: "Libc", Versions: []aostest.Version{{Version: "1244.1.7"}}},
+			{Name: "xnu", Versions: []aostest.Version{{Version: "3789.1.32"}}},
+		},
+		Releases: []aostest.Release{
+			{Name: "macos-10121", Projects: []aostest.ReleaseProject{
+				{Name: "Libc", Version: "1158.20.4", ComingSoon: true},
+				{Name: "xnu", Version: "3789.21.4", ComingSoon: true},
+			}},
+		},
+	})
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := &Client{Cache: NewFileCache(t.TempDir()), BaseURL: srv.BaseURL()}
+	fname := filepath.Join(t.TempDir(), "watch.json")
+	opts := &WatchOptions{Projects: []string{"xnu"}, Platforms: []Platform{MacOS}}
+	ignore := cmpopts.IgnoreFields(WatchEvent{}, "Time")
+
+	check := func(name string, want []WatchEvent) {
+		t.Helper()
+
+		state, err := ReadWatchState(fname)
+		if err != nil {
+			t.Fatalf("%s: ReadWatchState() error = %v", name, err)
+		}
+		events, err := c.CheckUpdates(ctx, state, opts)
+		if err != nil {
+			t.Fatalf("%s: CheckUpdates() error = %v", name, err)
+		}
+		if diff := cmp.Diff(want, events, ignore); diff != "" {
+			t.Errorf("%s: CheckUpdates() mismatch (-want +got):\n%s", name, diff)
+		}
+		if err := state.Write(fname); err != nil {
+			t.Fatalf("%s: Write() error = %v", name, err)
+		}
+	}
+
+	// the first check records the baseline
+	check("baseline", []WatchEvent{})
+
+	srv.Update(func(site *aostest.Site) {
+		site.Projects[0].Versions = append(site.Projects[0].Versions, aostest.Version{Version: "1244.30.3"})
+		site.Projects[1].Versions = append(site.Projects[1].Versions, aostest.Version{Version: "3789.21.4"})
+		site.Releases[0].Projects = []aostest.ReleaseProject{
+			{Name: "Libc", Version: "1158.20.4"},
+			{Name: "xnu", Version: "3789.21.4"},
+		}
+		site.Releases = append(site.Releases,
+			aostest.Release{Name: "macos-10122", Projects: []aostest.ReleaseProject{
+				{Name: "xnu", Version: "3789.31.2", ComingSoon: true},
+			}},
+			// the release which is not known is found from the release list of the top page
+			aostest.Release{Name: "macos-1161", Title: "macOS 11.6.1", Projects: []aostest.ReleaseProject{
+				{Name: "xnu", Version: "7195.141.8"},
+			}},
+			aostest.Release{Name: "ios-151", Title: "iOS 15.1", Projects: []aostest.ReleaseProject{
+				{Name: "xnu", Version: "8019.41.5"},
+			}},
+		)
+	})
+	// the cached pages are revalidated regardless of CacheTTL, and only the watched projects and platforms
+	// are reported
+	check("updated", []WatchEvent{
+		{Type: EventNewVersion, Project: "xnu", Version: "3789.21.4"},
+		{Type: EventNewRelease, Platform: "macos", Release: "10.12.2"},
+		{Type: EventAvailable, Project: "xnu", Version: "3789.21.4", Platform: "macos", Release: "10.12.1"},
+		{Type: EventNewRelease, Platform: "macos", Release: "11.6.1"},
+	})
+
+	// the complete releases are not fetched again
+	srv.ResetRequests()
+	check("unchanged", []WatchEvent{})
+	for _, r := range srv.Requests() {
+		if r.Path == "/release/macos-10121.html" {
+			t.Errorf("the complete release is requested: %s", r.Path)
+		}
+	}
+
+	// the known releases are still watched without the release list
+	srv.AddFault(aostest.Fault{Path: "/", Status: http.StatusNotFound})
+	check("no release list", []WatchEvent{})
+	srv.ClearFaults()
+
+	// the project which is not found is an error
+	opts.Projects = []string{"nonexistent"}
+	state, err := ReadWatchState(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CheckUpdates(ctx, state, opts); err == nil {
+		t.Error("CheckUpdates() of the nonexistent project error = nil, want error")
+	}
+}
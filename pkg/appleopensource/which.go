@@ -0,0 +1,226 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+)
+
+// ReleaseVersion represents a release version of the platform.
+type ReleaseVersion struct {
+	Platform Platform
+	Version  string
+}
+
+// KnownReleases returns the KnownRelease versions of the platforms, or of all platforms if no platform is given.
+func KnownReleases(platforms ...Platform) []ReleaseVersion {
+	if len(platforms) == 0 {
+		platforms = []Platform{MacOS, Xcode, IOS, Server}
+	}
+
+	var releases []ReleaseVersion
+	for _, platform := range platforms {
+		if int(platform) >= len(KnownRelease) {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, v := range KnownRelease[platform] {
+			if seen[v] {
+				continue
+			}
+			seen[v] = true
+			releases = append(releases, ReleaseVersion{Platform: platform, Version: v})
+		}
+	}
+
+	return releases
+}
+
+// ReleaseEntry represents the project version shipped in the platform release.
+type ReleaseEntry struct {
+	Platform Platform `json:"platform" yaml:"platform"`
+	Release  string   `json:"release" yaml:"release"`
+	Product  Product  `json:"product" yaml:"product"`
+}
+
+// ReleaseIndex is the reverse index from the project versions to the releases which ship them.
+type ReleaseIndex struct {
+	releases []ReleaseVersion
+	projects map[string][]ReleaseEntry
+}
+
+// NewReleaseIndex returns the empty ReleaseIndex.
+func NewReleaseIndex() *ReleaseIndex {
+	return &ReleaseIndex{projects: make(map[string][]ReleaseEntry)}
+}
+
+// Add adds the projects of the platform release such as the ListRelease returns.
+func (x *ReleaseIndex) Add(platform Platform, release string, list []Product) {
+	x.releases = append(x.releases, ReleaseVersion{Platform: platform, Version: release})
+	for _, p := range list {
+		if p.Name == "" {
+			continue
+		}
+		x.projects[p.Name] = append(x.projects[p.Name], ReleaseEntry{Platform: platform, Release: release, Product: p})
+	}
+}
+
+// Projects returns the names of the projects shipped in any release, sorted by the name.
+func (x *ReleaseIndex) Projects() []string {
+	names := make([]string, 0, len(x.projects))
+	for name := range x.projects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Versions returns the versions of the project shipped in any release, sorted from the oldest.
+func (x *ReleaseIndex) Versions(project string) []string {
+	seen := make(map[string]bool)
+	var versions []string
+	for _, e := range x.projects[project] {
+		if !seen[e.Product.Version] {
+			seen[e.Product.Version] = true
+			versions = append(versions, e.Product.Version)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return compareVersions(versions[i], versions[j]) < 0 })
+
+	return versions
+}
+
+// Entries returns the releases which ship the project in the order of Add.
+func (x *ReleaseIndex) Entries(project string) []ReleaseEntry {
+	return x.projects[project]
+}
+
+// Releases returns the releases which ship the exact version of the project in the order of Add.
+func (x *ReleaseIndex) Releases(project, version string) []ReleaseEntry {
+	var entries []ReleaseEntry
+	for _, e := range x.projects[project] {
+		if e.Product.Version == version {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries
+}
+
+// Which returns the releases which ship the exact version of the project, and reports whether the version
+// is found. If no release ships the version, Which returns the releases of the nearest older and newer
+// versions instead.
+func (x *ReleaseIndex) Which(project, version string) ([]ReleaseEntry, bool) {
+	if entries := x.Releases(project, version); len(entries) > 0 {
+		return entries, true
+	}
+
+	var older, newer string
+	for _, v := range x.Versions(project) {
+		if compareVersions(v, version) < 0 {
+			older = v
+			continue
+		}
+		newer = v
+		break
+	}
+
+	var entries []ReleaseEntry
+	if older != "" {
+		entries = append(entries, x.Releases(project, older)...)
+	}
+	if newer != "" {
+		entries = append(entries, x.Releases(project, newer)...)
+	}
+
+	return entries, false
+}
+
+// BuildReleaseIndex fetches the projects of the releases concurrently, and returns the ReleaseIndex of them.
+//
+// The releases which are not found, or not cached in the offline mode, are skipped.
+func (c *Client) BuildReleaseIndex(ctx context.Context, releases []ReleaseVersion) (*ReleaseIndex, error) {
+	lists := make([][]Product, len(releases))
+
+	sem := semaphore.NewWeighted(int64(c.concurrency()))
+	eg, ctx := errgroup.WithContext(ctx)
+	for i, r := range releases {
+		i, r := i, r
+		eg.Go(func() error {
+			if err := sem.Acquire(ctx, 1); err != nil {
+				return err
+			}
+			defer sem.Release(1)
+
+			buf, err := c.IndexRelease(ctx, r.Platform, r.Version)
+			switch {
+			case err == nil:
+			case errors.Is(err, ErrNotFound), isNotCached(err):
+				c.log(LevelDebug, "skip release", "platform", r.Platform, "release", r.Version, "err", err)
+				return nil
+			default:
+				return err
+			}
+
+			lists[i], err = ListRelease(buf)
+			return err
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	x := NewReleaseIndex()
+	for i, r := range releases {
+		if lists[i] == nil {
+			continue // skipped
+		}
+		x.Add(r.Platform, r.Version, lists[i])
+	}
+
+	return x, nil
+}
+
+// compareVersions compares the dot separated versions such as "4903.221.2" by the numeric value of each
+// component, and returns -1, 0 or +1. The non-numeric components are compared lexically.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		x, y := "0", "0"
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+
+		xn, xerr := strconv.Atoi(x)
+		yn, yerr := strconv.Atoi(y)
+		switch {
+		case xerr == nil && yerr == nil:
+			if xn != yn {
+				if xn < yn {
+					return -1
+				}
+				return 1
+			}
+		case x != y:
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,164 @@
+// Copyright 2021 The appleopensource Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appleopensource
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go-darwin.dev/appleopensource/pkg/appleopensource/aostest"
+)
+
+func TestReleaseIndex_Which(t *testing.T) {
+	macOS, err := ListRelease(releaseIndexMacOS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xcode, err := ListRelease(releaseIndexXcode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x := NewReleaseIndex()
+	x.Add(MacOS, "10.12", macOS)
+	x.Add(Xcode, "7.3.1", xcode)
+	x.Add(MacOS, "10.12.1", []Product{{Name: "xnu", Version: "3789.21.4"}})
+	x.Add(MacOS, "10.13", []Product{{Name: "xnu", Version: "4570.1.46"}})
+
+	tests := []struct {
+		name      string
+		project   string
+		version   string
+		want      []ReleaseEntry
+		wantExact bool
+	}{
+		{
+			name:    "exact",
+			project: "xnu",
+			version: "3789.1.32",
+			want: []ReleaseEntry{
+				{Platform: MacOS, Release: "10.12", Product: Product{Name: "xnu", Version: "3789.1.32"}},
+			},
+			wantExact: true,
+		},
+		{
+			name:    "updated",
+			project: "ld64",
+			version: "264.3.102",
+			want: []ReleaseEntry{
+				{Platform: Xcode, Release: "7.3.1", Product: Product{Name: "ld64", Version: "264.3.102", Updated: true}},
+			},
+			wantExact: true,
+		},
+		{
+			name:    "nearest",
+			project: "xnu",
+			version: "3789.31.2",
+			want: []ReleaseEntry{
+				{Platform: MacOS, Release: "10.12.1", Product: Product{Name: "xnu", Version: "3789.21.4"}},
+				{Platform: MacOS, Release: "10.13", Product: Product{Name: "xnu", Version: "4570.1.46"}},
+			},
+		},
+		{
+			name:    "newer than all",
+			project: "xnu",
+			version: "4903.221.2",
+			want: []ReleaseEntry{
+				{Platform: MacOS, Release: "10.13", Product: Product{Name: "xnu", Version: "4570.1.46"}},
+			},
+		},
+		{
+			name:    "unknown project",
+			project: "launchd",
+			version: "1",
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, exact := x.Which(tt.project, tt.version)
+			if exact != tt.wantExact {
+				t.Errorf("Which(%q, %q) exact = %v, want %v", tt.project, tt.version, exact, tt.wantExact)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Which(%q, %q) mismatch (-want +got):\n%s", tt.project, tt.version, diff)
+			}
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"4903.221.2", "4903.221.2", 0},
+		{"3789.1.32", "4903.221.2", -1},
+		{"4903.221.2", "4903.41.1", 1},
+		{"85", "85.0", 0},
+		{"85", "85.1", -1},
+		{"1.2b", "1.2a", 1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestClient_BuildReleaseIndex(t *testing.T) {
+	srv := aostest.NewServer(&aostest.Site{
+		Releases: []aostest.Release{
+			{Name: "macos-1014", Projects: []aostest.ReleaseProject{{Name: "xnu", Version: "4903.221.2"}}},
+			{Name: "macos-10141", Projects: []aostest.ReleaseProject{{Name: "xnu", Version: "4903.221.2"}}},
+			{Name: "ios-12", Projects: []aostest.ReleaseProject{{Name: "xnu", Version: "4903.222.5"}}},
+		},
+	})
+	defer srv.Close()
+
+	c := &Client{BaseURL: srv.BaseURL()}
+	x, err := c.BuildReleaseIndex(context.Background(), []ReleaseVersion{
+		{Platform: MacOS, Version: "10.14"},
+		{Platform: MacOS, Version: "10.14.1"},
+		{Platform: MacOS, Version: "10.14.2"}, // not found
+		{Platform: IOS, Version: "12"},
+	})
+	if err != nil {
+		t.Fatalf("BuildReleaseIndex() error = %v", err)
+	}
+
+	got, exact := x.Which("xnu", "4903.221.2")
+	want := []ReleaseEntry{
+		{Platform: MacOS, Release: "10.14", Product: Product{Name: "xnu", Version: "4903.221.2"}},
+		{Platform: MacOS, Release: "10.14.1", Product: Product{Name: "xnu", Version: "4903.221.2"}},
+	}
+	if !exact {
+		t.Error("Which() exact = false, want true")
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Which() mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"4903.221.2", "4903.222.5"}, x.Versions("xnu")); diff != "" {
+		t.Errorf("Versions() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestKnownReleases(t *testing.T) {
+	got := KnownReleases(Server)
+	want := []ReleaseVersion{{Platform: Server, Version: "3.0.2"}, {Platform: Server, Version: "2.2.2"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("KnownReleases() mismatch (-want +got):\n%s", diff)
+	}
+
+	seen := make(map[ReleaseVersion]bool)
+	for _, r := range KnownReleases() {
+		if seen[r] {
+			t.Errorf("KnownReleases() has the duplicated %v", r)
+		}
+		seen[r] = true
+	}
+}